@@ -0,0 +1,98 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/common/log"
+)
+
+// loopbackAddress returns the address with the loopback interface as host if
+// it has none, so that the admin endpoints are only exposed beyond the host
+// on purpose.
+func loopbackAddress(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<html>
+	<head><title>{{.Title}}</title></head>
+	<body>
+	<h1>{{.Title}}</h1>
+	{{range .Links}}<p><a href="{{.Path}}">{{.Title}}</a></p>
+	{{end}}</body>
+	</html>`))
+
+type indexLink struct {
+	Path, Title string
+}
+
+// serveMux links the pages registered with it on an index page at "/", so
+// that the index of each listener only lists what that listener serves.
+type serveMux struct {
+	*http.ServeMux
+	title string
+
+	mtx   sync.Mutex
+	links []indexLink
+}
+
+func newServeMux(mux *http.ServeMux, title string) *serveMux {
+	m := &serveMux{ServeMux: mux, title: title}
+	mux.HandleFunc("/", m.serveIndex)
+	return m
+}
+
+// handlePage registers handler for path and links it on the index page.
+func (m *serveMux) handlePage(path, title string, handler http.Handler) {
+	m.Handle(path, handler)
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.links = append(m.links, indexLink{Path: path, Title: title})
+}
+
+func (m *serveMux) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	m.mtx.Lock()
+	links := append([]indexLink(nil), m.links...)
+	m.mtx.Unlock()
+	indexTemplate.Execute(w, struct {
+		Title string
+		Links []indexLink
+	}{m.title, links})
+}
+
+// serveAdmin serves the control and debugging endpoints registered with mux
+// on a listener of their own.
+func serveAdmin(l net.Listener, mux *serveMux) {
+	log.Infoln("Serving admin endpoints on", l.Addr())
+	log.Fatal(http.Serve(l, mux))
+}
+
+func serveHealthy(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Healthy.\n"))
+}
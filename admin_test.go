@@ -0,0 +1,81 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoopbackAddress(t *testing.T) {
+	for addr, expected := range map[string]string{
+		":9103":          "localhost:9103",
+		"0.0.0.0:9103":   "0.0.0.0:9103",
+		"10.0.0.1:9103":  "10.0.0.1:9103",
+		"[::1]:9103":     "[::1]:9103",
+		"localhost:9103": "localhost:9103",
+	} {
+		got, err := loopbackAddress(addr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", addr, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("%s: expected %s, got %s", addr, expected, got)
+		}
+	}
+	if _, err := loopbackAddress("9103"); err == nil {
+		t.Errorf("Expected an address without port to be rejected")
+	}
+}
+
+func TestServeMuxIndex(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	public := newServeMux(http.NewServeMux(), "StatsD Exporter")
+	public.handlePage("/metrics", "Metrics", ok)
+	admin := newServeMux(http.NewServeMux(), "StatsD Exporter Admin")
+	admin.handlePage("/config", "Configuration", ok)
+	admin.handlePage("/debug/fsm", "Mapping FSM", ok)
+
+	for _, tc := range []struct {
+		mux       *serveMux
+		want, not []string
+	}{
+		{public, []string{`href="/metrics"`}, []string{"/config", "/debug/"}},
+		{admin, []string{`href="/config"`, `href="/debug/fsm"`}, []string{"/metrics"}},
+	} {
+		w := httptest.NewRecorder()
+		tc.mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		body := w.Body.String()
+		for _, want := range tc.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: expected index to contain %s, got %s", tc.mux.title, want, body)
+			}
+		}
+		for _, not := range tc.not {
+			if strings.Contains(body, not) {
+				t.Errorf("%s: expected index not to link %s, got %s", tc.mux.title, not, body)
+			}
+		}
+		for _, path := range tc.not {
+			w := httptest.NewRecorder()
+			tc.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			if w.Code != http.StatusNotFound {
+				t.Errorf("%s: expected %s to be not found, got status %d", tc.mux.title, path, w.Code)
+			}
+		}
+	}
+}
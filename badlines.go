@@ -0,0 +1,56 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+// badLineRecorders passes lines that could not be parsed to several
+// recorders.
+type badLineRecorders []line.BadLineRecorder
+
+func (r badLineRecorders) RecordBadLine(listener, l, reason string) {
+	for _, recorder := range r {
+		recorder.RecordBadLine(listener, l, reason)
+	}
+}
+
+// openDeadLetter opens the dead letter output: a UDP connection for targets
+// of the form udp://host:port, or else a file that lines are appended to.
+func openDeadLetter(target string) (io.Writer, error) {
+	if strings.HasPrefix(target, "udp://") {
+		return net.Dial("udp", strings.TrimPrefix(target, "udp://"))
+	}
+	return os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+// serveBadLines lists the most recent lines that could not be parsed, oldest
+// first, with the time, listener and reason they were recorded with.
+func serveBadLines(b *line.BadLines) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, bl := range b.Lines() {
+			fmt.Fprintf(w, "%s %s %s %q\n", bl.Time.UTC().Format(time.RFC3339), bl.Listener, bl.Reason, bl.Line)
+		}
+	}
+}
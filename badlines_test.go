@@ -0,0 +1,90 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/statsd_exporter/pkg/clock"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+func TestServeBadLines(t *testing.T) {
+	clock.ClockInstance = &clock.Clock{Instant: time.Unix(0, 0)}
+	defer func() { clock.ClockInstance = nil }()
+
+	b := line.NewBadLines(10, 0)
+	b.RecordBadLine("udp", "foo", "malformed_line")
+	b.RecordBadLine("tcp", "bar:x|c", "malformed_value")
+
+	w := httptest.NewRecorder()
+	serveBadLines(b)(w, httptest.NewRequest("GET", "/debug/badlines", nil))
+
+	want := "1970-01-01T00:00:00Z udp malformed_line \"foo\"\n" +
+		"1970-01-01T00:00:00Z tcp malformed_value \"bar:x|c\"\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestOpenDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dead-letter")
+	for _, l := range []string{"foo:x|c", "bar"} {
+		w, err := openDeadLetter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line.NewDeadLetter(w).RecordBadLine("udp", l, "malformed_line")
+		w.(*os.File).Close()
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "foo:x|c\nbar\n"; string(content) != want {
+		t.Errorf("Expected the file to be appended to, got %q", content)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	w, err := openDeadLetter("udp://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	line.NewDeadLetter(w).RecordBadLine("udp", "foo:x|c", "malformed_value")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "foo:x|c\n" {
+		t.Errorf("Expected the line to be relayed, got %q", got)
+	}
+}
@@ -14,137 +14,191 @@
 package main
 
 import (
+	"net"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/listener"
 )
 
 func TestHandlePacket(t *testing.T) {
 	scenarios := []struct {
 		name string
 		in   string
-		out  Events
+		out  event.Events
 	}{
 		{
 			name: "empty",
 		}, {
 			name: "simple counter",
 			in:   "foo:2|c",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      2,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      2,
+					CLabels:     map[string]string{},
 				},
 			},
 		}, {
 			name: "simple gauge",
 			in:   "foo:3|g",
-			out: Events{
-				&GaugeEvent{
-					metricName: "foo",
-					value:      3,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.GaugeEvent{
+					GMetricName: "foo",
+					GValue:      3,
+					GLabels:     map[string]string{},
 				},
 			},
 		}, {
 			name: "gauge decrement",
 			in:   "foo:-10|g",
-			out: Events{
-				&GaugeEvent{
-					metricName: "foo",
-					value:      -10,
-					relative:   true,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.GaugeEvent{
+					GMetricName: "foo",
+					GValue:      -10,
+					GRelative:   true,
+					GLabels:     map[string]string{},
 				},
 			},
 		}, {
 			name: "simple timer",
 			in:   "foo:200|ms",
-			out: Events{
-				&TimerEvent{
-					metricName: "foo",
-					value:      200,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.TimerEvent{
+					TMetricName: "foo",
+					TValue:      200,
+					TLabels:     map[string]string{},
 				},
 			},
 		}, {
 			name: "datadog tag extension",
 			in:   "foo:100|c|#tag1:bar,tag2:baz",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      100,
-					labels:     map[string]string{"tag1": "bar", "tag2": "baz"},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      100,
+					CLabels:     map[string]string{"tag1": "bar", "tag2": "baz"},
 				},
 			},
 		}, {
 			name: "datadog tag extension with # in all keys (as sent by datadog php client)",
 			in:   "foo:100|c|#tag1:bar,#tag2:baz",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      100,
-					labels:     map[string]string{"tag1": "bar", "tag2": "baz"},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      100,
+					CLabels:     map[string]string{"tag1": "bar", "tag2": "baz"},
 				},
 			},
 		}, {
 			name: "datadog tag extension with tag keys unsupported by prometheus",
 			in:   "foo:100|c|#09digits:0,tag.with.dots:1",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      100,
-					labels:     map[string]string{"_09digits": "0", "tag_with_dots": "1"},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      100,
+					CLabels:     map[string]string{"_09digits": "0", "tag_with_dots": "1"},
 				},
 			},
 		}, {
 			name: "datadog tag extension with valueless tags: ignored",
 			in:   "foo:100|c|#tag_without_a_value",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      100,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      100,
+					CLabels:     map[string]string{},
 				},
 			},
 		}, {
 			name: "datadog tag extension with valueless tags (edge case)",
 			in:   "foo:100|c|#tag_without_a_value,tag:value",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      100,
-					labels:     map[string]string{"tag": "value"},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      100,
+					CLabels:     map[string]string{"tag": "value"},
 				},
 			},
 		}, {
 			name: "datadog tag extension with empty tags (edge case)",
 			in:   "foo:100|c|#tag:value,,",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      100,
-					labels:     map[string]string{"tag": "value"},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      100,
+					CLabels:     map[string]string{"tag": "value"},
 				},
 			},
 		}, {
 			name: "datadog tag extension with sampling",
 			in:   "foo:100|c|@0.1|#tag1:bar,#tag2:baz",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      1000,
-					labels:     map[string]string{"tag1": "bar", "tag2": "baz"},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      1000,
+					CLabels:     map[string]string{"tag1": "bar", "tag2": "baz"},
 				},
 			},
 		}, {
 			name: "datadog tag extension with multiple colons",
 			in:   "foo:100|c|@0.1|#tag1:foo:bar",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      1000,
-					labels:     map[string]string{"tag1": "foo:bar"},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      1000,
+					CLabels:     map[string]string{"tag1": "foo:bar"},
+				},
+			},
+		}, {
+			name: "datadog tag extension before sampling",
+			in:   "foo:100|c|#tag1:bar,tag2:baz|@0.1",
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      1000,
+					CLabels:     map[string]string{"tag1": "bar", "tag2": "baz"},
+				},
+			},
+		}, {
+			name: "datadog timer with tags before sampling",
+			in:   "foo:200|ms|#tag:value|@0.5",
+			out: event.Events{
+				&event.TimerEvent{TMetricName: "foo", TValue: 200, TLabels: map[string]string{"tag": "value"}},
+				&event.TimerEvent{TMetricName: "foo", TValue: 200, TLabels: map[string]string{"tag": "value"}},
+			},
+		}, {
+			name: "datadog container ID and timestamp",
+			in:   "foo:100|c|#tag:value|c:abc123|T1656581400",
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      100,
+					CLabels:     map[string]string{"tag": "value"},
+				},
+			},
+		}, {
+			name: "datadog fields in any order",
+			in:   "foo:100|c|T1656581400|c:abc123|@0.1|#tag:value",
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      1000,
+					CLabels:     map[string]string{"tag": "value"},
+				},
+			},
+		}, {
+			name: "datadog tag extension with multiple tag sections",
+			in:   "foo:100|c|#tag1:bar,tag2:baz|@0.1|#tag2:qux,tag3:quux",
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      1000,
+					CLabels:     map[string]string{"tag1": "bar", "tag2": "qux", "tag3": "quux"},
 				},
 			},
 		}, {
@@ -156,62 +210,62 @@ func TestHandlePacket(t *testing.T) {
 		}, {
 			name: "multiple metrics with invalid datadog utf8 tag values",
 			in:   "foo:200|c|#tag:value\nfoo:300|c|#tag:\xc3\x28invalid",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      200,
-					labels:     map[string]string{"tag": "value"},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      200,
+					CLabels:     map[string]string{"tag": "value"},
 				},
 			},
 		}, {
 			name: "combined multiline metrics",
 			in:   "foo:200|ms:300|ms:5|c|@0.1:6|g\nbar:1|c:5|ms",
-			out: Events{
-				&TimerEvent{
-					metricName: "foo",
-					value:      200,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.TimerEvent{
+					TMetricName: "foo",
+					TValue:      200,
+					TLabels:     map[string]string{},
 				},
-				&TimerEvent{
-					metricName: "foo",
-					value:      300,
-					labels:     map[string]string{},
+				&event.TimerEvent{
+					TMetricName: "foo",
+					TValue:      300,
+					TLabels:     map[string]string{},
 				},
-				&CounterEvent{
-					metricName: "foo",
-					value:      50,
-					labels:     map[string]string{},
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      50,
+					CLabels:     map[string]string{},
 				},
-				&GaugeEvent{
-					metricName: "foo",
-					value:      6,
-					labels:     map[string]string{},
+				&event.GaugeEvent{
+					GMetricName: "foo",
+					GValue:      6,
+					GLabels:     map[string]string{},
 				},
-				&CounterEvent{
-					metricName: "bar",
-					value:      1,
-					labels:     map[string]string{},
+				&event.CounterEvent{
+					CMetricName: "bar",
+					CValue:      1,
+					CLabels:     map[string]string{},
 				},
-				&TimerEvent{
-					metricName: "bar",
-					value:      5,
-					labels:     map[string]string{},
+				&event.TimerEvent{
+					TMetricName: "bar",
+					TValue:      5,
+					TLabels:     map[string]string{},
 				},
 			},
 		}, {
 			name: "timings with sampling factor",
 			in:   "foo.timing:0.5|ms|@0.1",
-			out: Events{
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
-				&TimerEvent{metricName: "foo.timing", value: 0.5, labels: map[string]string{}},
+			out: event.Events{
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
+				&event.TimerEvent{TMetricName: "foo.timing", TValue: 0.5, TLabels: map[string]string{}},
 			},
 		}, {
 			name: "bad line",
@@ -225,24 +279,90 @@ func TestHandlePacket(t *testing.T) {
 		}, {
 			name: "illegal sampling factor",
 			in:   "foo:1|c|@bar",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      1,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      1,
+					CLabels:     map[string]string{},
 				},
 			},
 		}, {
 			name: "zero sampling factor",
 			in:   "foo:2|c|@0",
-			out: Events{
-				&CounterEvent{
-					metricName: "foo",
-					value:      2,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "foo",
+					CValue:      2,
+					CLabels:     map[string]string{},
 				},
 			},
 		}, {
+			name: "set",
+			in:   "foo:bar|s|#tag:value",
+			out: event.Events{
+				&event.SetEvent{
+					SMetricName: "foo",
+					SElement:    "bar",
+					SLabels:     map[string]string{"tag": "value"},
+				},
+			},
+		},
+		{
+			name: "set with empty element",
+			in:   "foo:|s",
+		},
+		{
+			name: "pre-bucketed histogram",
+			in:   "foo:le1=5,le5=3,sum=42,count=9|H|#tag:value",
+			out: event.Events{
+				&event.HistogramEvent{
+					HMetricName: "foo",
+					HBuckets:    map[float64]uint64{1: 5, 5: 3},
+					HSum:        42,
+					HCount:      9,
+					HLabels:     map[string]string{"tag": "value"},
+				},
+			},
+		},
+		{
+			name: "pre-bucketed histogram without count",
+			in:   "foo:le1=5,le5=3,sum=42|H",
+			out: event.Events{
+				&event.HistogramEvent{
+					HMetricName: "foo",
+					HBuckets:    map[float64]uint64{1: 5, 5: 3},
+					HSum:        42,
+					HCount:      8,
+					HLabels:     map[string]string{},
+				},
+			},
+		},
+		{
+			name: "pre-bucketed histogram without sum",
+			in:   "foo:le1=5,count=5|H",
+		},
+		{
+			name: "pre-bucketed histogram with count below its buckets",
+			in:   "foo:le1=5,sum=3,count=4|H",
+		},
+		{
+			name: "pre-bucketed histogram with duplicate bucket",
+			in:   "foo:le1=5,le1=2,sum=3|H",
+		},
+		{
+			name: "pre-bucketed histogram with sampling factor",
+			in:   "foo:le1=5,sum=3|H|@0.1",
+			out: event.Events{
+				&event.HistogramEvent{
+					HMetricName: "foo",
+					HBuckets:    map[float64]uint64{1: 5},
+					HSum:        3,
+					HCount:      5,
+					HLabels:     map[string]string{},
+				},
+			},
+		},
+		{
 			name: "illegal stat type",
 			in:   "foo:2|t",
 		},
@@ -261,24 +381,24 @@ func TestHandlePacket(t *testing.T) {
 		{
 			name: "some invalid utf8",
 			in:   "valid_utf8:1|c\ninvalid\xc3\x28utf8:1|c",
-			out: Events{
-				&CounterEvent{
-					metricName: "valid_utf8",
-					value:      1,
-					labels:     map[string]string{},
+			out: event.Events{
+				&event.CounterEvent{
+					CMetricName: "valid_utf8",
+					CValue:      1,
+					CLabels:     map[string]string{},
 				},
 			},
 		},
 	}
 
-	for k, l := range []statsDPacketHandler{&StatsDUDPListener{}, &mockStatsDTCPListener{}} {
-		events := make(chan Events, 32)
+	for k, l := range []statsDPacketHandler{&listener.StatsDUDPListener{}, &mockStatsDTCPListener{}} {
+		events := make(chan event.Events, 32)
 		for i, scenario := range scenarios {
-			l.handlePacket([]byte(scenario.in), events)
+			l.HandlePacket([]byte(scenario.in), nil, events)
 
 			le := len(events)
 			// Flatten actual events.
-			actual := Events{}
+			actual := event.Events{}
 			for i := 0; i < le; i++ {
 				actual = append(actual, <-events...)
 			}
@@ -295,3 +415,84 @@ func TestHandlePacket(t *testing.T) {
 		}
 	}
 }
+
+func TestListenerLabel(t *testing.T) {
+	for _, l := range []statsDPacketHandler{
+		&listener.StatsDUDPListener{ListenerLabel: "udp"},
+		&mockStatsDTCPListener{listener.StatsDTCPListener{ListenerLabel: "tcp"}},
+	} {
+		events := make(chan event.Events, 32)
+		l.HandlePacket([]byte("foo:1|c|#listener:spoofed,tag:value\nbar:2|g"), nil, events)
+
+		le := len(events)
+		actual := event.Events{}
+		for i := 0; i < le; i++ {
+			actual = append(actual, <-events...)
+		}
+		if len(actual) != 2 {
+			t.Fatalf("Expected 2 events, got %d", len(actual))
+		}
+
+		var want string
+		switch l.(type) {
+		case *listener.StatsDUDPListener:
+			want = "udp"
+		default:
+			want = "tcp"
+		}
+		for _, event := range actual {
+			if got := event.Labels()[listener.ListenerLabelName]; got != want {
+				t.Errorf("Expected listener label %q on %s, got %q", want, event.MetricName(), got)
+			}
+		}
+		if got := actual[0].Labels()["tag"]; got != "value" {
+			t.Errorf("Expected tag to be preserved, got %q", got)
+		}
+	}
+}
+
+func TestUDPReaderThreads(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The gauge is global and the readers of earlier listeners keep
+	// running, so only check the change.
+	before := udpReaderGoroutines(t)
+	events := make(chan event.Events, 32)
+	l := &listener.StatsDUDPListener{Conn: conn, ReaderThreads: 3}
+	go l.Listen(events)
+
+	client, err := net.DialUDP("udp4", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("reader_threads:1|c")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case actual := <-events:
+		if len(actual) != 1 || actual[0].MetricName() != "reader_threads" {
+			t.Fatalf("Unexpected events %v", actual)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for UDP packet")
+	}
+
+	if after := udpReaderGoroutines(t); after-before != 3 {
+		t.Fatalf("Expected 3 more reader goroutines, got %v", after-before)
+	}
+}
+
+func udpReaderGoroutines(t *testing.T) float64 {
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := getFloat64(metrics, "statsd_exporter_udp_reader_goroutines", prometheus.Labels{}); value != nil {
+		return *value
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/listener"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// compareConfigs maps all lines read from capture with both mapping configs,
+// and writes the series exported by only one of them, or with different
+// values, to w. It returns the number of differences.
+func compareConfigs(capture io.Reader, before, after *mapper.MetricMapper, w io.Writer) (int, error) {
+	lines, err := ioutil.ReadAll(capture)
+	if err != nil {
+		return 0, err
+	}
+	seriesBefore, err := mapCapture(lines, before)
+	if err != nil {
+		return 0, err
+	}
+	seriesAfter, err := mapCapture(lines, after)
+	if err != nil {
+		return 0, err
+	}
+
+	var diffs []string
+	for series, value := range seriesBefore {
+		if other, ok := seriesAfter[series]; !ok {
+			diffs = append(diffs, fmt.Sprintf("- %s %s", series, value))
+		} else if other != value {
+			diffs = append(diffs, fmt.Sprintf("~ %s %s before, %s after", series, value, other))
+		}
+	}
+	for series, value := range seriesAfter {
+		if _, ok := seriesBefore[series]; !ok {
+			diffs = append(diffs, fmt.Sprintf("+ %s %s", series, value))
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i][2:] < diffs[j][2:] })
+	for _, diff := range diffs {
+		if _, err := fmt.Fprintln(w, diff); err != nil {
+			return 0, err
+		}
+	}
+	return len(diffs), nil
+}
+
+// mapCapture maps the lines with m into a registry of its own, and returns
+// the resulting series with their type and value.
+func mapCapture(lines []byte, m *mapper.MetricMapper) (map[string]string, error) {
+	events := make(chan event.Events, 1024)
+	errc := make(chan error, 1)
+	go func() {
+		rl := &listener.ReaderListener{Reader: bytes.NewReader(lines)}
+		errc <- rl.Listen(events)
+		close(events)
+	}()
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(m, exporter.WithRegisterer(reg))
+	for e := range events {
+		ex.HandleEvents(e)
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		return nil, err
+	}
+	series := map[string]string{}
+	for _, mf := range mfs {
+		for _, metric := range mf.GetMetric() {
+			series[seriesName(mf.GetName(), metric)] = seriesValue(mf.GetType(), metric)
+		}
+	}
+	return series, nil
+}
+
+// seriesName returns the name and labels of a series in the text format.
+func seriesName(name string, metric *dto.Metric) string {
+	labels := make([]string, 0, len(metric.GetLabel()))
+	for _, pair := range metric.GetLabel() {
+		labels = append(labels, fmt.Sprintf("%s=%q", pair.GetName(), pair.GetValue()))
+	}
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// seriesValue describes the type and value of a series, or for summaries and
+// histograms the number and sum of observations.
+func seriesValue(t dto.MetricType, metric *dto.Metric) string {
+	typ := strings.ToLower(t.String())
+	switch t {
+	case dto.MetricType_COUNTER:
+		return fmt.Sprintf("%s %g", typ, metric.GetCounter().GetValue())
+	case dto.MetricType_GAUGE:
+		return fmt.Sprintf("%s %g", typ, metric.GetGauge().GetValue())
+	case dto.MetricType_SUMMARY:
+		return fmt.Sprintf("%s count %d sum %g", typ, metric.GetSummary().GetSampleCount(), metric.GetSummary().GetSampleSum())
+	case dto.MetricType_HISTOGRAM:
+		return fmt.Sprintf("%s count %d sum %g", typ, metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum())
+	}
+	return fmt.Sprintf("%s %g", typ, metric.GetUntyped().GetValue())
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+func TestCompareConfigs(t *testing.T) {
+	before := &mapper.MetricMapper{}
+	if err := before.InitFromYAMLString(`
+mappings:
+- match: api.*.requests
+  name: api_requests
+  labels:
+    handler: $1
+- match: api.*.latency
+  timer_type: histogram
+  name: api_latency
+  labels:
+    handler: $1
+`); err != nil {
+		t.Fatal(err)
+	}
+	after := &mapper.MetricMapper{}
+	if err := after.InitFromYAMLString(`
+mappings:
+- match: api.*.requests
+  name: api_requests
+  labels:
+    route: $1
+- match: api.*.latency
+  timer_type: histogram
+  name: api_latency
+  labels:
+    handler: $1
+- match: debug.*
+  action: drop
+  name: dropped
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	capture := "api.users.requests:1|c\napi.users.latency:100|ms\ndebug.foo:1|g\n"
+	var out bytes.Buffer
+	n, err := compareConfigs(strings.NewReader(capture), before, after, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `- api_requests{handler="users"} counter 1
++ api_requests{route="users"} counter 1
+- debug_foo{} gauge 1
+`
+	if n != 3 || out.String() != want {
+		t.Errorf("Expected 3 differences:\n%s\ngot %d:\n%s", want, n, out.String())
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// effectiveConfig is the resolved runtime configuration of the exporter.
+type effectiveConfig struct {
+	Flags          map[string]string `yaml:"flags"`
+	MappingConfigs []mappingConfig   `yaml:"mapping_configs"`
+}
+
+type mappingConfig struct {
+	File          string `yaml:"file,omitempty"`
+	mapper.Config `yaml:",inline"`
+}
+
+// configReporter collects the flag values and the loaded mapping
+// configurations, to report the configuration an instance is running with.
+type configReporter struct {
+	flags map[string]string
+
+	mtx     sync.Mutex
+	mappers map[string]*mapper.MetricMapper
+}
+
+// redacted replaces credentials in reported flag values.
+const redacted = "<secret>"
+
+// headerFlags are flags whose values are headers as key=value, the values of
+// which are credentials in general.
+var headerFlags = map[string]bool{
+	"otlp.header": true,
+}
+
+// redactFlag returns the value of f with the credentials it may carry
+// replaced: the user info of URLs, e.g. the password of --redis.url, and the
+// header values of headerFlags.
+func redactFlag(f *kingpin.FlagModel) string {
+	values := []string{f.String()}
+	if g, ok := f.Value.(kingpin.Getter); ok {
+		if s, ok := g.Get().(*[]string); ok {
+			values = append([]string(nil), *s...)
+		}
+	}
+	for i, v := range values {
+		if headerFlags[f.Name] {
+			if eq := strings.Index(v, "="); eq >= 0 {
+				v = v[:eq+1] + redacted
+			}
+		} else if u, err := url.Parse(v); err == nil && u.User != nil {
+			u.User = nil
+			v = strings.Replace(u.String(), "//", "//"+redacted+"@", 1)
+		}
+		values[i] = v
+	}
+	return strings.Join(values, ",")
+}
+
+// newConfigReporter records the values of all visible flags of app, which
+// must have been parsed, with credentials redacted.
+func newConfigReporter(app *kingpin.Application) *configReporter {
+	flags := map[string]string{}
+	for _, f := range app.Model().Flags {
+		if f.Hidden || f.Name == "help" || f.Name == "version" || f.Name == "print-config" {
+			continue
+		}
+		flags[f.Name] = redactFlag(f)
+	}
+	return &configReporter{
+		flags:   flags,
+		mappers: map[string]*mapper.MetricMapper{},
+	}
+}
+
+// addMapper registers the mapper loaded from the given file. Mappers are
+// reported with their current configuration, including reloads.
+func (r *configReporter) addMapper(fileName string, m *mapper.MetricMapper) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.mappers[fileName] = m
+}
+
+func (r *configReporter) hasMapper(fileName string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, ok := r.mappers[fileName]
+	return ok
+}
+
+// YAML returns the effective configuration as YAML.
+func (r *configReporter) YAML() ([]byte, error) {
+	r.mtx.Lock()
+	files := make([]string, 0, len(r.mappers))
+	for fileName := range r.mappers {
+		files = append(files, fileName)
+	}
+	sort.Strings(files)
+	config := effectiveConfig{Flags: r.flags}
+	for _, fileName := range files {
+		config.MappingConfigs = append(config.MappingConfigs, mappingConfig{
+			File:   fileName,
+			Config: r.mappers[fileName].Config(),
+		})
+	}
+	r.mtx.Unlock()
+	return yaml.Marshal(config)
+}
+
+func (r *configReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	out, err := r.YAML()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	w.Write(out)
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+func TestConfigReporter(t *testing.T) {
+	app := kingpin.New("test", "")
+	app.Flag("statsd.listen-udp", "").Default(":9125").String()
+	app.Flag("statsd.counter-flush-interval", "").Default("0").Duration()
+	app.Flag("print-config", "").Bool()
+	redisURL := app.Flag("redis.url", "").String()
+	natsURL := app.Flag("nats.url", "").String()
+	headers := app.Flag("otlp.header", "").Strings()
+	args := []string{
+		"--statsd.counter-flush-interval=5s",
+		"--print-config",
+		"--redis.url=redis://:s3cret@localhost:6379/0",
+		"--nats.url=nats://localhost:4222",
+		"--otlp.header=Authorization=Bearer TOKEN",
+		"--otlp.header=X-Scope-OrgID=team",
+	}
+	if _, err := app.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mapper.MetricMapper{}
+	err := m.InitFromYAMLString(`
+defaults:
+  ttl: 1m
+mappings:
+- match: test.*
+  name: test
+  labels:
+    kind: $1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newConfigReporter(app)
+	r.addMapper("mapping.yml", m)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+
+	var got effectiveConfig
+	if err := yaml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Config is not valid YAML: %v\n%s", err, w.Body.String())
+	}
+
+	wantFlags := map[string]string{
+		"statsd.listen-udp":             ":9125",
+		"statsd.counter-flush-interval": "5s",
+		"redis.url":                     "redis://<secret>@localhost:6379/0",
+		"nats.url":                      "nats://localhost:4222",
+		"otlp.header":                   "Authorization=<secret>,X-Scope-OrgID=<secret>",
+	}
+	if !reflect.DeepEqual(got.Flags, wantFlags) {
+		t.Errorf("Expected flags %v, got %v", wantFlags, got.Flags)
+	}
+	if *redisURL != "redis://:s3cret@localhost:6379/0" || *natsURL != "nats://localhost:4222" || (*headers)[0] != "Authorization=Bearer TOKEN" {
+		t.Errorf("Flag values were changed by redacting them: %q, %q, %q", *redisURL, *natsURL, *headers)
+	}
+	if len(got.MappingConfigs) != 1 {
+		t.Fatalf("Expected one mapping config, got %d", len(got.MappingConfigs))
+	}
+	mc := got.MappingConfigs[0]
+	if mc.File != "mapping.yml" || mc.Defaults.Ttl != time.Minute || mc.Defaults.MatchType != mapper.MatchTypeGlob {
+		t.Errorf("Unexpected mapping config %+v", mc)
+	}
+	if len(mc.Mappings) != 1 || mc.Mappings[0].Name != "test" {
+		t.Errorf("Unexpected mappings %+v", mc.Mappings)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/howeyc/fsnotify"
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+const (
+	// configReloadDelay is how long the config watcher waits for changes
+	// to settle before reloading, so that a burst of events causes a single
+	// reload.
+	configReloadDelay = 500 * time.Millisecond
+	// configRecheckInterval is how often the config watcher re-establishes
+	// its watches and checks for changes it may have missed.
+	configRecheckInterval = 30 * time.Second
+)
+
+// configWatcher reloads a mapping config file when its content changes. It
+// watches the directories of the file and of the file it links to, rather
+// than the file itself, so that it also notices files being replaced, e.g.
+// by editors writing a new file and renaming it, or Kubernetes swapping the
+// symlinks of a ConfigMap volume.
+type configWatcher struct {
+	fileName string
+	mapper   *mapper.MetricMapper
+	delay    time.Duration
+
+	watcher  *fsnotify.Watcher
+	watched  map[string]bool
+	checksum []byte
+}
+
+func newConfigWatcher(fileName string, m *mapper.MetricMapper, delay time.Duration) (*configWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &configWatcher{
+		fileName: fileName,
+		mapper:   m,
+		delay:    delay,
+		watcher:  watcher,
+		watched:  map[string]bool{},
+	}
+	// The mapper was loaded from the current content.
+	w.checksum, _ = fileChecksum(fileName)
+	w.watch()
+	return w, nil
+}
+
+func watchConfig(fileName string, m *mapper.MetricMapper) {
+	w, err := newConfigWatcher(fileName, m, configReloadDelay)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.run(nil)
+}
+
+// run handles the events of the watched directories until stop is closed.
+func (w *configWatcher) run(stop <-chan struct{}) {
+	defer w.watcher.Close()
+	recheck := time.NewTicker(configRecheckInterval)
+	defer recheck.Stop()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case ev := <-w.watcher.Event:
+			log.Debugf("Config directory changed (%s)", ev)
+			settled = time.After(w.delay)
+		case <-settled:
+			settled = nil
+			w.reload()
+		case <-recheck.C:
+			w.reload()
+		case err := <-w.watcher.Error:
+			log.Errorln("Error watching config:", err)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reload reloads the config if its content changed since the last attempt,
+// and updates the watches as the file may now link elsewhere.
+func (w *configWatcher) reload() {
+	defer w.watch()
+
+	checksum, err := fileChecksum(w.fileName)
+	if err != nil {
+		// The file may be in the middle of being replaced, the next
+		// event or recheck will try again.
+		log.Debugln("Error reading config:", err)
+		return
+	}
+	if bytes.Equal(checksum, w.checksum) {
+		return
+	}
+	w.checksum = checksum
+
+	log.Infof("Config file %s changed, attempting reload", w.fileName)
+	_ = reloadConfig(w.fileName, w.mapper)
+}
+
+// watch (re-)establishes the watches of the directories of the config file
+// and of the file it links to. Watches are re-added every time, as they are
+// lost when a directory is replaced.
+func (w *configWatcher) watch() {
+	dirs := map[string]bool{filepath.Dir(w.fileName): true}
+	if resolved, err := filepath.EvalSymlinks(w.fileName); err == nil {
+		dirs[filepath.Dir(resolved)] = true
+	}
+	for dir := range w.watched {
+		if !dirs[dir] {
+			_ = w.watcher.RemoveWatch(dir)
+			delete(w.watched, dir)
+		}
+	}
+	for dir := range dirs {
+		if err := w.watcher.Watch(dir); err != nil {
+			log.Errorf("Error watching config directory %s: %s", dir, err)
+			continue
+		}
+		w.watched[dir] = true
+	}
+}
+
+func fileChecksum(fileName string) ([]byte, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(content)
+	return checksum[:], nil
+}
+
+// reloadConfig reloads a mapper from its mapping config file, and logs and
+// counts the outcome.
+func reloadConfig(fileName string, m *mapper.MetricMapper) error {
+	err := m.InitFromFile(fileName)
+	recordConfigLoad(fileName, err)
+	if err != nil {
+		log.Errorf("Error reloading config %s: %s", fileName, err)
+		configLoads.WithLabelValues("failure").Inc()
+		return err
+	}
+	log.Infof("Config %s reloaded successfully", fileName)
+	configLoads.WithLabelValues("success").Inc()
+	return nil
+}
+
+// recordConfigLoad updates the reload status of a mapping config file after
+// it was loaded, initially or by a reload.
+func recordConfigLoad(fileName string, err error) {
+	if err != nil {
+		configLastReloadSuccessful.WithLabelValues(fileName).Set(0)
+		return
+	}
+	configLastReloadSuccessful.WithLabelValues(fileName).Set(1)
+	configLastReloadSuccess.WithLabelValues(fileName).SetToCurrentTime()
+	configGeneration.WithLabelValues(fileName).Inc()
+}
+
+// configReloader reloads all mapping configs on request, by SIGHUP or a POST
+// to its handler, regardless of whether they are watched.
+type configReloader struct {
+	mtx     sync.Mutex
+	mappers map[string]*mapper.MetricMapper
+}
+
+func (r *configReloader) add(fileName string, m *mapper.MetricMapper) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.mappers == nil {
+		r.mappers = map[string]*mapper.MetricMapper{}
+	}
+	r.mappers[fileName] = m
+}
+
+// reload reloads every mapping config, and returns the first error. A config
+// that fails to load keeps its previous mappings.
+func (r *configReloader) reload() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	files := make([]string, 0, len(r.mappers))
+	for fileName := range r.mappers {
+		files = append(files, fileName)
+	}
+	sort.Strings(files)
+
+	var firstErr error
+	for _, fileName := range files {
+		if err := reloadConfig(fileName, r.mappers[fileName]); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error reloading config %s: %s", fileName, err)
+		}
+	}
+	return firstErr
+}
+
+func (r *configReloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests reload the configuration.", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// reloadOnSignal reloads all mapping configs whenever the process receives
+// SIGHUP.
+func (r *configReloader) reloadOnSignal() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Infoln("Received SIGHUP, reloading config")
+		_ = r.reload()
+	}
+}
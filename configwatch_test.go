@@ -0,0 +1,163 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// writeConfigMap lays out a mapping config like a Kubernetes ConfigMap
+// volume: the file links to ..data/mapping.yml, and ..data links to a
+// directory holding the current version, swapped by renaming a new link
+// over it.
+func writeConfigMap(t *testing.T, dir, version, content string) {
+	versionDir := filepath.Join(dir, version)
+	if err := os.Mkdir(versionDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(versionDir, "mapping.yml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigWatcherSymlinkSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigMap(t, dir, "..v1", "mappings:\n- match: app.*\n  name: first\n")
+	fileName := filepath.Join(dir, "mapping.yml")
+	if err := os.Symlink(filepath.Join("..data", "mapping.yml"), fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mapper.MetricMapper{}
+	if err := m.InitFromFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	w, err := newConfigWatcher(fileName, m, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go w.run(stop)
+
+	mappedName := func() string {
+		return m.Config().Mappings[0].Name
+	}
+
+	writeConfigMap(t, dir, "..v2", "mappings:\n- match: app.*\n  name: second\n")
+	os.RemoveAll(filepath.Join(dir, "..v1"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for mappedName() != "second" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the swapped config to be loaded, mapping still named %q", mappedName())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The watches follow the swap, a second one is noticed as well.
+	writeConfigMap(t, dir, "..v3", "mappings:\n- match: app.*\n  name: third\n")
+	deadline = time.Now().Add(5 * time.Second)
+	for mappedName() != "third" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the second swap to be loaded, mapping still named %q", mappedName())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigReloader(t *testing.T) {
+	f, err := ioutil.TempFile("", "mapping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if err := ioutil.WriteFile(f.Name(), []byte("mappings:\n- match: app.*\n  name: first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &mapper.MetricMapper{}
+	if err := m.InitFromFile(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	reloader := &configReloader{}
+	reloader.add(f.Name(), m)
+
+	reload := func(method string) int {
+		rec := httptest.NewRecorder()
+		reloader.ServeHTTP(rec, httptest.NewRequest(method, "/-/reload", nil))
+		return rec.Code
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte("mappings:\n- match: app.*\n  name: second\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := reload(http.MethodGet); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rejected, got status %d", code)
+	}
+	if name := m.Config().Mappings[0].Name; name != "first" {
+		t.Errorf("Expected GET not to reload, mapping named %q", name)
+	}
+	if code := reload(http.MethodPost); code != http.StatusOK {
+		t.Errorf("Expected POST to reload, got status %d", code)
+	}
+	if name := m.Config().Mappings[0].Name; name != "second" {
+		t.Errorf("Expected the config to be reloaded, mapping named %q", name)
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte("mappings:\n- match: app.*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := reload(http.MethodPost); code != http.StatusInternalServerError {
+		t.Errorf("Expected an invalid config to fail, got status %d", code)
+	}
+	if name := m.Config().Mappings[0].Name; name != "second" {
+		t.Errorf("Expected the previous config to be kept, mapping named %q", name)
+	}
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := prometheus.Labels{"file": f.Name()}
+	if value := getFloat64(metrics, "statsd_exporter_config_generation", labels); value == nil || *value != 1 {
+		t.Errorf("Expected the config generation to be 1 after one successful reload, got %v", value)
+	}
+	if value := getFloat64(metrics, "statsd_exporter_config_last_reload_successful", labels); value == nil || *value != 0 {
+		t.Errorf("Expected the last reload to be unsuccessful, got %v", value)
+	}
+	if value := getFloat64(metrics, "statsd_exporter_config_last_reload_success_timestamp_seconds", labels); value == nil || *value == 0 {
+		t.Errorf("Expected the time of the successful reload, got %v", value)
+	}
+}
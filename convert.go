@@ -0,0 +1,116 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/listener"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// convert maps all lines read from r and writes the resulting metrics to w in
+// the Prometheus text format. Metrics of the exporter itself are omitted.
+func convert(r io.Reader, w io.Writer, m *mapper.MetricMapper) error {
+	// Everything exported before the conversion is exporter telemetry.
+	// Telemetry vectors without children are only exported once used, and
+	// are recognized by their prefix.
+	before, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+	internal := make(map[string]bool, len(before))
+	for _, mf := range before {
+		internal[mf.GetName()] = true
+	}
+
+	events := make(chan event.Events, 1024)
+	errc := make(chan error, 1)
+	go func() {
+		rl := &listener.ReaderListener{Reader: r}
+		errc <- rl.Listen(events)
+		close(events)
+	}()
+	ex := exporter.NewExporter(m)
+	for e := range events {
+		ex.HandleEvents(e)
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+	enc := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, mf := range mfs {
+		if internal[mf.GetName()] || strings.HasPrefix(mf.GetName(), "statsd_exporter_") {
+			continue
+		}
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertMappings rewrites the matches of the mapping config to the match
+// type to and writes the resulting config to w. If samples is not nil, the
+// metric names or StatsD lines read from it must be mapped the same way by
+// both configs.
+func convertMappings(config string, to mapper.MatchType, samples io.Reader, w io.Writer) error {
+	out, skipped, err := mapper.ConvertMatchTypes(config, to)
+	if err != nil {
+		return err
+	}
+	for _, s := range skipped {
+		log.Warnf("Mapping not converted to %s: %s", to, s)
+	}
+
+	if samples != nil {
+		before, after := &mapper.MetricMapper{}, &mapper.MetricMapper{}
+		if err := before.InitFromYAMLString(config); err != nil {
+			return err
+		}
+		if err := after.InitFromYAMLString(string(out)); err != nil {
+			return fmt.Errorf("converted config is invalid: %v", err)
+		}
+		var names []string
+		scanner := bufio.NewScanner(samples)
+		for scanner.Scan() {
+			if name := strings.SplitN(scanner.Text(), ":", 2)[0]; name != "" {
+				names = append(names, name)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		if diffs := mapper.CompareMappings(before, after, names); len(diffs) > 0 {
+			return fmt.Errorf("converted config maps %d samples differently:\n%s", len(diffs), strings.Join(diffs, "\n"))
+		}
+	}
+
+	_, err = w.Write(out)
+	return err
+}
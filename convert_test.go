@@ -0,0 +1,90 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+func TestConvert(t *testing.T) {
+	m := &mapper.MetricMapper{}
+	err := m.InitFromYAMLString(`
+mappings:
+- match: convert.*.requests
+  name: convert_requests
+  labels:
+    service: $1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := strings.NewReader("convert.api.requests:1|c\nconvert.api.requests:2|c\nconvert.web.requests:5|c\nconvert_temperature:21.5|g\n")
+	var out bytes.Buffer
+	if err := convert(in, &out, m); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP convert_requests Metric autogenerated by statsd_exporter.
+# TYPE convert_requests counter
+convert_requests{service="api"} 3
+convert_requests{service="web"} 5
+# HELP convert_temperature Metric autogenerated by statsd_exporter.
+# TYPE convert_temperature gauge
+convert_temperature 21.5
+`
+	if out.String() != want {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestConvertMappings(t *testing.T) {
+	config := `
+mappings:
+- match: convert.*.requests
+  name: convert_requests
+  labels:
+    service: $1
+- match: ^convert\.(.*)$
+  match_type: regex
+  name: convert_other
+`
+	var out bytes.Buffer
+	samples := strings.NewReader("convert.api.requests:1|c\nconvert.api.errors\n")
+	if err := convertMappings(config, mapper.MatchTypeRegex, samples, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `match: ^convert\.([^.]*)\.requests$`) {
+		t.Errorf("Expected the glob to be converted, got:\n%s", out.String())
+	}
+
+	// Converted to regular expressions in config order, the catch-all
+	// regex takes precedence.
+	config = `
+mappings:
+- match: ^convert\.(.*)$
+  match_type: regex
+  name: convert_other
+- match: convert.*.requests
+  name: convert_requests
+`
+	samples = strings.NewReader("convert.api.requests\n")
+	if err := convertMappings(config, mapper.MatchTypeRegex, samples, &out); err == nil {
+		t.Error("Expected the converted config to map the sample differently")
+	}
+}
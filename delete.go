@@ -0,0 +1,90 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+)
+
+// deleteHandler deletes series from all exporters. The metric is given by
+// the "name" parameter, and the series can be narrowed down with "label"
+// parameters of the form label=value.
+type deleteHandler struct {
+	mtx       sync.Mutex
+	exporters []*exporter.Exporter
+}
+
+// deleteResult is the data of the response of a deleteHandler.
+type deleteResult struct {
+	Deleted int `json:"deleted"`
+}
+
+func (h *deleteHandler) add(ex *exporter.Exporter) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.exporters = append(h.exporters, ex)
+}
+
+func (h *deleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests are accepted.", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.Form.Get("name")
+	if name == "" {
+		http.Error(w, "The name parameter is required.", http.StatusBadRequest)
+		return
+	}
+	labels := prometheus.Labels{}
+	for _, label := range r.Form["label"] {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 {
+			http.Error(w, fmt.Sprintf("Invalid label %q, expected label=value.", label), http.StatusBadRequest)
+			return
+		}
+		labels[parts[0]] = parts[1]
+	}
+
+	h.mtx.Lock()
+	exporters := h.exporters
+	h.mtx.Unlock()
+
+	deleted := 0
+	for _, ex := range exporters {
+		deleted += ex.DeleteSeries(name, labels)
+	}
+	log.Infof("Deleted %d series of %s matching %v", deleted, name, labels)
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(struct {
+		Status string       `json:"status"`
+		Data   deleteResult `json:"data"`
+	}{"success", deleteResult{deleted}})
+	if err != nil {
+		log.Errorln("Error writing response:", err)
+	}
+}
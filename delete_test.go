@@ -0,0 +1,71 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+func TestDeleteHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(&mapper.MetricMapper{}, exporter.WithRegisterer(reg))
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("deleted_counter", 1, map[string]string{"region": "eu", "host": "a"}),
+		event.NewCounterEvent("deleted_counter", 1, map[string]string{"region": "eu", "host": "b"}),
+		event.NewCounterEvent("deleted_counter", 1, map[string]string{"region": "us", "host": "a"}),
+	})
+	h := &deleteHandler{}
+	h.add(ex)
+
+	scenarios := []struct {
+		method, query string
+		code          int
+		body          string
+	}{
+		{"GET", "name=deleted_counter", 405, ""},
+		{"POST", "", 400, ""},
+		{"POST", "name=deleted_counter&label=region", 400, ""},
+		{"POST", "name=deleted_counter&label=region%3Deu", 200, `{"status":"success","data":{"deleted":2}}`},
+		{"POST", "name=deleted_counter&label=region%3Deu", 200, `{"status":"success","data":{"deleted":0}}`},
+	}
+	for i, s := range scenarios {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(s.method, "/api/v1/admin/delete_series?"+s.query, nil))
+		if rec.Code != s.code {
+			t.Errorf("%d. expected status %d, got %d", i, s.code, rec.Code)
+		}
+		if body := strings.TrimSpace(rec.Body.String()); s.body != "" && body != s.body {
+			t.Errorf("%d. expected body %s, got %s", i, s.body, body)
+		}
+	}
+
+	metrics, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := getFloat64(metrics, "deleted_counter", prometheus.Labels{"region": "us", "host": "a"}); value == nil || *value != 1 {
+		t.Errorf("Expected the series of other regions to be kept, got %v", value)
+	}
+	if value := getFloat64(metrics, "deleted_counter", prometheus.Labels{"region": "eu", "host": "a"}); value != nil {
+		t.Errorf("Expected the series of region eu to be deleted, got %v", *value)
+	}
+}
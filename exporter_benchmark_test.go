@@ -16,6 +16,9 @@ package main
 import (
 	"fmt"
 	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/listener"
 )
 
 func benchmarkExporter(times int, b *testing.B) {
@@ -38,13 +41,13 @@ func benchmarkExporter(times int, b *testing.B) {
 		}
 	}
 	for n := 0; n < b.N; n++ {
-		l := StatsDUDPListener{}
+		l := listener.StatsDUDPListener{}
 		// there are more events than input lines, need bigger buffer
-		events := make(chan Events, len(bytesInput)*times*2)
+		events := make(chan event.Events, len(bytesInput)*times*2)
 
 		for i := 0; i < times; i++ {
 			for _, line := range bytesInput {
-				l.handlePacket([]byte(line), events)
+				l.HandlePacket([]byte(line), nil, events)
 			}
 		}
 	}
@@ -14,15 +14,22 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"net"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
 
 	"github.com/prometheus/statsd_exporter/pkg/clock"
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/listener"
 	"github.com/prometheus/statsd_exporter/pkg/mapper"
 )
 
@@ -40,19 +47,19 @@ func TestNegativeCounter(t *testing.T) {
 		}
 	}()
 
-	events := make(chan Events)
+	events := make(chan event.Events)
 	go func() {
-		c := Events{
-			&CounterEvent{
-				metricName: "foo",
-				value:      -1,
+		c := event.Events{
+			&event.CounterEvent{
+				CMetricName: "foo",
+				CValue:      -1,
 			},
 		}
 		events <- c
 		close(events)
 	}()
 
-	ex := NewExporter(&mapper.MetricMapper{})
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
 	ex.Listen(events)
 }
 
@@ -68,39 +75,40 @@ func TestInvalidUtf8InDatadogTagValue(t *testing.T) {
 		}
 	}()
 
-	events := make(chan Events)
+	events := make(chan event.Events)
 
 	go func() {
-		for _, l := range []statsDPacketHandler{&StatsDUDPListener{}, &mockStatsDTCPListener{}} {
-			l.handlePacket([]byte("bar:200|c|#tag:value\nbar:200|c|#tag:\xc3\x28invalid"), events)
+		for _, l := range []statsDPacketHandler{&listener.StatsDUDPListener{}, &mockStatsDTCPListener{}} {
+			l.HandlePacket([]byte("bar:200|c|#tag:value\nbar:200|c|#tag:\xc3\x28invalid"), nil, events)
 		}
 		close(events)
 	}()
 
-	ex := NewExporter(&mapper.MetricMapper{})
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
 	ex.Listen(events)
 }
 
 func TestHistogramUnits(t *testing.T) {
 	// Start exporter with a synchronous channel
-	events := make(chan Events)
+	events := make(chan event.Events)
 	go func() {
-		ex := NewExporter(&mapper.MetricMapper{})
-		ex.mapper.Defaults.TimerType = mapper.TimerTypeHistogram
+		testMapper := &mapper.MetricMapper{}
+		testMapper.Defaults.TimerType = mapper.TimerTypeHistogram
+		ex := exporter.NewExporter(testMapper)
 		ex.Listen(events)
 	}()
 
 	// Synchronously send a statsd event to wait for handleEvent execution.
 	// Then close events channel to stop a listener.
 	name := "foo"
-	c := Events{
-		&TimerEvent{
-			metricName: name,
-			value:      300,
+	c := event.Events{
+		&event.TimerEvent{
+			TMetricName: name,
+			TValue:      300,
 		},
 	}
 	events <- c
-	events <- Events{}
+	events <- event.Events{}
 	close(events)
 
 	// Check histogram value
@@ -120,14 +128,14 @@ func TestHistogramUnits(t *testing.T) {
 }
 
 type statsDPacketHandler interface {
-	handlePacket(packet []byte, e chan<- Events)
+	HandlePacket(packet []byte, src net.IP, e chan<- event.Events)
 }
 
 type mockStatsDTCPListener struct {
-	StatsDTCPListener
+	listener.StatsDTCPListener
 }
 
-func (ml *mockStatsDTCPListener) handlePacket(packet []byte, e chan<- Events) {
+func (ml *mockStatsDTCPListener) HandlePacket(packet []byte, src net.IP, e chan<- event.Events) {
 	// Forcing IPv4 because the TravisCI build environment does not have IPv6
 	// addresses.
 	lc, err := net.ListenTCP("tcp4", nil)
@@ -155,143 +163,1621 @@ func (ml *mockStatsDTCPListener) handlePacket(packet []byte, e chan<- Events) {
 	if err != nil {
 		panic(fmt.Sprintf("mockStatsDTCPListener: accept failed: %v", err))
 	}
-	ml.handleConn(sc, e)
+	ml.HandleConn(sc, e)
 }
 
-func TestEscapeMetricName(t *testing.T) {
-	scenarios := map[string]string{
-		"clean":                   "clean",
-		"0starts_with_digit":      "_0starts_with_digit",
-		"with_underscore":         "with_underscore",
-		"with.dot":                "with_dot",
-		"with😱emoji":              "with_emoji",
-		"with.*.multiple":         "with___multiple",
-		"test.web-server.foo.bar": "test_web_server_foo_bar",
+// TestHandleEvents validates that events created with the public
+// constructors can be passed to the exporter directly.
+func TestHandleEvents(t *testing.T) {
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("injected_counter", 2, nil),
+		event.NewGaugeEvent("injected_gauge", 5, false, map[string]string{"tag": "value"}),
+		event.NewGaugeEvent("injected_gauge", -2, true, map[string]string{"tag": "value"}),
+		event.NewTimerEvent("injected_timer", 300, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	scenarios := []struct {
+		name   string
+		labels prometheus.Labels
+		want   float64
+	}{
+		{name: "injected_counter", labels: prometheus.Labels{}, want: 2},
+		{name: "injected_gauge", labels: prometheus.Labels{"tag": "value"}, want: 3},
+		{name: "injected_timer", labels: prometheus.Labels{}, want: 300},
+	}
+	for _, s := range scenarios {
+		value := getFloat64(metrics, s.name, s.labels)
+		if value == nil {
+			t.Fatalf("Metric %s not found", s.name)
+		}
+		if *value != s.want {
+			t.Errorf("Metric %s: expected %f, got %f", s.name, s.want, *value)
+		}
+	}
+}
+
+func TestWithRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(&mapper.MetricMapper{}, exporter.WithRegisterer(prometheus.WrapRegistererWithPrefix("embedded_", reg)))
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("registerer_counter", 1, nil),
+		event.NewTimerEvent("registerer_timer", 1, nil),
+	})
+
+	metrics, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from registry: %v", err)
+	}
+	if getFloat64(metrics, "embedded_registerer_counter", prometheus.Labels{}) == nil {
+		t.Error("Counter should be registered with the custom registerer")
+	}
+	if getFloat64(metrics, "embedded_registerer_timer", prometheus.Labels{}) == nil {
+		t.Error("Timer should be registered with the custom registerer")
+	}
+
+	metrics, err = prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	if getFloat64(metrics, "registerer_counter", prometheus.Labels{}) != nil {
+		t.Error("Counter should not be registered with the default registerer")
+	}
+}
+
+func TestMaxSeries(t *testing.T) {
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
+	ex.MaxSeries = 2
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("quota_counter", 1, map[string]string{"series": "a"}),
+		event.NewCounterEvent("quota_counter", 1, map[string]string{"series": "b"}),
+		event.NewCounterEvent("quota_counter", 1, map[string]string{"series": "c"}),
+		event.NewCounterEvent("quota_counter", 1, map[string]string{"series": "a"}),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for series, want := range map[string]float64{"a": 2, "b": 1} {
+		value := getFloat64(metrics, "quota_counter", prometheus.Labels{"series": series})
+		if value == nil || *value != want {
+			t.Errorf("Expected series %s to be %f, got %v", series, want, value)
+		}
+	}
+	if value := getFloat64(metrics, "quota_counter", prometheus.Labels{"series": "c"}); value != nil {
+		t.Errorf("Series beyond the limit should be dropped, got %f", *value)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: budget.*
+  name: budget_mapped
+  labels:
+    series: $1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget := &exporter.MemoryBudget{Limit: 1000, MaxBatch: 1}
+	ex := exporter.NewExporter(testMapper)
+	ex.MemoryBudget = budget
+	ex.HandleEvents(event.Events{event.NewCounterEvent("budget_unmapped", 1, map[string]string{"series": "a"})})
+
+	budget.Observe(950)
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("budget_unmapped", 1, map[string]string{"series": "a"}),
+		event.NewCounterEvent("budget_unmapped", 1, map[string]string{"series": "b"}),
+		event.NewCounterEvent("budget.c", 1, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	if value := getFloat64(metrics, "budget_unmapped", prometheus.Labels{"series": "a"}); value == nil || *value != 2 {
+		t.Errorf("Expected the existing series to be updated, got %v", value)
+	}
+	if value := getFloat64(metrics, "budget_unmapped", prometheus.Labels{"series": "b"}); value != nil {
+		t.Errorf("New series without mapping should be dropped, got %f", *value)
+	}
+	if value := getFloat64(metrics, "budget_mapped", prometheus.Labels{"series": "c"}); value == nil || *value != 1 {
+		t.Errorf("Expected the mapped series to be created, got %v", value)
+	}
+
+	in := make(chan event.Events, 2)
+	out := make(chan event.Events, 2)
+	in <- event.Events{event.NewCounterEvent("budget.d", 1, nil), event.NewCounterEvent("budget.e", 1, nil)}
+	in <- event.Events{event.NewCounterEvent("budget.f", 1, nil)}
+	close(in)
+	exporter.RunBudgetedQueue(in, out, false, budget)
+	if got := <-out; len(got) != 1 || got[0].MetricName() != "budget.f" {
+		t.Errorf("Expected only the small batch to be queued, got %v", got)
+	}
+
+	budget.Observe(100)
+	if budget.Exceeded() {
+		t.Error("Expected the budget not to be exceeded after the heap shrank")
+	}
+}
+
+func TestInconsistentLabelSets(t *testing.T) {
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("label_sets_counter", 1, map[string]string{"a": "x"}),
+		event.NewCounterEvent("label_sets_counter", 2, map[string]string{"a": "x", "b": "y"}),
+		event.NewCounterEvent("label_sets_counter", 4, map[string]string{}),
+		event.NewCounterEvent("label_sets_counter", 8, map[string]string{"a": "x"}),
+		event.NewGaugeEvent("label_sets_gauge", 1, false, map[string]string{"a": "x", "b": "y"}),
+		event.NewGaugeEvent("label_sets_gauge", 2, false, map[string]string{"b": "z"}),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		labels prometheus.Labels
+		want   float64
+	}{
+		{"label_sets_counter", prometheus.Labels{"a": "x", "b": ""}, 9},
+		{"label_sets_counter", prometheus.Labels{"a": "x", "b": "y"}, 2},
+		{"label_sets_counter", prometheus.Labels{"a": "", "b": ""}, 4},
+		{"label_sets_gauge", prometheus.Labels{"a": "x", "b": "y"}, 1},
+		{"label_sets_gauge", prometheus.Labels{"a": "", "b": "z"}, 2},
+	} {
+		value := getFloat64(metrics, tc.name, tc.labels)
+		if value == nil || *value != tc.want {
+			t.Errorf("Expected %s%v to be %f, got %v", tc.name, tc.labels, tc.want, value)
+		}
+	}
+}
+
+func TestInconsistentLabelSetsSharedRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	widened := exporter.NewExporter(&mapper.MetricMapper{}, exporter.WithRegisterer(reg))
+	widened.HandleEvents(event.Events{
+		event.NewCounterEvent("shared_label_sets", 1, map[string]string{"a": "x"}),
+		event.NewCounterEvent("shared_label_sets", 2, map[string]string{"a": "x", "b": "y"}),
+	})
+	// Another exporter on the same registry must not register the metric
+	// again once it was widened.
+	other := exporter.NewExporter(&mapper.MetricMapper{}, exporter.WithRegisterer(reg))
+	other.HandleEvents(event.Events{
+		event.NewCounterEvent("shared_label_sets", 4, map[string]string{"a": "x"}),
+		event.NewCounterEvent("shared_label_sets", 8, map[string]string{"a": "x", "b": "y"}),
+	})
+
+	metrics, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from registry: %v", err)
+	}
+	if value := getFloat64(metrics, "shared_label_sets", prometheus.Labels{"a": "x", "b": ""}); value == nil || *value != 1 {
+		t.Errorf("Expected the widened counter to be kept, got %v", value)
+	}
+}
+
+func TestTypeConflictSuffix(t *testing.T) {
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
+	ex.TypeConflictPolicy = exporter.TypeConflictSuffix
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("conflict_suffix", 1, nil),
+		event.NewGaugeEvent("conflict_suffix", 2, false, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	if value := getFloat64(metrics, "conflict_suffix", prometheus.Labels{}); value == nil || *value != 1 {
+		t.Errorf("Expected the counter to be kept, got %v", value)
+	}
+	if value := getFloat64(metrics, "conflict_suffix_gauge", prometheus.Labels{}); value == nil || *value != 2 {
+		t.Errorf("Expected the gauge under the suffixed name, got %v", value)
+	}
+	if value := getFloat64(metrics, "statsd_exporter_metric_type_conflict", prometheus.Labels{"metric_name": "conflict_suffix", "type": "gauge"}); value == nil || *value != 1 {
+		t.Errorf("Expected the conflict to be exported, got %v", value)
+	}
+}
+
+func TestTypeConflictReplace(t *testing.T) {
+	// Mock a time.NewTicker
+	tickerCh := make(chan time.Time)
+	clock.ClockInstance = &clock.Clock{
+		TickerCh: tickerCh,
+	}
+	clock.ClockInstance.Instant = time.Unix(0, 0)
+
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+defaults:
+  ttl: 1s
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan event.Events)
+	defer close(events)
+	go func() {
+		ex := exporter.NewExporter(testMapper)
+		ex.TypeConflictPolicy = exporter.TypeConflictReplace
+		ex.Listen(events)
+	}()
+
+	// The gauge is dropped while the counter has series.
+	events <- event.Events{
+		event.NewCounterEvent("conflict_replace", 1, nil),
+		event.NewGaugeEvent("conflict_replace", 2, false, nil),
+	}
+	events <- event.Events{}
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	if value := getFloat64(metrics, "conflict_replace", prometheus.Labels{}); value == nil || *value != 1 {
+		t.Errorf("Expected the counter to be kept, got %v", value)
+	}
+
+	// Once the counter has expired, the gauge replaces it.
+	clock.ClockInstance.Instant = time.Unix(2, 0)
+	clock.ClockInstance.TickerCh <- time.Unix(0, 0)
+	events <- event.Events{event.NewGaugeEvent("conflict_replace", 3, false, nil)}
+	events <- event.Events{}
+	metrics, err = prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for _, family := range metrics {
+		if family.GetName() == "conflict_replace" && family.GetType() != dto.MetricType_GAUGE {
+			t.Errorf("Expected conflict_replace to be replaced by a gauge, got %v", family.GetType())
+		}
+	}
+	if value := getFloat64(metrics, "conflict_replace", prometheus.Labels{}); value == nil || *value != 3 {
+		t.Errorf("Expected the gauge to replace the counter, got %v", value)
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: sampled.counter
+  name: sampled_counter
+  sample_rate: 0.1
+- match: sampled.timer
+  name: sampled_timer
+  timer_type: histogram
+  sample_rate: 0.1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	for i := 0; i < 10000; i++ {
+		ex.HandleEvents(event.Events{
+			event.NewCounterEvent("sampled.counter", 1, nil),
+			event.NewTimerEvent("sampled.timer", 1, nil),
+		})
+	}
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	// The standard deviation of both is about 3%.
+	if value := getFloat64(metrics, "sampled_counter", prometheus.Labels{}); value == nil || *value < 8500 || *value > 11500 {
+		t.Errorf("Expected the sampled counter to be scaled to about 10000, got %v", value)
+	}
+	// Observations of a millisecond each.
+	if value := getFloat64(metrics, "sampled_timer", prometheus.Labels{}); value == nil || *value < 0.85 || *value > 1.15 {
+		t.Errorf("Expected about 1000 timer observations to be kept, got %v", value)
+	}
+}
+
+func TestCoalesceBatches(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: coalesce.timer
+  name: coalesce_timer
+  timer_type: histogram
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.CoalesceBatches = true
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("coalesce_counter", 1, nil),
+		event.NewGaugeEvent("coalesce_gauge", 5, false, nil),
+		event.NewTimerEvent("coalesce.timer", 100, nil),
+		event.NewCounterEvent("coalesce_counter", 2, nil),
+		event.NewGaugeEvent("coalesce_gauge", 3, false, nil),
+		event.NewGaugeEvent("coalesce_gauge", 1, true, nil),
+		event.NewTimerEvent("coalesce.timer", 300, nil),
+	})
+
+	// The batch is applied when it has been handled.
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for name, want := range map[string]float64{"coalesce_counter": 3, "coalesce_gauge": 4, "coalesce_timer": 0.4} {
+		if value := getFloat64(metrics, name, prometheus.Labels{}); value == nil || *value != want {
+			t.Errorf("Expected %s to be %f, got %v", name, want, value)
+		}
+	}
+}
+
+func TestUnmappedRecorder(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: recorder.*.mapped
+  name: recorder_mapped
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suggester := &mapper.Suggester{MinVariants: 2}
+	ex := exporter.NewExporter(testMapper)
+	ex.UnmappedRecorder = suggester
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("recorder.aa.mapped", 1, nil),
+		event.NewCounterEvent("recorder.aa.unmapped", 1, nil),
+		event.NewCounterEvent("recorder.bb.unmapped", 1, nil),
+	})
+
+	got := suggester.Suggest()
+	if len(got) != 1 || got[0].Match != "recorder.*.unmapped" {
+		t.Errorf("Expected a suggestion for recorder.*.unmapped only, got %v", got)
+	}
+}
+
+func TestDropUnmapped(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: strict.*.mapped
+  name: strict_mapped
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.DropUnmapped = true
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("strict.aa.mapped", 1, nil),
+		event.NewCounterEvent("strict_unmapped", 1, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	if getFloat64(metrics, "strict_mapped", prometheus.Labels{}) == nil {
+		t.Error("Mapped metric should be exported")
+	}
+	if getFloat64(metrics, "strict_unmapped", prometheus.Labels{}) != nil {
+		t.Error("Unmapped metric should be dropped")
+	}
+}
+
+func TestNameSeparator(t *testing.T) {
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
+	ex.NameSeparator = ":"
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("separator.foo-bar.baz", 1, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	if getFloat64(metrics, "separator:foo_bar:baz", prometheus.Labels{}) == nil {
+		t.Error("Expected the dots of the unmapped name to be replaced by the separator")
+	}
+}
+
+func TestStripPrefixes(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: strip.*
+  name: strip_mapped
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.StripPrefixes = []string{"statsd.", "app."}
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("statsd.strip.foo", 1, nil),
+		event.NewCounterEvent("app.strip.foo", 1, nil),
+		event.NewCounterEvent("strip.foo", 1, nil),
+		event.NewCounterEvent("statsd.app.strip_unmapped", 1, nil),
+		event.NewCounterEvent("app.", 1, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	scenarios := []struct {
+		name string
+		want float64
+	}{
+		{name: "strip_mapped", want: 3},
+		// Only the first matching prefix is removed.
+		{name: "app_strip_unmapped", want: 1},
+		// Names are never stripped to nothing.
+		{name: "app_", want: 1},
+	}
+	for _, s := range scenarios {
+		value := getFloat64(metrics, s.name, prometheus.Labels{})
+		if value == nil {
+			t.Errorf("Metric %s is missing", s.name)
+		} else if *value != s.want {
+			t.Errorf("Expected %v for %s, got %v", s.want, s.name, *value)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: namespace.*
+  name: namespace_mapped
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.Namespace = "flag_"
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("namespace.foo", 1, nil),
+		event.NewCounterEvent("namespace_unmapped", 1, nil),
+	})
+
+	// The namespace of the mapping config takes precedence.
+	err = testMapper.InitFromYAMLString(`
+defaults:
+  namespace: config_
+mappings:
+- match: namespace.*
+  name: namespace_mapped
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("namespace.foo", 1, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for _, name := range []string{"flag_namespace_mapped", "flag_namespace_unmapped", "config_namespace_mapped"} {
+		if getFloat64(metrics, name, prometheus.Labels{}) == nil {
+			t.Errorf("Metric %s is missing", name)
+		}
+	}
+
+	if err := testMapper.InitFromYAMLString("defaults:\n  namespace: my-org\n"); err == nil {
+		t.Error("Expected an error for an invalid namespace")
+	}
+}
+
+func TestMappingNamespaceSubsystem(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: fqname.both.*
+  name: requests
+  namespace: fqname
+  subsystem: both
+- match: fqname.subsystem.*
+  name: requests
+  subsystem: fqname_subsystem
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("fqname.both.foo", 1, nil),
+		event.NewCounterEvent("fqname.subsystem.foo", 1, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for _, name := range []string{"fqname_both_requests", "fqname_subsystem_requests"} {
+		if getFloat64(metrics, name, prometheus.Labels{}) == nil {
+			t.Errorf("Metric %s is missing", name)
+		}
+	}
+}
+
+func TestHostTag(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+defaults:
+  host_tag: exported_instance
+mappings:
+- match: host.dropped
+  name: host_dropped
+  host_tag: drop
+- match: host.kept
+  name: host_kept
+  host_tag: keep
+- match: host.renamed
+  name: host_renamed
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("host.dropped", 1, map[string]string{"host": "a"}),
+		event.NewCounterEvent("host.kept", 1, map[string]string{"host": "a"}),
+		event.NewCounterEvent("host.renamed", 1, map[string]string{"host": "a"}),
+		event.NewCounterEvent("host_unmapped", 1, map[string]string{"host": "a"}),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	scenarios := []struct {
+		name   string
+		labels prometheus.Labels
+	}{
+		{name: "host_dropped", labels: prometheus.Labels{}},
+		{name: "host_kept", labels: prometheus.Labels{"host": "a"}},
+		{name: "host_renamed", labels: prometheus.Labels{"exported_instance": "a"}},
+		{name: "host_unmapped", labels: prometheus.Labels{"exported_instance": "a"}},
+	}
+	for _, s := range scenarios {
+		if getFloat64(metrics, s.name, s.labels) == nil {
+			t.Errorf("Metric %s%v is missing", s.name, s.labels)
+		}
+	}
+}
+
+func TestLowercase(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+defaults:
+  lowercase: true
+mappings:
+- match: lower.global.*
+  name: lower_global_${1}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("Lower.Global.Foo", 1, map[string]string{"Host": "A"}),
+		event.NewCounterEvent("lower.GLOBAL.foo", 1, map[string]string{"host": "A"}),
+		event.NewCounterEvent("Lower_Unmapped", 1, nil),
+	})
+
+	err = testMapper.InitFromYAMLString(`
+mappings:
+- match: lower.mapping.*
+  name: lower_mapping_${1}
+  lowercase: true
+  labels:
+    Kind: "x"
+- match: lower.kept.*
+  name: lower_kept_${1}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("lower.mapping.Foo", 1, map[string]string{"Host": "A"}),
+		event.NewCounterEvent("lower.kept.Foo", 1, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	scenarios := []struct {
+		name   string
+		labels prometheus.Labels
+		want   float64
+	}{
+		{name: "lower_global_foo", labels: prometheus.Labels{"host": "A"}, want: 2},
+		{name: "lower_unmapped", labels: prometheus.Labels{}, want: 1},
+		{name: "lower_mapping_foo", labels: prometheus.Labels{"host": "A", "kind": "x"}, want: 1},
+		{name: "lower_kept_Foo", labels: prometheus.Labels{}, want: 1},
+	}
+	for _, s := range scenarios {
+		value := getFloat64(metrics, s.name, s.labels)
+		if value == nil {
+			t.Errorf("Metric %s%v is missing", s.name, s.labels)
+		} else if *value != s.want {
+			t.Errorf("Expected %v for %s%v, got %v", s.want, s.name, s.labels, *value)
+		}
+	}
+}
+
+func TestLengthLimits(t *testing.T) {
+	for _, truncate := range []bool{false, true} {
+		ex := exporter.NewExporter(&mapper.MetricMapper{})
+		ex.MaxNameLength = 16
+		ex.MaxLabelValueLength = 4
+		ex.TruncateLongValues = truncate
+		prefix := fmt.Sprintf("limit_%t_", truncate)
+		ex.HandleEvents(event.Events{
+			event.NewCounterEvent(prefix+"ok", 1, map[string]string{"tag": "abcd"}),
+			event.NewCounterEvent(prefix+"long_name", 1, nil),
+			event.NewCounterEvent(prefix+"lbl", 1, map[string]string{"tag": "abcdé"}),
+		})
+
+		metrics, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+		}
+		if getFloat64(metrics, prefix+"ok", prometheus.Labels{"tag": "abcd"}) == nil {
+			t.Errorf("truncate=%t: metric within the limits is missing", truncate)
+		}
+		if getFloat64(metrics, prefix+"long_name", prometheus.Labels{}) != nil {
+			t.Errorf("truncate=%t: metric with long name was not limited", truncate)
+		}
+		truncatedName := (prefix + "long_name")[:16]
+		if got := getFloat64(metrics, truncatedName, prometheus.Labels{}) != nil; got != truncate {
+			t.Errorf("truncate=%t: expected truncated metric %s to exist: %t, got %t", truncate, truncatedName, truncate, got)
+		}
+		if got := getFloat64(metrics, prefix+"lbl", prometheus.Labels{"tag": "abcd"}) != nil; got != truncate {
+			t.Errorf("truncate=%t: expected metric with truncated label to exist: %t, got %t", truncate, truncate, got)
+		}
+	}
+}
+
+func TestPersistGauges(t *testing.T) {
+	defer func(c *clock.Clock) { clock.ClockInstance = c }(clock.ClockInstance)
+	clock.ClockInstance = nil
+
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: persist.*
+  name: persist_gauge
+  ttl: 1h
+  labels:
+    name: $1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.HandleEvents(event.Events{
+		event.NewGaugeEvent("persist.foo", 42, false, nil),
+		event.NewGaugeEvent("persist.bar", 2, false, nil),
+		event.NewGaugeEvent("persist.bar", 3, true, nil),
+	})
+
+	var snapshot bytes.Buffer
+	if err := ex.SaveGauges(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	snapshot.WriteString(`{"name":"persist_expired","labels":{},"value":1,"last_registered_at":"2000-01-01T00:00:00Z","ttl":60000000000}` + "\n")
+
+	// Emulate a restart.
+	prometheus.Unregister(ex.Gauges.Elements["persist_gauge"])
+	ex = exporter.NewExporter(testMapper)
+	if err := ex.RestoreGauges(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for name, want := range map[string]float64{"foo": 42, "bar": 5} {
+		value := getFloat64(metrics, "persist_gauge", prometheus.Labels{"name": name})
+		if value == nil || *value != want {
+			t.Errorf("Expected restored gauge %s to be %f, got %v", name, want, value)
+		}
+	}
+	if getFloat64(metrics, "persist_expired", prometheus.Labels{}) != nil {
+		t.Error("Expired gauge should not be restored")
+	}
+}
+
+func TestInfoAction(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: app.*.version.*
+  name: app_version_info
+  action: info
+  labels:
+    app: $1
+    version: $2
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("app.shop.version.v1_2_3", 5, nil),
+		event.NewGaugeEvent("app.cart.version.v2_0", 0, false, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for _, labels := range []prometheus.Labels{
+		{"app": "shop", "version": "v1_2_3"},
+		{"app": "cart", "version": "v2_0"},
+	} {
+		value := getFloat64(metrics, "app_version_info", labels)
+		if value == nil || *value != 1 {
+			t.Errorf("Expected app_version_info%v to be 1, got %v", labels, value)
+		}
+	}
+}
+
+func TestValueLabel(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: web.*.status
+  name: web_responses
+  value_label: code
+  value_label_format: "%.0f"
+  labels:
+    handler: $1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.HandleEvents(event.Events{
+		event.NewGaugeEvent("web.index.status", 200, false, nil),
+		event.NewGaugeEvent("web.index.status", 200, false, nil),
+		event.NewTimerEvent("web.index.status", 404, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for code, want := range map[string]float64{"200": 2, "404": 1} {
+		value := getFloat64(metrics, "web_responses", prometheus.Labels{"handler": "index", "code": code})
+		if value == nil || *value != want {
+			t.Errorf("Expected %f responses with code %s, got %v", want, code, value)
+		}
+	}
+}
+
+func TestTimerThresholds(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: api.*.latency
+  name: api_latency
+  thresholds: [0.25, 1]
+  labels:
+    handler: $1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper)
+	ex.HandleEvents(event.Events{
+		event.NewTimerEvent("api.users.latency", 100, nil),
+		event.NewTimerEvent("api.users.latency", 500, nil),
+		event.NewTimerEvent("api.users.latency", 1500, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for threshold, want := range map[string]float64{"0.25": 2, "1": 1} {
+		value := getFloat64(metrics, "api_latency_over_threshold_total", prometheus.Labels{"handler": "users", "threshold": threshold})
+		if value == nil || *value != want {
+			t.Errorf("Expected %f observations over %s, got %v", want, threshold, value)
+		}
+	}
+}
+
+func TestRunQueueShedGauges(t *testing.T) {
+	in := make(chan event.Events, 1)
+	// An unbuffered queue is always full.
+	out := make(chan event.Events)
+	in <- event.Events{
+		event.NewCounterEvent("queue_counter", 1, nil),
+		event.NewGaugeEvent("queue_gauge", 2, false, nil),
+		event.NewTimerEvent("queue_timer", 1, nil),
+	}
+	close(in)
+
+	done := make(chan struct{})
+	go func() {
+		exporter.RunQueue(in, out, true)
+		close(done)
+	}()
+
+	got := <-out
+	<-done
+	if len(got) != 2 || got[0].MetricName() != "queue_counter" || got[1].MetricName() != "queue_timer" {
+		t.Errorf("Expected only the gauge to be shed, got %v", got)
+	}
+}
+
+// TestTtlExpiration validates expiration of time series.
+// foobar metric without mapping should expire with default ttl of 1s
+// bazqux metric should expire with ttl of 2s
+func TestTtlExpiration(t *testing.T) {
+	// Mock a time.NewTicker
+	tickerCh := make(chan time.Time)
+	clock.ClockInstance = &clock.Clock{
+		TickerCh: tickerCh,
+	}
+
+	config := `
+defaults:
+  ttl: 1s
+mappings:
+- match: bazqux.*
+  name: bazqux
+  ttl: 2s
+`
+	// Create mapper from config and start an Exporter with a synchronous channel
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(config)
+	if err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	events := make(chan event.Events)
+	defer close(events)
+	go func() {
+		ex := exporter.NewExporter(testMapper)
+		ex.Listen(events)
+	}()
+
+	ev := event.Events{
+		// event with default ttl = 1s
+		&event.GaugeEvent{
+			GMetricName: "foobar",
+			GValue:      200,
+		},
+		// event with ttl = 2s from a mapping
+		&event.TimerEvent{
+			TMetricName: "bazqux.main",
+			TValue:      42,
+		},
+	}
+
+	var metrics []*dto.MetricFamily
+	var foobarValue *float64
+	var bazquxValue *float64
+
+	// Step 1. Send events with statsd metrics.
+	// Send empty Events to wait for events are handled.
+	// saveLabelValues will use fake instant as a lastRegisteredAt time.
+	clock.ClockInstance.Instant = time.Unix(0, 0)
+	events <- ev
+	events <- event.Events{}
+
+	// Check values
+	metrics, err = prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal("Gather should not fail")
+	}
+	foobarValue = getFloat64(metrics, "foobar", prometheus.Labels{})
+	bazquxValue = getFloat64(metrics, "bazqux", prometheus.Labels{})
+	if foobarValue == nil || bazquxValue == nil {
+		t.Fatalf("Gauge `foobar` and Summary `bazqux` should be gathered")
+	}
+	if *foobarValue != 200 {
+		t.Fatalf("Gauge `foobar` observation %f is not expected. Should be 200", *foobarValue)
+	}
+	if *bazquxValue != 42 {
+		t.Fatalf("Summary `bazqux` observation %f is not expected. Should be 42", *bazquxValue)
+	}
+
+	// Step 2. Increase Instant to emulate metrics expiration after 1s
+	clock.ClockInstance.Instant = time.Unix(1, 10)
+	clock.ClockInstance.TickerCh <- time.Unix(0, 0)
+	events <- event.Events{}
+
+	// Check values
+	metrics, err = prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal("Gather should not fail")
+	}
+	foobarValue = getFloat64(metrics, "foobar", prometheus.Labels{})
+	bazquxValue = getFloat64(metrics, "bazqux", prometheus.Labels{})
+	if foobarValue != nil {
+		t.Fatalf("Gauge `foobar` should be expired")
+	}
+	if bazquxValue == nil {
+		t.Fatalf("Summary `bazqux` should be gathered")
+	}
+	if *bazquxValue != 42 {
+		t.Fatalf("Summary `bazqux` observation %f is not expected. Should be 42", *bazquxValue)
+	}
+
+	// Step 3. Increase Instant to emulate metrics expiration after 2s
+	clock.ClockInstance.Instant = time.Unix(2, 200)
+	clock.ClockInstance.TickerCh <- time.Unix(0, 0)
+	events <- event.Events{}
+
+	// Check values
+	metrics, err = prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal("Gather should not fail")
+	}
+	foobarValue = getFloat64(metrics, "foobar", prometheus.Labels{})
+	bazquxValue = getFloat64(metrics, "bazqux", prometheus.Labels{})
+	if bazquxValue != nil {
+		t.Fatalf("Summary `bazqux` should be expired")
+	}
+	if foobarValue != nil {
+		t.Fatalf("Gauge `foobar` should not be gathered after expiration")
+	}
+}
+
+// TestFixedTtlExpiration validates that series with a fixed ttl expire after
+// their first registration even if they keep being updated, while series with
+// a sliding ttl are kept alive by updates.
+func TestFixedTtlExpiration(t *testing.T) {
+	tickerCh := make(chan time.Time)
+	clock.ClockInstance = &clock.Clock{
+		TickerCh: tickerCh,
+	}
+
+	config := `
+defaults:
+  ttl: 2s
+mappings:
+- match: oneshot.*
+  name: oneshot
+  ttl_type: fixed
+- match: sliding.*
+  name: sliding
+`
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(config)
+	if err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	events := make(chan event.Events)
+	defer close(events)
+	go func() {
+		ex := exporter.NewExporter(testMapper)
+		ex.Listen(events)
+	}()
+
+	ev := event.Events{
+		&event.GaugeEvent{GMetricName: "oneshot.job", GValue: 1, GLabels: map[string]string{}},
+		&event.GaugeEvent{GMetricName: "sliding.job", GValue: 1, GLabels: map[string]string{}},
+	}
+
+	// Register both series at 0s and update them at 1s.
+	clock.ClockInstance.Instant = time.Unix(0, 0)
+	events <- ev
+	events <- event.Events{}
+	clock.ClockInstance.Instant = time.Unix(1, 0)
+	events <- ev
+	events <- event.Events{}
+
+	// At 2.5s, the fixed ttl has passed since the first registration, but
+	// the sliding ttl has not passed since the last update.
+	clock.ClockInstance.Instant = time.Unix(2, 500)
+	clock.ClockInstance.TickerCh <- time.Unix(0, 0)
+	events <- event.Events{}
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal("Gather should not fail")
+	}
+	if value := getFloat64(metrics, "oneshot", prometheus.Labels{}); value != nil {
+		t.Fatalf("Gauge `oneshot` should be expired")
+	}
+	if value := getFloat64(metrics, "sliding", prometheus.Labels{}); value == nil {
+		t.Fatalf("Gauge `sliding` should not be expired")
+	}
+}
+
+// TestShortenedTtlExpiration validates that a series expires after a ttl
+// that was shortened by a reload, although it was scheduled to expire after
+// the longer ttl it was created with.
+func TestShortenedTtlExpiration(t *testing.T) {
+	tickerCh := make(chan time.Time)
+	clock.ClockInstance = &clock.Clock{
+		TickerCh: tickerCh,
+	}
+
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString("defaults:\n  ttl: 10s\n"); err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	events := make(chan event.Events)
+	defer close(events)
+	go func() {
+		ex := exporter.NewExporter(testMapper)
+		ex.Listen(events)
+	}()
+
+	ev := event.Events{
+		&event.GaugeEvent{GMetricName: "shortened_ttl", GValue: 1, GLabels: map[string]string{}},
+	}
+
+	clock.ClockInstance.Instant = time.Unix(0, 0)
+	events <- ev
+	events <- event.Events{}
+
+	if err := testMapper.InitFromYAMLString("defaults:\n  ttl: 1s\n"); err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	clock.ClockInstance.Instant = time.Unix(1, 0)
+	events <- ev
+	events <- event.Events{}
+
+	clock.ClockInstance.Instant = time.Unix(2, 500)
+	clock.ClockInstance.TickerCh <- time.Unix(0, 0)
+	events <- event.Events{}
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal("Gather should not fail")
+	}
+	if value := getFloat64(metrics, "shortened_ttl", prometheus.Labels{}); value != nil {
+		t.Fatalf("Gauge `shortened_ttl` should be expired")
+	}
+}
+
+// TestUnmappedTtl validates that metrics without mapping expire after the
+// unmapped TTL, while mapped metrics keep their own.
+func TestUnmappedTtl(t *testing.T) {
+	tickerCh := make(chan time.Time)
+	clock.ClockInstance = &clock.Clock{
+		TickerCh: tickerCh,
+	}
+
+	config := `
+defaults:
+  ttl: 1m
+mappings:
+- match: curated.*
+  name: curated
+`
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	reg := prometheus.NewRegistry()
+	events := make(chan event.Events)
+	defer close(events)
+	go func() {
+		ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(reg))
+		ex.UnmappedTtl = time.Second
+		ex.Listen(events)
+	}()
+
+	clock.ClockInstance.Instant = time.Unix(0, 0)
+	events <- event.Events{
+		&event.GaugeEvent{GMetricName: "curated.gauge", GValue: 1, GLabels: map[string]string{}},
+		&event.GaugeEvent{GMetricName: "exploratory.gauge", GValue: 1, GLabels: map[string]string{}},
+	}
+	events <- event.Events{}
+
+	clock.ClockInstance.Instant = time.Unix(2, 0)
+	clock.ClockInstance.TickerCh <- time.Unix(0, 0)
+	events <- event.Events{}
+
+	metrics, err := reg.Gather()
+	if err != nil {
+		t.Fatal("Gather should not fail")
+	}
+	if value := getFloat64(metrics, "exploratory_gauge", prometheus.Labels{}); value != nil {
+		t.Errorf("Gauge `exploratory_gauge` should be expired")
+	}
+	if value := getFloat64(metrics, "curated", prometheus.Labels{}); value == nil {
+		t.Errorf("Gauge `curated` should not be expired")
+	}
+}
+
+// TestExpiryJitter validates that series created at the same time expire
+// spread over the jitter added to their ttl.
+func TestExpiryJitter(t *testing.T) {
+	tickerCh := make(chan time.Time)
+	clock.ClockInstance = &clock.Clock{
+		TickerCh: tickerCh,
+	}
+
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString("defaults:\n  ttl: 10s\n"); err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	events := make(chan event.Events)
+	defer close(events)
+	go func() {
+		ex := exporter.NewExporter(testMapper)
+		ex.ExpiryJitter = 0.5
+		ex.Listen(events)
+	}()
+
+	var ev event.Events
+	for i := 0; i < 100; i++ {
+		ev = append(ev, &event.GaugeEvent{GMetricName: "jittered", GValue: 1, GLabels: map[string]string{"series": fmt.Sprint(i)}})
+	}
+	clock.ClockInstance.Instant = time.Unix(0, 0)
+	events <- ev
+	events <- event.Events{}
+
+	remaining := func(at time.Time) int {
+		clock.ClockInstance.Instant = at
+		clock.ClockInstance.TickerCh <- time.Unix(0, 0)
+		events <- event.Events{}
+		metrics, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatal("Gather should not fail")
+		}
+		for _, mf := range metrics {
+			if mf.GetName() == "jittered" {
+				return len(mf.GetMetric())
+			}
+		}
+		return 0
+	}
+	if n := remaining(time.Unix(9, 0)); n != 100 {
+		t.Fatalf("Expected no series to expire before the ttl, %d of 100 are left", n)
+	}
+	if n := remaining(time.Unix(12, 500000000)); n == 0 || n == 100 {
+		t.Fatalf("Expected some series to expire within the jitter, %d of 100 are left", n)
+	}
+	if n := remaining(time.Unix(15, 1)); n != 0 {
+		t.Fatalf("Expected all series to expire after the ttl and jitter, %d of 100 are left", n)
+	}
+}
+
+// TestZeroExpiry validates that series with the zero expiry action are kept
+// at zero for the grace period after their ttl has passed.
+func TestZeroExpiry(t *testing.T) {
+	tickerCh := make(chan time.Time)
+	clock.ClockInstance = &clock.Clock{
+		TickerCh: tickerCh,
+	}
+
+	config := `
+defaults:
+  ttl: 1s
+mappings:
+- match: zeroed.*
+  name: zeroed_$1
+  expiry_action: zero
+  expiry_grace: 2s
+`
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(config)
+	if err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	events := make(chan event.Events)
+	done := make(chan struct{})
+	defer func() {
+		close(events)
+		<-done
+	}()
+	go func() {
+		ex := exporter.NewExporter(testMapper)
+		ex.Listen(events)
+		close(done)
+	}()
+
+	clock.ClockInstance.Instant = time.Unix(0, 0)
+	events <- event.Events{
+		event.NewGaugeEvent("zeroed.gauge", 5, false, nil),
+		event.NewCounterEvent("zeroed.counter", 3, nil),
+	}
+	events <- event.Events{}
+
+	for _, step := range []struct {
+		at     time.Time
+		want   float64
+		exists bool
+	}{
+		{at: time.Unix(1, 500), want: 0, exists: true},
+		{at: time.Unix(3, 500), exists: false},
+	} {
+		clock.ClockInstance.Instant = step.at
+		clock.ClockInstance.TickerCh <- step.at
+		events <- event.Events{}
+
+		metrics, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatal("Gather should not fail")
+		}
+		for _, name := range []string{"zeroed_gauge", "zeroed_counter"} {
+			value := getFloat64(metrics, name, prometheus.Labels{})
+			if !step.exists {
+				if value != nil {
+					t.Errorf("%s should be deleted at %v, got %f", name, step.at, *value)
+				}
+				continue
+			}
+			if value == nil || *value != step.want {
+				t.Errorf("Expected %s to be %f at %v, got %v", name, step.want, step.at, value)
+			}
+		}
+	}
+}
+
+// TestCounterAggregation validates that counter increments are only applied
+// once the flush interval has passed when pre-aggregation is enabled.
+func TestCounterAggregation(t *testing.T) {
+	clock.ClockInstance = &clock.Clock{
+		Instant: time.Unix(0, 0),
+	}
+	defer func() { clock.ClockInstance = nil }()
+
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
+	ex.CounterFlushInterval = 10 * time.Second
+
+	name := "aggregated_counter"
+	c := event.Events{
+		&event.CounterEvent{CMetricName: name, CValue: 1, CLabels: map[string]string{}},
+		&event.CounterEvent{CMetricName: name, CValue: 2, CLabels: map[string]string{}},
+	}
+	ex.HandleEvents(c)
+	ex.HandleEvents(c)
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	if value := getFloat64(metrics, name, prometheus.Labels{}); value != nil {
+		t.Fatalf("Counter should not be exported before the flush interval, got %f", *value)
+	}
+
+	clock.ClockInstance.Instant = time.Unix(10, 0)
+	ex.HandleEvents(event.Events{})
+
+	metrics, err = prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	value := getFloat64(metrics, name, prometheus.Labels{})
+	if value == nil {
+		t.Fatal("Counter should be exported after the flush interval")
+	}
+	if *value != 6 {
+		t.Fatalf("Counter value %f is not expected. Should be 6", *value)
+	}
+}
+
+// TestFlushInterval validates that gauge updates and timer observations are
+// merged and only applied once the flush interval has passed.
+func TestFlushInterval(t *testing.T) {
+	clock.ClockInstance = &clock.Clock{
+		Instant: time.Unix(0, 0),
+	}
+	defer func() { clock.ClockInstance = nil }()
+
+	ex := exporter.NewExporter(&mapper.MetricMapper{})
+	ex.FlushInterval = 10 * time.Second
+
+	ex.HandleEvents(event.Events{
+		event.NewGaugeEvent("flushed_gauge", 1, true, nil),
+		event.NewGaugeEvent("flushed_gauge", 5, false, nil),
+		event.NewGaugeEvent("flushed_gauge", 2, true, nil),
+		event.NewTimerEvent("flushed_timer", 100, nil),
+		event.NewTimerEvent("flushed_timer", 200, nil),
+	})
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for _, name := range []string{"flushed_gauge", "flushed_timer"} {
+		if value := getFloat64(metrics, name, prometheus.Labels{}); value != nil {
+			t.Fatalf("%s should not be exported before the flush interval, got %f", name, *value)
+		}
+	}
+
+	clock.ClockInstance.Instant = time.Unix(10, 0)
+	ex.HandleEvents(event.Events{})
+
+	metrics, err = prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for name, want := range map[string]float64{"flushed_gauge": 7, "flushed_timer": 300} {
+		value := getFloat64(metrics, name, prometheus.Labels{})
+		if value == nil || *value != want {
+			t.Errorf("Expected %s to be %f after the flush interval, got %v", name, want, value)
+		}
+	}
+}
+
+func TestAdaptiveFlush(t *testing.T) {
+	clock.ClockInstance = &clock.Clock{
+		Instant: time.Unix(0, 0),
 	}
+	defer func() { clock.ClockInstance = nil }()
+
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(&mapper.MetricMapper{}, exporter.WithRegisterer(reg))
+	ex.CounterFlushInterval = 16 * time.Second
+	ex.FlushThreshold = 3
 
-	for in, want := range scenarios {
-		if got := escapeMetricName(in); want != got {
-			t.Errorf("expected `%s` to be escaped to `%s`, got `%s`", in, want, got)
+	inc := event.NewCounterEvent("adaptive_counter", 1, nil)
+	for _, step := range []struct {
+		at     int64
+		events event.Events
+		want   float64
+	}{
+		// Below the threshold, within the interval.
+		{0, event.Events{inc, inc}, 0},
+		// Reaching the threshold flushes, and halves the interval to 8s.
+		{0, event.Events{inc}, 3},
+		{4, event.Events{inc}, 3},
+		{8, event.Events{}, 4},
+		// An idle interval doubles it back to 16s, and the first event
+		// after it is applied at once.
+		{16, event.Events{}, 4},
+		{100, event.Events{inc}, 5},
+		{110, event.Events{inc}, 5},
+		{116, event.Events{}, 6},
+	} {
+		clock.ClockInstance.Instant = time.Unix(step.at, 0)
+		ex.HandleEvents(step.events)
+
+		metrics, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Cannot gather from registry: %v", err)
+		}
+		var got float64
+		if value := getFloat64(metrics, "adaptive_counter", prometheus.Labels{}); value != nil {
+			got = *value
+		}
+		if got != step.want {
+			t.Errorf("At %ds: expected %f, got %f", step.at, step.want, got)
 		}
 	}
 }
 
-// TestTtlExpiration validates expiration of time series.
-// foobar metric without mapping should expire with default ttl of 1s
-// bazqux metric should expire with ttl of 2s
-func TestTtlExpiration(t *testing.T) {
-	// Mock a time.NewTicker
-	tickerCh := make(chan time.Time)
-	clock.ClockInstance = &clock.Clock{
-		TickerCh: tickerCh,
-	}
-
+func TestBiasedSummary(t *testing.T) {
 	config := `
-defaults:
-  ttl: 1s
 mappings:
-- match: bazqux.*
-  name: bazqux
-  ttl: 2s
+- match: biased.timer
+  name: biased_timer
+  quantile_algorithm: biased
+  quantiles:
+    - quantile: 0.5
+    - quantile: 0.99
 `
-	// Create mapper from config and start an Exporter with a synchronous channel
 	testMapper := &mapper.MetricMapper{}
-	err := testMapper.InitFromYAMLString(config)
-	if err != nil {
+	if err := testMapper.InitFromYAMLString(config); err != nil {
 		t.Fatalf("Config load error: %s %s", config, err)
 	}
-	events := make(chan Events)
-	defer close(events)
+
+	ev := event.Events{}
+	for i := 1; i <= 1000; i++ {
+		ev = append(ev, event.NewTimerEvent("biased.timer", float64(i), nil))
+	}
+	exporter.NewExporter(testMapper).HandleEvents(ev)
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	var summary *dto.Summary
+	for _, mf := range metrics {
+		if mf.GetName() == "biased_timer" {
+			summary = mf.Metric[0].GetSummary()
+		}
+	}
+	if summary == nil {
+		t.Fatal("Biased timer should be exposed as a summary")
+	}
+	if summary.GetSampleCount() != 1000 || summary.GetSampleSum() != 500500 {
+		t.Fatalf("Expected 1000 observations summing to 500500, got %d and %f", summary.GetSampleCount(), summary.GetSampleSum())
+	}
+	// The error is relative to the distance from the maximum, plus one
+	// rank.
+	want := map[float64]float64{0.5: 500, 0.99: 990}
+	for _, q := range summary.GetQuantile() {
+		w := want[q.GetQuantile()]
+		if got, tolerance := q.GetValue(), (1000-w)*0.02+1; got < w-tolerance || got > w+tolerance {
+			t.Errorf("Quantile %v: expected %f, got %f", q.GetQuantile(), w, got)
+		}
+	}
+}
+
+// TestTimerAggregates validates the StatsD timer aggregates of a flush window.
+func TestTimerAggregates(t *testing.T) {
+	clock.ClockInstance = &clock.Clock{
+		Instant:  time.Unix(0, 0),
+		TickerCh: make(chan time.Time),
+	}
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: db.query
+  name: db_query
+  timer_aggregates: true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan event.Events)
+	done := make(chan struct{})
+	defer func() {
+		// Wait for the final flush, which reads the clock.
+		close(events)
+		<-done
+	}()
 	go func() {
-		ex := NewExporter(testMapper)
+		ex := exporter.NewExporter(testMapper)
 		ex.Listen(events)
+		close(done)
 	}()
 
-	ev := Events{
-		// event with default ttl = 1s
-		&GaugeEvent{
-			metricName: "foobar",
-			value:      200,
-		},
-		// event with ttl = 2s from a mapping
-		&TimerEvent{
-			metricName: "bazqux.main",
-			value:      42,
-		},
+	events <- event.Events{
+		event.NewTimerEvent("db.query", 2, nil),
+		event.NewTimerEvent("db.query", 4, nil),
+		event.NewTimerEvent("db.query", 6, nil),
 	}
+	events <- event.Events{}
+	clock.ClockInstance.Instant = time.Unix(10, 0)
+	clock.ClockInstance.TickerCh <- time.Unix(10, 0)
+	events <- event.Events{}
 
-	var metrics []*dto.MetricFamily
-	var foobarValue *float64
-	var bazquxValue *float64
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+	}
+	for name, want := range map[string]float64{
+		"db_query_min":          2,
+		"db_query_max":          6,
+		"db_query_mean":         4,
+		"db_query_stddev":       math.Sqrt(8.0 / 3),
+		"db_query_window_count": 3,
+	} {
+		value := getFloat64(metrics, name, prometheus.Labels{})
+		if value == nil || math.Abs(*value-want) > 1e-9 {
+			t.Errorf("Expected %s to be %f, got %v", name, want, value)
+		}
+	}
 
-	// Step 1. Send events with statsd metrics.
-	// Send empty Events to wait for events are handled.
-	// saveLabelValues will use fake instant as a lastRegisteredAt time.
-	clock.ClockInstance.Instant = time.Unix(0, 0)
-	events <- ev
-	events <- Events{}
+	// The count drops to 0 in a window without observations.
+	clock.ClockInstance.Instant = time.Unix(20, 0)
+	clock.ClockInstance.TickerCh <- time.Unix(20, 0)
+	events <- event.Events{}
 
-	// Check values
 	metrics, err = prometheus.DefaultGatherer.Gather()
 	if err != nil {
-		t.Fatal("Gather should not fail")
-	}
-	foobarValue = getFloat64(metrics, "foobar", prometheus.Labels{})
-	bazquxValue = getFloat64(metrics, "bazqux", prometheus.Labels{})
-	if foobarValue == nil || bazquxValue == nil {
-		t.Fatalf("Gauge `foobar` and Summary `bazqux` should be gathered")
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
 	}
-	if *foobarValue != 200 {
-		t.Fatalf("Gauge `foobar` observation %f is not expected. Should be 200", *foobarValue)
+	if value := getFloat64(metrics, "db_query_window_count", prometheus.Labels{}); value == nil || *value != 0 {
+		t.Errorf("Expected an empty window to have count 0, got %v", value)
 	}
-	if *bazquxValue != 42 {
-		t.Fatalf("Summary `bazqux` observation %f is not expected. Should be 42", *bazquxValue)
+}
+
+func TestSketchTimer(t *testing.T) {
+	config := `
+defaults:
+  timer_type: sketch
+  quantiles:
+    - quantile: 0.5
+    - quantile: 0.99
+`
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
 	}
 
-	// Step 2. Increase Instant to emulate metrics expiration after 1s
-	clock.ClockInstance.Instant = time.Unix(1, 10)
-	clock.ClockInstance.TickerCh <- time.Unix(0, 0)
-	events <- Events{}
+	events := make(chan event.Events)
+	go func() {
+		ex := exporter.NewExporter(testMapper)
+		ex.Listen(events)
+	}()
 
-	// Check values
-	metrics, err = prometheus.DefaultGatherer.Gather()
+	name := "sketch_timer"
+	ev := event.Events{}
+	for i := 1; i <= 1000; i++ {
+		ev = append(ev, &event.TimerEvent{TMetricName: name, TValue: float64(i), TLabels: map[string]string{}})
+	}
+	events <- ev
+	events <- event.Events{}
+	close(events)
+
+	metrics, err := prometheus.DefaultGatherer.Gather()
 	if err != nil {
-		t.Fatal("Gather should not fail")
+		t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
 	}
-	foobarValue = getFloat64(metrics, "foobar", prometheus.Labels{})
-	bazquxValue = getFloat64(metrics, "bazqux", prometheus.Labels{})
-	if foobarValue != nil {
-		t.Fatalf("Gauge `foobar` should be expired")
+	var summary *dto.Summary
+	for _, mf := range metrics {
+		if mf.GetName() == name {
+			summary = mf.Metric[0].GetSummary()
+		}
 	}
-	if bazquxValue == nil {
-		t.Fatalf("Summary `bazqux` should be gathered")
+	if summary == nil {
+		t.Fatal("Sketch timer should be exposed as a summary")
 	}
-	if *bazquxValue != 42 {
-		t.Fatalf("Summary `bazqux` observation %f is not expected. Should be 42", *bazquxValue)
+	if summary.GetSampleCount() != 1000 {
+		t.Fatalf("Expected 1000 observations, got %d", summary.GetSampleCount())
+	}
+	want := map[float64]float64{0.5: 500, 0.99: 990}
+	for _, q := range summary.GetQuantile() {
+		w := want[q.GetQuantile()]
+		if got := q.GetValue(); got < w*0.99 || got > w*1.01 {
+			t.Errorf("Quantile %v: expected %f within 1%%, got %f", q.GetQuantile(), w, got)
+		}
 	}
+}
 
-	// Step 3. Increase Instant to emulate metrics expiration after 2s
-	clock.ClockInstance.Instant = time.Unix(2, 200)
-	clock.ClockInstance.TickerCh <- time.Unix(0, 0)
-	events <- Events{}
+// getFloat64 search for metric by name in array of MetricFamily and then search a value by labels.
+// Method returns a value or nil if metric is not found.
+func TestPreBucketedHistograms(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: request.latency
+  name: request_latency_seconds
+  timer_type: histogram
+  buckets: [0.001, 0.005, 0.01]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(reg))
+	// Buckets of 2ms merge into the 5ms bucket of the mapping. One
+	// observation is above the highest bucket.
+	ex.HandleEvents(event.Events{
+		event.NewHistogramEvent("request.latency", map[float64]uint64{1: 5, 2: 1, 5: 2}, 42, 9, nil),
+		event.NewHistogramEvent("request.latency", map[float64]uint64{1: 1}, 0.5, 1, nil),
+		event.NewTimerEvent("request.latency", 8, nil),
+	})
 
-	// Check values
-	metrics, err = prometheus.DefaultGatherer.Gather()
+	metrics, err := reg.Gather()
 	if err != nil {
-		t.Fatal("Gather should not fail")
+		t.Fatalf("Cannot gather from registry: %v", err)
 	}
-	foobarValue = getFloat64(metrics, "foobar", prometheus.Labels{})
-	bazquxValue = getFloat64(metrics, "bazqux", prometheus.Labels{})
-	if bazquxValue != nil {
-		t.Fatalf("Summary `bazqux` should be expired")
+	if len(metrics) != 1 || len(metrics[0].Metric) != 1 {
+		t.Fatalf("Expected a single histogram, got %v", metrics)
 	}
-	if foobarValue != nil {
-		t.Fatalf("Gauge `foobar` should not be gathered after expiration")
+	h := metrics[0].Metric[0].GetHistogram()
+	if h.GetSampleCount() != 11 {
+		t.Errorf("Expected a count of 11, got %d", h.GetSampleCount())
+	}
+	if sum := h.GetSampleSum(); math.Abs(sum-0.0505) > 1e-9 {
+		t.Errorf("Expected a sum of 0.0505, got %v", sum)
+	}
+	want := map[float64]uint64{0.001: 6, 0.005: 9, 0.01: 10}
+	for _, b := range h.GetBucket() {
+		if b.GetCumulativeCount() != want[b.GetUpperBound()] {
+			t.Errorf("Expected bucket %v to be %d, got %d", b.GetUpperBound(), want[b.GetUpperBound()], b.GetCumulativeCount())
+		}
 	}
 }
 
-// getFloat64 search for metric by name in array of MetricFamily and then search a value by labels.
-// Method returns a value or nil if metric is not found.
 func getFloat64(metrics []*dto.MetricFamily, name string, labels prometheus.Labels) *float64 {
 	var metricFamily *dto.MetricFamily
 	for _, m := range metrics {
@@ -305,9 +1791,9 @@ func getFloat64(metrics []*dto.MetricFamily, name string, labels prometheus.Labe
 	}
 
 	var metric *dto.Metric
-	labelsHash := hashNameAndLabels(name, labels)
+	labelsHash := model.LabelsToSignature(labels)
 	for _, m := range metricFamily.Metric {
-		h := hashNameAndLabels(name, labelPairsAsLabels(m.GetLabel()))
+		h := model.LabelsToSignature(labelPairsAsLabels(m.GetLabel()))
 		if h == labelsHash {
 			metric = m
 			break
@@ -355,3 +1841,368 @@ func labelPairsAsLabels(pairs []*dto.LabelPair) (labels prometheus.Labels) {
 	}
 	return
 }
+
+func TestExactSets(t *testing.T) {
+	clock.ClockInstance = &clock.Clock{
+		Instant:  time.Unix(0, 0),
+		TickerCh: make(chan time.Time),
+	}
+	defer func() { clock.ClockInstance = nil }()
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: errors.distinct
+  name: errors_distinct
+  set_window: 10s
+  set_max_elements: 2
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan event.Events)
+	done := make(chan struct{})
+	defer func() {
+		close(events)
+		<-done
+	}()
+	go func() {
+		ex := exporter.NewExporter(testMapper)
+		ex.Listen(events)
+		close(done)
+	}()
+
+	assertCount := func(want float64) {
+		t.Helper()
+		metrics, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatalf("Cannot gather from DefaultGatherer: %v", err)
+		}
+		value := getFloat64(metrics, "errors_distinct", prometheus.Labels{})
+		if value == nil || *value != want {
+			t.Errorf("Expected errors_distinct to be %v, got %v", want, value)
+		}
+	}
+
+	// The third distinct element exceeds the limit and is dropped.
+	events <- event.Events{
+		event.NewSetEvent("errors.distinct", "E404", nil),
+		event.NewSetEvent("errors.distinct", "E500", nil),
+		event.NewSetEvent("errors.distinct", "E404", nil),
+		event.NewSetEvent("errors.distinct", "E503", nil),
+	}
+	events <- event.Events{}
+	assertCount(2)
+
+	clock.ClockInstance.Instant = time.Unix(8, 0)
+	events <- event.Events{event.NewSetEvent("errors.distinct", "E500", nil)}
+	events <- event.Events{}
+	assertCount(2)
+
+	// E404 falls out of the window, E500 was seen again since.
+	clock.ClockInstance.Instant = time.Unix(12, 0)
+	clock.ClockInstance.TickerCh <- time.Unix(12, 0)
+	events <- event.Events{}
+	assertCount(1)
+
+	clock.ClockInstance.Instant = time.Unix(20, 0)
+	clock.ClockInstance.TickerCh <- time.Unix(20, 0)
+	events <- event.Events{}
+	assertCount(0)
+}
+
+// collectingRegisterer records the collectors registered with it, so that a
+// test can collect them itself.
+type collectingRegisterer struct {
+	*prometheus.Registry
+	collectors []prometheus.Collector
+}
+
+func (r *collectingRegisterer) Register(c prometheus.Collector) error {
+	r.collectors = append(r.collectors, c)
+	return r.Registry.Register(c)
+}
+
+// TestScrapeDoesNotStallIngestion validates that a scrape that is slow to
+// consume the metrics of a summary does not block its observations.
+func TestScrapeDoesNotStallIngestion(t *testing.T) {
+	config := `
+mappings:
+- match: biased.timer
+  name: biased_timer
+  quantile_algorithm: biased
+- match: sketch.timer
+  name: sketch_timer
+  timer_type: sketch
+`
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	registerer := &collectingRegisterer{Registry: prometheus.NewRegistry()}
+	ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(registerer))
+
+	for _, name := range []string{"biased.timer", "sketch.timer"} {
+		ex.HandleEvents(event.Events{
+			event.NewTimerEvent(name, 1, map[string]string{"series": "a"}),
+			event.NewTimerEvent(name, 1, map[string]string{"series": "b"}),
+		})
+	}
+	if len(registerer.collectors) != 2 {
+		t.Fatalf("Expected 2 collectors to be registered, got %d", len(registerer.collectors))
+	}
+
+	for _, c := range registerer.collectors {
+		// Nobody reads the metrics, so the collection blocks sending the
+		// first one.
+		go c.Collect(make(chan prometheus.Metric))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		for _, name := range []string{"biased.timer", "sketch.timer"} {
+			ex.HandleEvents(event.Events{
+				event.NewTimerEvent(name, 2, map[string]string{"series": "a"}),
+				event.NewTimerEvent(name, 2, map[string]string{"series": "b"}),
+			})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Observations were blocked by a collection in progress")
+	}
+}
+
+// TestScrapeActions validates that series with a scrape action are deleted or
+// reset after a successful scrape, and kept after a failed one.
+func TestScrapeActions(t *testing.T) {
+	config := `
+mappings:
+- match: deleted.*
+  name: deleted
+  scrape_action: delete
+  labels:
+    job: $1
+- match: zeroed.*
+  name: zeroed
+  scrape_action: zero
+  labels:
+    job: $1
+`
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(reg))
+	ex.HandleEvents(event.Events{
+		&event.CounterEvent{CMetricName: "deleted.a", CValue: 3, CLabels: map[string]string{}},
+		&event.GaugeEvent{GMetricName: "zeroed.a", GValue: 5, GLabels: map[string]string{}},
+		&event.CounterEvent{CMetricName: "kept", CValue: 1, CLabels: map[string]string{}},
+	})
+
+	gather := func() []*dto.MetricFamily {
+		metrics, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather should not fail: %v", err)
+		}
+		return metrics
+	}
+	failed := func() ([]*dto.MetricFamily, error) { return nil, fmt.Errorf("gather failed") }
+	scrape := func(g prometheus.Gatherer) {
+		scrapes := &scrapeActions{exporters: []*exporter.Exporter{ex}}
+		rec := httptest.NewRecorder()
+		scrapes.handler(gathererHandler(g)).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	}
+
+	scrape(prometheus.GathererFunc(failed))
+	metrics := gather()
+	if value := getFloat64(metrics, "deleted", prometheus.Labels{"job": "a"}); value == nil || *value != 3 {
+		t.Fatalf("Expected deleted to be kept at 3 after a failed scrape, got %v", value)
+	}
+
+	scrape(reg)
+	metrics = gather()
+	if value := getFloat64(metrics, "deleted", prometheus.Labels{"job": "a"}); value != nil {
+		t.Fatalf("Expected deleted to be deleted after a scrape, got %v", *value)
+	}
+	if value := getFloat64(metrics, "zeroed", prometheus.Labels{"job": "a"}); value == nil || *value != 0 {
+		t.Fatalf("Expected zeroed to be reset after a scrape, got %v", value)
+	}
+	if value := getFloat64(metrics, "kept", prometheus.Labels{}); value == nil || *value != 1 {
+		t.Fatalf("Expected kept to be kept at 1 after a scrape, got %v", value)
+	}
+
+	ex.HandleEvents(event.Events{&event.CounterEvent{CMetricName: "deleted.a", CValue: 2, CLabels: map[string]string{}}})
+	metrics = gather()
+	if value := getFloat64(metrics, "deleted", prometheus.Labels{"job": "a"}); value == nil || *value != 2 {
+		t.Fatalf("Expected deleted to restart at 2, got %v", value)
+	}
+}
+
+// TestValueRange validates that values out of the range of their mapping are
+// clamped or dropped.
+func TestValueRange(t *testing.T) {
+	config := `
+mappings:
+- match: clamped.timer
+  name: clamped_timer
+  timer_type: histogram
+  min_value: 0
+  max_value: 60000
+- match: dropped.gauge
+  name: dropped_gauge
+  max_value: 100
+  out_of_range: drop
+`
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(reg))
+	ex.HandleEvents(event.Events{
+		event.NewTimerEvent("clamped.timer", -5, nil),
+		event.NewTimerEvent("clamped.timer", 1e9, nil),
+		event.NewTimerEvent("clamped.timer", 500, nil),
+		event.NewGaugeEvent("dropped.gauge", 50, false, nil),
+		event.NewGaugeEvent("dropped.gauge", 1e12, false, nil),
+		event.NewGaugeEvent("dropped.gauge", 100, true, nil),
+	})
+
+	metrics, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather should not fail: %v", err)
+	}
+	// The sum of 0, 60 and 0.5 seconds.
+	if value := getFloat64(metrics, "clamped_timer", prometheus.Labels{}); value == nil || *value != 60.5 {
+		t.Errorf("Expected clamped_timer to sum up to 60.5, got %v", value)
+	}
+	// Relative gauge updates are not bounded.
+	if value := getFloat64(metrics, "dropped_gauge", prometheus.Labels{}); value == nil || *value != 150 {
+		t.Errorf("Expected dropped_gauge to be 150, got %v", value)
+	}
+}
+
+// TestRoundValues validates that values are rounded to the round_to of their
+// mapping without leaving float noise in value labels.
+func TestRoundValues(t *testing.T) {
+	config := `
+mappings:
+- match: rounded.status
+  name: rounded_status_total
+  value_label: status
+  round_to: 0.1
+- match: rounded.gauge
+  name: rounded_gauge
+  round_to: 25
+`
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(reg))
+	ex.HandleEvents(event.Events{
+		event.NewGaugeEvent("rounded.status", 0.1+0.2, false, nil),
+		event.NewGaugeEvent("rounded.status", 0.31, false, nil),
+		event.NewGaugeEvent("rounded.gauge", 62, false, nil),
+	})
+
+	metrics, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather should not fail: %v", err)
+	}
+	if value := getFloat64(metrics, "rounded_status_total", prometheus.Labels{"status": "0.3"}); value == nil || *value != 2 {
+		t.Errorf("Expected rounded_status_total{status=\"0.3\"} to be 2, got %v", value)
+	}
+	if value := getFloat64(metrics, "rounded_gauge", prometheus.Labels{}); value == nil || *value != 50 {
+		t.Errorf("Expected rounded_gauge to be 50, got %v", value)
+	}
+}
+
+// TestFanOutMapping validates that a mapping with outputs records every event
+// as all of its metrics.
+func TestFanOutMapping(t *testing.T) {
+	config := `
+mappings:
+- match: api.*.duration
+  name: fanout_duration_seconds
+  timer_type: histogram
+  labels:
+    endpoint: $1
+  outputs:
+  - name: fanout_requests_total
+    count: true
+  - name: fanout_duration_by_source_seconds
+    labels:
+      endpoint: $1
+      source: fanout
+`
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(reg))
+	ex.HandleEvents(event.Events{
+		event.NewTimerEvent("api.users.duration", 200, map[string]string{"region": "eu"}),
+		event.NewTimerEvent("api.users.duration", 300, map[string]string{"region": "eu"}),
+	})
+
+	metrics, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather should not fail: %v", err)
+	}
+	if value := getFloat64(metrics, "fanout_duration_seconds", prometheus.Labels{"endpoint": "users", "region": "eu"}); value == nil || *value != 0.5 {
+		t.Errorf("Expected fanout_duration_seconds to sum up to 0.5, got %v", value)
+	}
+	if value := getFloat64(metrics, "fanout_requests_total", prometheus.Labels{"endpoint": "users", "region": "eu"}); value == nil || *value != 2 {
+		t.Errorf("Expected fanout_requests_total to be 2, got %v", value)
+	}
+	if value := getFloat64(metrics, "fanout_duration_by_source_seconds", prometheus.Labels{"endpoint": "users", "region": "eu", "source": "fanout"}); value == nil || *value != 0.5 {
+		t.Errorf("Expected fanout_duration_by_source_seconds to sum up to 0.5, got %v", value)
+	}
+}
+
+func TestRelabeling(t *testing.T) {
+	config := `
+mappings:
+- match: relabel.*.requests
+  name: relabel_requests_total
+  labels:
+    endpoint: $1
+relabel_configs:
+- source_labels: [endpoint]
+  regex: healthcheck
+  action: drop
+- source_labels: [__name__, region]
+  regex: (.*)_total;(.*)
+  target_label: __name__
+  replacement: ${1}_${2}_total
+`
+	testMapper := &mapper.MetricMapper{}
+	if err := testMapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s %s", config, err)
+	}
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(reg))
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("relabel.users.requests", 2, map[string]string{"region": "eu"}),
+		event.NewCounterEvent("relabel.healthcheck.requests", 1, map[string]string{"region": "eu"}),
+	})
+
+	metrics, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather should not fail: %v", err)
+	}
+	if value := getFloat64(metrics, "relabel_requests_eu_total", prometheus.Labels{"endpoint": "users", "region": "eu"}); value == nil || *value != 2 {
+		t.Errorf("Expected relabel_requests_eu_total to be 2, got %v", value)
+	}
+	if value := getFloat64(metrics, "relabel_requests_eu_total", prometheus.Labels{"endpoint": "healthcheck", "region": "eu"}); value != nil {
+		t.Errorf("Expected the healthcheck series to be dropped, got %v", *value)
+	}
+}
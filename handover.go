@@ -0,0 +1,227 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/common/log"
+)
+
+// handoverEnv lists the sockets a process hands over to the process
+// replacing it, as network/address=fd pairs separated by commas.
+const handoverEnv = "STATSD_EXPORTER_HANDOVER_FDS"
+
+// handoverReadyEnv is the file descriptor of the pipe a process that was
+// handed sockets over reports its readiness on.
+const handoverReadyEnv = "STATSD_EXPORTER_HANDOVER_READY"
+
+type handoverHook struct {
+	before, failed func()
+}
+
+var (
+	handoverMtx   sync.Mutex
+	handoverHooks []handoverHook
+)
+
+// onHandOver registers before to be run before the sockets are handed over
+// to a new process, and failed to be run if that process did not become
+// ready, in which case this process carries on.
+func onHandOver(before, failed func()) {
+	handoverMtx.Lock()
+	defer handoverMtx.Unlock()
+	handoverHooks = append(handoverHooks, handoverHook{before: before, failed: failed})
+}
+
+func runHandoverHooks(failed bool) {
+	handoverMtx.Lock()
+	defer handoverMtx.Unlock()
+	for _, h := range handoverHooks {
+		if failed {
+			h.failed()
+		} else {
+			h.before()
+		}
+	}
+}
+
+// fileSocket is a socket whose file descriptor can be handed over.
+type fileSocket interface {
+	File() (*os.File, error)
+}
+
+type handoverSocket struct {
+	key    string
+	socket fileSocket
+}
+
+// sockets opens the sockets the exporter listens on, taking over those
+// handed over by the process it replaces, if any, and keeps them to hand
+// them over in turn. Sockets are identified by their network and address as
+// configured, so that a socket is only taken over if its address did not
+// change.
+type sockets struct {
+	mtx       sync.Mutex
+	inherited map[string]uintptr
+	open      []handoverSocket
+
+	// readyPipe reports the readiness of this process to the process that
+	// handed the sockets over, if any.
+	readyPipe *os.File
+}
+
+// newSockets returns sockets taking over the sockets listed in the
+// environment.
+func newSockets() (*sockets, error) {
+	s := &sockets{inherited: map[string]uintptr{}}
+	if ready := os.Getenv(handoverReadyEnv); ready != "" {
+		os.Unsetenv(handoverReadyEnv)
+		fd, err := strconv.ParseUint(ready, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor %q in %s", ready, handoverReadyEnv)
+		}
+		s.readyPipe = os.NewFile(uintptr(fd), "ready")
+	}
+	fds := os.Getenv(handoverEnv)
+	os.Unsetenv(handoverEnv)
+	if fds == "" {
+		return s, nil
+	}
+	for _, pair := range strings.Split(fds, ",") {
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid socket %q in %s", pair, handoverEnv)
+		}
+		fd, err := strconv.ParseUint(pair[i+1:], 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor of socket %q in %s", pair, handoverEnv)
+		}
+		s.inherited[pair[:i]] = uintptr(fd)
+	}
+	return s, nil
+}
+
+// take returns the file of the handed over socket with the given key, if
+// any.
+func (s *sockets) take(key string) *os.File {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	fd, ok := s.inherited[key]
+	if !ok {
+		return nil
+	}
+	delete(s.inherited, key)
+	return os.NewFile(fd, key)
+}
+
+// ready tells the process that handed the sockets over, if any, that this
+// process is fully set up, so that it can exit.
+func (s *sockets) ready() {
+	if s.readyPipe == nil {
+		return
+	}
+	if _, err := s.readyPipe.Write([]byte{1}); err != nil {
+		log.Errorln("Error reporting readiness to the previous process:", err)
+	}
+	s.readyPipe.Close()
+	s.readyPipe = nil
+}
+
+func (s *sockets) keep(key string, socket fileSocket) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.open = append(s.open, handoverSocket{key: key, socket: socket})
+}
+
+// listenUDP listens on the UDP address, as given by the flag addr.
+func (s *sockets) listenUDP(addr string) (*net.UDPConn, error) {
+	key := "udp/" + addr
+	var conn *net.UDPConn
+	if f := s.take(key); f != nil {
+		c, err := net.FilePacketConn(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error taking over socket %s: %v", key, err)
+		}
+		udp, ok := c.(*net.UDPConn)
+		if !ok {
+			c.Close()
+			return nil, fmt.Errorf("socket %s handed over is not a UDP socket", key)
+		}
+		conn = udp
+	} else {
+		udp, err := net.ListenUDP("udp", udpAddrFromString(addr))
+		if err != nil {
+			return nil, err
+		}
+		conn = udp
+	}
+	s.keep(key, conn)
+	return conn, nil
+}
+
+// listenTCP listens on the TCP address, as given by the flag addr.
+func (s *sockets) listenTCP(addr string) (*net.TCPListener, error) {
+	key := "tcp/" + addr
+	var listener *net.TCPListener
+	if f := s.take(key); f != nil {
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error taking over socket %s: %v", key, err)
+		}
+		tcp, ok := l.(*net.TCPListener)
+		if !ok {
+			l.Close()
+			return nil, fmt.Errorf("socket %s handed over is not a TCP socket", key)
+		}
+		listener = tcp
+	} else {
+		tcp, err := net.ListenTCP("tcp", tcpAddrFromString(addr))
+		if err != nil {
+			return nil, err
+		}
+		listener = tcp
+	}
+	s.keep(key, listener)
+	return listener, nil
+}
+
+// handoverFiles returns the files of the open sockets, to be passed to a
+// new process starting at the given file descriptor, and the value of
+// handoverEnv listing them.
+func (s *sockets) handoverFiles(firstFd int) ([]*os.File, string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	files := make([]*os.File, 0, len(s.open))
+	pairs := make([]string, 0, len(s.open))
+	for i, socket := range s.open {
+		f, err := socket.socket.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, "", fmt.Errorf("error handing over socket %s: %v", socket.key, err)
+		}
+		files = append(files, f)
+		pairs = append(pairs, fmt.Sprintf("%s=%d", socket.key, firstFd+i))
+	}
+	return files, strings.Join(pairs, ","), nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestSocketsHandover(t *testing.T) {
+	old := &sockets{inherited: map[string]uintptr{}}
+	uconn, err := old.listenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uconn.Close()
+	tl, err := old.listenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+
+	files, fds, err := old.handoverFiles(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	if want := "udp/127.0.0.1:0=3,tcp/127.0.0.1:0=4"; fds != want {
+		t.Fatalf("expected %q, got %q", want, fds)
+	}
+
+	// Hand the descriptors over within this process, duplicating them as
+	// the sockets taken over are owned by the new sockets.
+	fd := make([]int, len(files))
+	for i, f := range files {
+		if fd[i], err = syscall.Dup(int(f.Fd())); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	os.Setenv(handoverEnv, fmt.Sprintf("udp/127.0.0.1:0=%d,tcp/127.0.0.1:0=%d", fd[0], fd[1]))
+	s, err := newSockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := os.Getenv(handoverEnv); v != "" {
+		t.Fatalf("expected %s to be unset, got %q", handoverEnv, v)
+	}
+
+	nuconn, err := s.listenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nuconn.Close()
+	if nuconn.LocalAddr().String() != uconn.LocalAddr().String() {
+		t.Fatalf("expected UDP socket on %s, got %s", uconn.LocalAddr(), nuconn.LocalAddr())
+	}
+	ntl, err := s.listenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ntl.Close()
+	if ntl.Addr().String() != tl.Addr().String() {
+		t.Fatalf("expected TCP socket on %s, got %s", tl.Addr(), ntl.Addr())
+	}
+
+	// Datagrams sent to the old address are received on the new socket.
+	c, err := net.Dial("udp", uconn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	uconn.Close()
+	if _, err := c.Write([]byte("foo:1|c")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, _, err := nuconn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "foo:1|c" {
+		t.Fatalf("unexpected datagram %q", buf[:n])
+	}
+}
+
+func TestSocketsReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	os.Setenv(handoverReadyEnv, fmt.Sprint(fd))
+	s, err := newSockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := os.Getenv(handoverReadyEnv); v != "" {
+		t.Fatalf("expected %s to be unset, got %q", handoverReadyEnv, v)
+	}
+	s.ready()
+	// Readiness is reported once, and the pipe is closed afterwards.
+	s.ready()
+
+	buf := make([]byte, 2)
+	if n, err := r.Read(buf); err != nil || n != 1 {
+		t.Fatalf("expected readiness to be reported, got %d bytes, error %v", n, err)
+	}
+	if _, err := r.Read(buf); err != io.EOF {
+		t.Fatalf("expected the pipe to be closed, got %v", err)
+	}
+}
+
+func TestSocketsInvalidEnv(t *testing.T) {
+	for _, v := range []string{"udp/:9125", "udp/:9125=x"} {
+		os.Setenv(handoverEnv, v)
+		if _, err := newSockets(); err == nil {
+			t.Errorf("expected error for %q", v)
+		}
+	}
+	os.Unsetenv(handoverEnv)
+
+	os.Setenv(handoverReadyEnv, "x")
+	if _, err := newSockets(); err == nil {
+		t.Errorf("expected error for invalid %s", handoverReadyEnv)
+	}
+	os.Unsetenv(handoverReadyEnv)
+}
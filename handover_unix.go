@@ -0,0 +1,116 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// handoverTimeout is how long a new process has to become ready before the
+// handover is given up.
+const handoverTimeout = time.Minute
+
+// handOverOnSignal starts a new process of the same executable with the same
+// arguments on SIGUSR2, hands the sockets over to it, and once it is ready,
+// shuts this process down like SIGTERM does. Datagrams arriving meanwhile
+// wait in the buffers of the sockets, so the exporter can be upgraded without
+// dropping any. If the new process fails to start, this one carries on.
+func (s *sockets) handOverOnSignal() {
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+	for range usr2 {
+		runHandoverHooks(false)
+		pid, err := s.handOver()
+		if err != nil {
+			log.Errorln("Error handing over sockets:", err)
+			runHandoverHooks(true)
+			continue
+		}
+		shutdown(fmt.Sprintf("Handed over sockets to process %d", pid))
+	}
+}
+
+// handOver starts the new process and waits for it to report its readiness.
+func (s *sockets) handOver() (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	stdio := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	files, fds, err := s.handoverFiles(len(stdio))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer readyR.Close()
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, handoverEnv+"=") && !strings.HasPrefix(kv, handoverReadyEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env,
+		handoverEnv+"="+fds,
+		fmt.Sprintf("%s=%d", handoverReadyEnv, len(stdio)+len(files)),
+	)
+
+	p, err := os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: append(append(stdio, files...), readyW),
+	})
+	// Only the new process may hold the write end, so that reading fails
+	// once it exits.
+	readyW.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			p.Wait()
+			return 0, fmt.Errorf("process %d exited before becoming ready", p.Pid)
+		}
+	case <-time.After(handoverTimeout):
+		p.Kill()
+		p.Wait()
+		return 0, fmt.Errorf("process %d did not become ready within %v", p.Pid, handoverTimeout)
+	}
+	pid := p.Pid
+	return pid, p.Release()
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// instrumentHandler tracks the requests of h being served, and the duration
+// and response size of every request, with the given handler label.
+func instrumentHandler(handler string, h http.Handler) http.Handler {
+	inFlight := httpRequestsInFlight.WithLabelValues(handler)
+	size := httpResponseSize.WithLabelValues(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		sw := &sizeWriter{statusWriter: statusWriter{ResponseWriter: w, status: http.StatusOK}}
+		h.ServeHTTP(sw, r)
+		httpRequestDuration.WithLabelValues(handler, strconv.Itoa(sw.status)).Observe(time.Since(start).Seconds())
+		size.Observe(float64(sw.size))
+	})
+}
+
+// sizeWriter records the status and size of a response.
+type sizeWriter struct {
+	statusWriter
+	size int
+}
+
+func (w *sizeWriter) Write(b []byte) (int, error) {
+	n, err := w.statusWriter.Write(b)
+	w.size += n
+	return n, err
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	var inFlight *float64
+	h := instrumentHandler("/instrumented", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		inFlight = getFloat64(metrics, "statsd_exporter_http_requests_in_flight", prometheus.Labels{"handler": "/instrumented"})
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unavailable"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/instrumented", nil))
+
+	if inFlight == nil || *inFlight != 1 {
+		t.Errorf("Expected 1 request in flight while serving, got %v", inFlight)
+	}
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := getFloat64(metrics, "statsd_exporter_http_requests_in_flight", prometheus.Labels{"handler": "/instrumented"}); value == nil || *value != 0 {
+		t.Errorf("Expected no request in flight after serving, got %v", value)
+	}
+	if value := getFloat64(metrics, "statsd_exporter_http_response_size_bytes", prometheus.Labels{"handler": "/instrumented"}); value == nil || *value != float64(len("unavailable")) {
+		t.Errorf("Expected a response size of %d, got %v", len("unavailable"), value)
+	}
+	if value := getFloat64(metrics, "statsd_exporter_http_request_duration_seconds", prometheus.Labels{"handler": "/instrumented", "code": "503"}); value == nil {
+		t.Errorf("Expected the duration of the request to be observed with its status")
+	}
+}
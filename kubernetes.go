@@ -0,0 +1,213 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	podLabelName        = "pod"
+	namespaceLabelName  = "namespace"
+	deploymentLabelName = "deployment"
+)
+
+// podList is the subset of the Kubernetes PodList resource we need.
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name            string            `json:"name"`
+			Namespace       string            `json:"namespace"`
+			Labels          map[string]string `json:"labels"`
+			OwnerReferences []struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"ownerReferences"`
+		} `json:"metadata"`
+		Spec struct {
+			HostNetwork bool `json:"hostNetwork"`
+		} `json:"spec"`
+		Status struct {
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// podLabeler maps the source address of incoming events to labels describing
+// the Kubernetes pod that sent them. The pod list is refreshed periodically
+// from the Kubernetes API.
+type podLabeler struct {
+	client    *http.Client
+	podsURL   string
+	tokenFile string
+	nodeName  string
+
+	mtx  sync.RWMutex
+	pods map[string]map[string]string // pod IP -> labels
+}
+
+// newInClusterPodLabeler creates a podLabeler that talks to the API server
+// using the service account credentials mounted into the pod. If nodeName is
+// set, only pods scheduled on that node are considered.
+func newInClusterPodLabeler(nodeName string) (*podLabeler, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+	tokenFile := serviceAccountDir + "/token"
+	if _, err := ioutil.ReadFile(tokenFile); err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s/ca.crt", serviceAccountDir)
+	}
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+	return newPodLabeler(client, "https://"+net.JoinHostPort(host, port), tokenFile, nodeName), nil
+}
+
+// newPodLabeler creates a podLabeler authenticating with the bearer token in
+// tokenFile, if set.
+func newPodLabeler(client *http.Client, apiServer, tokenFile, nodeName string) *podLabeler {
+	return &podLabeler{
+		client:    client,
+		podsURL:   strings.TrimSuffix(apiServer, "/") + "/api/v1/pods",
+		tokenFile: tokenFile,
+		nodeName:  nodeName,
+		pods:      map[string]map[string]string{},
+	}
+}
+
+// Run refreshes the pod list every interval. It never returns.
+func (p *podLabeler) Run(interval time.Duration) {
+	for {
+		if err := p.refresh(); err != nil {
+			log.Errorln("Error refreshing Kubernetes pods:", err)
+			kubernetesRefreshes.WithLabelValues("failure").Inc()
+		} else {
+			kubernetesRefreshes.WithLabelValues("success").Inc()
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (p *podLabeler) refresh() error {
+	selector := "status.phase=Running"
+	if p.nodeName != "" {
+		selector += ",spec.nodeName=" + p.nodeName
+	}
+	req, err := http.NewRequest("GET", p.podsURL+"?fieldSelector="+url.QueryEscape(selector), nil)
+	if err != nil {
+		return err
+	}
+	if p.tokenFile != "" {
+		// Projected service account tokens are rotated and expire, so the
+		// token is read again for every request.
+		token, err := ioutil.ReadFile(p.tokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status listing pods: %s", resp.Status)
+	}
+
+	var list podList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return err
+	}
+
+	pods := make(map[string]map[string]string, len(list.Items))
+	for _, pod := range list.Items {
+		// Pods in the host network share the node's address and cannot be
+		// told apart.
+		if pod.Spec.HostNetwork || pod.Status.PodIP == "" {
+			continue
+		}
+		labels := map[string]string{
+			podLabelName:       pod.Metadata.Name,
+			namespaceLabelName: pod.Metadata.Namespace,
+		}
+		// Deployments own pods through a ReplicaSet named after the
+		// deployment and the pod template hash.
+		for _, owner := range pod.Metadata.OwnerReferences {
+			hash, ok := pod.Metadata.Labels["pod-template-hash"]
+			if owner.Kind == "ReplicaSet" && ok {
+				labels[deploymentLabelName] = strings.TrimSuffix(owner.Name, "-"+hash)
+			}
+		}
+		pods[pod.Status.PodIP] = labels
+	}
+
+	p.mtx.Lock()
+	p.pods = pods
+	p.mtx.Unlock()
+	return nil
+}
+
+// LabelEvents adds the labels of the pod with the given IP to all events,
+// leaving tags sent by the client untouched. It is a no-op on a nil
+// podLabeler or for unknown addresses.
+func (p *podLabeler) LabelEvents(events event.Events, src net.IP) event.Events {
+	if p == nil || src == nil {
+		return events
+	}
+	p.mtx.RLock()
+	podLabels, ok := p.pods[src.String()]
+	p.mtx.RUnlock()
+	if !ok {
+		return events
+	}
+	for _, e := range events {
+		labels := e.Labels()
+		for k, v := range podLabels {
+			if _, ok := labels[k]; !ok {
+				labels[k] = v
+			}
+		}
+	}
+	return events
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+const testPodList = `{
+  "kind": "PodList",
+  "items": [
+    {
+      "metadata": {
+        "name": "web-5d8f6c7b9-x2k4p",
+        "namespace": "shop",
+        "labels": {"app": "web", "pod-template-hash": "5d8f6c7b9"},
+        "ownerReferences": [{"kind": "ReplicaSet", "name": "web-5d8f6c7b9"}]
+      },
+      "spec": {},
+      "status": {"podIP": "10.0.0.5"}
+    },
+    {
+      "metadata": {
+        "name": "db-0",
+        "namespace": "shop",
+        "ownerReferences": [{"kind": "StatefulSet", "name": "db"}]
+      },
+      "spec": {},
+      "status": {"podIP": "10.0.0.6"}
+    },
+    {
+      "metadata": {"name": "node-agent", "namespace": "kube-system"},
+      "spec": {"hostNetwork": true},
+      "status": {"podIP": "192.168.1.10"}
+    }
+  ]
+}`
+
+func TestPodLabeler(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		token = "secret"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		want := "Bearer " + token
+		mtx.Unlock()
+		if got := r.Header.Get("Authorization"); got != want {
+			t.Errorf("unexpected authorization header %q, want %q", got, want)
+		}
+		if got, want := r.URL.Query().Get("fieldSelector"), "status.phase=Running,spec.nodeName=node1"; got != want {
+			t.Errorf("unexpected field selector %q, want %q", got, want)
+		}
+		w.Write([]byte(testPodList))
+	}))
+	defer server.Close()
+
+	tokenFile, err := ioutil.TempFile("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tokenFile.Name())
+	if _, err := tokenFile.WriteString("secret\n"); err != nil {
+		t.Fatal(err)
+	}
+	tokenFile.Close()
+
+	pl := newPodLabeler(server.Client(), server.URL, tokenFile.Name(), "node1")
+	if err := pl.refresh(); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	// A rotated token is picked up by the next refresh.
+	mtx.Lock()
+	token = "rotated"
+	mtx.Unlock()
+	if err := ioutil.WriteFile(tokenFile.Name(), []byte("rotated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.refresh(); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	scenarios := []struct {
+		src  string
+		tags map[string]string
+		want map[string]string
+	}{
+		{
+			src:  "10.0.0.5",
+			tags: map[string]string{},
+			want: map[string]string{"pod": "web-5d8f6c7b9-x2k4p", "namespace": "shop", "deployment": "web"},
+		}, {
+			src:  "10.0.0.6",
+			tags: map[string]string{},
+			want: map[string]string{"pod": "db-0", "namespace": "shop"},
+		}, {
+			src:  "10.0.0.5",
+			tags: map[string]string{"namespace": "from-client"},
+			want: map[string]string{"pod": "web-5d8f6c7b9-x2k4p", "namespace": "from-client", "deployment": "web"},
+		}, {
+			src:  "192.168.1.10",
+			tags: map[string]string{},
+			want: map[string]string{},
+		}, {
+			src:  "10.0.0.99",
+			tags: map[string]string{},
+			want: map[string]string{},
+		},
+	}
+
+	for i, scenario := range scenarios {
+		events := pl.LabelEvents(event.Events{&event.CounterEvent{CMetricName: "foo", CValue: 1, CLabels: scenario.tags}}, net.ParseIP(scenario.src))
+		if got := events[0].Labels(); !reflect.DeepEqual(got, scenario.want) {
+			t.Errorf("%d. expected labels %v, got %v", i, scenario.want, got)
+		}
+	}
+
+	var nilLabeler *podLabeler
+	events := nilLabeler.LabelEvents(event.Events{&event.CounterEvent{CMetricName: "foo", CValue: 1, CLabels: map[string]string{}}}, net.ParseIP("10.0.0.5"))
+	if len(events[0].Labels()) != 0 {
+		t.Errorf("nil podLabeler should not add labels, got %v", events[0].Labels())
+	}
+}
@@ -15,37 +15,42 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/howeyc/fsnotify"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/version"
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/prometheus/statsd_exporter/pkg/cluster"
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+	"github.com/prometheus/statsd_exporter/pkg/listener"
 	"github.com/prometheus/statsd_exporter/pkg/mapper"
+	"github.com/prometheus/statsd_exporter/pkg/spill"
+	"github.com/prometheus/statsd_exporter/pkg/tenant"
 )
 
 func init() {
 	prometheus.MustRegister(version.NewCollector("statsd_exporter"))
 }
 
-func serveHTTP(listenAddress, metricsEndpoint string) {
-	//lint:ignore SA1019 prometheus.Handler() is deprecated.
-	http.Handle(metricsEndpoint, prometheus.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-			<head><title>StatsD Exporter</title></head>
-			<body>
-			<h1>StatsD Exporter</h1>
-			<p><a href="` + metricsEndpoint + `">Metrics</a></p>
-			</body>
-			</html>`))
-	})
-	log.Fatal(http.ListenAndServe(listenAddress, nil))
+// serveHTTP serves the metrics, and the admin endpoints unless they have a
+// listener of their own.
+func serveHTTP(l net.Listener, mux *serveMux) {
+	log.Fatal(http.Serve(l, mux))
 }
 
 func ipPortFromString(addr string) (*net.IPAddr, int) {
@@ -88,39 +93,6 @@ func tcpAddrFromString(addr string) *net.TCPAddr {
 	}
 }
 
-func watchConfig(fileName string, mapper *mapper.MetricMapper) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = watcher.WatchFlags(fileName, fsnotify.FSN_MODIFY)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	for {
-		select {
-		case ev := <-watcher.Event:
-			log.Infof("Config file changed (%s), attempting reload", ev)
-			err = mapper.InitFromFile(fileName)
-			if err != nil {
-				log.Errorln("Error reloading config:", err)
-				configLoads.WithLabelValues("failure").Inc()
-			} else {
-				log.Infoln("Config reloaded successfully")
-				configLoads.WithLabelValues("success").Inc()
-			}
-			// Re-add the file watcher since it can get lost on some changes. E.g.
-			// saving a file with vim results in a RENAME-MODIFY-DELETE event
-			// sequence, after which the newly written file is no longer watched.
-			_ = watcher.WatchFlags(fileName, fsnotify.FSN_MODIFY)
-		case err := <-watcher.Error:
-			log.Errorln("Error watching config:", err)
-		}
-	}
-}
-
 func dumpFSM(mapper *mapper.MetricMapper, dumpFilename string) error {
 	f, err := os.Create(dumpFilename)
 	if err != nil {
@@ -128,22 +100,145 @@ func dumpFSM(mapper *mapper.MetricMapper, dumpFilename string) error {
 	}
 	log.Infoln("Start dumping FSM to", dumpFilename)
 	w := bufio.NewWriter(f)
-	mapper.FSM.DumpFSM(w)
+	if err := mapper.DumpFSM(w); err != nil {
+		f.Close()
+		return err
+	}
 	w.Flush()
 	f.Close()
 	log.Infoln("Finish dumping FSM")
 	return nil
 }
 
+// serveFSM serves the FSM of the currently loaded mapping config as Dot
+// graph, so that it can be inspected after configuration reloads.
+func serveFSM(m *mapper.MetricMapper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := m.DumpFSM(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Write(buf.Bytes())
+	}
+}
+
+// loadMapper returns a MetricMapper initialized from the given mapping config
+// file. An empty fileName yields a mapper without any mappings.
+func loadMapper(fileName string, mappingsCount prometheus.Gauge, defaultQuantiles []mapper.MetricObjective) *mapper.MetricMapper {
+	m := &mapper.MetricMapper{MappingsCount: mappingsCount, DefaultQuantiles: defaultQuantiles}
+	var err error
+	if fileName != "" {
+		err = m.InitFromFile(fileName)
+	} else {
+		// Resolve the defaults, so that they can be reported.
+		err = m.InitFromYAMLString("")
+	}
+	if err != nil {
+		log.Fatalf("Error loading config %s: %s", fileName, err)
+	}
+	if fileName != "" {
+		recordConfigLoad(fileName, nil)
+	}
+	return m
+}
+
 func main() {
 	var (
-		listenAddress   = kingpin.Flag("web.listen-address", "The address on which to expose the web interface and generated Prometheus metrics.").Default(":9102").String()
-		metricsEndpoint = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics.").Default("/metrics").String()
-		statsdListenUDP = kingpin.Flag("statsd.listen-udp", "The UDP address on which to receive statsd metric lines. \"\" disables it.").Default(":9125").String()
-		statsdListenTCP = kingpin.Flag("statsd.listen-tcp", "The TCP address on which to receive statsd metric lines. \"\" disables it.").Default(":9125").String()
-		mappingConfig   = kingpin.Flag("statsd.mapping-config", "Metric mapping configuration file name.").String()
-		readBuffer      = kingpin.Flag("statsd.read-buffer", "Size (in bytes) of the operating system's transmit read buffer associated with the UDP connection. Please make sure the kernel parameters net.core.rmem_max is set to a value greater than the value specified.").Int()
-		dumpFSMPath     = kingpin.Flag("debug.dump-fsm", "The path to dump internal FSM generated for glob matching as Dot file.").Default("").String()
+		listenAddress     = kingpin.Flag("web.listen-address", "The address on which to expose the web interface and generated Prometheus metrics.").Default(":9102").String()
+		adminAddress      = kingpin.Flag("web.admin-listen-address", "Address to serve the configuration, reload, health and debugging endpoints on instead of --web.listen-address. Addresses without host, e.g. \":9103\", are bound to the loopback interface. By default, they are served with the metrics.").Default("").String()
+		metricsEndpoint   = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics.").Default("/metrics").String()
+		scrapeCacheAge    = kingpin.Flag("web.cache-max-age", "Serve scrapes from a cached response rendered no longer than this ago, e.g. for several Prometheus servers scraping the exporter. 0 renders every scrape.").Default("0").Duration()
+		enableUI          = kingpin.Flag("web.enable-ui", "Serve a web UI for debugging mappings and traffic at /ui/.").Bool()
+		listenerPaths     = kingpin.Flag("web.listener-path", "Register the metrics of a listener's events in a separate registry exposed at this path, as listener=path, e.g. udp=/metrics/udp. May be repeated.").Strings()
+		runAsUser         = kingpin.Flag("run-as-user", "User, by name or uid, to switch to once the listeners are bound, e.g. to bind privileged ports as root. \"\" keeps the user.").Default("").String()
+		runAsGroup        = kingpin.Flag("run-as-group", "Group, by name or gid, to switch to once the listeners are bound. \"\" uses the groups of --run-as-user.").Default("").String()
+		tenantTag         = kingpin.Flag("tenant.tag", "Route events carrying this tag to a separate registry per tenant, named by the tag value. \"\" disables tenant routing.").Default("").String()
+		tenantPrefix      = kingpin.Flag("tenant.path-prefix", "Path prefix under which the metrics of each tenant are exposed, followed by the tenant name.").Default("/metrics/tenant/").String()
+		tenantLabel       = kingpin.Flag("tenant.label", "Label carrying the tenant name that is enforced on all metrics of a tenant.").Default("tenant").String()
+		maxTenants        = kingpin.Flag("tenant.max-tenants", "Maximum number of tenants. Events of further tenants are dropped. 0 disables the limit.").Default("100").Int()
+		tenantMaxSeries   = kingpin.Flag("tenant.max-series", "Maximum number of series per tenant. Events for new series are dropped while a tenant is at the limit. 0 disables the limit.").Default("0").Int()
+		statsdListenUDP   = kingpin.Flag("statsd.listen-udp", "The UDP address on which to receive statsd metric lines. \"\" disables it.").Default(":9125").String()
+		statsdListenTCP   = kingpin.Flag("statsd.listen-tcp", "The TCP address on which to receive statsd metric lines. \"\" disables it.").Default(":9125").String()
+		statsdListenStdin = kingpin.Flag("statsd.listen-stdin", "Read statsd metric lines from standard input, e.g. when piping an application's output to the exporter.").Bool()
+		statsdTailFiles   = kingpin.Flag("statsd.tail-file", "File to follow for appended statsd metric lines, handling rotation. May be repeated.").Strings()
+		mappingConfig     = kingpin.Flag("statsd.mapping-config", "Metric mapping configuration file name.").String()
+		watchConfigs      = kingpin.Flag("statsd.watch-config", "Reload mapping configs when they change. Without watching, configs are only reloaded on SIGHUP or a POST to /-/reload.").Default("true").Bool()
+		udpMappingConfig  = kingpin.Flag("statsd.udp-mapping-config", "Metric mapping configuration file name for the UDP listener. Defaults to --statsd.mapping-config.").String()
+		tcpMappingConfig  = kingpin.Flag("statsd.tcp-mapping-config", "Metric mapping configuration file name for the TCP listener. Defaults to --statsd.mapping-config.").String()
+		udpLineFormat     = kingpin.Flag("statsd.udp-line-format", "Line format accepted by the UDP listener. One of: "+strings.Join(line.Formats(), ", ")+".").Default(line.DefaultFormat).String()
+		tcpDelimiter      = kingpin.Flag("statsd.tcp-delimiter", "Character separating the records received by the TCP listener, in Go escape syntax, e.g. \"\\x00\" or \";\". A carriage return preceding it is dropped.").Default("\\n").String()
+		tcpLineFormat     = kingpin.Flag("statsd.tcp-line-format", "Line format accepted by the TCP listener. One of: "+strings.Join(line.Formats(), ", ")+".").Default(line.DefaultFormat).String()
+		listenerLabel     = kingpin.Flag("statsd.listener-label", "Attach a \"listener\" label with the receiving listener (udp, tcp, nats, redis, sqs, stdin, file, push, statsite or collectd) to all metrics.").Bool()
+		kubernetesPods    = kingpin.Flag("kubernetes.pod-labels", "Add pod, namespace and deployment labels of the Kubernetes pod that sent an event, using the in-cluster service account.").Bool()
+		kubernetesNode    = kingpin.Flag("kubernetes.node-name", "Only consider pods on this Kubernetes node.").Envar("NODE_NAME").String()
+		kubernetesResync  = kingpin.Flag("kubernetes.refresh-interval", "How often to refresh the list of Kubernetes pods.").Default("30s").Duration()
+		counterFlush      = kingpin.Flag("statsd.counter-flush-interval", "Aggregate counter increments and apply them at most this often. 0 applies every increment immediately.").Default("0").Duration()
+		coalesceBatches   = kingpin.Flag("statsd.coalesce-batches", "Merge the events of each series within a batch of received events before applying them: sum counter increments, keep the last gauge value and collect timer observations.").Bool()
+		flushInterval     = kingpin.Flag("statsd.flush-interval", "Emulate the StatsD flush interval: merge the events of each series and apply them at most this often. Also applies to counters unless --statsd.counter-flush-interval is set. 0 applies every event immediately.").Default("0").Duration()
+		flushThreshold    = kingpin.Flag("statsd.flush-threshold", "Make --statsd.flush-interval and --statsd.counter-flush-interval adaptive: apply pending events as soon as this many have accumulated, shortening the interval under load down to a sixteenth, and lengthen it back to the configured interval while idle. 0 keeps the intervals fixed.").Default("0").Int()
+		expiryInterval    = kingpin.Flag("statsd.expiry-interval", "How often series whose ttl has passed are removed.").Default("1s").Duration()
+		expiryJitter      = kingpin.Flag("statsd.expiry-jitter", "Extend the ttl of every series by a random fraction of it of up to this much, e.g. 0.1 for up to 10%, so that series created at the same time don't all expire at once.").Default("0").Float64()
+		timerWindow       = kingpin.Flag("statsd.timer-aggregate-interval", "Window over which the StatsD timer aggregates of mappings with timer_aggregates are computed.").Default("10s").Duration()
+		defaultQuantiles  = kingpin.Flag("statsd.default-quantiles", "Comma separated quantile:error pairs used for timers unless the mapping config sets quantiles, e.g. \"0.5:0.05,0.99:0.001\".").String()
+		udpMaxLine        = kingpin.Flag("statsd.udp-max-line-length", "Maximum length of lines received over UDP in bytes. Longer lines are dropped, or truncated with --statsd.udp-truncate-long-lines. 0 disables the limit.").Default("0").Int()
+		udpTruncateLines  = kingpin.Flag("statsd.udp-truncate-long-lines", "Truncate lines received over UDP to the maximum line length instead of dropping them.").Bool()
+		udpReaders        = kingpin.Flag("statsd.udp-reader-threads", "Number of goroutines reading from the UDP socket concurrently.").Default("1").Int()
+		readBuffer        = kingpin.Flag("statsd.read-buffer", "Size (in bytes) of the operating system's transmit read buffer associated with the UDP connection. Please make sure the kernel parameters net.core.rmem_max is set to a value greater than the value specified. 0 requests the largest size net.core.rmem_max allows.").Int()
+		dumpFSMPath       = kingpin.Flag("debug.dump-fsm", "The path to dump internal FSM generated for glob matching as Dot file.").Default("").String()
+		natsURL           = kingpin.Flag("nats.url", "URL of a NATS server to receive statsd metric lines from, e.g. nats://localhost:4222. \"\" disables it.").Default("").String()
+		natsSubject       = kingpin.Flag("nats.subject", "NATS subject to subscribe to. Every message is a batch of statsd metric lines.").Default("statsd").String()
+		natsQueueGroup    = kingpin.Flag("nats.queue-group", "NATS queue group to subscribe with, to share the messages between several exporters.").Default("").String()
+		redisURL          = kingpin.Flag("redis.url", "URL of a Redis server to receive statsd metric lines from, e.g. redis://:password@localhost:6379/0. \"\" disables it.").Default("").String()
+		redisChannel      = kingpin.Flag("redis.channel", "Redis pub/sub channel to subscribe to. Every message is a batch of statsd metric lines.").Default("").String()
+		redisStream       = kingpin.Flag("redis.stream", "Redis stream to read new entries from, if --redis.channel is not set.").Default("").String()
+		redisStreamField  = kingpin.Flag("redis.stream-field", "Field of Redis stream entries that holds a batch of statsd metric lines.").Default("data").String()
+		sqsQueueURL       = kingpin.Flag("sqs.queue-url", "URL of an AWS SQS queue to receive statsd metric lines from. Credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables. \"\" disables it.").Default("").String()
+		sqsRegion         = kingpin.Flag("sqs.region", "AWS region of the SQS queue. Defaults to the region in the queue URL.").Envar("AWS_REGION").String()
+		textfilePath      = kingpin.Flag("textfile.path", "Also write all metrics to this file, for node_exporter's textfile collector. The name must end in .prom. \"\" disables it.").Default("").String()
+		textfileInterval  = kingpin.Flag("textfile.interval", "How often to write the metrics to --textfile.path.").Default("15s").Duration()
+		otlpEndpoint      = kingpin.Flag("otlp.endpoint", "URL of an OpenTelemetry collector to periodically push all metrics to with OTLP/HTTP and JSON encoding, e.g. http://localhost:4318/v1/metrics. \"\" disables it.").Default("").String()
+		otlpInterval      = kingpin.Flag("otlp.interval", "How often to push the metrics to --otlp.endpoint.").Default("30s").Duration()
+		otlpHeaders       = kingpin.Flag("otlp.header", "Header sent with every push to --otlp.endpoint, as key=value, e.g. for authentication. May be repeated.").Strings()
+		maxNameLength     = kingpin.Flag("statsd.max-name-length", "Maximum length of received metric names in bytes. 0 disables the limit.").Default("0").Int()
+		maxLabelLength    = kingpin.Flag("statsd.max-label-value-length", "Maximum length of label values in bytes. 0 disables the limit.").Default("0").Int()
+		truncateLong      = kingpin.Flag("statsd.truncate-long-values", "Truncate metric names and label values exceeding the length limits instead of dropping the event.").Bool()
+		maxTags           = kingpin.Flag("statsd.max-tags", "Maximum number of tags accepted per event. Excess tags are dropped. 0 disables the limit.").Default("0").Int()
+		clusterPeers      = kingpin.Flag("cluster.peers", "UDP address of an exporter of the cluster, including this one. Events are forwarded to the peer owning their metric. May be repeated.").Strings()
+		clusterSelf       = kingpin.Flag("cluster.self", "UDP address of this exporter, as given in --cluster.peers.").String()
+		gaugeSnapshot     = kingpin.Flag("statsd.gauge-snapshot", "File to save gauge values to periodically and on shutdown, and to restore them from on startup. \"\" disables it.").Default("").String()
+		gaugeSnapshotInt  = kingpin.Flag("statsd.gauge-snapshot-interval", "How often to save gauge values to --statsd.gauge-snapshot.").Default("1m").Duration()
+		spillDir          = kingpin.Flag("statsd.spill-dir", "Directory to spill events to while the event queue is full. \"\" disables spilling.").Default("").String()
+		spillMaxBytes     = kingpin.Flag("statsd.spill-max-bytes", "Maximum size of each spill file in bytes.").Default("104857600").Int64()
+		shedGauges        = kingpin.Flag("statsd.shed-gauges", "Drop gauge events while the event queue is full, to preserve counter and timer events under overload.").Bool()
+		memoryLimit       = kingpin.Flag("statsd.memory-limit", "Heap size in bytes to stay below. From 90% of it, events for new series without mapping and large batches are dropped. 0 disables the limit.").Default("0").Uint64()
+		memoryShedBatch   = kingpin.Flag("statsd.memory-shed-batch-size", "Number of events above which batches are dropped while the memory limit is exceeded. 0 keeps all batches.").Default("1000").Int()
+		unmappedAction    = kingpin.Flag("statsd.unmapped-action", "What to do with metrics without mapping: map them under their escaped name, or drop them.").Default(string(mapper.ActionTypeMap)).Enum(string(mapper.ActionTypeMap), string(mapper.ActionTypeDrop))
+		unmappedTtl       = kingpin.Flag("statsd.unmapped-ttl", "TTL of metrics without mapping, replacing the default TTL of the mapping config, so that unexpected series expire quickly. 0 keeps the default TTL.").Default("0").Duration()
+		typeConflict      = kingpin.Flag("statsd.type-conflict", "What to do with events for a metric name in use by a metric of another type: drop them, export them under the name suffixed with their type, or replace the metric once all its series have expired.").Default(string(exporter.TypeConflictDrop)).Enum(string(exporter.TypeConflictDrop), string(exporter.TypeConflictSuffix), string(exporter.TypeConflictReplace))
+		stripPrefixes     = kingpin.Flag("statsd.strip-prefixes", "Comma separated prefixes removed from metric names before mapping, e.g. \"statsd.,app.\". Only the first matching prefix is removed.").Default("").String()
+		namespace         = kingpin.Flag("statsd.namespace", "Prefix prepended to the names of all exported metrics, e.g. \"myorg_\", unless the mapping config sets a namespace in its defaults.").Default("").String()
+		unaryTagValue     = kingpin.Flag("statsd.unary-tag-value", "Label value of DogStatsD tags without value, e.g. \"true\" for #canary. \"\" drops such tags.").Default("").String()
+		emptyTagValue     = kingpin.Flag("statsd.empty-tag-value", "Placeholder for empty tag values, e.g. \"__empty__\". \"\" drops tags with empty values.").Default("").String()
+		pushPath          = kingpin.Flag("web.push-path", "Path accepting metrics in the Prometheus text format pushed by HTTP POST, e.g. /push. They expire like StatsD metrics. \"\" disables it.").Default("").String()
+		statsiteListen    = kingpin.Flag("statsite.listen-tcp", "The TCP address on which to receive the binary stream of statsite sinks, e.g. from a stream_cmd of \"nc host 9127\". \"\" disables it.").Default("").String()
+		collectdListen    = kingpin.Flag("collectd.listen-udp", "The UDP address on which to receive the binary network protocol of collectd, e.g. :25826. \"\" disables it.").Default("").String()
+		collectdTypesDB   = kingpin.Flag("collectd.typesdb", "collectd types.db file naming the data sources of collectd types. Without it, the data sources of types with several values are named by index.").Default("").String()
+		nameSeparator     = kingpin.Flag("statsd.name-separator", "Replacement for the dots in the names of metrics without mapping. Must be valid in Prometheus metric names.").Default("_").String()
+		wallClockProfile  = kingpin.Flag("debug.fgprof", "Serve a wall-clock profile of all goroutines, running or waiting, at /debug/fgprof.").Bool()
+		unmappedNames     = kingpin.Flag("debug.unmapped-names", "Number of the most frequent unmapped metric names listed at /debug/unmapped. 0 disables it.").Default("1000").Int()
+		badLineCount      = kingpin.Flag("debug.bad-lines", "Number of the most recent lines that could not be parsed listed at /debug/badlines. 0 disables it.").Default("100").Int()
+		badLineLog        = kingpin.Flag("debug.bad-lines-log-interval", "Minimum interval between log messages summarizing lines that could not be parsed. 0 disables them.").Default("1m").Duration()
+		deadLetter        = kingpin.Flag("statsd.dead-letter", "File to append lines that could not be parsed to, or udp://host:port of a StatsD server to relay them to. \"\" disables it.").Default("").String()
+		suggestMappings   = kingpin.Flag("debug.suggest-mappings", "Record the names of unmapped metrics for this long, then print suggested mappings for them as YAML and exit. 0 disables it.").Default("0").Duration()
+		convertFile       = kingpin.Flag("statsd.convert-file", "Map the statsd metric lines in this file (\"-\" for standard input), print the resulting metrics in the Prometheus text format and exit.").String()
+		telegrafTemplates = kingpin.Flag("statsd.convert-telegraf-templates", "Convert the templates of Telegraf's statsd input in this file, one per line, into mappings, print them as YAML and exit.").String()
+		compareConfig     = kingpin.Flag("statsd.compare-mapping-config", "Map the statsd metric lines of --statsd.compare-capture with both --statsd.mapping-config and this mapping config, print the series exported by only one of them or with different values, and exit. The exit status is 1 if there are differences.").String()
+		compareCapture    = kingpin.Flag("statsd.compare-capture", "File of recorded statsd metric lines (\"-\" for standard input) to compare mapping configs with.").Default("-").String()
+		convertMatchType  = kingpin.Flag("statsd.convert-mappings", "Rewrite the matches of --statsd.mapping-config to this match type, print the resulting config as YAML and exit. One of: glob, regex.").Enum(string(mapper.MatchTypeGlob), string(mapper.MatchTypeRegex))
+		convertSamples    = kingpin.Flag("statsd.convert-samples", "File of metric names or statsd metric lines that both configs must map the same way when converting mappings.").String()
+		printConfig       = kingpin.Flag("print-config", "Print the effective configuration as YAML and exit.").Bool()
 	)
 
 	log.AddFlags(kingpin.CommandLine)
@@ -151,64 +246,614 @@ func main() {
 	kingpin.HelpFlag.Short('h')
 	kingpin.Parse()
 
-	if *statsdListenUDP == "" && *statsdListenTCP == "" {
-		log.Fatalln("At least one of UDP/TCP listeners must be specified.")
+	if *statsdListenUDP == "" && *statsdListenTCP == "" && *natsURL == "" && *redisURL == "" && *sqsQueueURL == "" && !*statsdListenStdin && len(*statsdTailFiles) == 0 && *pushPath == "" && *statsiteListen == "" && *collectdListen == "" && *convertFile == "" && *telegrafTemplates == "" && *convertMatchType == "" && *compareConfig == "" {
+		log.Fatalln("At least one of UDP/TCP/NATS/Redis/SQS/stdin/file/push/statsite/collectd listeners must be specified.")
+	}
+	if *redisURL != "" && (*redisChannel == "") == (*redisStream == "") {
+		log.Fatalln("Exactly one of --redis.channel and --redis.stream must be specified.")
+	}
+	if *udpReaders < 1 {
+		log.Fatalf("--statsd.udp-reader-threads must be at least 1, got %d.", *udpReaders)
+	}
+
+	if *textfilePath != "" && !strings.HasSuffix(*textfilePath, ".prom") {
+		log.Fatalf("--textfile.path must end in .prom, got %q.", *textfilePath)
+	}
+
+	pathsByListener, err := parseListenerPaths(*listenerPaths, *metricsEndpoint)
+	if err != nil {
+		log.Fatalf("Invalid --web.listener-path: %v", err)
+	}
+
+	if *expiryInterval <= 0 {
+		log.Fatalf("--statsd.expiry-interval must be positive, got %s.", *expiryInterval)
+	}
+	if *expiryJitter < 0 {
+		log.Fatalf("--statsd.expiry-jitter must not be negative, got %v.", *expiryJitter)
+	}
+	if *nameSeparator == "" || !model.IsValidMetricName(model.LabelValue("a"+*nameSeparator+"a")) {
+		log.Fatalf("--statsd.name-separator must be valid in metric names, got %q.", *nameSeparator)
+	}
+	if *namespace != "" && !model.IsValidMetricName(model.LabelValue(*namespace)) {
+		log.Fatalf("--statsd.namespace must be valid in metric names, got %q.", *namespace)
+	}
+	if *tenantTag != "" && !model.LabelName(*tenantLabel).IsValid() {
+		log.Fatalf("--tenant.label must be a valid label name, got %q.", *tenantLabel)
+	}
+
+	var quantiles []mapper.MetricObjective
+	if *defaultQuantiles != "" {
+		var err error
+		quantiles, err = mapper.ParseQuantiles(*defaultQuantiles)
+		if err != nil {
+			log.Fatal("Error parsing default quantiles:", err)
+		}
+	}
+
+	if *telegrafTemplates != "" {
+		f, err := os.Open(*telegrafTemplates)
+		if err != nil {
+			log.Fatal("Error opening Telegraf templates:", err)
+		}
+		out, err := mapper.ConvertTelegrafTemplatesYAML(f)
+		f.Close()
+		if err != nil {
+			log.Fatal("Error converting Telegraf templates:", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	if *convertMatchType != "" {
+		if *mappingConfig == "" {
+			log.Fatalln("--statsd.convert-mappings requires --statsd.mapping-config.")
+		}
+		config, err := ioutil.ReadFile(*mappingConfig)
+		if err != nil {
+			log.Fatal("Error reading mapping config:", err)
+		}
+		var samples io.Reader
+		if *convertSamples != "" {
+			f, err := os.Open(*convertSamples)
+			if err != nil {
+				log.Fatal("Error opening samples:", err)
+			}
+			defer f.Close()
+			samples = f
+		}
+		if err := convertMappings(string(config), mapper.MatchType(*convertMatchType), samples, os.Stdout); err != nil {
+			log.Fatal("Error converting mappings:", err)
+		}
+		return
+	}
+
+	reporter := newConfigReporter(kingpin.CommandLine)
+	metricMapper := loadMapper(*mappingConfig, mappingsCount, quantiles)
+	reporter.addMapper(*mappingConfig, metricMapper)
+
+	if *printConfig {
+		for _, fileName := range []string{*udpMappingConfig, *tcpMappingConfig} {
+			if fileName != "" && !reporter.hasMapper(fileName) {
+				reporter.addMapper(fileName, loadMapper(fileName, nil, quantiles))
+			}
+		}
+		out, err := reporter.YAML()
+		if err != nil {
+			log.Fatal("Error printing config:", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	if *compareConfig != "" {
+		in := os.Stdin
+		if *compareCapture != "-" {
+			f, err := os.Open(*compareCapture)
+			if err != nil {
+				log.Fatal("Error opening capture:", err)
+			}
+			defer f.Close()
+			in = f
+		}
+		n, err := compareConfigs(in, metricMapper, loadMapper(*compareConfig, nil, quantiles), os.Stdout)
+		if err != nil {
+			log.Fatal("Error comparing mapping configs:", err)
+		}
+		if n > 0 {
+			log.Errorf("%d series differ between %s and %s", n, *mappingConfig, *compareConfig)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *convertFile != "" {
+		in := os.Stdin
+		if *convertFile != "-" {
+			f, err := os.Open(*convertFile)
+			if err != nil {
+				log.Fatal("Error opening file to convert:", err)
+			}
+			defer f.Close()
+			in = f
+		}
+		if err := convert(in, os.Stdout, metricMapper); err != nil {
+			log.Fatal("Error converting metrics:", err)
+		}
+		return
 	}
 
+	if err := runAsService(); err != nil {
+		log.Fatal("Error connecting to the Windows service manager:", err)
+	}
+	go shutdownOnSignal()
+
 	log.Infoln("Starting StatsD -> Prometheus Exporter", version.Info())
 	log.Infoln("Build context", version.BuildContext())
 	log.Infof("Accepting StatsD Traffic: UDP %v, TCP %v", *statsdListenUDP, *statsdListenTCP)
 	log.Infoln("Accepting Prometheus Requests on", *listenAddress)
 
-	go serveHTTP(*listenAddress, *metricsEndpoint)
+	socks, err := newSockets()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go socks.handOverOnSignal()
+
+	// Control and debugging endpoints are served on the admin address, if
+	// set, rather than with the metrics.
+	public := newServeMux(http.DefaultServeMux, "StatsD Exporter")
+	scrapes := &scrapeActions{}
+	//lint:ignore SA1019 prometheus.Handler() is deprecated.
+	public.handlePage(*metricsEndpoint, "Metrics", instrumentHandler(*metricsEndpoint, maybeCacheResponses(scrapes.handler(prometheus.Handler()), *scrapeCacheAge)))
+	admin := public
+	if *adminAddress != "" {
+		addr, err := loopbackAddress(*adminAddress)
+		if err != nil {
+			log.Fatalf("Invalid --web.admin-listen-address: %v", err)
+		}
+		l, err := socks.listenTCP(addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		admin = newServeMux(http.NewServeMux(), "StatsD Exporter Admin")
+		go serveAdmin(l, admin)
+	}
+	admin.HandleFunc("/-/healthy", serveHealthy)
+
+	var recorders unmappedRecorders
+	var tracker *unmappedTracker
+	if *unmappedNames > 0 {
+		tracker = newUnmappedTracker(*unmappedNames)
+		recorders = append(recorders, tracker)
+		admin.handlePage("/debug/unmapped", "Unmapped metrics", tracker)
+	}
+
+	admin.handlePage("/config", "Configuration", reporter)
+	var hits *mappingHits
+	if *enableUI {
+		hits = &mappingHits{}
+		admin.handlePage(uiPath, "Debugging UI", &uiHandler{unmapped: tracker, hits: hits, gatherer: prometheus.DefaultGatherer})
+	}
+	reloader := &configReloader{}
+	admin.Handle("/-/reload", reloader)
+	go reloader.reloadOnSignal()
+	admin.handlePage("/debug/fsm", "Mapping FSM", serveFSM(metricMapper))
+	if *wallClockProfile {
+		admin.HandleFunc("/debug/fgprof", serveWallClockProfile)
+	}
+	metadata := &metadataHandler{}
+	admin.handlePage("/api/v1/metadata", "Metric metadata", metadata)
+	deleter := &deleteHandler{}
+	admin.Handle("/api/v1/admin/delete_series", deleter)
+	webListener, err := socks.listenTCP(*listenAddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go serveHTTP(webListener, public)
+	if *otlpEndpoint != "" {
+		headers, err := parseOTLPHeaders(*otlpHeaders)
+		if err != nil {
+			log.Fatalf("Invalid --otlp.header: %v", err)
+		}
+		p := &otlpPusher{
+			gatherer: prometheus.DefaultGatherer,
+			endpoint: *otlpEndpoint,
+			headers:  headers,
+			client:   &http.Client{Timeout: *otlpInterval},
+			start:    time.Now(),
+		}
+		go p.run(*otlpInterval)
+	}
+	if *textfilePath != "" {
+		go writeTextfiles(prometheus.DefaultGatherer, *textfilePath, *textfileInterval)
+	}
+
+	if *suggestMappings > 0 {
+		suggester := &mapper.Suggester{}
+		recorders = append(recorders, suggester)
+		log.Infof("Recording unmapped metric names for %v to suggest mappings", *suggestMappings)
+		time.AfterFunc(*suggestMappings, func() {
+			out, err := suggester.SuggestYAML()
+			if err != nil {
+				log.Fatal("Error suggesting mappings:", err)
+			}
+			os.Stdout.Write(out)
+			os.Exit(0)
+		})
+	}
 
-	events := make(chan Events, 1024)
+	events := make(chan event.Events, 1024)
 	defer close(events)
 
+	if *mappingConfig != "" {
+		if *dumpFSMPath != "" {
+			err := dumpFSM(metricMapper, *dumpFSMPath)
+			if err != nil {
+				log.Fatal("Error dumping FSM:", err)
+			}
+		}
+		reloader.add(*mappingConfig, metricMapper)
+		if *watchConfigs {
+			go watchConfig(*mappingConfig, metricMapper)
+		}
+	}
+
+	var budget *exporter.MemoryBudget
+	if *memoryLimit > 0 {
+		budget = &exporter.MemoryBudget{Limit: *memoryLimit, MaxBatch: *memoryShedBatch}
+		go budget.Run(time.Second)
+	}
+
+	// configureNames applies the flags deciding which series events are
+	// exported as.
+	configureNames := func(ex *exporter.Exporter) {
+		ex.MaxNameLength = *maxNameLength
+		ex.MaxLabelValueLength = *maxLabelLength
+		ex.TruncateLongValues = *truncateLong
+		ex.DropUnmapped = *unmappedAction == string(mapper.ActionTypeDrop)
+		ex.TypeConflictPolicy = exporter.TypeConflictPolicy(*typeConflict)
+		ex.NameSeparator = *nameSeparator
+		ex.Namespace = *namespace
+		if *stripPrefixes != "" {
+			ex.StripPrefixes = strings.Split(*stripPrefixes, ",")
+		}
+	}
+	newExporter := func(m *mapper.MetricMapper, options ...exporter.Option) *exporter.Exporter {
+		ex := exporter.NewExporter(m, options...)
+		ex.CounterFlushInterval = *counterFlush
+		if ex.CounterFlushInterval == 0 {
+			ex.CounterFlushInterval = *flushInterval
+		}
+		ex.FlushInterval = *flushInterval
+		ex.FlushThreshold = *flushThreshold
+		ex.CoalesceBatches = *coalesceBatches
+		ex.TimerAggregateInterval = *timerWindow
+		ex.ExpiryInterval = *expiryInterval
+		ex.ExpiryJitter = *expiryJitter
+		ex.MemoryBudget = budget
+		ex.UnmappedTtl = *unmappedTtl
+		configureNames(ex)
+		if len(recorders) > 0 {
+			ex.UnmappedRecorder = recorders
+		}
+		if hits != nil {
+			ex.MappingRecorder = hits
+		}
+		metadata.add(ex)
+		deleter.add(ex)
+		return ex
+	}
+	admin.Handle("/debug/test-line", &testLineHandler{
+		mapper:    metricMapper,
+		options:   line.Options{UnaryTagValue: *unaryTagValue, EmptyTagValue: *emptyTagValue},
+		configure: configureNames,
+	})
+
+	forwarded := func(out chan<- event.Events) chan<- event.Events { return out }
+	if len(*clusterPeers) > 0 {
+		forwarder, err := cluster.NewForwarder(*clusterPeers, *clusterSelf)
+		if err != nil {
+			log.Fatal("Error setting up cluster:", err)
+		}
+		forwarded = func(out chan<- event.Events) chan<- event.Events {
+			in := make(chan event.Events, 1024)
+			go forwarder.Forward(in, out)
+			return in
+		}
+	}
+
+	var badLines badLineRecorders
+	if *badLineCount > 0 || *badLineLog > 0 {
+		b := line.NewBadLines(*badLineCount, *badLineLog)
+		badLines = append(badLines, b)
+		if *badLineCount > 0 {
+			admin.handlePage("/debug/badlines", "Bad lines", serveBadLines(b))
+		}
+	}
+	if *deadLetter != "" {
+		w, err := openDeadLetter(*deadLetter)
+		if err != nil {
+			log.Fatal("Error opening dead letter output:", err)
+		}
+		badLines = append(badLines, line.NewDeadLetter(w))
+	}
+
+	lookupParser := func(format, listenerName string) line.Parser {
+		p, err := line.Lookup(format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p = line.WithOptions(p, line.Options{UnaryTagValue: *unaryTagValue, EmptyTagValue: *emptyTagValue})
+		if len(badLines) > 0 {
+			p = line.RecordBadLines(p, listenerName, badLines)
+		}
+		if *maxTags > 0 {
+			p = line.LimitTags(p, *maxTags)
+		}
+		return p
+	}
+
+	spillFiles := 0
+	spilled := func(in <-chan event.Events) <-chan event.Events {
+		if *spillDir == "" {
+			return in
+		}
+		path := filepath.Join(*spillDir, fmt.Sprintf("queue-%d.spill", spillFiles))
+		spillFiles++
+		q, err := spill.NewQueue(path, *spillMaxBytes)
+		if err != nil {
+			log.Fatal("Error creating spill file:", err)
+		}
+		out := make(chan event.Events, 1024)
+		go q.Run(in, out)
+		return out
+	}
+
+	// queued returns the queue of an Exporter fed from in.
+	queued := func(in <-chan event.Events) <-chan event.Events {
+		out := make(chan event.Events, 1024)
+		go exporter.RunBudgetedQueue(spilled(in), out, *shedGauges, budget)
+		return out
+	}
+
+	router := newConfigRouter(*mappingConfig, metricMapper, events)
+	router.load = func(fileName string) *mapper.MetricMapper {
+		m := loadMapper(fileName, nil, quantiles)
+		reporter.addMapper(fileName, m)
+		reloader.add(fileName, m)
+		if *watchConfigs {
+			go watchConfig(fileName, m)
+		}
+		return m
+	}
+	router.start = func(m *mapper.MetricMapper) chan<- event.Events {
+		e := make(chan event.Events, 1024)
+		ex := newExporter(m)
+		scrapes.add(ex)
+		go ex.Listen(queued(e))
+		return e
+	}
+
+	// isolated returns the queue of an Exporter registering into its own
+	// registry, exposed at path. The labels are added to all its metrics.
+	isolated := func(path string, m *mapper.MetricMapper, labels prometheus.Labels, maxSeries int) chan<- event.Events {
+		reg := prometheus.NewRegistry()
+		ex := newExporter(m, exporter.WithRegisterer(prometheus.WrapRegistererWith(labels, reg)))
+		ex.MaxSeries = maxSeries
+		scrapes := &scrapeActions{exporters: []*exporter.Exporter{ex}}
+		http.Handle(path, instrumentHandler(path, maybeCacheResponses(scrapes.handler(gathererHandler(reg)), *scrapeCacheAge)))
+		e := make(chan event.Events, 1024)
+		go ex.Listen(queued(e))
+		return e
+	}
+
+	// Listeners with their own exposition path feed an isolated Exporter.
+	listenerEvents := func(name, fileName string) chan<- event.Events {
+		if path, ok := pathsByListener[name]; ok {
+			return isolated(path, router.mapper(fileName), nil, 0)
+		}
+		return router.queue(fileName)
+	}
+
+	var pl *podLabeler
+	if *kubernetesPods {
+		var err error
+		pl, err = newInClusterPodLabeler(*kubernetesNode)
+		if err != nil {
+			log.Fatal("Error setting up Kubernetes pod labels:", err)
+		}
+		go pl.Run(*kubernetesResync)
+	}
+
 	if *statsdListenUDP != "" {
-		udpListenAddr := udpAddrFromString(*statsdListenUDP)
-		uconn, err := net.ListenUDP("udp", udpListenAddr)
+		uconn, err := socks.listenUDP(*statsdListenUDP)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		if *readBuffer != 0 {
-			err = uconn.SetReadBuffer(*readBuffer)
-			if err != nil {
-				log.Fatal("Error setting UDP read buffer:", err)
-			}
+		if err := tuneReadBuffer(uconn, *readBuffer); err != nil {
+			log.Fatal("Error setting UDP read buffer:", err)
 		}
 
-		ul := &StatsDUDPListener{conn: uconn}
-		go ul.Listen(events)
+		parser := lookupParser(*udpLineFormat, "udp")
+		ul := &listener.StatsDUDPListener{
+			Conn:              uconn,
+			ReaderThreads:     *udpReaders,
+			Parser:            parser,
+			MaxLineLength:     *udpMaxLine,
+			TruncateLongLines: *udpTruncateLines,
+		}
+		if pl != nil {
+			ul.SourceLabeler = pl
+		}
+		if *listenerLabel {
+			ul.ListenerLabel = "udp"
+		}
+		go ul.Listen(forwarded(listenerEvents("udp", *udpMappingConfig)))
 	}
 
 	if *statsdListenTCP != "" {
-		tcpListenAddr := tcpAddrFromString(*statsdListenTCP)
-		tconn, err := net.ListenTCP("tcp", tcpListenAddr)
+		tconn, err := socks.listenTCP(*statsdListenTCP)
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer tconn.Close()
 
-		tl := &StatsDTCPListener{conn: tconn}
-		go tl.Listen(events)
+		parser := lookupParser(*tcpLineFormat, "tcp")
+		delimiter, err := strconv.Unquote(`"` + *tcpDelimiter + `"`)
+		if err != nil || len(delimiter) != 1 {
+			log.Fatalf("TCP delimiter %q is not a single character", *tcpDelimiter)
+		}
+		tl := &listener.StatsDTCPListener{Conn: tconn, Parser: parser, Delimiter: delimiter[0]}
+		if pl != nil {
+			tl.SourceLabeler = pl
+		}
+		if *listenerLabel {
+			tl.ListenerLabel = "tcp"
+		}
+		go tl.Listen(forwarded(listenerEvents("tcp", *tcpMappingConfig)))
 	}
 
-	mapper := &mapper.MetricMapper{MappingsCount: mappingsCount}
-	if *mappingConfig != "" {
-		err := mapper.InitFromFile(*mappingConfig)
+	if *statsiteListen != "" {
+		sconn, err := socks.listenTCP(*statsiteListen)
 		if err != nil {
-			log.Fatal("Error loading config:", err)
+			log.Fatal(err)
 		}
-		if *dumpFSMPath != "" {
-			err := dumpFSM(mapper, *dumpFSMPath)
+		defer sconn.Close()
+
+		sl := &listener.StatsiteListener{Conn: sconn}
+		if *listenerLabel {
+			sl.ListenerLabel = "statsite"
+		}
+		go sl.Listen(forwarded(listenerEvents("statsite", "")))
+	}
+
+	if *collectdListen != "" {
+		cconn, err := socks.listenUDP(*collectdListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cl := &listener.CollectdListener{Conn: cconn}
+		if *collectdTypesDB != "" {
+			f, err := os.Open(*collectdTypesDB)
 			if err != nil {
-				log.Fatal("Error dumping FSM:", err)
+				log.Fatal("Error opening collectd types.db:", err)
+			}
+			cl.TypesDB, err = listener.ParseCollectdTypesDB(f)
+			f.Close()
+			if err != nil {
+				log.Fatal("Error parsing collectd types.db:", err)
+			}
+		}
+		if *listenerLabel {
+			cl.ListenerLabel = "collectd"
+		}
+		go cl.Listen(forwarded(listenerEvents("collectd", "")))
+	}
+
+	// Everything requiring privileges is done, the remaining listeners
+	// connect out or read files.
+	if err := dropPrivileges(*runAsUser, *runAsGroup); err != nil {
+		log.Fatal("Error dropping privileges:", err)
+	}
+	if *runAsUser != "" || *runAsGroup != "" {
+		log.Infof("Running as uid %d, gid %d", os.Getuid(), os.Getgid())
+	}
+
+	if *natsURL != "" {
+		nl := &listener.NATSListener{URL: *natsURL, Subject: *natsSubject, QueueGroup: *natsQueueGroup, Parser: lookupParser(line.DefaultFormat, "nats")}
+		if *listenerLabel {
+			nl.ListenerLabel = "nats"
+		}
+		go nl.Listen(forwarded(listenerEvents("nats", "")))
+	}
+
+	if *redisURL != "" {
+		rl := &listener.RedisListener{URL: *redisURL, Channel: *redisChannel, Stream: *redisStream, StreamField: *redisStreamField, Parser: lookupParser(line.DefaultFormat, "redis")}
+		if *listenerLabel {
+			rl.ListenerLabel = "redis"
+		}
+		go rl.Listen(forwarded(listenerEvents("redis", "")))
+	}
+
+	if *sqsQueueURL != "" {
+		creds, err := listener.AWSCredentialsFromEnv()
+		if err != nil {
+			log.Fatal("Error setting up SQS listener:", err)
+		}
+		region := *sqsRegion
+		if region == "" {
+			region, err = listener.RegionFromSQSURL(*sqsQueueURL)
+			if err != nil {
+				log.Fatal("Error setting up SQS listener:", err)
+			}
+		}
+		sl := &listener.SQSListener{QueueURL: *sqsQueueURL, Region: region, Credentials: creds, Parser: lookupParser(line.DefaultFormat, "sqs")}
+		if *listenerLabel {
+			sl.ListenerLabel = "sqs"
+		}
+		go sl.Listen(forwarded(listenerEvents("sqs", "")))
+	}
+
+	if *statsdListenStdin {
+		rl := &listener.ReaderListener{Reader: os.Stdin, Parser: lookupParser(line.DefaultFormat, "stdin")}
+		if *listenerLabel {
+			rl.ListenerLabel = "stdin"
+		}
+		stdinEvents := forwarded(listenerEvents("stdin", ""))
+		go func() {
+			if err := rl.Listen(stdinEvents); err != nil {
+				log.Errorln("Error reading from standard input:", err)
+				return
 			}
+			log.Infoln("Reached the end of standard input, still serving metrics")
+		}()
+	}
+
+	var fileEvents chan<- event.Events
+	if len(*statsdTailFiles) > 0 {
+		fileEvents = forwarded(listenerEvents("file", ""))
+	}
+	for _, path := range *statsdTailFiles {
+		fl := &listener.FileTailListener{Path: path, Parser: lookupParser(line.DefaultFormat, "file")}
+		if *listenerLabel {
+			fl.ListenerLabel = "file"
+		}
+		go fl.Listen(fileEvents)
+	}
+
+	if *pushPath != "" {
+		ph := &listener.PushHandler{Events: forwarded(listenerEvents("push", ""))}
+		if *listenerLabel {
+			ph.ListenerLabel = "push"
 		}
-		go watchConfig(*mappingConfig, mapper)
+		http.Handle(*pushPath, ph)
+	}
+
+	// With tenant routing, tagged events feed an isolated Exporter per
+	// tenant, which enforces the tenant label.
+	var untagged <-chan event.Events = events
+	if *tenantTag != "" {
+		r := &tenant.Router{
+			Tag:        *tenantTag,
+			MaxTenants: *maxTenants,
+			NewTenant: func(t string) chan<- event.Events {
+				log.Infof("Routing events of tenant %q to %s", t, *tenantPrefix+t)
+				return isolated(*tenantPrefix+t, metricMapper, prometheus.Labels{*tenantLabel: t}, *tenantMaxSeries)
+			},
+		}
+		e := make(chan event.Events, 1024)
+		go r.Route(events, e)
+		untagged = e
+	}
+
+	ex := newExporter(metricMapper)
+	scrapes.add(ex)
+	exporterEvents := queued(untagged)
+	if *gaugeSnapshot != "" {
+		restoreGauges(ex, *gaugeSnapshot)
+		go snapshotGauges(ex, *gaugeSnapshot, *gaugeSnapshotInt)
 	}
-	exporter := NewExporter(mapper)
-	exporter.Listen(events)
+	socks.ready()
+	ex.Listen(exporterEvents)
 }
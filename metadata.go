@@ -0,0 +1,56 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+)
+
+// metadataHandler serves the metadata of the metrics of all exporters as
+// JSON.
+type metadataHandler struct {
+	mtx       sync.Mutex
+	exporters []*exporter.Exporter
+}
+
+func (h *metadataHandler) add(ex *exporter.Exporter) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.exporters = append(h.exporters, ex)
+}
+
+func (h *metadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mtx.Lock()
+	exporters := h.exporters
+	h.mtx.Unlock()
+
+	data := []exporter.MetricMetadata{}
+	for _, ex := range exporters {
+		data = append(data, ex.Metadata()...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(struct {
+		Status string                    `json:"status"`
+		Data   []exporter.MetricMetadata `json:"data"`
+	}{"success", data})
+	if err != nil {
+		log.Errorln("Error writing metadata:", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+func TestMetadataHandler(t *testing.T) {
+	testMapper := &mapper.MetricMapper{}
+	err := testMapper.InitFromYAMLString(`
+mappings:
+- match: meta.*.latency
+  name: meta_latency
+  help: Latency of meta requests.
+  timer_type: histogram
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex := exporter.NewExporter(testMapper, exporter.WithRegisterer(prometheus.NewRegistry()))
+	ex.HandleEvents(event.Events{
+		event.NewTimerEvent("meta.users.latency", 12, nil),
+		event.NewCounterEvent("meta_unmapped", 1, nil),
+	})
+	h := &metadataHandler{}
+	h.add(ex)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/metadata", nil))
+	var resp struct {
+		Status string
+		Data   []exporter.MetricMetadata
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []exporter.MetricMetadata{
+		{Name: "meta_latency", Type: "histogram", Help: "Latency of meta requests.", Mapping: "meta.*.latency"},
+		{Name: "meta_unmapped", Type: "counter", Help: "Metric autogenerated by statsd_exporter."},
+	}
+	if resp.Status != "success" || len(resp.Data) != len(want) {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+	for i := range want {
+		if resp.Data[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], resp.Data[i])
+		}
+	}
+}
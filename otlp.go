@@ -0,0 +1,275 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// The OTLP/HTTP JSON encoding of metrics, as far as used. 64 bit integers are
+// encoded as strings.
+type (
+	otlpRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string          `json:"key"`
+		Value otlpStringValue `json:"value"`
+	}
+	otlpStringValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpMetric struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		Gauge       *otlpGauge     `json:"gauge,omitempty"`
+		Sum         *otlpSum       `json:"sum,omitempty"`
+		Histogram   *otlpHistogram `json:"histogram,omitempty"`
+		Summary     *otlpSummary   `json:"summary,omitempty"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+		AggregationTemporality int                   `json:"aggregationTemporality"`
+		IsMonotonic            bool                  `json:"isMonotonic"`
+	}
+	otlpHistogram struct {
+		DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+		AggregationTemporality int                      `json:"aggregationTemporality"`
+	}
+	otlpSummary struct {
+		DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+	}
+	otlpNumberDataPoint struct {
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		AsDouble          float64         `json:"asDouble"`
+	}
+	otlpHistogramDataPoint struct {
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		Count             string          `json:"count"`
+		Sum               float64         `json:"sum"`
+		BucketCounts      []string        `json:"bucketCounts"`
+		ExplicitBounds    []float64       `json:"explicitBounds"`
+	}
+	otlpSummaryDataPoint struct {
+		Attributes        []otlpAttribute     `json:"attributes,omitempty"`
+		StartTimeUnixNano string              `json:"startTimeUnixNano"`
+		TimeUnixNano      string              `json:"timeUnixNano"`
+		Count             string              `json:"count"`
+		Sum               float64             `json:"sum"`
+		QuantileValues    []otlpQuantileValue `json:"quantileValues"`
+	}
+	otlpQuantileValue struct {
+		Quantile float64 `json:"quantile"`
+		Value    float64 `json:"value"`
+	}
+)
+
+// otlpCumulative is the cumulative aggregation temporality of OTLP.
+const otlpCumulative = 2
+
+// otlpPusher pushes the metrics gathered from a Gatherer to an OpenTelemetry
+// collector using OTLP/HTTP with JSON encoding.
+type otlpPusher struct {
+	gatherer prometheus.Gatherer
+	// endpoint is the URL metrics are POSTed to, usually ending in
+	// /v1/metrics.
+	endpoint string
+	// headers are sent with every request, e.g. for authentication.
+	headers map[string]string
+	client  *http.Client
+	// start is reported as the start time of all cumulative metrics.
+	start time.Time
+}
+
+// push sends the current state of all metrics to the collector.
+func (p *otlpPusher) push(now time.Time) error {
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{otlpAttr("service.name", "statsd_exporter")}},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "github.com/prometheus/statsd_exporter"},
+			Metrics: otlpMetrics(mfs, p.start, now),
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// run pushes the metrics every interval. It never returns.
+func (p *otlpPusher) run(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		if err := p.push(now); err != nil {
+			otlpPushes.WithLabelValues("failure").Inc()
+			log.Errorf("Error pushing metrics to %s: %v", p.endpoint, err)
+			continue
+		}
+		otlpPushes.WithLabelValues("success").Inc()
+	}
+}
+
+// otlpMetrics converts metric families into OTLP metrics. Counters become
+// monotonic cumulative sums, untyped metrics gauges.
+func otlpMetrics(mfs []*dto.MetricFamily, start, now time.Time) []otlpMetric {
+	startNano := strconv.FormatInt(start.UnixNano(), 10)
+	nowNano := strconv.FormatInt(now.UnixNano(), 10)
+	metrics := make([]otlpMetric, 0, len(mfs))
+	for _, mf := range mfs {
+		m := otlpMetric{Name: mf.GetName(), Description: mf.GetHelp()}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			m.Gauge = &otlpGauge{}
+		case dto.MetricType_HISTOGRAM:
+			m.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+		case dto.MetricType_SUMMARY:
+			m.Summary = &otlpSummary{}
+		default:
+			continue
+		}
+
+		for _, metric := range mf.GetMetric() {
+			attrs := make([]otlpAttribute, 0, len(metric.GetLabel()))
+			for _, l := range metric.GetLabel() {
+				attrs = append(attrs, otlpAttr(l.GetName(), l.GetValue()))
+			}
+			switch {
+			case m.Sum != nil:
+				m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberDataPoint{
+					Attributes: attrs, StartTimeUnixNano: startNano, TimeUnixNano: nowNano, AsDouble: metric.GetCounter().GetValue(),
+				})
+			case m.Gauge != nil:
+				value := metric.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_UNTYPED {
+					value = metric.GetUntyped().GetValue()
+				}
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberDataPoint{
+					Attributes: attrs, TimeUnixNano: nowNano, AsDouble: value,
+				})
+			case m.Histogram != nil:
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, otlpHistogramPoint(metric.GetHistogram(), attrs, startNano, nowNano))
+			case m.Summary != nil:
+				s := metric.GetSummary()
+				p := otlpSummaryDataPoint{
+					Attributes: attrs, StartTimeUnixNano: startNano, TimeUnixNano: nowNano,
+					Count: strconv.FormatUint(s.GetSampleCount(), 10), Sum: s.GetSampleSum(),
+					QuantileValues: []otlpQuantileValue{},
+				}
+				for _, q := range s.GetQuantile() {
+					p.QuantileValues = append(p.QuantileValues, otlpQuantileValue{Quantile: q.GetQuantile(), Value: q.GetValue()})
+				}
+				m.Summary.DataPoints = append(m.Summary.DataPoints, p)
+			}
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// otlpHistogramPoint converts the cumulative buckets of a Prometheus
+// histogram into the per bucket counts of OTLP, with a last bucket above the
+// highest bound.
+func otlpHistogramPoint(h *dto.Histogram, attrs []otlpAttribute, startNano, nowNano string) otlpHistogramDataPoint {
+	p := otlpHistogramDataPoint{
+		Attributes: attrs, StartTimeUnixNano: startNano, TimeUnixNano: nowNano,
+		Count: strconv.FormatUint(h.GetSampleCount(), 10), Sum: h.GetSampleSum(),
+		BucketCounts: []string{}, ExplicitBounds: []float64{},
+	}
+	var previous uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), +1) {
+			continue
+		}
+		p.ExplicitBounds = append(p.ExplicitBounds, b.GetUpperBound())
+		p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-previous, 10))
+		previous = b.GetCumulativeCount()
+	}
+	p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(h.GetSampleCount()-previous, 10))
+	return p
+}
+
+func otlpAttr(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpStringValue{StringValue: value}}
+}
+
+// parseOTLPHeaders parses key=value pairs into headers.
+func parseOTLPHeaders(pairs []string) (map[string]string, error) {
+	headers := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		headers[kv[0]] = kv[1]
+	}
+	return headers, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOTLPPush(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "otlp_requests_total", Help: "Requests."}, []string{"code"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "otlp_duration_seconds", Help: "Duration.", Buckets: []float64{0.1, 1}})
+	reg.MustRegister(counter, histogram)
+	counter.WithLabelValues("200").Add(3)
+	for _, v := range []float64{0.05, 0.5, 0.7, 5} {
+		histogram.Observe(v)
+	}
+
+	var got otlpRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("Cannot decode request: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	p := &otlpPusher{
+		gatherer: reg,
+		endpoint: server.URL + "/v1/metrics",
+		headers:  map[string]string{"Authorization": "Bearer secret"},
+		client:   server.Client(),
+		start:    time.Unix(100, 0),
+	}
+	if err := p.push(time.Unix(200, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := got.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("Expected 2 metrics, got %v", metrics)
+	}
+	h := metrics[0].Histogram
+	if metrics[0].Name != "otlp_duration_seconds" || h == nil {
+		t.Fatalf("Expected a histogram, got %v", metrics[0])
+	}
+	if want := []string{"1", "2", "1"}; !reflect.DeepEqual(h.DataPoints[0].BucketCounts, want) {
+		t.Errorf("Expected bucket counts %v, got %v", want, h.DataPoints[0].BucketCounts)
+	}
+	if want := []float64{0.1, 1}; !reflect.DeepEqual(h.DataPoints[0].ExplicitBounds, want) {
+		t.Errorf("Expected bounds %v, got %v", want, h.DataPoints[0].ExplicitBounds)
+	}
+	sum := metrics[1].Sum
+	if sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != otlpCumulative {
+		t.Fatalf("Expected a cumulative monotonic sum, got %v", metrics[1])
+	}
+	want := otlpNumberDataPoint{
+		Attributes:        []otlpAttribute{otlpAttr("code", "200")},
+		StartTimeUnixNano: "100000000000",
+		TimeUnixNano:      "200000000000",
+		AsDouble:          3,
+	}
+	if !reflect.DeepEqual(sum.DataPoints[0], want) {
+		t.Errorf("Expected data point %v, got %v", want, sum.DataPoints[0])
+	}
+}
+
+func TestOTLPPushError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	p := &otlpPusher{gatherer: prometheus.NewRegistry(), endpoint: server.URL, client: server.Client()}
+	if err := p.push(time.Now()); err == nil {
+		t.Error("Expected an error for a rejected push")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestRing(t *testing.T) {
+	peers := []string{"a:9125", "b:9125", "c:9125"}
+	r := NewRing(peers)
+	owned := map[string]int{}
+	owners := map[string]string{}
+	for i := 0; i < 3000; i++ {
+		name := fmt.Sprintf("metric_%d", i)
+		owners[name] = r.Owner(name)
+		owned[owners[name]]++
+	}
+	for _, peer := range peers {
+		if owned[peer] < 500 {
+			t.Errorf("Peer %s owns only %d of 3000 names", peer, owned[peer])
+		}
+	}
+
+	// Removing a peer only moves the names it owned.
+	r = NewRing(peers[:2])
+	for name, owner := range owners {
+		if owner != "c:9125" && r.Owner(name) != owner {
+			t.Errorf("Owner of %s moved from %s to %s", name, owner, r.Owner(name))
+		}
+	}
+}
+
+func TestForwarder(t *testing.T) {
+	peerConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerConn.Close()
+	self := "127.0.0.1:1"
+	peer := peerConn.LocalAddr().String()
+
+	f, err := NewForwarder([]string{self, peer}, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var localName, remoteName string
+	for i := 0; localName == "" || remoteName == ""; i++ {
+		name := fmt.Sprintf("metric_%d", i)
+		if f.ring.Owner(name) == self {
+			localName = name
+		} else {
+			remoteName = name
+		}
+	}
+
+	in := make(chan event.Events, 1)
+	out := make(chan event.Events, 1)
+	in <- event.Events{
+		event.NewCounterEvent(localName, 1, nil),
+		event.NewCounterEvent(remoteName, 2, map[string]string{"tag": "value"}),
+	}
+	close(in)
+	f.Forward(in, out)
+
+	local := <-out
+	if len(local) != 1 || local[0].MetricName() != localName {
+		t.Errorf("Expected only %s to be handled locally, got %v", localName, local)
+	}
+
+	buf := make([]byte, maxPacketSize)
+	peerConn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := peerConn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf[:n]), remoteName+":2|c|#tag:value"; got != want {
+		t.Errorf("Expected forwarded packet %q, got %q", want, got)
+	}
+}
+
+func TestNewForwarderRequiresSelf(t *testing.T) {
+	_, err := NewForwarder([]string{"127.0.0.1:9125"}, "127.0.0.1:9126")
+	if err == nil || !strings.Contains(err.Error(), "not one of the peers") {
+		t.Errorf("Expected error for missing own address, got %v", err)
+	}
+}
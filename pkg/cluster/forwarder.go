@@ -0,0 +1,115 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+// maxPacketSize keeps forwarded packets below common MTUs.
+const maxPacketSize = 1400
+
+// Forwarder passes on the events of metrics owned by this exporter, and sends
+// all other events to their owner as DogStatsD lines over UDP.
+type Forwarder struct {
+	ring  *Ring
+	self  string
+	conns map[string]net.Conn
+}
+
+// NewForwarder returns a forwarder for the given peers, which are the UDP
+// addresses of the exporters of the cluster. self is the address of this
+// exporter, and must be one of the peers.
+func NewForwarder(peers []string, self string) (*Forwarder, error) {
+	f := &Forwarder{
+		ring:  NewRing(peers),
+		self:  self,
+		conns: map[string]net.Conn{},
+	}
+	for _, peer := range peers {
+		if peer == self {
+			continue
+		}
+		conn, err := net.Dial("udp", peer)
+		if err != nil {
+			return nil, fmt.Errorf("cannot forward to peer %s: %v", peer, err)
+		}
+		f.conns[peer] = conn
+	}
+	if len(f.conns) == len(peers) {
+		return nil, fmt.Errorf("own address %s is not one of the peers %v", self, peers)
+	}
+	return f, nil
+}
+
+// Forward reads events from in, sends the events of metrics owned by other
+// peers to them, and passes on the others to out. It returns when in is
+// closed.
+func (f *Forwarder) Forward(in <-chan event.Events, out chan<- event.Events) {
+	for events := range in {
+		if local := f.forward(events); len(local) > 0 {
+			out <- local
+		}
+	}
+}
+
+// forward sends the events owned by other peers and returns the remaining
+// ones.
+func (f *Forwarder) forward(events event.Events) event.Events {
+	var local event.Events
+	packets := map[string][]byte{}
+	for _, e := range events {
+		owner := f.ring.Owner(e.MetricName())
+		if owner == f.self {
+			local = append(local, e)
+			continue
+		}
+		lines, err := line.EventToLines(e)
+		if err != nil {
+			forwardErrors.Inc()
+			log.Debugf("Cannot forward event: %v", err)
+			continue
+		}
+		for _, l := range lines {
+			if len(packets[owner]) > 0 && len(packets[owner])+len(l)+1 > maxPacketSize {
+				f.send(owner, packets[owner])
+				packets[owner] = nil
+			}
+			if len(packets[owner]) > 0 {
+				packets[owner] = append(packets[owner], '\n')
+			}
+			packets[owner] = append(packets[owner], l...)
+		}
+		eventsForwarded.Inc()
+	}
+	for owner, packet := range packets {
+		if len(packet) > 0 {
+			f.send(owner, packet)
+		}
+	}
+	return local
+}
+
+func (f *Forwarder) send(peer string, packet []byte) {
+	if _, err := f.conns[peer].Write(packet); err != nil {
+		forwardErrors.Inc()
+		log.Debugf("Error forwarding to %s: %v", peer, err)
+	}
+}
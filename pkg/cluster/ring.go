@@ -0,0 +1,71 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cluster distributes events between several exporters, so that all
+// events of a metric are handled by the same exporter.
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// virtualNodes is the number of points of every peer on the ring. More points
+// distribute metric names more evenly.
+const virtualNodes = 128
+
+// Ring assigns metric names to peers by consistent hashing. Adding or
+// removing a peer only moves the names owned by that peer.
+type Ring struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+// NewRing returns a ring of the given peers. All exporters of a cluster must
+// use the same peers to agree on the owners.
+func NewRing(peers []string) *Ring {
+	r := &Ring{owners: map[uint64]string{}}
+	for _, peer := range peers {
+		for i := 0; i < virtualNodes; i++ {
+			point := hash(peer + "#" + strconv.Itoa(i))
+			if _, ok := r.owners[point]; ok {
+				continue
+			}
+			r.owners[point] = peer
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Owner returns the peer owning the given metric name, or "" if the ring is
+// empty.
+func (r *Ring) Owner(metricName string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hash(metricName)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
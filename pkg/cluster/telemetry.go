@@ -0,0 +1,38 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	eventsForwarded = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_cluster_events_forwarded_total",
+			Help: "The total number of events forwarded to the peer owning their metric.",
+		},
+	)
+	forwardErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_cluster_forward_errors_total",
+			Help: "The number of errors forwarding events to peers.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(eventsForwarded)
+	prometheus.MustRegister(forwardErrors)
+}
@@ -0,0 +1,136 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package event defines the StatsD events passed from the listeners to the
+// exporter.
+package event
+
+import (
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+type Event interface {
+	MetricName() string
+	Value() float64
+	Labels() map[string]string
+	MetricType() mapper.MetricType
+}
+
+type CounterEvent struct {
+	CMetricName string
+	CValue      float64
+	CLabels     map[string]string
+}
+
+// NewCounterEvent returns an event that increments the counter metricName by
+// value. The event takes ownership of labels, which may be nil.
+func NewCounterEvent(metricName string, value float64, labels map[string]string) *CounterEvent {
+	return &CounterEvent{CMetricName: metricName, CValue: value, CLabels: ensureLabels(labels)}
+}
+
+func (c *CounterEvent) MetricName() string            { return c.CMetricName }
+func (c *CounterEvent) Value() float64                { return c.CValue }
+func (c *CounterEvent) Labels() map[string]string     { return c.CLabels }
+func (c *CounterEvent) MetricType() mapper.MetricType { return mapper.MetricTypeCounter }
+
+type GaugeEvent struct {
+	GMetricName string
+	GValue      float64
+	GRelative   bool
+	GLabels     map[string]string
+}
+
+// NewGaugeEvent returns an event that sets the gauge metricName to value, or
+// adds value to it if relative is true. The event takes ownership of labels,
+// which may be nil.
+func NewGaugeEvent(metricName string, value float64, relative bool, labels map[string]string) *GaugeEvent {
+	return &GaugeEvent{GMetricName: metricName, GValue: value, GRelative: relative, GLabels: ensureLabels(labels)}
+}
+
+func (g *GaugeEvent) MetricName() string            { return g.GMetricName }
+func (g *GaugeEvent) Value() float64                { return g.GValue }
+func (c *GaugeEvent) Labels() map[string]string     { return c.GLabels }
+func (c *GaugeEvent) MetricType() mapper.MetricType { return mapper.MetricTypeGauge }
+
+type TimerEvent struct {
+	TMetricName string
+	TValue      float64
+	TLabels     map[string]string
+}
+
+// NewTimerEvent returns an event that observes value, in milliseconds, for the
+// timer metricName. The event takes ownership of labels, which may be nil.
+func NewTimerEvent(metricName string, value float64, labels map[string]string) *TimerEvent {
+	return &TimerEvent{TMetricName: metricName, TValue: value, TLabels: ensureLabels(labels)}
+}
+
+func (t *TimerEvent) MetricName() string            { return t.TMetricName }
+func (t *TimerEvent) Value() float64                { return t.TValue }
+func (c *TimerEvent) Labels() map[string]string     { return c.TLabels }
+func (c *TimerEvent) MetricType() mapper.MetricType { return mapper.MetricTypeTimer }
+
+// SetEvent adds an element to a StatsD set. As it adds a single element, its
+// value is always 1.
+type SetEvent struct {
+	SMetricName string
+	SElement    string
+	SLabels     map[string]string
+}
+
+// NewSetEvent returns an event that adds element to the set metricName. The
+// event takes ownership of labels, which may be nil.
+func NewSetEvent(metricName string, element string, labels map[string]string) *SetEvent {
+	return &SetEvent{SMetricName: metricName, SElement: element, SLabels: ensureLabels(labels)}
+}
+
+func (s *SetEvent) MetricName() string            { return s.SMetricName }
+func (s *SetEvent) Value() float64                { return 1 }
+func (s *SetEvent) Element() string               { return s.SElement }
+func (s *SetEvent) Labels() map[string]string     { return s.SLabels }
+func (s *SetEvent) MetricType() mapper.MetricType { return mapper.MetricTypeSet }
+
+// HistogramEvent merges the buckets of a histogram aggregated by the client.
+// Buckets maps upper bounds to the number of observations in the bucket, not
+// including those of lower buckets. Count includes the observations above the
+// highest bound. Bounds and the sum are in milliseconds, like timer values.
+// Its value is the sum.
+type HistogramEvent struct {
+	HMetricName string
+	HBuckets    map[float64]uint64
+	HSum        float64
+	HCount      uint64
+	HLabels     map[string]string
+}
+
+// NewHistogramEvent returns an event that merges buckets, sum and count into
+// the histogram metricName. The event takes ownership of labels, which may be
+// nil.
+func NewHistogramEvent(metricName string, buckets map[float64]uint64, sum float64, count uint64, labels map[string]string) *HistogramEvent {
+	return &HistogramEvent{HMetricName: metricName, HBuckets: buckets, HSum: sum, HCount: count, HLabels: ensureLabels(labels)}
+}
+
+func (h *HistogramEvent) MetricName() string            { return h.HMetricName }
+func (h *HistogramEvent) Value() float64                { return h.HSum }
+func (h *HistogramEvent) Labels() map[string]string     { return h.HLabels }
+func (h *HistogramEvent) MetricType() mapper.MetricType { return mapper.MetricTypeTimer }
+
+type Events []Event
+
+// ensureLabels returns labels, or an empty map if labels is nil. The exporter
+// adds mapped labels to the map of an event.
+func ensureLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return map[string]string{}
+	}
+	return labels
+}
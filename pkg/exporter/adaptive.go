@@ -0,0 +1,56 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import "time"
+
+// adaptiveFlushRange is how far an adaptive flush interval shrinks below its
+// configured value.
+const adaptiveFlushRange = 16
+
+// adaptiveFlush adapts a flush interval to the load when FlushThreshold is
+// set. The configured interval is the upper bound.
+type adaptiveFlush struct {
+	interval time.Duration
+	// events is the number of events pending since the last flush.
+	events int
+}
+
+// due returns whether the pending events are to be applied elapsed after the
+// last flush. Reaching the threshold applies them right away and halves the
+// interval, so that bursts are applied in full batches without waiting. An
+// interval passing without events doubles it again, but does not count as a
+// flush, so that the first event after an idle period is applied at once.
+func (a *adaptiveFlush) due(max time.Duration, threshold int, elapsed time.Duration) bool {
+	if a.interval == 0 {
+		a.interval = max
+	}
+	switch {
+	case a.events >= threshold:
+		a.interval /= 2
+		if min := max / adaptiveFlushRange; a.interval < min {
+			a.interval = min
+		}
+		return true
+	case elapsed < a.interval:
+		return false
+	case a.events == 0:
+		a.interval *= 2
+		if a.interval > max {
+			a.interval = max
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/clock"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// timerWindow accumulates the observations of a single timer series within
+// one aggregation window, like StatsD does between two flushes.
+type timerWindow struct {
+	metricName string
+	labels     prometheus.Labels
+	help       string
+	mapping    *mapper.MetricMapping
+
+	count      float64
+	sum        float64
+	sumSquares float64
+	min        float64
+	max        float64
+}
+
+// addTimerObservation records a timer observation, in the unit it was
+// received in, in the current aggregation window of its series.
+func (b *Exporter) addTimerObservation(metricName string, labels prometheus.Labels, help string, value float64, mapping *mapper.MetricMapping) {
+	if b.lastTimerFlush.IsZero() {
+		// The first window starts with the first observation.
+		b.lastTimerFlush = clock.Now()
+	}
+	hash := hashNameAndLabels(metricName, labels)
+	w, ok := b.timerWindows[hash]
+	if !ok {
+		w = &timerWindow{
+			metricName: metricName,
+			labels:     labels,
+			help:       help,
+		}
+		b.timerWindows[hash] = w
+	}
+	if w.count == 0 || value < w.min {
+		w.min = value
+	}
+	if w.count == 0 || value > w.max {
+		w.max = value
+	}
+	w.count++
+	w.sum += value
+	w.sumSquares += value * value
+	w.mapping = mapping
+}
+
+// maybeFlushTimerWindows flushes the timer aggregation windows if the
+// aggregation interval has passed.
+func (b *Exporter) maybeFlushTimerWindows() {
+	if len(b.timerWindows) > 0 && clock.Now().Sub(b.lastTimerFlush) >= b.TimerAggregateInterval {
+		b.flushTimerWindows()
+	}
+}
+
+// flushTimerWindows sets the aggregate gauges of every timer series observed
+// since the last flush. Series without observations in the last window only
+// have their count reset to 0, and are forgotten afterwards.
+func (b *Exporter) flushTimerWindows() {
+	if len(b.timerWindows) == 0 {
+		return
+	}
+	for hash, w := range b.timerWindows {
+		aggregates := map[string]float64{"_window_count": w.count}
+		if w.count > 0 {
+			mean := w.sum / w.count
+			aggregates["_min"] = w.min
+			aggregates["_max"] = w.max
+			aggregates["_mean"] = mean
+			aggregates["_stddev"] = math.Sqrt(math.Max(w.sumSquares/w.count-mean*mean, 0))
+		} else {
+			delete(b.timerWindows, hash)
+		}
+		for suffix, value := range aggregates {
+			gaugeName := w.metricName + suffix
+			b.origins[gaugeName] = w.mapping.Match
+			gauge, err := b.Gauges.Get(gaugeName, w.labels, w.help)
+			if err != nil {
+				log.Debugf(regErrF, gaugeName, err)
+				conflictingEventStats.WithLabelValues("timer").Inc()
+				continue
+			}
+			gauge.Set(value)
+			b.saveLabelValues(gaugeName, w.labels, w.mapping)
+		}
+		w.count, w.sum, w.sumSquares = 0, 0, 0
+	}
+	b.lastTimerFlush = clock.Now()
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/beorn7/perks/quantile"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// biasedEpsilon is the error of all quantiles exposed for biased summaries,
+// relative to the distance of the quantile from 1.
+const biasedEpsilon = 0.01
+
+// biasedVec is a collector exposing one summary per label set, whose
+// quantiles are estimated by a high-biased CKMS stream. Unlike a targeted
+// stream, its cost does not grow with the number of configured quantiles.
+type biasedVec struct {
+	desc       *prometheus.Desc
+	labelNames []string
+	quantiles  []float64
+
+	// mtx only guards the series map, each series has its own lock, so that
+	// a scrape computing quantiles does not block observations of the
+	// other series.
+	mtx    sync.Mutex
+	series map[uint64]*biasedSeries
+}
+
+type biasedSeries struct {
+	labelValues []string
+
+	mtx    sync.Mutex
+	stream *quantile.Stream
+	count  uint64
+	sum    float64
+}
+
+func newBiasedVec(name, help string, labelNames []string, quantiles []float64) *biasedVec {
+	return &biasedVec{
+		desc:       prometheus.NewDesc(name, help, labelNames, nil),
+		labelNames: labelNames,
+		quantiles:  quantiles,
+		series:     map[uint64]*biasedSeries{},
+	}
+}
+
+func (v *biasedVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+func (v *biasedVec) Collect(ch chan<- prometheus.Metric) {
+	v.mtx.Lock()
+	series := make([]*biasedSeries, 0, len(v.series))
+	for _, s := range v.series {
+		series = append(series, s)
+	}
+	v.mtx.Unlock()
+
+	for _, s := range series {
+		quantiles := make(map[float64]float64, len(v.quantiles))
+		s.mtx.Lock()
+		for _, q := range v.quantiles {
+			quantiles[q] = s.stream.Query(q)
+		}
+		count, sum := s.count, s.sum
+		s.mtx.Unlock()
+		ch <- prometheus.MustNewConstSummary(v.desc, count, sum, quantiles, s.labelValues...)
+	}
+}
+
+// getMetricWith returns an Observer for the series with the given labels,
+// creating it if necessary.
+func (v *biasedVec) getMetricWith(labels prometheus.Labels) (prometheus.Observer, error) {
+	if len(labels) != len(v.labelNames) {
+		return nil, fmt.Errorf("inconsistent label cardinality: expected %d label values but got %d in %#v", len(v.labelNames), len(labels), labels)
+	}
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		value, ok := labels[name]
+		if !ok {
+			return nil, fmt.Errorf("label name %q missing in label map", name)
+		}
+		labelValues[i] = value
+	}
+
+	hash := model.LabelsToSignature(labels)
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	s, ok := v.series[hash]
+	if !ok {
+		s = &biasedSeries{labelValues: labelValues, stream: quantile.NewHighBiased(biasedEpsilon)}
+		v.series[hash] = s
+	}
+	return &biasedObserver{series: s}, nil
+}
+
+// delete removes the series with the given labels. It reports whether the
+// series existed.
+func (v *biasedVec) delete(labels prometheus.Labels) bool {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	hash := model.LabelsToSignature(labels)
+	_, ok := v.series[hash]
+	delete(v.series, hash)
+	return ok
+}
+
+type biasedObserver struct {
+	series *biasedSeries
+}
+
+func (o *biasedObserver) Observe(value float64) {
+	o.series.mtx.Lock()
+	defer o.series.mtx.Unlock()
+	o.series.stream.Insert(value)
+	o.series.count++
+	o.series.sum += value
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// bucketedVec is a collector exposing one histogram per label set, which
+// accepts the buckets of histograms aggregated by clients besides single
+// observations.
+type bucketedVec struct {
+	desc       *prometheus.Desc
+	labelNames []string
+	// buckets are the sorted upper bounds, without +Inf.
+	buckets []float64
+
+	// mtx only guards the series map, each series has its own lock.
+	mtx    sync.Mutex
+	series map[uint64]*bucketedSeries
+}
+
+type bucketedSeries struct {
+	labelValues []string
+
+	mtx sync.Mutex
+	// counts holds the number of observations per bucket, not including
+	// those of lower buckets. The last one is the +Inf bucket.
+	counts []uint64
+	sum    float64
+}
+
+func newBucketedVec(name, help string, labelNames []string, buckets []float64) *bucketedVec {
+	bounds := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		if !math.IsInf(b, +1) {
+			bounds = append(bounds, b)
+		}
+	}
+	sort.Float64s(bounds)
+	return &bucketedVec{
+		desc:       prometheus.NewDesc(name, help, labelNames, nil),
+		labelNames: labelNames,
+		buckets:    bounds,
+		series:     map[uint64]*bucketedSeries{},
+	}
+}
+
+func (v *bucketedVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+func (v *bucketedVec) Collect(ch chan<- prometheus.Metric) {
+	v.mtx.Lock()
+	series := make([]*bucketedSeries, 0, len(v.series))
+	for _, s := range v.series {
+		series = append(series, s)
+	}
+	v.mtx.Unlock()
+
+	for _, s := range series {
+		buckets := make(map[float64]uint64, len(v.buckets))
+		var count uint64
+		s.mtx.Lock()
+		for i, bound := range v.buckets {
+			count += s.counts[i]
+			buckets[bound] = count
+		}
+		count += s.counts[len(v.buckets)]
+		sum := s.sum
+		s.mtx.Unlock()
+		ch <- prometheus.MustNewConstHistogram(v.desc, count, sum, buckets, s.labelValues...)
+	}
+}
+
+// getMetricWith returns the series with the given labels, creating it if
+// necessary.
+func (v *bucketedVec) getMetricWith(labels prometheus.Labels) (*bucketedObserver, error) {
+	if len(labels) != len(v.labelNames) {
+		return nil, fmt.Errorf("inconsistent label cardinality: expected %d label values but got %d in %#v", len(v.labelNames), len(labels), labels)
+	}
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		value, ok := labels[name]
+		if !ok {
+			return nil, fmt.Errorf("label name %q missing in label map", name)
+		}
+		labelValues[i] = value
+	}
+
+	hash := model.LabelsToSignature(labels)
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	s, ok := v.series[hash]
+	if !ok {
+		s = &bucketedSeries{labelValues: labelValues, counts: make([]uint64, len(v.buckets)+1)}
+		v.series[hash] = s
+	}
+	return &bucketedObserver{vec: v, series: s}, nil
+}
+
+// delete removes the series with the given labels. It reports whether the
+// series existed.
+func (v *bucketedVec) delete(labels prometheus.Labels) bool {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	hash := model.LabelsToSignature(labels)
+	_, ok := v.series[hash]
+	delete(v.series, hash)
+	return ok
+}
+
+type bucketedObserver struct {
+	vec    *bucketedVec
+	series *bucketedSeries
+}
+
+func (o *bucketedObserver) Observe(value float64) {
+	o.series.mtx.Lock()
+	defer o.series.mtx.Unlock()
+	o.series.counts[sort.SearchFloat64s(o.vec.buckets, value)]++
+	o.series.sum += value
+}
+
+// merge adds the buckets of a histogram aggregated by a client. Each bucket
+// is counted in the lowest bucket of the series whose upper bound is not
+// below its own, so bounds missing from the series make the histogram less
+// precise, but not wrong. Observations not in buckets, count minus their
+// total, are counted in the +Inf bucket.
+func (o *bucketedObserver) merge(buckets map[float64]uint64, sum float64, count uint64) {
+	o.series.mtx.Lock()
+	defer o.series.mtx.Unlock()
+	var total uint64
+	for bound, n := range buckets {
+		o.series.counts[sort.SearchFloat64s(o.vec.buckets, bound)] += n
+		total += n
+	}
+	o.series.counts[len(o.vec.buckets)] += count - total
+	o.series.sum += sum
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// childCache keeps the series of the vecs of a container by the signature of
+// their labels. Events of existing series then skip the label checks and the
+// lock of the vec, which a scrape holds while collecting it.
+type childCache map[string]map[uint64]cachedChild
+
+type cachedChild struct {
+	// vec is the vec the series belongs to. Series of a vec that was
+	// replaced, by widening it for example, are not returned.
+	vec    prometheus.Collector
+	metric prometheus.Metric
+}
+
+// get returns the cached series of vec with the given labels.
+func (c childCache) get(metricName string, vec prometheus.Collector, labels prometheus.Labels) (prometheus.Metric, uint64, bool) {
+	hash := model.LabelsToSignature(labels)
+	child, ok := c[metricName][hash]
+	if !ok || child.vec != vec {
+		return nil, hash, false
+	}
+	return child.metric, hash, true
+}
+
+func (c childCache) put(metricName string, vec prometheus.Collector, hash uint64, metric prometheus.Metric) {
+	children, ok := c[metricName]
+	if !ok {
+		children = map[uint64]cachedChild{}
+		c[metricName] = children
+	}
+	children[hash] = cachedChild{vec: vec, metric: metric}
+}
+
+// delete forgets the series with the given labels.
+func (c childCache) delete(metricName string, labels prometheus.Labels) {
+	if children, ok := c[metricName]; ok {
+		delete(children, model.LabelsToSignature(labels))
+	}
+}
+
+// forget forgets all series of a metric.
+func (c childCache) forget(metricName string) {
+	delete(c, metricName)
+}
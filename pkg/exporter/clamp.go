@@ -0,0 +1,98 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// applyValueRange applies the value range of a mapping to counter
+// increments, absolute gauge values and timer observations. It returns the
+// event to handle, with its value clamped if necessary, or false if the event
+// is to be dropped.
+func applyValueRange(e event.Event, mapping *mapper.MetricMapping) (event.Event, bool) {
+	if mapping.MinValue == nil && mapping.MaxValue == nil {
+		return e, true
+	}
+	switch ev := e.(type) {
+	case *event.CounterEvent, *event.TimerEvent:
+	case *event.GaugeEvent:
+		if ev.GRelative {
+			return e, true
+		}
+	default:
+		return e, true
+	}
+	value := e.Value()
+	switch {
+	case mapping.MinValue != nil && value < *mapping.MinValue:
+		value = *mapping.MinValue
+	case mapping.MaxValue != nil && value > *mapping.MaxValue:
+		value = *mapping.MaxValue
+	default:
+		return e, true
+	}
+
+	metricType := string(e.MetricType())
+	if mapping.OutOfRange == mapper.OutOfRangeDrop {
+		valuesOutOfRange.WithLabelValues(metricType, string(mapper.OutOfRangeDrop)).Inc()
+		return nil, false
+	}
+	e = withValue(e, value)
+	valuesOutOfRange.WithLabelValues(metricType, string(mapper.OutOfRangeClamp)).Inc()
+	return e, true
+}
+
+// roundValue rounds the values of counter, gauge and timer events to the
+// nearest multiple of the round_to of their mapping.
+func roundValue(e event.Event, mapping *mapper.MetricMapping) event.Event {
+	if mapping.RoundTo <= 0 {
+		return e
+	}
+	switch e.(type) {
+	case *event.CounterEvent, *event.GaugeEvent, *event.TimerEvent:
+	default:
+		return e
+	}
+	value := math.Round(e.Value()/mapping.RoundTo) * mapping.RoundTo
+	// Multiplying by e.g. 0.1 leaves noise in the last digits, drop
+	// the digits the step does not have.
+	step := strconv.FormatFloat(mapping.RoundTo, 'f', -1, 64)
+	if i := strings.IndexByte(step, '.'); i >= 0 {
+		value, _ = strconv.ParseFloat(strconv.FormatFloat(value, 'f', len(step)-i-1, 64), 64)
+	}
+	if value == e.Value() {
+		return e
+	}
+	return withValue(e, value)
+}
+
+// withValue returns a copy of a counter, gauge or timer event with another
+// value.
+func withValue(e event.Event, value float64) event.Event {
+	switch ev := e.(type) {
+	case *event.CounterEvent:
+		return event.NewCounterEvent(ev.CMetricName, value, ev.CLabels)
+	case *event.GaugeEvent:
+		return event.NewGaugeEvent(ev.GMetricName, value, ev.GRelative, ev.GLabels)
+	case *event.TimerEvent:
+		return event.NewTimerEvent(ev.TMetricName, value, ev.TLabels)
+	}
+	return e
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"github.com/prometheus/common/log"
+)
+
+// TypeConflictPolicy decides what happens to events for a metric name that
+// is in use by a metric of another type.
+type TypeConflictPolicy string
+
+const (
+	// TypeConflictDrop drops the events.
+	TypeConflictDrop TypeConflictPolicy = "drop"
+	// TypeConflictSuffix exports the events under the metric name
+	// suffixed with their type, e.g. "_gauge".
+	TypeConflictSuffix TypeConflictPolicy = "suffix"
+	// TypeConflictReplace replaces the metric once all its series have
+	// expired, and drops the events until then.
+	TypeConflictReplace TypeConflictPolicy = "replace"
+)
+
+// resolveTypeConflict returns the name to export an event of the given type
+// under, following the TypeConflictPolicy if the metric name is in use by a
+// metric of another type. It returns false if the event is to be dropped.
+func (b *Exporter) resolveTypeConflict(metricName, metricType string) (string, bool) {
+	seen, ok := b.metricTypes[metricName]
+	if !ok || seen == metricType {
+		b.metricTypes[metricName] = metricType
+		return metricName, true
+	}
+
+	switch b.TypeConflictPolicy {
+	case TypeConflictSuffix:
+		suffixed := metricName + "_" + metricType
+		if seen, ok := b.metricTypes[suffixed]; !ok || seen == metricType {
+			b.metricTypes[suffixed] = metricType
+			typeConflicts.WithLabelValues(metricName, metricType).Set(1)
+			return suffixed, true
+		}
+	case TypeConflictReplace:
+		if len(b.labelValues[metricName]) == 0 {
+			log.Debugf("Replacing %s %q by a %s, all its series have expired", seen, metricName, metricType)
+			b.Counters.remove(metricName)
+			b.Gauges.remove(metricName)
+			b.Summaries.remove(metricName)
+			b.Histograms.remove(metricName)
+			b.Sketches.remove(metricName)
+			b.metricTypes[metricName] = metricType
+			typeConflicts.DeleteLabelValues(metricName, metricType)
+			return metricName, true
+		}
+	}
+	log.Debugf("Dropping %s event for %q, the name is in use by a %s", metricType, metricName, seen)
+	typeConflicts.WithLabelValues(metricName, metricType).Set(1)
+	return "", false
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DeleteSeries deletes the series of the metric with the given name that
+// have all of the given labels, and returns how many it deleted. Updates of
+// those series waiting for a flush are dropped along with them.
+func (b *Exporter) DeleteSeries(metricName string, labels prometheus.Labels) int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	deleted := 0
+	for hash, lvs := range b.labelValues[metricName] {
+		if !hasLabels(lvs.labels, labels) {
+			continue
+		}
+		b.Counters.Delete(metricName, lvs.labels)
+		b.Gauges.Delete(metricName, lvs.labels)
+		b.Summaries.Delete(metricName, lvs.labels)
+		b.Histograms.Delete(metricName, lvs.labels)
+		b.Sketches.Delete(metricName, lvs.labels)
+		delete(b.labelValues[metricName], hash)
+		delete(b.sets, hash)
+		delete(b.pendingCounters, hash)
+		delete(b.pendingGauges, hash)
+		delete(b.pendingTimers, hash)
+		delete(b.timerWindows, hash)
+		b.series--
+		deleted++
+	}
+	return deleted
+}
+
+// hasLabels reports whether labels contains all of want.
+func hasLabels(labels, want prometheus.Labels) bool {
+	for name, value := range want {
+		if v, ok := labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiry is a point in time at which a series may expire.
+type expiry struct {
+	deadline   time.Time
+	metricName string
+	hash       uint64
+	lvs        *LabelValues
+}
+
+// expiryQueue is a min-heap of expiries by deadline, so that removing stale
+// series only touches the series whose deadline has passed. Every series
+// with a TTL has an entry. Events extending the TTL of a series don't update
+// it: once the deadline passes, the series is checked, and scheduled again
+// if it was updated in the meantime.
+type expiryQueue []expiry
+
+func (q expiryQueue) Len() int            { return len(q) }
+func (q expiryQueue) Less(i, j int) bool  { return q[i].deadline.Before(q[j].deadline) }
+func (q expiryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x interface{}) { *q = append(*q, x.(expiry)) }
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = expiry{}
+	*q = old[:len(old)-1]
+	return e
+}
+
+// scheduleExpiry makes sure the series is checked for expiry no later than
+// deadline.
+func (b *Exporter) scheduleExpiry(metricName string, hash uint64, lvs *LabelValues, deadline time.Time) {
+	if !lvs.expiresAt.IsZero() && !deadline.Before(lvs.expiresAt) {
+		return
+	}
+	lvs.expiresAt = deadline
+	heap.Push(&b.expiries, expiry{deadline: deadline, metricName: metricName, hash: hash, lvs: lvs})
+}
+
+// nextExpiry removes and returns the first entry of the expiry queue that is
+// due at now, skipping the entries of deleted series and entries superseded
+// by an earlier deadline.
+func (b *Exporter) nextExpiry(now time.Time) (expiry, bool) {
+	for len(b.expiries) > 0 && b.expiries[0].deadline.Before(now) {
+		e := heap.Pop(&b.expiries).(expiry)
+		if b.labelValues[e.metricName][e.hash] != e.lvs || !e.lvs.expiresAt.Equal(e.deadline) {
+			continue
+		}
+		e.lvs.expiresAt = time.Time{}
+		return e, true
+	}
+	return expiry{}, false
+}
+
+// expiryJitter returns the random duration added to a ttl.
+func (b *Exporter) expiryJitter(ttl time.Duration) time.Duration {
+	if b.ExpiryJitter <= 0 || ttl == 0 {
+		return 0
+	}
+	return time.Duration(b.random() * b.ExpiryJitter * float64(ttl))
+}
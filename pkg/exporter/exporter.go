@@ -0,0 +1,1539 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exporter turns StatsD events into Prometheus metrics according to a
+// metric mapping.
+package exporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/statsd_exporter/pkg/clock"
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+const (
+	defaultHelp = "Metric autogenerated by statsd_exporter."
+	regErrF     = "A change of configuration created inconsistent metrics for " +
+		"%q. You have to restart the statsd_exporter, and you should " +
+		"consider the effects on your monitoring setup. Error: %s"
+)
+
+const (
+	// Inline FNV-1a parameters, see hash/fnv.
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+func labelNames(labels prometheus.Labels) []string {
+	names := make([]string, 0, len(labels))
+	for labelName := range labels {
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hashNameAndLabels returns a hash value of the provided name string and all
+// the label names and values in the provided labels map.
+//
+// The FNV-1a hash is computed inline, so that several Exporters can hash
+// concurrently without allocating a hasher per call.
+func hashNameAndLabels(name string, labels prometheus.Labels) uint64 {
+	var intBuf [8]byte
+	hash := uint64(offset64)
+	for i := 0; i < len(name); i++ {
+		hash ^= uint64(name[i])
+		hash *= prime64
+	}
+	binary.BigEndian.PutUint64(intBuf[:], model.LabelsToSignature(labels))
+	for _, b := range intBuf {
+		hash ^= uint64(b)
+		hash *= prime64
+	}
+	return hash
+}
+
+type CounterContainer struct {
+	//           metric name
+	Elements   map[string]*prometheus.CounterVec
+	help       map[string]string
+	children   childCache
+	labelSets  labelSets
+	widened    widenedCollectors
+	registerer prometheus.Registerer
+}
+
+func NewCounterContainer() *CounterContainer {
+	return &CounterContainer{
+		Elements:   make(map[string]*prometheus.CounterVec),
+		help:       make(map[string]string),
+		children:   make(childCache),
+		labelSets:  make(labelSets),
+		widened:    make(widenedCollectors),
+		registerer: prometheus.DefaultRegisterer,
+	}
+}
+
+// Get returns the counter series with the given labels. Label names the
+// counter was registered with that are missing from labels are set to "".
+// Additional label names widen the counter, keeping the values of its series.
+func (c *CounterContainer) Get(metricName string, labels prometheus.Labels, help string) (prometheus.Counter, error) {
+	labels, widened := c.labelSets.conform(metricName, labels)
+	counterVec, ok := c.Elements[metricName]
+	if ok && widened != nil {
+		var err error
+		if counterVec, err = c.widen(metricName, widened); err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		counterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: metricName,
+			Help: help,
+		}, labelNames(labels))
+		if err := c.widened.register(c.registerer, metricName, counterVec); err != nil {
+			return nil, err
+		}
+		c.Elements[metricName] = counterVec
+		c.help[metricName] = help
+		c.labelSets[metricName] = labelNames(labels)
+	}
+	child, hash, ok := c.children.get(metricName, counterVec, labels)
+	if ok {
+		return child.(prometheus.Counter), nil
+	}
+	counter, err := counterVec.GetMetricWith(labels)
+	if err != nil {
+		return nil, err
+	}
+	c.children.put(metricName, counterVec, hash, counter)
+	return counter, nil
+}
+
+// widen re-registers a counter with the given label names, carrying over the
+// values of its series.
+func (c *CounterContainer) widen(metricName string, names []string) (*prometheus.CounterVec, error) {
+	old := c.Elements[metricName]
+	counterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: metricName,
+		Help: c.help[metricName],
+	}, names)
+	for _, v := range collectValues(old) {
+		counterVec.With(padLabels(v.labels, names)).Add(v.value)
+	}
+	if err := c.widened.unregister(c.registerer, metricName, old); err != nil {
+		return nil, err
+	}
+	if err := c.widened.register(c.registerer, metricName, counterVec); err != nil {
+		return nil, err
+	}
+	c.Elements[metricName] = counterVec
+	c.children.forget(metricName)
+	c.labelSets[metricName] = names
+	labelSetsWidened.WithLabelValues("counter").Inc()
+	return counterVec, nil
+}
+
+// remove unregisters a counter, so that its name can be used by a metric of
+// another type.
+func (c *CounterContainer) remove(metricName string) {
+	if vec, ok := c.Elements[metricName]; ok {
+		c.widened.remove(c.registerer, metricName, vec)
+		delete(c.Elements, metricName)
+		c.children.forget(metricName)
+		delete(c.labelSets, metricName)
+	}
+}
+
+func (c *CounterContainer) Delete(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if _, ok := c.Elements[metricName]; ok {
+		c.Elements[metricName].Delete(labels)
+		c.children.delete(metricName, labels)
+	}
+}
+
+// Reset replaces an existing series with one at its zero value.
+func (c *CounterContainer) Reset(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if vec, ok := c.Elements[metricName]; ok && vec.Delete(labels) {
+		c.children.delete(metricName, labels)
+		vec.With(labels)
+	}
+}
+
+type GaugeContainer struct {
+	Elements map[string]*prometheus.GaugeVec
+	// help records the help text of every gauge, to persist gauges.
+	help       map[string]string
+	children   childCache
+	labelSets  labelSets
+	widened    widenedCollectors
+	registerer prometheus.Registerer
+}
+
+func NewGaugeContainer() *GaugeContainer {
+	return &GaugeContainer{
+		Elements:   make(map[string]*prometheus.GaugeVec),
+		help:       make(map[string]string),
+		children:   make(childCache),
+		labelSets:  make(labelSets),
+		widened:    make(widenedCollectors),
+		registerer: prometheus.DefaultRegisterer,
+	}
+}
+
+// Get returns the gauge series with the given labels. Label names the gauge
+// was registered with that are missing from labels are set to "". Additional
+// label names widen the gauge, keeping the values of its series.
+func (c *GaugeContainer) Get(metricName string, labels prometheus.Labels, help string) (prometheus.Gauge, error) {
+	labels, widened := c.labelSets.conform(metricName, labels)
+	gaugeVec, ok := c.Elements[metricName]
+	if ok && widened != nil {
+		var err error
+		if gaugeVec, err = c.widen(metricName, widened); err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		gaugeVec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: metricName,
+			Help: help,
+		}, labelNames(labels))
+		if err := c.widened.register(c.registerer, metricName, gaugeVec); err != nil {
+			return nil, err
+		}
+		c.Elements[metricName] = gaugeVec
+		c.help[metricName] = help
+		c.labelSets[metricName] = labelNames(labels)
+	}
+	child, hash, ok := c.children.get(metricName, gaugeVec, labels)
+	if ok {
+		return child.(prometheus.Gauge), nil
+	}
+	gauge, err := gaugeVec.GetMetricWith(labels)
+	if err != nil {
+		return nil, err
+	}
+	c.children.put(metricName, gaugeVec, hash, gauge)
+	return gauge, nil
+}
+
+// widen re-registers a gauge with the given label names, carrying over the
+// values of its series.
+func (c *GaugeContainer) widen(metricName string, names []string) (*prometheus.GaugeVec, error) {
+	old := c.Elements[metricName]
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: metricName,
+		Help: c.help[metricName],
+	}, names)
+	for _, v := range collectValues(old) {
+		gaugeVec.With(padLabels(v.labels, names)).Set(v.value)
+	}
+	if err := c.widened.unregister(c.registerer, metricName, old); err != nil {
+		return nil, err
+	}
+	if err := c.widened.register(c.registerer, metricName, gaugeVec); err != nil {
+		return nil, err
+	}
+	c.Elements[metricName] = gaugeVec
+	c.children.forget(metricName)
+	c.labelSets[metricName] = names
+	labelSetsWidened.WithLabelValues("gauge").Inc()
+	return gaugeVec, nil
+}
+
+// remove unregisters a gauge, so that its name can be used by a metric of
+// another type.
+func (c *GaugeContainer) remove(metricName string) {
+	if vec, ok := c.Elements[metricName]; ok {
+		c.widened.remove(c.registerer, metricName, vec)
+		delete(c.Elements, metricName)
+		c.children.forget(metricName)
+		delete(c.labelSets, metricName)
+	}
+}
+
+func (c *GaugeContainer) Delete(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if _, ok := c.Elements[metricName]; ok {
+		c.Elements[metricName].Delete(labels)
+		c.children.delete(metricName, labels)
+	}
+}
+
+// Reset replaces an existing series with one at its zero value.
+func (c *GaugeContainer) Reset(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if vec, ok := c.Elements[metricName]; ok && vec.Delete(labels) {
+		c.children.delete(metricName, labels)
+		vec.With(labels)
+	}
+}
+
+type SummaryContainer struct {
+	Elements map[string]*prometheus.SummaryVec
+	// biased holds the summaries using the biased quantile algorithm.
+	biased     map[string]*biasedVec
+	help       map[string]string
+	labelSets  labelSets
+	widened    widenedCollectors
+	mapper     *mapper.MetricMapper
+	registerer prometheus.Registerer
+}
+
+func NewSummaryContainer(mapper *mapper.MetricMapper) *SummaryContainer {
+	return &SummaryContainer{
+		Elements:   make(map[string]*prometheus.SummaryVec),
+		biased:     make(map[string]*biasedVec),
+		help:       make(map[string]string),
+		labelSets:  make(labelSets),
+		widened:    make(widenedCollectors),
+		mapper:     mapper,
+		registerer: prometheus.DefaultRegisterer,
+	}
+}
+
+// Get returns the summary series with the given labels. Label names the
+// summary was registered with that are missing from labels are set to "".
+// Additional label names re-register the summary, dropping its observations
+// so far.
+func (c *SummaryContainer) Get(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping) (prometheus.Observer, error) {
+	labels, widened := c.labelSets.conform(metricName, labels)
+	if widened != nil {
+		if err := c.unregister(metricName); err != nil {
+			return nil, err
+		}
+	}
+	if vec, ok := c.biased[metricName]; ok {
+		return vec.getMetricWith(labels)
+	}
+	summaryVec, ok := c.Elements[metricName]
+	if !ok {
+		quantiles := c.mapper.Defaults.Quantiles
+		if len(quantiles) == 0 {
+			quantiles = c.mapper.DefaultQuantiles
+		}
+		if mapping != nil && mapping.Quantiles != nil && len(mapping.Quantiles) > 0 {
+			quantiles = mapping.Quantiles
+		}
+		algorithm := c.mapper.Defaults.QuantileAlgorithm
+		if mapping != nil && mapping.QuantileAlgorithm != mapper.QuantileAlgorithmDefault {
+			algorithm = mapping.QuantileAlgorithm
+		}
+		if algorithm == mapper.QuantileAlgorithmBiased {
+			return c.getBiased(metricName, labels, help, quantiles)
+		}
+		objectives := make(map[float64]float64)
+		for _, q := range quantiles {
+			objectives[q.Quantile] = q.Error
+		}
+		summaryVec = prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name:       metricName,
+				Help:       help,
+				Objectives: objectives,
+			}, labelNames(labels))
+		if err := c.widened.register(c.registerer, metricName, summaryVec); err != nil {
+			return nil, err
+		}
+		c.Elements[metricName] = summaryVec
+		c.help[metricName] = help
+		c.labelSets[metricName] = labelNames(labels)
+	}
+	return summaryVec.GetMetricWith(labels)
+}
+
+func (c *SummaryContainer) getBiased(metricName string, labels prometheus.Labels, help string, objectives []mapper.MetricObjective) (prometheus.Observer, error) {
+	quantiles := make([]float64, 0, len(objectives))
+	for _, q := range objectives {
+		quantiles = append(quantiles, q.Quantile)
+	}
+	vec := newBiasedVec(metricName, help, labelNames(labels), quantiles)
+	if err := c.widened.register(c.registerer, metricName, vec); err != nil {
+		return nil, err
+	}
+	c.biased[metricName] = vec
+	c.help[metricName] = help
+	c.labelSets[metricName] = labelNames(labels)
+	return vec.getMetricWith(labels)
+}
+
+// unregister removes a summary, to re-register it with other label names.
+func (c *SummaryContainer) unregister(metricName string) error {
+	var collector prometheus.Collector
+	if vec, ok := c.Elements[metricName]; ok {
+		collector = vec
+		delete(c.Elements, metricName)
+	} else if vec, ok := c.biased[metricName]; ok {
+		collector = vec
+		delete(c.biased, metricName)
+	}
+	delete(c.labelSets, metricName)
+	labelSetsWidened.WithLabelValues("summary").Inc()
+	return c.widened.unregister(c.registerer, metricName, collector)
+}
+
+// remove unregisters a summary, so that its name can be used by a metric of
+// another type.
+func (c *SummaryContainer) remove(metricName string) {
+	if vec, ok := c.Elements[metricName]; ok {
+		c.widened.remove(c.registerer, metricName, vec)
+		delete(c.Elements, metricName)
+	}
+	if vec, ok := c.biased[metricName]; ok {
+		c.widened.remove(c.registerer, metricName, vec)
+		delete(c.biased, metricName)
+	}
+	delete(c.labelSets, metricName)
+}
+
+func (c *SummaryContainer) Delete(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if _, ok := c.Elements[metricName]; ok {
+		c.Elements[metricName].Delete(labels)
+	}
+	if vec, ok := c.biased[metricName]; ok {
+		vec.delete(labels)
+	}
+}
+
+// Reset replaces an existing series with one at its zero value.
+func (c *SummaryContainer) Reset(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if vec, ok := c.Elements[metricName]; ok && vec.Delete(labels) {
+		vec.With(labels)
+	}
+	if vec, ok := c.biased[metricName]; ok && vec.delete(labels) {
+		vec.getMetricWith(labels)
+	}
+}
+
+type HistogramContainer struct {
+	Elements map[string]*prometheus.HistogramVec
+	// bucketed holds the histograms created by pre-bucketed events.
+	bucketed   map[string]*bucketedVec
+	help       map[string]string
+	labelSets  labelSets
+	widened    widenedCollectors
+	mapper     *mapper.MetricMapper
+	registerer prometheus.Registerer
+}
+
+func NewHistogramContainer(mapper *mapper.MetricMapper) *HistogramContainer {
+	return &HistogramContainer{
+		Elements:   make(map[string]*prometheus.HistogramVec),
+		bucketed:   make(map[string]*bucketedVec),
+		help:       make(map[string]string),
+		labelSets:  make(labelSets),
+		widened:    make(widenedCollectors),
+		mapper:     mapper,
+		registerer: prometheus.DefaultRegisterer,
+	}
+}
+
+// Get returns the histogram series with the given labels. Label names the
+// histogram was registered with that are missing from labels are set to "".
+// Additional label names re-register the histogram, dropping its
+// observations so far.
+func (c *HistogramContainer) Get(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping) (prometheus.Observer, error) {
+	labels, widened := c.labelSets.conform(metricName, labels)
+	if _, ok := c.bucketed[metricName]; ok && widened != nil {
+		if err := c.unregister(metricName); err != nil {
+			return nil, err
+		}
+		observer, err := c.getBucketed(metricName, labels, help, mapping)
+		if err != nil {
+			return nil, err
+		}
+		return observer, nil
+	}
+	if widened != nil {
+		if err := c.unregister(metricName); err != nil {
+			return nil, err
+		}
+	}
+	if vec, ok := c.bucketed[metricName]; ok {
+		return vec.getMetricWith(labels)
+	}
+	histogramVec, ok := c.Elements[metricName]
+	if !ok {
+		buckets := c.buckets(mapping)
+		histogramVec = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    metricName,
+				Help:    help,
+				Buckets: buckets,
+			}, labelNames(labels))
+		if err := c.widened.register(c.registerer, metricName, histogramVec); err != nil {
+			return nil, err
+		}
+		c.Elements[metricName] = histogramVec
+		c.help[metricName] = help
+		c.labelSets[metricName] = labelNames(labels)
+	}
+	return histogramVec.GetMetricWith(labels)
+}
+
+// getBucketed returns the histogram series for pre-bucketed events. Once it
+// exists, timer observations of the same metric are added to it as well. A
+// histogram created by timer observations first cannot merge buckets.
+func (c *HistogramContainer) getBucketed(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping) (*bucketedObserver, error) {
+	labels, widened := c.labelSets.conform(metricName, labels)
+	if widened != nil {
+		if err := c.unregister(metricName); err != nil {
+			return nil, err
+		}
+	}
+	vec, ok := c.bucketed[metricName]
+	if !ok {
+		if _, ok := c.Elements[metricName]; ok {
+			return nil, fmt.Errorf("histogram %s was created by timer observations and cannot merge buckets", metricName)
+		}
+		vec = newBucketedVec(metricName, help, labelNames(labels), c.buckets(mapping))
+		if err := c.widened.register(c.registerer, metricName, vec); err != nil {
+			return nil, err
+		}
+		c.bucketed[metricName] = vec
+		c.help[metricName] = help
+		c.labelSets[metricName] = labelNames(labels)
+	}
+	return vec.getMetricWith(labels)
+}
+
+// unregister removes a histogram, to re-register it with other label names.
+func (c *HistogramContainer) unregister(metricName string) error {
+	var collector prometheus.Collector
+	if vec, ok := c.Elements[metricName]; ok {
+		collector = vec
+		delete(c.Elements, metricName)
+	} else if vec, ok := c.bucketed[metricName]; ok {
+		collector = vec
+		delete(c.bucketed, metricName)
+	}
+	delete(c.labelSets, metricName)
+	labelSetsWidened.WithLabelValues("histogram").Inc()
+	return c.widened.unregister(c.registerer, metricName, collector)
+}
+
+// buckets returns the buckets of histograms of the given mapping.
+func (c *HistogramContainer) buckets(mapping *mapper.MetricMapping) []float64 {
+	if mapping != nil && mapping.Buckets != nil && len(mapping.Buckets) > 0 {
+		return mapping.Buckets
+	}
+	if len(c.mapper.Defaults.Buckets) > 0 {
+		return c.mapper.Defaults.Buckets
+	}
+	return prometheus.DefBuckets
+}
+
+// remove unregisters a histogram, so that its name can be used by a metric of
+// another type.
+func (c *HistogramContainer) remove(metricName string) {
+	if vec, ok := c.Elements[metricName]; ok {
+		c.widened.remove(c.registerer, metricName, vec)
+		delete(c.Elements, metricName)
+	}
+	if vec, ok := c.bucketed[metricName]; ok {
+		c.widened.remove(c.registerer, metricName, vec)
+		delete(c.bucketed, metricName)
+	}
+	delete(c.labelSets, metricName)
+}
+
+func (c *HistogramContainer) Delete(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if _, ok := c.Elements[metricName]; ok {
+		c.Elements[metricName].Delete(labels)
+	}
+	if vec, ok := c.bucketed[metricName]; ok {
+		vec.delete(labels)
+	}
+}
+
+// Reset replaces an existing series with one at its zero value.
+func (c *HistogramContainer) Reset(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if vec, ok := c.Elements[metricName]; ok && vec.Delete(labels) {
+		vec.With(labels)
+	}
+	if vec, ok := c.bucketed[metricName]; ok && vec.delete(labels) {
+		vec.getMetricWith(labels)
+	}
+}
+
+type LabelValues struct {
+	lastRegisteredAt time.Time
+	labels           prometheus.Labels
+	ttl              time.Duration
+	// jitter is added to the ttl, see Exporter.ExpiryJitter.
+	jitter       time.Duration
+	expiryAction mapper.ExpiryAction
+	expiryGrace  time.Duration
+	// zeroed is set while an expired series is kept at zero.
+	zeroed bool
+	// expiresAt is the deadline of the entry of the series in the expiry
+	// queue, zero if it has none.
+	expiresAt time.Time
+
+	scrapeAction mapper.ScrapeAction
+}
+
+// deadline returns the time after which the series expires.
+func (lvs *LabelValues) deadline() time.Time {
+	return lvs.lastRegisteredAt.Add(lvs.ttl + lvs.jitter)
+}
+
+// pendingCounter accumulates the increments of a single counter series until
+// they are flushed to the Prometheus counter.
+type pendingCounter struct {
+	metricName string
+	labels     prometheus.Labels
+	help       string
+	mapping    *mapper.MetricMapping
+	delta      float64
+}
+
+// pendingGauge accumulates the updates of a single gauge series until they
+// are flushed to the Prometheus gauge. Relative updates following an absolute
+// one are merged into its value.
+type pendingGauge struct {
+	metricName string
+	labels     prometheus.Labels
+	help       string
+	mapping    *mapper.MetricMapping
+	value      float64
+	absolute   bool
+}
+
+// pendingTimer collects the observations of a single timer series until they
+// are flushed to the Prometheus summary, histogram or sketch.
+type pendingTimer struct {
+	metricName   string
+	labels       prometheus.Labels
+	help         string
+	mapping      *mapper.MetricMapping
+	observations []float64
+}
+
+// UnmappedRecorder records the names of events that no mapping matched.
+type UnmappedRecorder interface {
+	RecordUnmapped(metricName string)
+}
+
+// MappingRecorder records the match of the mapping of every mapped event.
+type MappingRecorder interface {
+	RecordMapped(match string)
+}
+
+type Exporter struct {
+	Counters    *CounterContainer
+	Gauges      *GaugeContainer
+	Summaries   *SummaryContainer
+	Histograms  *HistogramContainer
+	Sketches    *SketchContainer
+	mapper      *mapper.MetricMapper
+	labelValues map[string]map[uint64]*LabelValues
+	// expiries holds the series with a TTL by the time they may expire.
+	expiries expiryQueue
+	// scrapeSeries holds the metric names of the series with a scrape
+	// action updated since the last scrape, by hash. hasScrapeActions is
+	// set once it is created, for BeginScrape to read without locking.
+	scrapeSeries     map[uint64]string
+	hasScrapeActions int32
+	// origins records the match of the mapping each metric originates
+	// from.
+	origins map[string]string
+	// metricTypes records the type each metric name is exported as.
+	metricTypes map[string]string
+	// random decides which events of mappings with a sample rate are
+	// kept.
+	random func() float64
+
+	// mtx serializes event handling and expiry between Listen and
+	// HandleEvents.
+	mtx sync.Mutex
+
+	// CounterFlushInterval enables pre-aggregation of counter increments
+	// when non-zero. Increments are applied at most this often.
+	CounterFlushInterval time.Duration
+	pendingCounters      map[uint64]*pendingCounter
+	lastCounterFlush     time.Time
+	counterFlush         adaptiveFlush
+
+	// FlushInterval emulates the flush interval of StatsD when non-zero:
+	// gauge updates and timer observations are merged per series, and
+	// only applied this often. Counters follow CounterFlushInterval.
+	FlushInterval time.Duration
+	pendingGauges map[uint64]*pendingGauge
+	pendingTimers map[uint64]*pendingTimer
+	lastFlush     time.Time
+	pendingFlush  adaptiveFlush
+
+	// FlushThreshold makes FlushInterval and CounterFlushInterval adaptive
+	// when non-zero: pending events are applied once this many have
+	// accumulated, shortening the interval under load, and the interval
+	// grows back to its configured value while idle.
+	FlushThreshold int
+
+	// CoalesceBatches merges the events of each series within a batch
+	// like FlushInterval, and applies them at the end of the batch, so
+	// that chatty clients cause fewer registry operations.
+	CoalesceBatches bool
+
+	// TimerAggregateInterval is the window over which the StatsD timer
+	// aggregates of mappings with timer_aggregates are computed.
+	TimerAggregateInterval time.Duration
+	timerWindows           map[uint64]*timerWindow
+	lastTimerFlush         time.Time
+
+	// sets holds the elements of every set series within the window of
+	// its mapping.
+	sets map[uint64]*exactSet
+
+	// UnmappedRecorder, if set, is passed the name of every event without
+	// mapping.
+	UnmappedRecorder UnmappedRecorder
+	// MappingRecorder, if set, is passed the match of the mapping of every
+	// mapped event.
+	MappingRecorder MappingRecorder
+	// DropUnmapped drops events without mapping, as if the mapping config
+	// ended with a catch-all drop mapping.
+	DropUnmapped bool
+	// UnmappedTtl, if set, replaces the default TTL of the mapping config
+	// for events without mapping.
+	UnmappedTtl time.Duration
+	// NameSeparator replaces the dots separating the components of the
+	// names of events without mapping. Empty means "_".
+	NameSeparator string
+	// StripPrefixes are removed from the start of event names before
+	// mapping. Only the first matching prefix is removed.
+	StripPrefixes []string
+	// Namespace is prepended to the names of all exported metrics, unless
+	// the mapping config sets a namespace in its defaults.
+	Namespace string
+
+	// MaxSeries limits the number of series the exporter creates. Events
+	// for new series are dropped while the limit is reached. 0 disables
+	// the limit.
+	MaxSeries int
+	series    int
+
+	// MemoryBudget, if set, makes the exporter drop events for new series
+	// without mapping while the budget is exceeded.
+	MemoryBudget *MemoryBudget
+
+	// MaxNameLength limits the length of received metric names, and
+	// MaxLabelValueLength that of label values, in bytes. Events exceeding
+	// a limit are dropped, unless TruncateLongValues is set. 0 disables a
+	// limit.
+	MaxNameLength       int
+	MaxLabelValueLength int
+	TruncateLongValues  bool
+
+	// TypeConflictPolicy decides what happens to events for a metric name
+	// in use by a metric of another type. Empty means TypeConflictDrop.
+	TypeConflictPolicy TypeConflictPolicy
+
+	// ExpiryInterval is how often expired series are removed. 0 removes
+	// them every second, along with flushing pending events.
+	ExpiryInterval time.Duration
+	// ExpiryJitter extends the ttl of every series by a random fraction of
+	// up to ExpiryJitter of it, so that series created at the same time
+	// don't all expire at the same time.
+	ExpiryJitter float64
+}
+
+// Listen handles all events sent to the given channel sequentially. It
+// terminates when the channel is closed.
+func (b *Exporter) Listen(e <-chan event.Events) {
+	removeStaleMetricsTicker := clock.NewTicker(time.Second)
+	// Without an expiry interval of its own, expired series are removed
+	// along with the other periodic work.
+	var expiryTicks <-chan time.Time
+	if b.ExpiryInterval > 0 {
+		expiryTicker := clock.NewTicker(b.ExpiryInterval)
+		defer expiryTicker.Stop()
+		expiryTicks = expiryTicker.C
+	}
+	if b.CounterFlushInterval > 0 || b.FlushInterval > 0 {
+		b.mtx.Lock()
+		b.lastCounterFlush = clock.Now()
+		b.lastFlush = clock.Now()
+		b.mtx.Unlock()
+	}
+
+	for {
+		select {
+		case <-removeStaleMetricsTicker.C:
+			b.mtx.Lock()
+			b.maybeFlushCounters()
+			b.maybeFlushPending()
+			b.maybeFlushTimerWindows()
+			b.expireSetElements()
+			if b.ExpiryInterval <= 0 {
+				b.removeStaleMetrics()
+			}
+			b.mtx.Unlock()
+		case <-expiryTicks:
+			b.mtx.Lock()
+			b.removeStaleMetrics()
+			b.mtx.Unlock()
+		case events, ok := <-e:
+			if !ok {
+				log.Debug("Channel is closed. Break out of Exporter.Listener.")
+				b.mtx.Lock()
+				if b.CounterFlushInterval > 0 {
+					b.flushCounters()
+				}
+				if b.FlushInterval > 0 {
+					b.flushPending()
+				}
+				b.flushTimerWindows()
+				b.mtx.Unlock()
+				removeStaleMetricsTicker.Stop()
+				return
+			}
+			b.HandleEvents(events)
+		}
+	}
+}
+
+// HandleEvents processes the given events synchronously. Together with the
+// constructors in package event, it allows embedding applications to record
+// metrics without going through a listener. It is safe to call concurrently
+// with Listen.
+func (b *Exporter) HandleEvents(events event.Events) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, thisEvent := range events {
+		b.handleEvent(thisEvent)
+	}
+	b.maybeFlushCounters()
+	b.maybeFlushPending()
+	if b.CoalesceBatches {
+		if b.CounterFlushInterval == 0 {
+			b.flushCounters()
+		}
+		if b.FlushInterval == 0 {
+			b.flushPending()
+		}
+	}
+}
+
+// limitLength applies a length limit to value. It returns the value,
+// truncated if necessary, and whether the event can be processed.
+func (b *Exporter) limitLength(value string, limit int, field string) (string, bool) {
+	if limit == 0 || len(value) <= limit {
+		return value, true
+	}
+	if !b.TruncateLongValues {
+		eventStats.WithLabelValues("too_long_" + field).Inc()
+		return "", false
+	}
+	truncatedValues.WithLabelValues(field).Inc()
+	// Do not cut a multi-byte character in half.
+	for limit > 0 && !utf8.RuneStart(value[limit]) {
+		limit--
+	}
+	return value[:limit], true
+}
+
+// lowercaseLabelNames lowercases the names of labels in place. Of labels
+// whose names only differ in case, a label with an already lowercase name
+// is kept.
+func lowercaseLabelNames(labels map[string]string) {
+	for name, value := range labels {
+		lower := strings.ToLower(name)
+		if lower == name {
+			continue
+		}
+		if _, ok := labels[lower]; !ok {
+			labels[lower] = value
+		}
+		delete(labels, name)
+	}
+}
+
+// handleEvent processes a single Event according to the configured mapping.
+func (b *Exporter) handleEvent(thisEvent event.Event) {
+	eventName, ok := b.limitLength(thisEvent.MetricName(), b.MaxNameLength, "metric_name")
+	if !ok {
+		return
+	}
+	for _, prefix := range b.StripPrefixes {
+		if len(eventName) > len(prefix) && strings.HasPrefix(eventName, prefix) {
+			eventName = eventName[len(prefix):]
+			break
+		}
+	}
+	if b.mapper.Defaults.Lowercase {
+		// Normalize the casing of clients before matching.
+		eventName = strings.ToLower(eventName)
+		lowercaseLabelNames(thisEvent.Labels())
+	}
+
+	mapping, labels, outputs, present := b.mapper.GetMappingOutputs(eventName, thisEvent.MetricType())
+	if present && b.MappingRecorder != nil {
+		b.MappingRecorder.RecordMapped(mapping.Match)
+	}
+	if mapping == nil {
+		mapping = &mapper.MetricMapping{}
+		if b.UnmappedTtl > 0 {
+			mapping.Ttl = b.UnmappedTtl
+		} else if b.mapper.Defaults.Ttl != 0 {
+			mapping.Ttl = b.mapper.Defaults.Ttl
+		}
+		mapping.TtlType = b.mapper.Defaults.TtlType
+		mapping.ExpiryAction = b.mapper.Defaults.ExpiryAction
+		mapping.ExpiryGrace = b.mapper.Defaults.ExpiryGrace
+		mapping.ScrapeAction = b.mapper.Defaults.ScrapeAction
+		mapping.HostTag = b.mapper.Defaults.HostTag
+		mapping.SetWindow = b.mapper.Defaults.SetWindow
+		mapping.SetMaxElements = b.mapper.Defaults.SetMaxElements
+	}
+
+	if mapping.Action == mapper.ActionTypeDrop {
+		return
+	}
+
+	// Handling an event modifies its labels, copy them for the outputs
+	// first.
+	outputEvents := make([]event.Event, 0, len(outputs))
+	for _, output := range outputs {
+		outputEvents = append(outputEvents, outputEvent(thisEvent, output))
+	}
+	b.handleMappedEvent(thisEvent, eventName, mapping, labels, present)
+	for i, output := range outputs {
+		b.handleMappedEvent(outputEvents[i], eventName, output.Mapping, output.Labels, true)
+	}
+}
+
+// handleMappedEvent records an event as the metric of the given mapping.
+func (b *Exporter) handleMappedEvent(thisEvent event.Event, eventName string, mapping *mapper.MetricMapping, labels prometheus.Labels, present bool) {
+	var ok bool
+
+	help := defaultHelp
+	if mapping.HelpText != "" {
+		help = mapping.HelpText
+	}
+
+	metricName := ""
+	prometheusLabels := thisEvent.Labels()
+	if host, ok := prometheusLabels[mapper.HostTag]; ok {
+		switch mapping.HostTag {
+		case mapper.HostTagExportedInstance:
+			delete(prometheusLabels, mapper.HostTag)
+			prometheusLabels["exported_instance"] = host
+		case mapper.HostTagDrop:
+			delete(prometheusLabels, mapper.HostTag)
+		}
+	}
+	if present {
+		metricName = mapper.EscapeMetricName(prometheus.BuildFQName(mapping.Namespace, mapping.Subsystem, mapping.Name))
+		for label, value := range labels {
+			prometheusLabels[label] = value
+		}
+		if mapping.Lowercase {
+			metricName = strings.ToLower(metricName)
+			lowercaseLabelNames(prometheusLabels)
+		}
+	} else {
+		eventsUnmapped.Inc()
+		if b.UnmappedRecorder != nil {
+			b.UnmappedRecorder.RecordUnmapped(eventName)
+		}
+		if b.DropUnmapped {
+			return
+		}
+		if b.NameSeparator != "" {
+			metricName = mapper.EscapeMetricNameWithSeparator(eventName, b.NameSeparator)
+		} else {
+			metricName = mapper.EscapeMetricName(eventName)
+		}
+	}
+	if namespace := b.mapper.Defaults.Namespace; namespace != "" {
+		metricName = namespace + metricName
+	} else {
+		metricName = b.Namespace + metricName
+	}
+	if metricName, prometheusLabels, ok = b.mapper.Relabel(metricName, prometheusLabels); !ok {
+		eventStats.WithLabelValues("relabel_dropped").Inc()
+		return
+	}
+	if present {
+		b.origins[metricName] = mapping.Match
+	}
+	for label, value := range prometheusLabels {
+		if prometheusLabels[label], ok = b.limitLength(value, b.MaxLabelValueLength, "label_value"); !ok {
+			return
+		}
+	}
+
+	if thisEvent, ok = applyValueRange(thisEvent, mapping); !ok {
+		return
+	}
+	thisEvent = roundValue(thisEvent, mapping)
+
+	if mapping.ValueLabel != "" {
+		// The value identifies what happened, count its occurrences.
+		prometheusLabels[mapping.ValueLabel] = fmt.Sprintf(mapping.ValueLabelFormat, thisEvent.Value())
+		thisEvent = event.NewCounterEvent(thisEvent.MetricName(), 1, prometheusLabels)
+	}
+
+	if mapping.SampleRate > 0 && mapping.SampleRate < 1 {
+		if b.random() >= mapping.SampleRate {
+			eventStats.WithLabelValues("sampled_out").Inc()
+			return
+		}
+		if _, ok := thisEvent.(*event.CounterEvent); ok {
+			// Kept increments stand for those sampled out.
+			thisEvent = event.NewCounterEvent(thisEvent.MetricName(), thisEvent.Value()/mapping.SampleRate, prometheusLabels)
+		}
+	}
+
+	metricType := thisEvent.MetricType()
+	if mapping.Action == mapper.ActionTypeInfo || metricType == mapper.MetricTypeSet {
+		metricType = mapper.MetricTypeGauge
+	}
+	if metricName, ok = b.resolveTypeConflict(metricName, string(metricType)); !ok {
+		if mapping.Action == mapper.ActionTypeInfo {
+			conflictingEventStats.WithLabelValues("info").Inc()
+		} else {
+			conflictingEventStats.WithLabelValues(string(thisEvent.MetricType())).Inc()
+		}
+		return
+	}
+
+	if b.MaxSeries > 0 && b.series >= b.MaxSeries && !b.hasSeries(metricName, prometheusLabels) {
+		log.Debugf("Dropping event for %q, the limit of %d series is reached", metricName, b.MaxSeries)
+		eventStats.WithLabelValues("over_series_limit").Inc()
+		return
+	}
+
+	if !present && b.MemoryBudget.Exceeded() && !b.hasSeries(metricName, prometheusLabels) {
+		log.Debugf("Dropping event for %q without mapping, the memory budget is exceeded", metricName)
+		eventStats.WithLabelValues("over_memory_budget").Inc()
+		return
+	}
+
+	if mapping.Action == mapper.ActionTypeInfo {
+		// Info metrics carry their information in labels, the value of
+		// the event is irrelevant.
+		gauge, err := b.Gauges.Get(metricName, prometheusLabels, help)
+		if err != nil {
+			log.Debugf(regErrF, metricName, err)
+			conflictingEventStats.WithLabelValues("info").Inc()
+			return
+		}
+		gauge.Set(1)
+		b.saveLabelValues(metricName, prometheusLabels, mapping)
+		eventStats.WithLabelValues("info").Inc()
+		return
+	}
+
+	switch ev := thisEvent.(type) {
+	case *event.CounterEvent:
+		// We don't accept negative values for counters. Incrementing the counter with a negative number
+		// will cause the exporter to panic. Instead we will warn and continue to the next event.
+		if thisEvent.Value() < 0.0 {
+			log.Debugf("Counter %q is: '%f' (counter must be non-negative value)", metricName, thisEvent.Value())
+			eventStats.WithLabelValues("illegal_negative_counter").Inc()
+			return
+		}
+
+		if b.CounterFlushInterval > 0 || b.CoalesceBatches {
+			b.addPendingCounter(metricName, prometheusLabels, help, thisEvent.Value(), mapping)
+			eventStats.WithLabelValues("counter").Inc()
+			return
+		}
+
+		counter, err := b.Counters.Get(
+			metricName,
+			prometheusLabels,
+			help,
+		)
+		if err == nil {
+			counter.Add(thisEvent.Value())
+			b.saveLabelValues(metricName, prometheusLabels, mapping)
+			eventStats.WithLabelValues("counter").Inc()
+		} else {
+			log.Debugf(regErrF, metricName, err)
+			conflictingEventStats.WithLabelValues("counter").Inc()
+		}
+
+	case *event.GaugeEvent:
+		if b.FlushInterval > 0 || b.CoalesceBatches {
+			b.addPendingGauge(metricName, prometheusLabels, help, thisEvent.Value(), ev.GRelative, mapping)
+			eventStats.WithLabelValues("gauge").Inc()
+			return
+		}
+
+		gauge, err := b.Gauges.Get(
+			metricName,
+			prometheusLabels,
+			help,
+		)
+
+		if err == nil {
+			if ev.GRelative {
+				gauge.Add(thisEvent.Value())
+			} else {
+				gauge.Set(thisEvent.Value())
+			}
+			b.saveLabelValues(metricName, prometheusLabels, mapping)
+			eventStats.WithLabelValues("gauge").Inc()
+		} else {
+			log.Debugf(regErrF, metricName, err)
+			conflictingEventStats.WithLabelValues("gauge").Inc()
+		}
+
+	case *event.TimerEvent:
+		if b.FlushInterval > 0 || b.CoalesceBatches {
+			b.addPendingTimer(metricName, prometheusLabels, help, thisEvent.Value(), mapping)
+		} else {
+			b.observeTimer(metricName, prometheusLabels, help, mapping, thisEvent.Value())
+		}
+
+		if len(mapping.Thresholds) > 0 {
+			b.countOverThresholds(metricName, prometheusLabels, help, mapping, thisEvent.Value()/1000)
+		}
+		if mapping.TimerAggregates {
+			b.addTimerObservation(metricName, prometheusLabels, help, thisEvent.Value(), mapping)
+		}
+
+	case *event.HistogramEvent:
+		// Pre-bucketed events always merge into a histogram, whatever the
+		// timer type of the mapping.
+		histogram, err := b.Histograms.getBucketed(
+			metricName,
+			prometheusLabels,
+			help,
+			mapping,
+		)
+		if err == nil {
+			bounds := make(map[float64]uint64, len(ev.HBuckets))
+			for bound, n := range ev.HBuckets {
+				bounds[bound/1000] = n
+			}
+			histogram.merge(bounds, ev.HSum/1000, ev.HCount) // prometheus presumes seconds, statsd millisecond
+			b.saveLabelValues(metricName, prometheusLabels, mapping)
+			eventStats.WithLabelValues("histogram").Inc()
+		} else {
+			log.Debugf(regErrF, metricName, err)
+			conflictingEventStats.WithLabelValues("histogram").Inc()
+		}
+
+	case *event.SetEvent:
+		b.addSetElement(metricName, prometheusLabels, help, ev.Element(), mapping)
+
+	default:
+		log.Debugln("Unsupported event type")
+		eventStats.WithLabelValues("illegal").Inc()
+	}
+}
+
+// observeTimer records timer observations, in milliseconds, in the timer
+// type configured for the mapping.
+func (b *Exporter) observeTimer(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping, values ...float64) {
+	t := mapper.TimerTypeDefault
+	if mapping != nil {
+		t = mapping.TimerType
+	}
+	if t == mapper.TimerTypeDefault {
+		t = b.mapper.Defaults.TimerType
+	}
+
+	switch t {
+	case mapper.TimerTypeHistogram:
+		histogram, err := b.Histograms.Get(
+			metricName,
+			labels,
+			help,
+			mapping,
+		)
+		if err == nil {
+			for _, value := range values {
+				histogram.Observe(value / 1000) // prometheus presumes seconds, statsd millisecond
+			}
+			b.saveLabelValues(metricName, labels, mapping)
+			eventStats.WithLabelValues("timer").Add(float64(len(values)))
+		} else {
+			log.Debugf(regErrF, metricName, err)
+			conflictingEventStats.WithLabelValues("timer").Add(float64(len(values)))
+		}
+
+	case mapper.TimerTypeDefault, mapper.TimerTypeSummary:
+		summary, err := b.Summaries.Get(
+			metricName,
+			labels,
+			help,
+			mapping,
+		)
+		if err == nil {
+			for _, value := range values {
+				summary.Observe(value)
+			}
+			b.saveLabelValues(metricName, labels, mapping)
+			eventStats.WithLabelValues("timer").Add(float64(len(values)))
+		} else {
+			log.Debugf(regErrF, metricName, err)
+			conflictingEventStats.WithLabelValues("timer").Add(float64(len(values)))
+		}
+
+	case mapper.TimerTypeSketch:
+		sketch, err := b.Sketches.Get(
+			metricName,
+			labels,
+			help,
+			mapping,
+		)
+		if err == nil {
+			for _, value := range values {
+				sketch.Observe(value)
+			}
+			b.saveLabelValues(metricName, labels, mapping)
+			eventStats.WithLabelValues("timer").Add(float64(len(values)))
+		} else {
+			log.Debugf(regErrF, metricName, err)
+			conflictingEventStats.WithLabelValues("timer").Add(float64(len(values)))
+		}
+
+	default:
+		panic(fmt.Sprintf("unknown timer type '%s'", t))
+	}
+}
+
+// countOverThresholds counts a timer observation, in seconds, in the
+// <metricName>_over_threshold_total counter of every threshold it exceeds.
+// The counters of the other thresholds are created, so that ratios can be
+// computed right away.
+func (b *Exporter) countOverThresholds(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping, seconds float64) {
+	counterName := metricName + "_over_threshold_total"
+	b.origins[counterName] = mapping.Match
+	for _, threshold := range mapping.Thresholds {
+		counterLabels := make(prometheus.Labels, len(labels)+1)
+		for k, v := range labels {
+			counterLabels[k] = v
+		}
+		counterLabels["threshold"] = strconv.FormatFloat(threshold, 'g', -1, 64)
+		counter, err := b.Counters.Get(counterName, counterLabels, help)
+		if err != nil {
+			log.Debugf(regErrF, counterName, err)
+			conflictingEventStats.WithLabelValues("counter").Inc()
+			return
+		}
+		if seconds > threshold {
+			counter.Inc()
+		}
+		b.saveLabelValues(counterName, counterLabels, mapping)
+	}
+}
+
+// addPendingCounter records a counter increment to be applied on the next
+// flush.
+func (b *Exporter) addPendingCounter(metricName string, labels prometheus.Labels, help string, value float64, mapping *mapper.MetricMapping) {
+	hash := hashNameAndLabels(metricName, labels)
+	c, ok := b.pendingCounters[hash]
+	if !ok {
+		c = &pendingCounter{
+			metricName: metricName,
+			labels:     labels,
+			help:       help,
+		}
+		b.pendingCounters[hash] = c
+	}
+	c.delta += value
+	c.mapping = mapping
+	b.counterFlush.events++
+}
+
+// maybeFlushCounters flushes the pending counter increments if the flush
+// interval has passed.
+func (b *Exporter) maybeFlushCounters() {
+	if b.CounterFlushInterval <= 0 {
+		return
+	}
+	if b.lastCounterFlush.IsZero() {
+		// Without Listen, the interval starts with the first batch.
+		b.lastCounterFlush = clock.Now()
+	}
+	elapsed := clock.Now().Sub(b.lastCounterFlush)
+	if b.FlushThreshold > 0 {
+		if b.counterFlush.due(b.CounterFlushInterval, b.FlushThreshold, elapsed) {
+			b.flushCounters()
+		}
+		return
+	}
+	if elapsed >= b.CounterFlushInterval {
+		b.flushCounters()
+	}
+}
+
+// flushCounters applies all pending counter increments to the Prometheus
+// counters.
+func (b *Exporter) flushCounters() {
+	for hash, c := range b.pendingCounters {
+		counter, err := b.Counters.Get(c.metricName, c.labels, c.help)
+		if err == nil {
+			counter.Add(c.delta)
+			b.saveLabelValues(c.metricName, c.labels, c.mapping)
+		} else {
+			log.Debugf(regErrF, c.metricName, err)
+			conflictingEventStats.WithLabelValues("counter").Inc()
+		}
+		delete(b.pendingCounters, hash)
+	}
+	b.lastCounterFlush = clock.Now()
+	b.counterFlush.events = 0
+}
+
+// addPendingGauge records a gauge update to be applied on the next flush.
+func (b *Exporter) addPendingGauge(metricName string, labels prometheus.Labels, help string, value float64, relative bool, mapping *mapper.MetricMapping) {
+	hash := hashNameAndLabels(metricName, labels)
+	g, ok := b.pendingGauges[hash]
+	if !ok {
+		g = &pendingGauge{
+			metricName: metricName,
+			labels:     labels,
+			help:       help,
+		}
+		b.pendingGauges[hash] = g
+	}
+	if relative {
+		g.value += value
+	} else {
+		g.value = value
+		g.absolute = true
+	}
+	g.mapping = mapping
+	b.pendingFlush.events++
+}
+
+// addPendingTimer records a timer observation to be applied on the next
+// flush.
+func (b *Exporter) addPendingTimer(metricName string, labels prometheus.Labels, help string, value float64, mapping *mapper.MetricMapping) {
+	hash := hashNameAndLabels(metricName, labels)
+	t, ok := b.pendingTimers[hash]
+	if !ok {
+		t = &pendingTimer{
+			metricName: metricName,
+			labels:     labels,
+			help:       help,
+		}
+		b.pendingTimers[hash] = t
+	}
+	t.observations = append(t.observations, value)
+	t.mapping = mapping
+	b.pendingFlush.events++
+}
+
+// maybeFlushPending flushes the pending gauge updates and timer
+// observations if the flush interval has passed.
+func (b *Exporter) maybeFlushPending() {
+	if b.FlushInterval <= 0 {
+		return
+	}
+	if b.lastFlush.IsZero() {
+		// Without Listen, the interval starts with the first batch.
+		b.lastFlush = clock.Now()
+	}
+	elapsed := clock.Now().Sub(b.lastFlush)
+	if b.FlushThreshold > 0 {
+		if b.pendingFlush.due(b.FlushInterval, b.FlushThreshold, elapsed) {
+			b.flushPending()
+		}
+		return
+	}
+	if elapsed >= b.FlushInterval {
+		b.flushPending()
+	}
+}
+
+// flushPending applies all pending gauge updates and timer observations.
+func (b *Exporter) flushPending() {
+	for hash, g := range b.pendingGauges {
+		gauge, err := b.Gauges.Get(g.metricName, g.labels, g.help)
+		if err == nil {
+			if g.absolute {
+				gauge.Set(g.value)
+			} else {
+				gauge.Add(g.value)
+			}
+			b.saveLabelValues(g.metricName, g.labels, g.mapping)
+		} else {
+			log.Debugf(regErrF, g.metricName, err)
+			conflictingEventStats.WithLabelValues("gauge").Inc()
+		}
+		delete(b.pendingGauges, hash)
+	}
+	for hash, t := range b.pendingTimers {
+		b.observeTimer(t.metricName, t.labels, t.help, t.mapping, t.observations...)
+		delete(b.pendingTimers, hash)
+	}
+	b.lastFlush = clock.Now()
+	b.pendingFlush.events = 0
+}
+
+// removeStaleMetrics removes label values set from metric with stale values
+func (b *Exporter) removeStaleMetrics() {
+	now := clock.Now()
+	// delete timeseries with expired ttl
+	for {
+		e, ok := b.nextExpiry(now)
+		if !ok {
+			return
+		}
+		metricName, lvs := e.metricName, e.lvs
+		if lvs.ttl == 0 {
+			continue
+		}
+		expiresAt := lvs.deadline()
+		if !expiresAt.Before(now) {
+			// The series was updated since it was scheduled.
+			b.scheduleExpiry(metricName, e.hash, lvs, expiresAt)
+			continue
+		}
+		if lvs.expiryAction == mapper.ExpiryActionZero {
+			if !lvs.zeroed {
+				b.Counters.Reset(metricName, lvs.labels)
+				b.Gauges.Reset(metricName, lvs.labels)
+				b.Summaries.Reset(metricName, lvs.labels)
+				b.Histograms.Reset(metricName, lvs.labels)
+				b.Sketches.Reset(metricName, lvs.labels)
+				lvs.zeroed = true
+				seriesExpired.WithLabelValues(string(mapper.ExpiryActionZero)).Inc()
+			}
+			// Without a grace period, the series is kept at zero until
+			// it is updated again.
+			if lvs.expiryGrace == 0 {
+				continue
+			}
+			if deleteAt := expiresAt.Add(lvs.expiryGrace); !deleteAt.Before(now) {
+				b.scheduleExpiry(metricName, e.hash, lvs, deleteAt)
+				continue
+			}
+		} else {
+			seriesExpired.WithLabelValues(string(mapper.ExpiryActionDelete)).Inc()
+		}
+		b.Counters.Delete(metricName, lvs.labels)
+		b.Gauges.Delete(metricName, lvs.labels)
+		b.Summaries.Delete(metricName, lvs.labels)
+		b.Histograms.Delete(metricName, lvs.labels)
+		b.Sketches.Delete(metricName, lvs.labels)
+		delete(b.labelValues[metricName], e.hash)
+		delete(b.sets, e.hash)
+		b.series--
+	}
+}
+
+// hasSeries reports whether the series with the given name and labels
+// exists.
+func (b *Exporter) hasSeries(metricName string, labels prometheus.Labels) bool {
+	_, ok := b.labelValues[metricName][hashNameAndLabels(metricName, labels)]
+	return ok
+}
+
+// saveLabelValues stores label values set to labelValues and updates the
+// lastRegisteredAt time and ttl according to the mapping. Fixed TTLs keep
+// counting from the first registration.
+func (b *Exporter) saveLabelValues(metricName string, labels prometheus.Labels, mapping *mapper.MetricMapping) {
+	metric, hasMetric := b.labelValues[metricName]
+	if !hasMetric {
+		metric = make(map[uint64]*LabelValues)
+		b.labelValues[metricName] = metric
+	}
+	hash := hashNameAndLabels(metricName, labels)
+	metricLabelValues, ok := metric[hash]
+	if !ok {
+		metricLabelValues = &LabelValues{
+			labels: labels,
+		}
+		b.labelValues[metricName][hash] = metricLabelValues
+		b.series++
+	}
+	if !ok || mapping.TtlType != mapper.TtlTypeFixed || metricLabelValues.zeroed {
+		metricLabelValues.lastRegisteredAt = clock.Now()
+	}
+	metricLabelValues.zeroed = false
+	// Update ttl from mapping
+	if !ok || metricLabelValues.ttl != mapping.Ttl {
+		metricLabelValues.jitter = b.expiryJitter(mapping.Ttl)
+	}
+	metricLabelValues.ttl = mapping.Ttl
+	metricLabelValues.expiryAction = mapping.ExpiryAction
+	metricLabelValues.expiryGrace = mapping.ExpiryGrace
+	metricLabelValues.scrapeAction = mapping.ScrapeAction
+	b.trackScrapeAction(metricName, hash, mapping.ScrapeAction)
+	if metricLabelValues.ttl != 0 {
+		b.scheduleExpiry(metricName, hash, metricLabelValues, metricLabelValues.deadline())
+	}
+}
+
+// Option configures an Exporter on creation.
+type Option func(*Exporter)
+
+// WithRegisterer makes the exporter register the metrics it creates with r
+// instead of the default registerer. r can be wrapped, e.g. with
+// prometheus.WrapRegistererWithPrefix, to put all metrics in a namespace.
+func WithRegisterer(r prometheus.Registerer) Option {
+	return func(b *Exporter) {
+		b.Counters.registerer = r
+		b.Gauges.registerer = r
+		b.Summaries.registerer = r
+		b.Histograms.registerer = r
+		b.Sketches.registerer = r
+	}
+}
+
+func NewExporter(mapper *mapper.MetricMapper, options ...Option) *Exporter {
+	b := &Exporter{
+		Counters:    NewCounterContainer(),
+		Gauges:      NewGaugeContainer(),
+		Summaries:   NewSummaryContainer(mapper),
+		Histograms:  NewHistogramContainer(mapper),
+		Sketches:    NewSketchContainer(mapper),
+		mapper:      mapper,
+		labelValues: make(map[string]map[uint64]*LabelValues),
+		origins:     make(map[string]string),
+		metricTypes: make(map[string]string),
+		random:      rand.Float64,
+
+		pendingCounters: make(map[uint64]*pendingCounter),
+		pendingGauges:   make(map[uint64]*pendingGauge),
+		pendingTimers:   make(map[uint64]*pendingTimer),
+
+		TimerAggregateInterval: 10 * time.Second,
+		timerWindows:           make(map[uint64]*timerWindow),
+
+		sets: make(map[uint64]*exactSet),
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
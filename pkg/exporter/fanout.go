@@ -0,0 +1,48 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// outputEvent returns a copy of an event to record for an output of its
+// mapping. Outputs counting events get a counter increment of one, or of the
+// number of observations of pre-bucketed histograms.
+func outputEvent(e event.Event, output mapper.Output) event.Event {
+	labels := make(map[string]string, len(e.Labels()))
+	for k, v := range e.Labels() {
+		labels[k] = v
+	}
+	if output.Count {
+		if h, ok := e.(*event.HistogramEvent); ok {
+			return event.NewCounterEvent(h.HMetricName, float64(h.HCount), labels)
+		}
+		return event.NewCounterEvent(e.MetricName(), 1, labels)
+	}
+	switch ev := e.(type) {
+	case *event.CounterEvent:
+		return event.NewCounterEvent(ev.CMetricName, ev.CValue, labels)
+	case *event.GaugeEvent:
+		return event.NewGaugeEvent(ev.GMetricName, ev.GValue, ev.GRelative, labels)
+	case *event.TimerEvent:
+		return event.NewTimerEvent(ev.TMetricName, ev.TValue, labels)
+	case *event.SetEvent:
+		return event.NewSetEvent(ev.SMetricName, ev.SElement, labels)
+	case *event.HistogramEvent:
+		return event.NewHistogramEvent(ev.HMetricName, ev.HBuckets, ev.HSum, ev.HCount, labels)
+	}
+	return e
+}
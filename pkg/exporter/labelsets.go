@@ -0,0 +1,186 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labelSets records the label names each metric of a container was
+// registered with. Clients commonly omit a tag now and then, so the label
+// names of events for the same metric can differ.
+type labelSets map[string][]string
+
+// conform returns the labels to use with the metric of the given name, with
+// the label names it lacks set to "". If labels has names the metric was not
+// registered with, the label names to widen the metric to are returned too.
+// The given labels are not modified.
+func (s labelSets) conform(metricName string, labels prometheus.Labels) (prometheus.Labels, []string) {
+	names, ok := s[metricName]
+	if !ok {
+		return labels, nil
+	}
+	known := 0
+	for _, name := range names {
+		if _, ok := labels[name]; ok {
+			known++
+		}
+	}
+	if known == len(names) && known == len(labels) {
+		return labels, nil
+	}
+
+	conformed := padLabels(labels, names)
+	if known == len(labels) {
+		return conformed, nil
+	}
+	return conformed, labelNames(conformed)
+}
+
+// padLabels returns labels with the given names it lacks set to "".
+func padLabels(labels prometheus.Labels, names []string) prometheus.Labels {
+	padded := make(prometheus.Labels, len(names))
+	for _, name := range names {
+		padded[name] = ""
+	}
+	for name, value := range labels {
+		padded[name] = value
+	}
+	return padded
+}
+
+// seriesValue is the value of a single counter or gauge series.
+type seriesValue struct {
+	labels prometheus.Labels
+	value  float64
+}
+
+// collectValues returns the values of all series of a counter or gauge
+// collector, to carry them over when it is widened.
+func collectValues(c prometheus.Collector) []seriesValue {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var values []seriesValue
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		labels := make(prometheus.Labels, len(m.GetLabel()))
+		for _, pair := range m.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		value := m.GetGauge().GetValue()
+		if m.Counter != nil {
+			value = m.GetCounter().GetValue()
+		}
+		values = append(values, seriesValue{labels: labels, value: value})
+	}
+	return values
+}
+
+// widenedCollector exposes the metrics of a collector registered in place of
+// one with fewer label names. A registry insists on the label names a metric
+// was first registered with, so it is registered with the descriptors of the
+// original collector, once per metric, and the collector it exposes is
+// swapped when the metric is widened again. Registering the metric elsewhere
+// still fails as it would have without widening.
+type widenedCollector struct {
+	descs []*prometheus.Desc
+
+	mtx       sync.Mutex
+	collector prometheus.Collector
+}
+
+func (w *widenedCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range w.descs {
+		ch <- desc
+	}
+}
+
+func (w *widenedCollector) Collect(ch chan<- prometheus.Metric) {
+	w.mtx.Lock()
+	collector := w.collector
+	w.mtx.Unlock()
+	if collector != nil {
+		collector.Collect(ch)
+	}
+}
+
+func (w *widenedCollector) set(collector prometheus.Collector) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.collector = collector
+}
+
+// describe returns the descriptors of a collector.
+func describe(c prometheus.Collector) []*prometheus.Desc {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	var descs []*prometheus.Desc
+	for desc := range ch {
+		descs = append(descs, desc)
+	}
+	return descs
+}
+
+// widenedCollectors holds the widened collectors of a container by metric
+// name.
+type widenedCollectors map[string]*widenedCollector
+
+// register registers the collector of the metric of the given name, through
+// its widened collector if it has one.
+func (w widenedCollectors) register(r prometheus.Registerer, metricName string, collector prometheus.Collector) error {
+	if wc, ok := w[metricName]; ok {
+		wc.set(collector)
+		return nil
+	}
+	return r.Register(collector)
+}
+
+// unregister removes the collector of the metric of the given name, so that
+// it can be registered again with more label names.
+func (w widenedCollectors) unregister(r prometheus.Registerer, metricName string, collector prometheus.Collector) error {
+	if wc, ok := w[metricName]; ok {
+		wc.set(nil)
+		return nil
+	}
+	wc := &widenedCollector{descs: describe(collector)}
+	r.Unregister(collector)
+	if err := r.Register(wc); err != nil {
+		r.Register(collector)
+		return err
+	}
+	w[metricName] = wc
+	return nil
+}
+
+// remove unregisters the collector of the metric of the given name for good.
+func (w widenedCollectors) remove(r prometheus.Registerer, metricName string, collector prometheus.Collector) {
+	if wc, ok := w[metricName]; ok {
+		r.Unregister(wc)
+		delete(w, metricName)
+		return
+	}
+	r.Unregister(collector)
+}
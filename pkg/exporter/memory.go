@@ -0,0 +1,75 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// memoryBudgetHighWater is the share of the limit from which load is shed,
+// to leave headroom for the garbage collector.
+const memoryBudgetHighWater = 0.9
+
+// MemoryBudget compares the heap in use by the process against a limit. While
+// the heap approaches the limit, the exporter drops events for new series
+// without mapping, and queues drop large batches, instead of growing until the
+// process is killed.
+type MemoryBudget struct {
+	// Limit is the heap size in bytes the exporter should stay below.
+	Limit uint64
+	// MaxBatch is the number of events above which batches are dropped
+	// while the budget is exceeded. 0 keeps all batches.
+	MaxBatch int
+
+	exceeded int32
+}
+
+// Exceeded reports whether the heap in use was within 10% of the limit, or
+// above it, when last observed. It is false for a nil budget.
+func (m *MemoryBudget) Exceeded() bool {
+	return m != nil && atomic.LoadInt32(&m.exceeded) == 1
+}
+
+// Observe records the heap in use.
+func (m *MemoryBudget) Observe(heapBytes uint64) {
+	exceeded := float64(heapBytes) >= memoryBudgetHighWater*float64(m.Limit)
+	if exceeded {
+		atomic.StoreInt32(&m.exceeded, 1)
+		memoryBudgetExceeded.Set(1)
+	} else {
+		atomic.StoreInt32(&m.exceeded, 0)
+		memoryBudgetExceeded.Set(0)
+	}
+}
+
+// Run observes the heap in use every interval. It never returns.
+func (m *MemoryBudget) Run(interval time.Duration) {
+	memoryBudgetLimit.Set(float64(m.Limit))
+	var stats runtime.MemStats
+	for {
+		runtime.ReadMemStats(&stats)
+		m.Observe(stats.HeapInuse)
+		time.Sleep(interval)
+	}
+}
+
+// shedBatch reports whether events should be dropped as too large a batch
+// while the budget is exceeded.
+func (m *MemoryBudget) shedBatch(events event.Events) bool {
+	return m.Exceeded() && m.MaxBatch > 0 && len(events) > m.MaxBatch
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"sort"
+)
+
+// MetricMetadata describes a metric created by an Exporter.
+type MetricMetadata struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Help string `json:"help"`
+	// Mapping is the match of the mapping the metric originates from. It
+	// is empty for unmapped metrics.
+	Mapping string `json:"mapping"`
+}
+
+// Metadata returns the metadata of all metrics created by the exporter,
+// sorted by name.
+func (b *Exporter) Metadata() []MetricMetadata {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	var metadata []MetricMetadata
+	add := func(name, metricType string, help map[string]string) {
+		metadata = append(metadata, MetricMetadata{
+			Name:    name,
+			Type:    metricType,
+			Help:    help[name],
+			Mapping: b.origins[name],
+		})
+	}
+	for name := range b.Counters.Elements {
+		add(name, "counter", b.Counters.help)
+	}
+	for name := range b.Gauges.Elements {
+		add(name, "gauge", b.Gauges.help)
+	}
+	for name := range b.Summaries.Elements {
+		add(name, "summary", b.Summaries.help)
+	}
+	for name := range b.Summaries.biased {
+		add(name, "summary", b.Summaries.help)
+	}
+	for name := range b.Histograms.Elements {
+		add(name, "histogram", b.Histograms.help)
+	}
+	for name := range b.Histograms.bucketed {
+		add(name, "histogram", b.Histograms.help)
+	}
+	for name := range b.Sketches.Elements {
+		add(name, "summary", b.Sketches.help)
+	}
+	sort.Slice(metadata, func(i, j int) bool { return metadata[i].Name < metadata[j].Name })
+	return metadata
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/clock"
+)
+
+// gaugeSnapshot is the persisted state of a single gauge series.
+type gaugeSnapshot struct {
+	Name             string            `json:"name"`
+	Help             string            `json:"help"`
+	Labels           prometheus.Labels `json:"labels"`
+	Value            float64           `json:"value"`
+	LastRegisteredAt time.Time         `json:"last_registered_at"`
+	TTL              time.Duration     `json:"ttl"`
+}
+
+// SaveGauges writes the current values of all gauges, together with their
+// expiry state, to w. They can be restored with RestoreGauges.
+func (b *Exporter) SaveGauges(w io.Writer) error {
+	b.mtx.Lock()
+	var snapshots []gaugeSnapshot
+	for metricName, gaugeVec := range b.Gauges.Elements {
+		for _, lv := range b.labelValues[metricName] {
+			labels, _ := b.Gauges.labelSets.conform(metricName, lv.labels)
+			gauge, err := gaugeVec.GetMetricWith(labels)
+			if err != nil {
+				continue
+			}
+			var m dto.Metric
+			if err := gauge.Write(&m); err != nil {
+				continue
+			}
+			snapshots = append(snapshots, gaugeSnapshot{
+				Name:             metricName,
+				Help:             b.Gauges.help[metricName],
+				Labels:           lv.labels,
+				Value:            m.GetGauge().GetValue(),
+				LastRegisteredAt: lv.lastRegisteredAt,
+				TTL:              lv.ttl,
+			})
+		}
+	}
+	b.mtx.Unlock()
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	enc := json.NewEncoder(w)
+	for _, s := range snapshots {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreGauges sets the gauges saved by SaveGauges. Gauges that have expired
+// in the meantime are skipped.
+func (b *Exporter) RestoreGauges(r io.Reader) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	now := clock.Now()
+	dec := json.NewDecoder(r)
+	for {
+		var s gaugeSnapshot
+		if err := dec.Decode(&s); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if s.TTL > 0 && s.LastRegisteredAt.Add(s.TTL).Before(now) {
+			continue
+		}
+		if s.Labels == nil {
+			s.Labels = prometheus.Labels{}
+		}
+		gauge, err := b.Gauges.Get(s.Name, s.Labels, s.Help)
+		if err != nil {
+			log.Debugf(regErrF, s.Name, err)
+			conflictingEventStats.WithLabelValues("gauge").Inc()
+			continue
+		}
+		gauge.Set(s.Value)
+		metric, ok := b.labelValues[s.Name]
+		if !ok {
+			metric = make(map[uint64]*LabelValues)
+			b.labelValues[s.Name] = metric
+		}
+		hash := hashNameAndLabels(s.Name, s.Labels)
+		if _, ok := metric[hash]; !ok {
+			b.series++
+		}
+		lvs := &LabelValues{
+			labels:           s.Labels,
+			lastRegisteredAt: s.LastRegisteredAt,
+			ttl:              s.TTL,
+			jitter:           b.expiryJitter(s.TTL),
+		}
+		metric[hash] = lvs
+		if lvs.ttl != 0 {
+			b.scheduleExpiry(s.Name, hash, lvs, lvs.deadline())
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// RunQueue passes on the events read from in to out, the queue of an
+// Exporter, counting them by type. With shedGauges, gauge events are dropped
+// while out is full, so that counter increments and timer observations are
+// preserved under overload; gauges are overwritten by later events anyway.
+// It returns when in is closed.
+func RunQueue(in <-chan event.Events, out chan<- event.Events, shedGauges bool) {
+	RunBudgetedQueue(in, out, shedGauges, nil)
+}
+
+// RunBudgetedQueue is RunQueue, additionally dropping batches of more than
+// the MaxBatch of budget events while the budget is exceeded.
+func RunBudgetedQueue(in <-chan event.Events, out chan<- event.Events, shedGauges bool, budget *MemoryBudget) {
+	for events := range in {
+		for _, e := range events {
+			eventsQueued.WithLabelValues(string(e.MetricType())).Inc()
+		}
+		if budget.shedBatch(events) {
+			memoryShedBatches.Inc()
+			continue
+		}
+		if shedGauges && len(out) == cap(out) {
+			events = shed(events)
+		}
+		out <- events
+	}
+}
+
+// shed returns the events that are not gauges.
+func shed(events event.Events) event.Events {
+	kept := events[:0]
+	for _, e := range events {
+		if _, ok := e.(*event.GaugeEvent); ok {
+			eventsShed.WithLabelValues(string(e.MetricType())).Inc()
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// BeginScrape must be called before gathering the metrics of b for a
+// scrape, and the returned function after it, reporting whether the scrape
+// succeeded. If it did, the series with a scrape action are deleted or reset.
+// Once any series has a scrape action, event handling is paused in between,
+// so that no event is lost between gathering and resetting a series.
+func (b *Exporter) BeginScrape() (end func(succeeded bool)) {
+	if atomic.LoadInt32(&b.hasScrapeActions) == 0 {
+		return func(bool) {}
+	}
+	b.mtx.Lock()
+	return func(succeeded bool) {
+		defer b.mtx.Unlock()
+		if succeeded {
+			b.applyScrapeActions()
+		}
+	}
+}
+
+// trackScrapeAction records a series whose mapping has a scrape action.
+func (b *Exporter) trackScrapeAction(metricName string, hash uint64, action mapper.ScrapeAction) {
+	if action != mapper.ScrapeActionDelete && action != mapper.ScrapeActionZero {
+		return
+	}
+	if b.scrapeSeries == nil {
+		b.scrapeSeries = map[uint64]string{}
+		atomic.StoreInt32(&b.hasScrapeActions, 1)
+	}
+	b.scrapeSeries[hash] = metricName
+}
+
+// applyScrapeActions deletes or resets the series updated since the last
+// scrape.
+func (b *Exporter) applyScrapeActions() {
+	for hash, metricName := range b.scrapeSeries {
+		delete(b.scrapeSeries, hash)
+		lvs, ok := b.labelValues[metricName][hash]
+		if !ok {
+			continue
+		}
+		switch lvs.scrapeAction {
+		case mapper.ScrapeActionZero:
+			b.Counters.Reset(metricName, lvs.labels)
+			b.Gauges.Reset(metricName, lvs.labels)
+			b.Summaries.Reset(metricName, lvs.labels)
+			b.Histograms.Reset(metricName, lvs.labels)
+			b.Sketches.Reset(metricName, lvs.labels)
+		case mapper.ScrapeActionDelete:
+			b.Counters.Delete(metricName, lvs.labels)
+			b.Gauges.Delete(metricName, lvs.labels)
+			b.Summaries.Delete(metricName, lvs.labels)
+			b.Histograms.Delete(metricName, lvs.labels)
+			b.Sketches.Delete(metricName, lvs.labels)
+			delete(b.labelValues[metricName], hash)
+			delete(b.sets, hash)
+			b.series--
+		}
+	}
+}
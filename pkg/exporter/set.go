@@ -0,0 +1,108 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/clock"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// exactSet counts the distinct elements of a single set series exactly. It
+// keeps every element with the time it was last seen, until it falls out of
+// the sliding window of the mapping.
+type exactSet struct {
+	metricName string
+	labels     prometheus.Labels
+	help       string
+	mapping    *mapper.MetricMapping
+
+	elements map[string]time.Time
+}
+
+// addSetElement adds an element to its set series, and exports the number
+// of distinct elements seen within the window as gauge.
+func (b *Exporter) addSetElement(metricName string, labels prometheus.Labels, help string, element string, mapping *mapper.MetricMapping) {
+	hash := hashNameAndLabels(metricName, labels)
+	s, ok := b.sets[hash]
+	if !ok {
+		s = &exactSet{
+			metricName: metricName,
+			labels:     labels,
+			help:       help,
+			elements:   map[string]time.Time{},
+		}
+		b.sets[hash] = s
+	}
+	s.mapping = mapping
+
+	now := clock.Now()
+	s.expire(now)
+	if _, ok := s.elements[element]; !ok && len(s.elements) >= mapping.SetMaxElements {
+		log.Debugf("Dropping element of set %q, the limit of %d elements is reached", metricName, mapping.SetMaxElements)
+		setElementsDropped.Inc()
+	} else {
+		s.elements[element] = now
+	}
+	b.exportSet(s)
+}
+
+// expire removes the elements last seen before the window of the mapping.
+func (s *exactSet) expire(now time.Time) {
+	for element, seen := range s.elements {
+		if now.Sub(seen) > s.mapping.SetWindow {
+			delete(s.elements, element)
+		}
+	}
+}
+
+// exportSet sets the gauge of a set series to its number of elements.
+func (b *Exporter) exportSet(s *exactSet) {
+	gauge, err := b.Gauges.Get(s.metricName, s.labels, s.help)
+	if err != nil {
+		log.Debugf(regErrF, s.metricName, err)
+		conflictingEventStats.WithLabelValues("set").Inc()
+		return
+	}
+	gauge.Set(float64(len(s.elements)))
+	b.saveLabelValues(s.metricName, s.labels, s.mapping)
+	eventStats.WithLabelValues("set").Inc()
+}
+
+// expireSetElements removes elements that fell out of the window from all
+// sets, so that their counts go down without new elements. Empty sets are
+// forgotten once their count is 0.
+func (b *Exporter) expireSetElements() {
+	now := clock.Now()
+	for hash, s := range b.sets {
+		before := len(s.elements)
+		s.expire(now)
+		if len(s.elements) == before {
+			continue
+		}
+		// Series kept at zero after their ttl has passed stay at zero.
+		if lvs, ok := b.labelValues[s.metricName][hash]; ok && !lvs.zeroed {
+			if gauge, err := b.Gauges.Get(s.metricName, s.labels, s.help); err == nil {
+				gauge.Set(float64(len(s.elements)))
+			}
+		}
+		if len(s.elements) == 0 {
+			delete(b.sets, hash)
+		}
+	}
+}
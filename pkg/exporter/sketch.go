@@ -0,0 +1,219 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+	"github.com/prometheus/statsd_exporter/pkg/sketch"
+)
+
+const (
+	// sketchRelativeAccuracy is the relative error of all quantiles
+	// exposed for sketch timers.
+	sketchRelativeAccuracy = 0.01
+	// sketchMaxBuckets bounds the memory used per series.
+	sketchMaxBuckets = 2048
+)
+
+// sketchVec is a collector exposing one summary per label set, whose
+// quantiles are computed from a DDSketch at scrape time.
+type sketchVec struct {
+	desc       *prometheus.Desc
+	labelNames []string
+	quantiles  []float64
+
+	// mtx only guards the series map, each series has its own lock.
+	mtx    sync.Mutex
+	series map[uint64]*sketchSeries
+}
+
+type sketchSeries struct {
+	labelValues []string
+
+	mtx    sync.Mutex
+	sketch *sketch.DDSketch
+}
+
+func newSketchVec(name, help string, labelNames []string, quantiles []float64) *sketchVec {
+	return &sketchVec{
+		desc:       prometheus.NewDesc(name, help, labelNames, nil),
+		labelNames: labelNames,
+		quantiles:  quantiles,
+		series:     map[uint64]*sketchSeries{},
+	}
+}
+
+func (v *sketchVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+func (v *sketchVec) Collect(ch chan<- prometheus.Metric) {
+	v.mtx.Lock()
+	series := make([]*sketchSeries, 0, len(v.series))
+	for _, s := range v.series {
+		series = append(series, s)
+	}
+	v.mtx.Unlock()
+
+	for _, s := range series {
+		quantiles := make(map[float64]float64, len(v.quantiles))
+		s.mtx.Lock()
+		for _, q := range v.quantiles {
+			quantiles[q] = s.sketch.Quantile(q)
+		}
+		count, sum := s.sketch.Count(), s.sketch.Sum()
+		s.mtx.Unlock()
+		ch <- prometheus.MustNewConstSummary(v.desc, count, sum, quantiles, s.labelValues...)
+	}
+}
+
+// getMetricWith returns an Observer for the series with the given labels,
+// creating it if necessary.
+func (v *sketchVec) getMetricWith(labels prometheus.Labels) (prometheus.Observer, error) {
+	if len(labels) != len(v.labelNames) {
+		return nil, fmt.Errorf("inconsistent label cardinality: expected %d label values but got %d in %#v", len(v.labelNames), len(labels), labels)
+	}
+	labelValues := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		value, ok := labels[name]
+		if !ok {
+			return nil, fmt.Errorf("label name %q missing in label map", name)
+		}
+		labelValues[i] = value
+	}
+
+	hash := model.LabelsToSignature(labels)
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	s, ok := v.series[hash]
+	if !ok {
+		sk, err := sketch.NewDDSketch(sketchRelativeAccuracy, sketchMaxBuckets)
+		if err != nil {
+			return nil, err
+		}
+		s = &sketchSeries{labelValues: labelValues, sketch: sk}
+		v.series[hash] = s
+	}
+	return &sketchObserver{series: s}, nil
+}
+
+// delete removes the series with the given labels. It reports whether the
+// series existed.
+func (v *sketchVec) delete(labels prometheus.Labels) bool {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	hash := model.LabelsToSignature(labels)
+	_, ok := v.series[hash]
+	delete(v.series, hash)
+	return ok
+}
+
+type sketchObserver struct {
+	series *sketchSeries
+}
+
+func (o *sketchObserver) Observe(value float64) {
+	o.series.mtx.Lock()
+	defer o.series.mtx.Unlock()
+	o.series.sketch.Add(value)
+}
+
+type SketchContainer struct {
+	Elements   map[string]*sketchVec
+	help       map[string]string
+	labelSets  labelSets
+	widened    widenedCollectors
+	mapper     *mapper.MetricMapper
+	registerer prometheus.Registerer
+}
+
+func NewSketchContainer(mapper *mapper.MetricMapper) *SketchContainer {
+	return &SketchContainer{
+		Elements:   make(map[string]*sketchVec),
+		help:       make(map[string]string),
+		labelSets:  make(labelSets),
+		widened:    make(widenedCollectors),
+		mapper:     mapper,
+		registerer: prometheus.DefaultRegisterer,
+	}
+}
+
+// Get returns the sketch series with the given labels. Label names the
+// sketch was registered with that are missing from labels are set to "".
+// Additional label names re-register the sketch, dropping its observations
+// so far.
+func (c *SketchContainer) Get(metricName string, labels prometheus.Labels, help string, mapping *mapper.MetricMapping) (prometheus.Observer, error) {
+	labels, widened := c.labelSets.conform(metricName, labels)
+	if vec, ok := c.Elements[metricName]; ok && widened != nil {
+		delete(c.Elements, metricName)
+		delete(c.labelSets, metricName)
+		labelSetsWidened.WithLabelValues("sketch").Inc()
+		if err := c.widened.unregister(c.registerer, metricName, vec); err != nil {
+			return nil, err
+		}
+	}
+	vec, ok := c.Elements[metricName]
+	if !ok {
+		objectives := c.mapper.Defaults.Quantiles
+		if len(objectives) == 0 {
+			objectives = c.mapper.DefaultQuantiles
+		}
+		if mapping != nil && mapping.Quantiles != nil && len(mapping.Quantiles) > 0 {
+			objectives = mapping.Quantiles
+		}
+		quantiles := make([]float64, 0, len(objectives))
+		for _, q := range objectives {
+			quantiles = append(quantiles, q.Quantile)
+		}
+		vec = newSketchVec(metricName, help, labelNames(labels), quantiles)
+		if err := c.widened.register(c.registerer, metricName, vec); err != nil {
+			return nil, err
+		}
+		c.Elements[metricName] = vec
+		c.help[metricName] = help
+		c.labelSets[metricName] = labelNames(labels)
+	}
+	return vec.getMetricWith(labels)
+}
+
+// remove unregisters a sketch, so that its name can be used by a metric of
+// another type.
+func (c *SketchContainer) remove(metricName string) {
+	if vec, ok := c.Elements[metricName]; ok {
+		c.widened.remove(c.registerer, metricName, vec)
+		delete(c.Elements, metricName)
+		delete(c.labelSets, metricName)
+	}
+}
+
+func (c *SketchContainer) Delete(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if _, ok := c.Elements[metricName]; ok {
+		c.Elements[metricName].delete(labels)
+	}
+}
+
+// Reset replaces an existing series with an empty one.
+func (c *SketchContainer) Reset(metricName string, labels prometheus.Labels) {
+	labels, _ = c.labelSets.conform(metricName, labels)
+	if vec, ok := c.Elements[metricName]; ok && vec.delete(labels) {
+		vec.getMetricWith(labels)
+	}
+}
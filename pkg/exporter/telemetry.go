@@ -0,0 +1,129 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	eventStats = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_events_total",
+			Help: "The total number of StatsD events seen.",
+		},
+		[]string{"type"},
+	)
+	valuesOutOfRange = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_values_out_of_range_total",
+			Help: "The total number of StatsD events whose value was out of the range of their mapping.",
+		},
+		[]string{"type", "action"},
+	)
+	eventsUnmapped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "statsd_exporter_events_unmapped_total",
+		Help: "The total number of StatsD events no mapping was found for.",
+	})
+	conflictingEventStats = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_events_conflict_total",
+			Help: "The total number of StatsD events with conflicting names.",
+		},
+		[]string{"type"},
+	)
+	typeConflicts = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_metric_type_conflict",
+			Help: "Whether events of the given type were received for a metric name in use by a metric of another type.",
+		},
+		[]string{"metric_name", "type"},
+	)
+	eventsQueued = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_events_queued_total",
+			Help: "The total number of events queued for processing, by type.",
+		},
+		[]string{"type"},
+	)
+	eventsShed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_events_shed_total",
+			Help: "The total number of events dropped because the queue was full, by type.",
+		},
+		[]string{"type"},
+	)
+	labelSetsWidened = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_label_sets_widened_total",
+			Help: "The number of metrics re-registered with additional label names, by type.",
+		},
+		[]string{"type"},
+	)
+	memoryBudgetLimit = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_memory_budget_bytes",
+			Help: "The heap size the exporter sheds load to stay below.",
+		},
+	)
+	memoryBudgetExceeded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_memory_budget_exceeded",
+			Help: "Whether the heap in use approaches the memory budget, so that load is shed.",
+		},
+	)
+	memoryShedBatches = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_memory_shed_batches_total",
+			Help: "The number of event batches dropped for their size while the memory budget was exceeded.",
+		},
+	)
+	truncatedValues = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_truncated_values_total",
+			Help: "The total number of metric names and label values truncated for exceeding the length limit.",
+		},
+		[]string{"field"},
+	)
+	setElementsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_set_elements_dropped_total",
+			Help: "The total number of set elements dropped because their set reached the limit of elements.",
+		},
+	)
+	seriesExpired = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_series_expired_total",
+			Help: "The total number of series whose ttl has passed, by expiry action.",
+		},
+		[]string{"action"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(eventStats)
+	prometheus.MustRegister(valuesOutOfRange)
+	prometheus.MustRegister(eventsUnmapped)
+	prometheus.MustRegister(conflictingEventStats)
+	prometheus.MustRegister(typeConflicts)
+	prometheus.MustRegister(eventsQueued)
+	prometheus.MustRegister(eventsShed)
+	prometheus.MustRegister(labelSetsWidened)
+	prometheus.MustRegister(memoryBudgetLimit)
+	prometheus.MustRegister(memoryBudgetExceeded)
+	prometheus.MustRegister(memoryShedBatches)
+	prometheus.MustRegister(truncatedValues)
+	prometheus.MustRegister(seriesExpired)
+	prometheus.MustRegister(setElementsDropped)
+}
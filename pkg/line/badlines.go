@@ -0,0 +1,123 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/clock"
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// BadLine is a line that could not be parsed, or only in part.
+type BadLine struct {
+	Time     time.Time
+	Listener string
+	Reason   string
+	Line     string
+}
+
+// BadLineRecorder is passed the lines that could not be parsed, or only in
+// part, with the listener they were received by and the reason of the first
+// error.
+type BadLineRecorder interface {
+	RecordBadLine(listener, line, reason string)
+}
+
+// RecordBadLines returns a parser that passes the lines p fails to parse to
+// r as received by the given listener. Only errors of the built-in parsers
+// are recorded, other parsers are returned unchanged.
+func RecordBadLines(p Parser, listener string, r BadLineRecorder) Parser {
+	rp, ok := p.(reportingParser)
+	if !ok {
+		return p
+	}
+	return reportingFunc(func(line string, o parseOptions) event.Events {
+		var reason string
+		report := o.report
+		o.report = func(why string) {
+			if reason == "" {
+				reason = why
+			}
+			if report != nil {
+				report(why)
+			}
+		}
+		events := rp.lineToEvents(line, o)
+		if reason != "" {
+			r.RecordBadLine(listener, line, reason)
+		}
+		return events
+	})
+}
+
+// BadLines keeps the most recent lines that could not be parsed in a ring
+// buffer, and logs a summary of them at most once per log interval.
+type BadLines struct {
+	logInterval time.Duration
+
+	mtx      sync.Mutex
+	lines    []BadLine
+	next     int
+	lastLog  time.Time
+	unlogged int
+}
+
+// NewBadLines returns BadLines keeping the last size lines. With a log
+// interval of 0, no summary is logged.
+func NewBadLines(size int, logInterval time.Duration) *BadLines {
+	return &BadLines{
+		logInterval: logInterval,
+		lines:       make([]BadLine, 0, size),
+	}
+}
+
+// RecordBadLine adds a line received by the given listener to the ring
+// buffer, replacing the oldest line once it is full.
+func (b *BadLines) RecordBadLine(listener, line, reason string) {
+	now := clock.Now()
+	bl := BadLine{Time: now, Listener: listener, Reason: reason, Line: line}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if len(b.lines) < cap(b.lines) {
+		b.lines = append(b.lines, bl)
+	} else if len(b.lines) > 0 {
+		b.lines[b.next] = bl
+		b.next = (b.next + 1) % len(b.lines)
+	}
+
+	if b.logInterval <= 0 {
+		return
+	}
+	b.unlogged++
+	if now.Sub(b.lastLog) < b.logInterval {
+		return
+	}
+	log.Warnf("%d lines could not be parsed since the last report, the last one from listener %s (%s): %q", b.unlogged, listener, reason, line)
+	b.lastLog = now
+	b.unlogged = 0
+}
+
+// Lines returns the lines in the ring buffer, oldest first.
+func (b *BadLines) Lines() []BadLine {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	lines := make([]BadLine, 0, len(b.lines))
+	lines = append(lines, b.lines[b.next:]...)
+	return append(lines, b.lines[:b.next]...)
+}
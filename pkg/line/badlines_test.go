@@ -0,0 +1,54 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"testing"
+)
+
+func TestBadLines(t *testing.T) {
+	b := NewBadLines(2, 0)
+	for _, format := range []string{DefaultFormat, AutoFormat} {
+		p, err := Lookup(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p = RecordBadLines(p, format, b)
+		for _, l := range []string{"foo:1|c", "", "foo:x|c", "foo:1|c:2|z|q|r|s|t|u"} {
+			p.LineToEvents(l)
+		}
+	}
+
+	// Only the last two bad lines are kept, and lines that can be parsed in
+	// part are recorded with the reason of their first error.
+	got := b.Lines()
+	want := []BadLine{
+		{Listener: AutoFormat, Reason: "malformed_value", Line: "foo:x|c"},
+		{Listener: AutoFormat, Reason: "malformed_component", Line: "foo:1|c:2|z|q|r|s|t|u"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d bad lines, got %v", len(want), got)
+	}
+	for i := range want {
+		got[i].Time = want[i].Time
+		if got[i] != want[i] {
+			t.Errorf("Expected bad line %d to be %v, got %v", i, want[i], got[i])
+		}
+	}
+
+	custom := ParserFunc(LineToEvents)
+	if _, ok := RecordBadLines(custom, "udp", b).(ParserFunc); !ok {
+		t.Errorf("Expected parsers without error reporting to be returned unchanged")
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"io"
+	"sync"
+
+	"github.com/prometheus/common/log"
+)
+
+// DeadLetter writes every line that could not be parsed unchanged to a
+// writer, e.g. a file or a connection to another StatsD server, so that the
+// lines are kept until the client sending them is fixed.
+type DeadLetter struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+// NewDeadLetter returns a DeadLetter writing to w. Every line is written
+// with a single call to w.Write, so that lines sent over UDP arrive in
+// packets of their own.
+func NewDeadLetter(w io.Writer) *DeadLetter {
+	return &DeadLetter{w: w}
+}
+
+func (d *DeadLetter) RecordBadLine(listener, line, reason string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, err := io.WriteString(d.w, line+"\n"); err != nil {
+		deadLetterErrors.Inc()
+		log.Debugf("Error writing dead letter line from listener %s: %v", listener, err)
+		return
+	}
+	deadLetterLines.Inc()
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeadLetter(t *testing.T) {
+	var buf bytes.Buffer
+	p := RecordBadLines(ParserFunc(LineToEvents), "udp", NewDeadLetter(&buf))
+	// ParserFunc does not report errors, so it is returned unchanged.
+	p.LineToEvents("foo:x|c")
+
+	p, err := Lookup(DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = RecordBadLines(p, "udp", NewDeadLetter(&buf))
+	for _, l := range []string{"foo:1|c", "foo:x|c", "bar", "foo:1|c:2|z"} {
+		p.LineToEvents(l)
+	}
+
+	want := "foo:x|c\nbar\nfoo:1|c:2|z\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Expected dead letter output:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// tagValueReplacer replaces the characters that separate the parts of a
+// DogStatsD line in tag values.
+var tagValueReplacer = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+
+// EventToLines formats an event as DogStatsD lines that LineToEvents parses
+// back into an equivalent event. Labels become tags, sorted by name; commas,
+// pipes and newlines in their values are replaced with underscores. Setting a
+// gauge to a negative value takes two lines.
+func EventToLines(e event.Event) ([]string, error) {
+	var statType string
+	value := strconv.FormatFloat(e.Value(), 'g', -1, 64)
+	var prefix []string
+	switch ev := e.(type) {
+	case *event.CounterEvent:
+		statType = "c"
+	case *event.GaugeEvent:
+		statType = "g"
+		switch {
+		case ev.GRelative && ev.GValue >= 0:
+			value = "+" + value
+		case !ev.GRelative && ev.GValue < 0:
+			// A leading sign makes the value relative, so reset the
+			// gauge to zero first.
+			prefix = []string{ev.GMetricName + ":0|g" + formatTags(ev.GLabels)}
+		}
+	case *event.TimerEvent:
+		statType = "ms"
+	case *event.SetEvent:
+		statType = "s"
+		value = ev.SElement
+	case *event.HistogramEvent:
+		statType = "H"
+		value = formatBuckets(ev)
+	default:
+		return nil, fmt.Errorf("cannot format event of type %T", e)
+	}
+	return append(prefix, e.MetricName()+":"+value+"|"+statType+formatTags(e.Labels())), nil
+}
+
+func formatBuckets(h *event.HistogramEvent) string {
+	bounds := make([]float64, 0, len(h.HBuckets))
+	for bound := range h.HBuckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+	fields := make([]string, 0, len(bounds)+2)
+	for _, bound := range bounds {
+		fields = append(fields, "le"+strconv.FormatFloat(bound, 'g', -1, 64)+"="+strconv.FormatUint(h.HBuckets[bound], 10))
+	}
+	fields = append(fields, "sum="+strconv.FormatFloat(h.HSum, 'g', -1, 64), "count="+strconv.FormatUint(h.HCount, 10))
+	return strings.Join(fields, ",")
+}
+
+func formatTags(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("|#")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name + ":" + tagValueReplacer.Replace(labels[name]))
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestEventToLines(t *testing.T) {
+	scenarios := []struct {
+		in   event.Event
+		want []string
+	}{
+		{
+			in:   event.NewCounterEvent("foo", 2.5, nil),
+			want: []string{"foo:2.5|c"},
+		},
+		{
+			in:   event.NewTimerEvent("foo", 300, map[string]string{"b": "x,y", "a": "1"}),
+			want: []string{"foo:300|ms|#a:1,b:x_y"},
+		},
+		{
+			in:   event.NewGaugeEvent("foo", 5, true, nil),
+			want: []string{"foo:+5|g"},
+		},
+		{
+			in:   event.NewGaugeEvent("foo", -5, true, nil),
+			want: []string{"foo:-5|g"},
+		},
+		{
+			in:   event.NewGaugeEvent("foo", -5, false, map[string]string{"a": "1"}),
+			want: []string{"foo:0|g|#a:1", "foo:-5|g|#a:1"},
+		},
+	}
+
+	for _, s := range scenarios {
+		got, err := EventToLines(s.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("Expected lines %q, got %q", s.want, got)
+		}
+	}
+}
+
+func TestEventToLinesRoundTrip(t *testing.T) {
+	for _, e := range []event.Event{
+		event.NewCounterEvent("foo", 2.5, map[string]string{"a": "1"}),
+		event.NewGaugeEvent("foo", 3, false, map[string]string{}),
+		event.NewGaugeEvent("foo", 3, true, map[string]string{}),
+		event.NewTimerEvent("foo", 0.25, map[string]string{"a": "1", "b": "2"}),
+		event.NewHistogramEvent("foo", map[float64]uint64{1: 5, 5: 3}, 42, 9, map[string]string{"a": "1"}),
+	} {
+		lines, err := EventToLines(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := LineToEvents(lines[0])
+		if len(got) != 1 || !reflect.DeepEqual(got[0], e) {
+			t.Errorf("Line %q was parsed to %v, expected %v", lines[0], got, e)
+		}
+	}
+}
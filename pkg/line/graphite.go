@@ -0,0 +1,127 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+const (
+	// GraphiteFormat is the name of the Graphite plaintext format.
+	GraphiteFormat = "graphite"
+	// AutoFormat detects the format of every line.
+	AutoFormat = "auto"
+
+	// dogStatsDFormat is only used to report detected lines, DogStatsD
+	// lines are parsed by the StatsD parser.
+	dogStatsDFormat = "dogstatsd"
+)
+
+func init() {
+	Register(GraphiteFormat, reportingFunc(graphiteLineToEvents))
+	Register(AutoFormat, reportingFunc(detectLineToEvents))
+}
+
+// GraphiteLineToEvents parses a line in the Graphite plaintext format,
+// "path[;tag=value...] value [timestamp]", into a gauge event. Timestamps
+// are ignored.
+func GraphiteLineToEvents(line string) event.Events {
+	return graphiteLineToEvents(line, parseOptions{})
+}
+
+func graphiteLineToEvents(line string, o parseOptions) event.Events {
+	events := event.Events{}
+	if line == "" {
+		return events
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 || !utf8.ValidString(line) {
+		sampleError(o, "malformed_line")
+		log.Debugln("Bad line from Graphite:", line)
+		return events
+	}
+	samplesReceived.Inc()
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		sampleError(o, "malformed_value")
+		log.Debugf("Bad value %s on line: %s", fields[1], line)
+		return events
+	}
+
+	// Tagged series carry their tags as ";name=value" after the path.
+	parts := strings.Split(fields[0], ";")
+	labels := map[string]string{}
+	for _, tag := range parts[1:] {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) == 2 && len(kv[1]) == 0 && o.EmptyTagValue != "" {
+			kv[1] = o.EmptyTagValue
+		}
+		if len(kv) < 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			tagErrors.Inc()
+			log.Debugf("Malformed or empty Graphite tag %s on line %s", tag, line)
+			continue
+		}
+		tagsReceived.Inc()
+		labels[mapper.EscapeMetricName(kv[0])] = kv[1]
+	}
+
+	return append(events, &event.GaugeEvent{
+		GMetricName: parts[0],
+		GValue:      value,
+		GLabels:     labels,
+	})
+}
+
+// DetectFormat guesses the format of a line: StatsD lines have a type
+// separated by "|", with DogStatsD tags in a "|#" section, while Graphite
+// lines consist of a path, a numeric value, and optionally a timestamp
+// separated by whitespace.
+func DetectFormat(line string) string {
+	if strings.Contains(line, "|") {
+		if strings.Contains(line, "|#") {
+			return dogStatsDFormat
+		}
+		return DefaultFormat
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 2 || len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			return GraphiteFormat
+		}
+	}
+	return DefaultFormat
+}
+
+// detectLineToEvents parses a line with the parser for its detected format,
+// so that a single listener can accept StatsD, DogStatsD and Graphite.
+func detectLineToEvents(line string, o parseOptions) event.Events {
+	if line == "" {
+		return event.Events{}
+	}
+	format := DetectFormat(line)
+	linesDetected.WithLabelValues(format).Inc()
+	if format == GraphiteFormat {
+		return graphiteLineToEvents(line, o)
+	}
+	return lineToEvents(line, o)
+}
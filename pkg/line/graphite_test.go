@@ -0,0 +1,86 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestGraphiteLineToEvents(t *testing.T) {
+	scenarios := []struct {
+		in  string
+		out event.Events
+	}{
+		{
+			in:  "",
+			out: event.Events{},
+		}, {
+			in:  "foo.bar 42 1546300800",
+			out: event.Events{event.NewGaugeEvent("foo.bar", 42, false, nil)},
+		}, {
+			in:  "foo.bar -1.5",
+			out: event.Events{event.NewGaugeEvent("foo.bar", -1.5, false, nil)},
+		}, {
+			in:  "foo.bar;env=prod;dc.name=ams;broken 1 1546300800",
+			out: event.Events{event.NewGaugeEvent("foo.bar", 1, false, map[string]string{"env": "prod", "dc_name": "ams"})},
+		}, {
+			in:  "foo.bar",
+			out: event.Events{},
+		}, {
+			in:  "foo.bar notanumber 1546300800",
+			out: event.Events{},
+		},
+	}
+
+	for _, s := range scenarios {
+		if got := GraphiteLineToEvents(s.in); !reflect.DeepEqual(got, s.out) {
+			t.Errorf("%q: expected %#v, got %#v", s.in, s.out, got)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	scenarios := map[string]string{
+		"foo:1|c":                  DefaultFormat,
+		"foo:1|c|@0.1":             DefaultFormat,
+		"foo:1|c|#tag:value":       dogStatsDFormat,
+		"foo.bar 1 1546300800":     GraphiteFormat,
+		"foo.bar;tag=value 1.5":    GraphiteFormat,
+		"foo.bar not a timestamp":  DefaultFormat,
+		"garbage":                  DefaultFormat,
+		"foo:1|ms:2|ms":            DefaultFormat,
+		"foo.bar 1 1546300800 bad": DefaultFormat,
+	}
+	for in, want := range scenarios {
+		if got := DetectFormat(in); got != want {
+			t.Errorf("%q: expected format %s, got %s", in, want, got)
+		}
+	}
+
+	p, err := Lookup(AutoFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := p.LineToEvents("foo.bar 3 1546300800")
+	if _, ok := events[0].(*event.GaugeEvent); len(events) != 1 || !ok {
+		t.Errorf("expected a single gauge event from Graphite line, got %v", events)
+	}
+	events = p.LineToEvents("foo:3|c|#tag:value")
+	if len(events) != 1 || events[0].Labels()["tag"] != "value" {
+		t.Errorf("expected a single tagged event from DogStatsD line, got %v", events)
+	}
+}
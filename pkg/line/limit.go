@@ -0,0 +1,46 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"sort"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// LimitTags returns a parser that keeps at most max tags of every event
+// parsed by p. Of the tags of an event, those with the lexicographically
+// smallest names are kept, so that the same tags are kept for all events
+// carrying the same tags.
+func LimitTags(p Parser, max int) Parser {
+	return ParserFunc(func(line string) event.Events {
+		events := p.LineToEvents(line)
+		for _, e := range events {
+			labels := e.Labels()
+			if len(labels) <= max {
+				continue
+			}
+			names := make([]string, 0, len(labels))
+			for name := range labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names[max:] {
+				delete(labels, name)
+			}
+			tagsDropped.Add(float64(len(names) - max))
+		}
+		return events
+	})
+}
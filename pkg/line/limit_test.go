@@ -0,0 +1,51 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLimitTags(t *testing.T) {
+	p := LimitTags(ParserFunc(LineToEvents), 2)
+
+	scenarios := []struct {
+		line string
+		want map[string]string
+	}{
+		{
+			line: "foo:1|c|#a:1,b:2",
+			want: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			line: "foo:1|c|#d:4,c:3,a:1,b:2",
+			want: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			line: "foo:1|c",
+			want: map[string]string{},
+		},
+	}
+
+	for _, s := range scenarios {
+		events := p.LineToEvents(s.line)
+		if len(events) != 1 {
+			t.Fatalf("%s: expected one event, got %d", s.line, len(events))
+		}
+		if got := events[0].Labels(); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: expected labels %v, got %v", s.line, s.want, got)
+		}
+	}
+}
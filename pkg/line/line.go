@@ -0,0 +1,289 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package line parses StatsD and DogStatsD lines into events.
+package line
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// buildEvent builds the event of a sample. valueStr is the value as received,
+// which sets and pre-bucketed histograms use instead of the parsed value.
+func buildEvent(statType, metric string, value float64, valueStr string, relative bool, labels map[string]string) (event.Event, error) {
+	switch statType {
+	case "c":
+		return &event.CounterEvent{
+			CMetricName: metric,
+			CValue:      float64(value),
+			CLabels:     labels,
+		}, nil
+	case "g":
+		return &event.GaugeEvent{
+			GMetricName: metric,
+			GValue:      float64(value),
+			GRelative:   relative,
+			GLabels:     labels,
+		}, nil
+	case "ms", "h":
+		return &event.TimerEvent{
+			TMetricName: metric,
+			TValue:      float64(value),
+			TLabels:     labels,
+		}, nil
+	case "s":
+		return &event.SetEvent{
+			SMetricName: metric,
+			SElement:    valueStr,
+			SLabels:     labels,
+		}, nil
+	case "H":
+		return parseBuckets(metric, valueStr, labels)
+	default:
+		return nil, fmt.Errorf("bad stat type %s", statType)
+	}
+}
+
+// parseBuckets parses the value of a pre-bucketed histogram, e.g.
+// le1=5,le5=3,sum=42,count=8. Bucket counts do not include the observations
+// of lower buckets. Without count, it is the total of the bucket counts.
+func parseBuckets(metric, value string, labels map[string]string) (*event.HistogramEvent, error) {
+	h := &event.HistogramEvent{
+		HMetricName: metric,
+		HBuckets:    map[float64]uint64{},
+		HLabels:     labels,
+	}
+	var total uint64
+	hasSum, hasCount := false, false
+	for _, field := range strings.Split(value, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad histogram field %q", field)
+		}
+		var err error
+		switch {
+		case kv[0] == "sum":
+			h.HSum, err = strconv.ParseFloat(kv[1], 64)
+			hasSum = true
+		case kv[0] == "count":
+			h.HCount, err = strconv.ParseUint(kv[1], 10, 64)
+			hasCount = true
+		case strings.HasPrefix(kv[0], "le"):
+			var bound float64
+			var count uint64
+			if bound, err = strconv.ParseFloat(kv[0][2:], 64); err != nil {
+				break
+			}
+			if math.IsNaN(bound) {
+				return nil, fmt.Errorf("bad histogram bucket %q", kv[0])
+			}
+			if count, err = strconv.ParseUint(kv[1], 10, 64); err != nil {
+				break
+			}
+			if _, ok := h.HBuckets[bound]; ok {
+				return nil, fmt.Errorf("duplicate histogram bucket %q", kv[0])
+			}
+			h.HBuckets[bound] = count
+			total += count
+		default:
+			return nil, fmt.Errorf("bad histogram field %q", field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad histogram field %q: %s", field, err)
+		}
+	}
+	if !hasSum {
+		return nil, fmt.Errorf("histogram without sum")
+	}
+	if !hasCount {
+		h.HCount = total
+	}
+	if h.HCount < total {
+		return nil, fmt.Errorf("histogram count %d is lower than the total of its buckets %d", h.HCount, total)
+	}
+	return h, nil
+}
+
+func parseDogStatsDTagsToLabels(component string, o parseOptions) map[string]string {
+	labels := map[string]string{}
+	tagsReceived.Inc()
+	tags := strings.Split(component, ",")
+	for _, t := range tags {
+		t = strings.TrimPrefix(t, "#")
+		kv := strings.SplitN(t, ":", 2)
+		if len(kv) == 1 && len(kv[0]) > 0 && o.UnaryTagValue != "" {
+			kv = append(kv, o.UnaryTagValue)
+		}
+		if len(kv) == 2 && len(kv[1]) == 0 && o.EmptyTagValue != "" {
+			kv[1] = o.EmptyTagValue
+		}
+
+		if len(kv) < 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			tagErrors.Inc()
+			log.Debugf("Malformed or empty DogStatsD tag %s in component %s", t, component)
+			continue
+		}
+
+		labels[mapper.EscapeMetricName(kv[0])] = kv[1]
+	}
+	return labels
+}
+
+// LineToEvents parses a single StatsD line into events. Malformed samples are
+// counted and skipped.
+func LineToEvents(line string) event.Events {
+	return lineToEvents(line, parseOptions{})
+}
+
+// sampleError counts a parse error and passes its reason to the report
+// function of the options, if set.
+func sampleError(o parseOptions, reason string) {
+	sampleErrors.WithLabelValues(reason).Inc()
+	if o.report != nil {
+		o.report(reason)
+	}
+}
+
+func lineToEvents(line string, o parseOptions) event.Events {
+	events := event.Events{}
+	if line == "" {
+		return events
+	}
+
+	elements := strings.SplitN(line, ":", 2)
+	if len(elements) < 2 || len(elements[0]) == 0 || !utf8.ValidString(line) {
+		sampleError(o, "malformed_line")
+		log.Debugln("Bad line from StatsD:", line)
+		return events
+	}
+	metric := elements[0]
+	var samples []string
+	if strings.Contains(elements[1], "|#") {
+		// using datadog extensions, disable multi-metrics
+		samples = elements[1:]
+	} else {
+		samples = strings.Split(elements[1], ":")
+	}
+samples:
+	for _, sample := range samples {
+		samplesReceived.Inc()
+		components := strings.Split(sample, "|")
+		samplingFactor := 1.0
+		// Besides value and type, a sample may carry a sampling factor,
+		// tags, a container ID and a timestamp, in any order.
+		if len(components) < 2 || len(components) > 6 {
+			sampleError(o, "malformed_component")
+			log.Debugln("Bad component on line:", line)
+			continue
+		}
+		valueStr, statType := components[0], components[1]
+
+		var relative = false
+		if strings.Index(valueStr, "+") == 0 || strings.Index(valueStr, "-") == 0 {
+			relative = true
+		}
+
+		// Set elements are arbitrary strings, and pre-bucketed histograms
+		// are parsed when building their event.
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil && (statType != "s" && statType != "H" || valueStr == "") {
+			log.Debugf("Bad value %s on line: %s", valueStr, line)
+			sampleError(o, "malformed_value")
+			continue
+		}
+
+		multiplyEvents := 1
+		labels := map[string]string{}
+		tagged := false
+		if len(components) >= 3 {
+			for _, component := range components[2:] {
+				if len(component) == 0 {
+					log.Debugln("Empty component on line: ", line)
+					sampleError(o, "malformed_component")
+					continue samples
+				}
+			}
+
+			for _, component := range components[2:] {
+				switch component[0] {
+				case '@':
+					if statType != "c" && statType != "ms" {
+						log.Debugln("Illegal sampling factor for non-counter metric on line", line)
+						sampleError(o, "illegal_sample_factor")
+						continue
+					}
+					samplingFactor, err = strconv.ParseFloat(component[1:], 64)
+					if err != nil {
+						log.Debugf("Invalid sampling factor %s on line %s", component[1:], line)
+						sampleError(o, "invalid_sample_factor")
+					}
+					if samplingFactor == 0 {
+						samplingFactor = 1
+					}
+
+					if statType == "c" {
+						value /= samplingFactor
+					} else if statType == "ms" {
+						multiplyEvents = int(1 / samplingFactor)
+					}
+				case '#':
+					if !tagged {
+						labels = parseDogStatsDTagsToLabels(component, o)
+						tagged = true
+						break
+					}
+					// Proxies concatenating payloads may add another tag
+					// section, its tags override earlier ones.
+					tagSectionsMerged.Inc()
+					for k, v := range parseDogStatsDTagsToLabels(component, o) {
+						if _, ok := labels[k]; ok {
+							tagConflicts.Inc()
+						}
+						labels[k] = v
+					}
+				case 'c', 'T':
+					// DogStatsD container IDs (c:<id>) and timestamps
+					// (T<unix seconds>) are accepted but ignored.
+					if component[0] == 'c' && !strings.HasPrefix(component, "c:") {
+						log.Debugf("Invalid sampling factor or tag section %s on line %s", component, line)
+						sampleError(o, "invalid_sample_factor")
+					}
+				default:
+					log.Debugf("Invalid sampling factor or tag section %s on line %s", components[2], line)
+					sampleError(o, "invalid_sample_factor")
+					continue
+				}
+			}
+		}
+
+		for i := 0; i < multiplyEvents; i++ {
+			event, err := buildEvent(statType, metric, value, valueStr, relative, labels)
+			if err != nil {
+				log.Debugf("Error building event on line %s: %s", line, err)
+				sampleError(o, "illegal_event")
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// DefaultFormat is the name of the StatsD line format, including the
+// DogStatsD extensions.
+const DefaultFormat = "statsd"
+
+// Parser turns a single line received by a listener into events.
+type Parser interface {
+	LineToEvents(line string) event.Events
+}
+
+// ParserFunc adapts an ordinary function to the Parser interface.
+type ParserFunc func(line string) event.Events
+
+func (f ParserFunc) LineToEvents(line string) event.Events { return f(line) }
+
+// Options change how the built-in parsers handle tags.
+type Options struct {
+	// UnaryTagValue, if not empty, is the value of tags without value,
+	// e.g. "#canary". Such tags are dropped otherwise.
+	UnaryTagValue string
+	// EmptyTagValue, if not empty, replaces empty tag values, e.g. in
+	// "#env:", so that the label is kept. Such tags are dropped otherwise.
+	EmptyTagValue string
+}
+
+// parseOptions are the options of a single call of a built-in parser.
+type parseOptions struct {
+	Options
+	// report, if set, is passed the reason for every error parsing a
+	// line.
+	report func(reason string)
+}
+
+// reportingParser is implemented by the built-in parsers, which accept
+// options and report the reason for every error parsing a line.
+type reportingParser interface {
+	lineToEvents(line string, o parseOptions) event.Events
+}
+
+// reportingFunc adapts a built-in parsing function to both Parser and
+// reportingParser.
+type reportingFunc func(line string, o parseOptions) event.Events
+
+func (f reportingFunc) LineToEvents(line string) event.Events { return f(line, parseOptions{}) }
+
+func (f reportingFunc) lineToEvents(line string, o parseOptions) event.Events {
+	return f(line, o)
+}
+
+// WithOptions returns a parser that parses lines like p with the given
+// options. Parsers other than the built-in ones are returned unchanged.
+func WithOptions(p Parser, o Options) Parser {
+	rp, ok := p.(reportingParser)
+	if !ok {
+		return p
+	}
+	return reportingFunc(func(line string, po parseOptions) event.Events {
+		po.Options = o
+		return rp.lineToEvents(line, po)
+	})
+}
+
+var (
+	parsersMtx sync.RWMutex
+	parsers    = map[string]Parser{
+		DefaultFormat: reportingFunc(lineToEvents),
+	}
+)
+
+// Register makes a parser available under the given format name. It panics
+// if the name is empty or already taken.
+func Register(format string, p Parser) {
+	parsersMtx.Lock()
+	defer parsersMtx.Unlock()
+	if format == "" || p == nil {
+		panic("line: Register called with empty format or nil parser")
+	}
+	if _, ok := parsers[format]; ok {
+		panic(fmt.Sprintf("line: parser for format %q registered twice", format))
+	}
+	parsers[format] = p
+}
+
+// Lookup returns the parser registered for the given format name.
+func Lookup(format string) (Parser, error) {
+	parsersMtx.RLock()
+	defer parsersMtx.RUnlock()
+	p, ok := parsers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown line format %q, available formats: %v", format, formats())
+	}
+	return p, nil
+}
+
+// Formats returns the sorted names of all registered formats.
+func Formats() []string {
+	parsersMtx.RLock()
+	defer parsersMtx.RUnlock()
+	return formats()
+}
+
+func formats() []string {
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
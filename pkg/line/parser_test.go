@@ -0,0 +1,107 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestParserRegistry(t *testing.T) {
+	p, err := Lookup(DefaultFormat)
+	if err != nil {
+		t.Fatalf("default format should be registered: %v", err)
+	}
+	if got := p.LineToEvents("foo:1|c"); len(got) != 1 || got[0].MetricName() != "foo" {
+		t.Fatalf("unexpected events from default parser: %v", got)
+	}
+
+	if _, err := Lookup("test"); err == nil {
+		t.Fatal("expected error for unregistered format")
+	}
+
+	Register("test", ParserFunc(func(line string) event.Events {
+		return event.Events{event.NewCounterEvent(line, 1, nil)}
+	}))
+	p, err = Lookup("test")
+	if err != nil {
+		t.Fatalf("registered format not found: %v", err)
+	}
+	if got := p.LineToEvents("bar"); len(got) != 1 || got[0].MetricName() != "bar" {
+		t.Fatalf("unexpected events from registered parser: %v", got)
+	}
+	if got, want := Formats(), []string{AutoFormat, GraphiteFormat, DefaultFormat, "test"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected formats %v, got %v", want, got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a format twice should panic")
+		}
+	}()
+	Register("test", ParserFunc(LineToEvents))
+}
+
+func TestUnaryTags(t *testing.T) {
+	p, err := Lookup(AutoFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBadLines(10, 0)
+	parsers := []Parser{
+		WithOptions(p, Options{UnaryTagValue: "true"}),
+		RecordBadLines(WithOptions(p, Options{UnaryTagValue: "true"}), "udp", b),
+		WithOptions(RecordBadLines(p, "udp", b), Options{UnaryTagValue: "true"}),
+	}
+	for i, p := range parsers {
+		events := p.LineToEvents("foo:1|c|#canary,env:prod,:x")
+		if len(events) != 1 {
+			t.Fatalf("%d. Expected one event, got %v", i, events)
+		}
+		want := map[string]string{"canary": "true", "env": "prod"}
+		if got := events[0].Labels(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d. Expected labels %v, got %v", i, want, got)
+		}
+	}
+
+	events := p.LineToEvents("foo:1|c|#canary")
+	if got := events[0].Labels(); len(got) != 0 {
+		t.Errorf("Expected unary tags to be dropped without options, got %v", got)
+	}
+}
+
+func TestEmptyTagValues(t *testing.T) {
+	p, err := Lookup(AutoFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = WithOptions(p, Options{EmptyTagValue: "__empty__"})
+
+	scenarios := map[string]map[string]string{
+		"foo:1|c|#env:,host:a": {"env": "__empty__", "host": "a"},
+		"foo:1|c|#env,host:":   {"host": "__empty__"},
+		"foo;env=;host=a 1":    {"env": "__empty__", "host": "a"},
+	}
+	for line, want := range scenarios {
+		events := p.LineToEvents(line)
+		if len(events) != 1 {
+			t.Fatalf("Expected one event for %q, got %v", line, events)
+		}
+		if got := events[0].Labels(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected labels %v for %q, got %v", want, line, got)
+		}
+	}
+}
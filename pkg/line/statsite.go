@@ -0,0 +1,123 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// Metric types of statsite records.
+const (
+	statsiteKeyValue = 0x1
+	statsiteCounter  = 0x2
+	statsiteTimer    = 0x3
+	statsiteSet      = 0x4
+	statsiteGauge    = 0x5
+)
+
+// Value types of statsite records, i.e. the aggregate they carry.
+const (
+	statsiteRaw        = 0x0
+	statsiteSum        = 0x1
+	statsiteSumSquares = 0x2
+	statsiteMean       = 0x3
+	statsiteCount      = 0x4
+	statsiteStddev     = 0x5
+	statsiteMin        = 0x6
+	statsiteMax        = 0x7
+	statsitePercentile = 0x80
+)
+
+// statsiteTimerSuffixes names the timer aggregates exported as gauges, after
+// the names of statsite's text sink.
+var statsiteTimerSuffixes = map[byte]string{
+	statsiteSum:        "sum",
+	statsiteSumSquares: "sum_sq",
+	statsiteMean:       "mean",
+	statsiteCount:      "count",
+	statsiteStddev:     "stdev",
+	statsiteMin:        "lower",
+	statsiteMax:        "upper",
+}
+
+// statsiteHeaderSize is the size of the fixed part of a record: timestamp,
+// metric type, value type, key length and value.
+const statsiteHeaderSize = 8 + 1 + 1 + 2 + 8
+
+// ReadStatsiteRecord reads a record of the binary stream statsite writes to
+// its sinks with binary_stream enabled, and returns its events. Records are
+// already aggregated over the statsite flush interval:
+//
+//   - key/value pairs, gauges and sets, whose value is their cardinality,
+//     set gauges,
+//   - the sums of counters increment counters, their other aggregates are
+//     skipped,
+//   - the aggregates of timers, including percentiles, set gauges named
+//     after the timer and the aggregate, e.g. <key>.mean or <key>.p99.
+//
+// Histogram bins and records of unknown types are skipped, without events. It
+// returns io.EOF at the end of the stream.
+func ReadStatsiteRecord(r *bufio.Reader) (event.Events, error) {
+	var header [statsiteHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated statsite record header")
+		}
+		return nil, err
+	}
+	metricType, valueType := header[8], header[9]
+	keyLength := binary.LittleEndian.Uint16(header[10:12])
+	value := math.Float64frombits(binary.LittleEndian.Uint64(header[12:20]))
+	key := make([]byte, keyLength)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, fmt.Errorf("truncated statsite record key: %v", err)
+	}
+	// Keys are NUL terminated.
+	if len(key) == 0 || key[len(key)-1] != 0 {
+		return nil, fmt.Errorf("statsite record key is not NUL terminated")
+	}
+	name := string(key[:len(key)-1])
+	samplesReceived.Inc()
+
+	switch {
+	case metricType == statsiteKeyValue || metricType == statsiteGauge || metricType == statsiteSet:
+		if valueType != statsiteRaw && !(metricType == statsiteSet && valueType == statsiteSum) {
+			break
+		}
+		return event.Events{event.NewGaugeEvent(name, value, false, nil)}, nil
+	case metricType == statsiteCounter:
+		if valueType != statsiteSum {
+			break
+		}
+		return event.Events{event.NewCounterEvent(name, value, nil)}, nil
+	case metricType == statsiteTimer && valueType&statsitePercentile != 0:
+		percentile := strconv.Itoa(int(valueType &^ statsitePercentile))
+		return event.Events{event.NewGaugeEvent(name+".p"+percentile, value, false, nil)}, nil
+	case metricType == statsiteTimer:
+		suffix, ok := statsiteTimerSuffixes[valueType]
+		if !ok {
+			break
+		}
+		return event.Events{event.NewGaugeEvent(name+"."+suffix, value, false, nil)}, nil
+	}
+	statsiteSkipped.Inc()
+	return event.Events{}, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// statsiteRecord encodes a record of statsite's binary stream.
+func statsiteRecord(metricType, valueType byte, key string, value float64) []byte {
+	b := make([]byte, statsiteHeaderSize, statsiteHeaderSize+len(key)+1)
+	binary.LittleEndian.PutUint64(b, 1500000000)
+	b[8], b[9] = metricType, valueType
+	binary.LittleEndian.PutUint16(b[10:], uint16(len(key)+1))
+	binary.LittleEndian.PutUint64(b[12:], math.Float64bits(value))
+	b = append(b, key...)
+	return append(b, 0)
+}
+
+func TestReadStatsiteRecord(t *testing.T) {
+	var stream []byte
+	for _, r := range [][]byte{
+		statsiteRecord(statsiteKeyValue, statsiteRaw, "kv", 1),
+		statsiteRecord(statsiteGauge, statsiteRaw, "gauge", 2),
+		statsiteRecord(statsiteCounter, statsiteSum, "counter", 3),
+		statsiteRecord(statsiteCounter, statsiteMean, "counter", 1.5),
+		statsiteRecord(statsiteSet, statsiteSum, "set", 4),
+		statsiteRecord(statsiteTimer, statsiteMean, "timer", 5),
+		statsiteRecord(statsiteTimer, statsitePercentile|99, "timer", 6),
+		statsiteRecord(statsiteTimer, 0x9, "timer", 7),
+	} {
+		stream = append(stream, r...)
+	}
+
+	want := event.Events{
+		event.NewGaugeEvent("kv", 1, false, nil),
+		event.NewGaugeEvent("gauge", 2, false, nil),
+		event.NewCounterEvent("counter", 3, nil),
+		event.NewGaugeEvent("set", 4, false, nil),
+		event.NewGaugeEvent("timer.mean", 5, false, nil),
+		event.NewGaugeEvent("timer.p99", 6, false, nil),
+	}
+	r := bufio.NewReader(bytes.NewReader(stream))
+	got := event.Events{}
+	for {
+		events, err := ReadStatsiteRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, events...)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+}
+
+func TestReadStatsiteRecordErrors(t *testing.T) {
+	record := statsiteRecord(statsiteGauge, statsiteRaw, "gauge", 1)
+	unterminated := append([]byte{}, record...)
+	unterminated[len(unterminated)-1] = 'x'
+	for name, stream := range map[string][]byte{
+		"truncated header": record[:10],
+		"truncated key":    record[:len(record)-2],
+		"unterminated key": unterminated,
+	} {
+		if _, err := ReadStatsiteRecord(bufio.NewReader(bytes.NewReader(stream))); err == nil || err == io.EOF {
+			t.Errorf("%s: expected an error, got %v", name, err)
+		}
+	}
+}
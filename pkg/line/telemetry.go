@@ -0,0 +1,103 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package line
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	samplesReceived = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_samples_total",
+			Help: "The total number of StatsD samples received.",
+		},
+	)
+	sampleErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_sample_errors_total",
+			Help: "The total number of errors parsing StatsD samples.",
+		},
+		[]string{"reason"},
+	)
+	tagsReceived = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tags_total",
+			Help: "The total number of DogStatsD tags processed.",
+		},
+	)
+	tagErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tag_errors_total",
+			Help: "The number of errors parsign DogStatsD tags.",
+		},
+	)
+	tagsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tags_dropped_total",
+			Help: "The number of tags dropped for exceeding the limit of tags per event.",
+		},
+	)
+	tagSectionsMerged = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tag_sections_merged_total",
+			Help: "The number of additional DogStatsD tag sections merged into the tags of a sample.",
+		},
+	)
+	tagConflicts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tag_conflicts_total",
+			Help: "The number of tags overriding a tag of the same name from an earlier tag section of a sample.",
+		},
+	)
+	deadLetterLines = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_dead_letter_lines_total",
+			Help: "The total number of lines that could not be parsed written to the dead letter output.",
+		},
+	)
+	deadLetterErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_dead_letter_errors_total",
+			Help: "The total number of errors writing lines to the dead letter output.",
+		},
+	)
+	statsiteSkipped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_statsite_records_skipped_total",
+			Help: "The number of statsite records skipped because their type or aggregate is not supported.",
+		},
+	)
+	linesDetected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_lines_detected_total",
+			Help: "The total number of lines by detected format, when format detection is enabled.",
+		},
+		[]string{"format"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(samplesReceived)
+	prometheus.MustRegister(sampleErrors)
+	prometheus.MustRegister(tagsReceived)
+	prometheus.MustRegister(tagErrors)
+	prometheus.MustRegister(tagsDropped)
+	prometheus.MustRegister(tagSectionsMerged)
+	prometheus.MustRegister(tagConflicts)
+	prometheus.MustRegister(linesDetected)
+	prometheus.MustRegister(deadLetterLines)
+	prometheus.MustRegister(deadLetterErrors)
+	prometheus.MustRegister(statsiteSkipped)
+}
@@ -0,0 +1,228 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// Part types of the collectd network protocol.
+const (
+	collectdHost           = 0x0000
+	collectdPlugin         = 0x0002
+	collectdPluginInstance = 0x0003
+	collectdType           = 0x0004
+	collectdTypeInstance   = 0x0005
+	collectdValues         = 0x0006
+	collectdEncryption     = 0x0210
+)
+
+// Data source types of collectd values.
+const (
+	collectdCounter  = 0
+	collectdGauge    = 1
+	collectdDerive   = 2
+	collectdAbsolute = 3
+)
+
+// CollectdListener receives the binary network protocol of collectd over
+// UDP, as sent by its network plugin. Values are named
+// collectd.<plugin>.<type>.<data source>, leaving out the type if it equals
+// the plugin and data sources named "value", and labeled with the host,
+// plugin_instance and type_instance if set. Gauges set gauges, absolute
+// values increment counters, and counters and derives increment counters by
+// their growth since the previous value.
+type CollectdListener struct {
+	Conn *net.UDPConn
+	// TypesDB maps collectd types to the names of their data sources, as
+	// read by ParseCollectdTypesDB. Without it, the data sources of types
+	// with several values are named by their index.
+	TypesDB map[string][]string
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+
+	counters cumulativeCounters
+}
+
+// Listen reads packets from the connection. It never returns.
+func (l *CollectdListener) Listen(e chan<- event.Events) {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := l.Conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		l.HandlePacket(buf[0:n], e)
+	}
+}
+
+// HandlePacket parses the values in packet and sends the resulting events to
+// e. The values preceding a malformed part are still sent.
+func (l *CollectdListener) HandlePacket(packet []byte, e chan<- event.Events) {
+	countPacket("collectd", packet)
+	events, err := l.packetToEvents(packet)
+	if err != nil {
+		collectdErrors.Inc()
+		log.Debugf("Bad collectd packet: %v", err)
+	}
+	if len(events) > 0 {
+		e <- AddListenerLabel(events, l.ListenerLabel)
+	}
+}
+
+func (l *CollectdListener) packetToEvents(packet []byte) (event.Events, error) {
+	events := event.Events{}
+	var host, plugin, pluginInstance, typ, typeInstance string
+	for len(packet) > 0 {
+		if len(packet) < 4 {
+			return events, fmt.Errorf("truncated part header")
+		}
+		partType := binary.BigEndian.Uint16(packet)
+		partLength := int(binary.BigEndian.Uint16(packet[2:]))
+		if partLength < 4 || partLength > len(packet) {
+			return events, fmt.Errorf("bad length %d of part type %#x", partLength, partType)
+		}
+		payload := packet[4:partLength]
+		packet = packet[partLength:]
+
+		var s *string
+		switch partType {
+		case collectdHost:
+			s = &host
+		case collectdPlugin:
+			s = &plugin
+		case collectdPluginInstance:
+			s = &pluginInstance
+		case collectdType:
+			s = &typ
+		case collectdTypeInstance:
+			s = &typeInstance
+		case collectdValues:
+			values, err := l.valuesToEvents(payload, host, plugin, pluginInstance, typ, typeInstance)
+			if err != nil {
+				return events, err
+			}
+			events = append(events, values...)
+			continue
+		case collectdEncryption:
+			return events, fmt.Errorf("encrypted packets are not supported")
+		default:
+			// Times, intervals, signatures and notifications.
+			continue
+		}
+		if len(payload) == 0 || payload[len(payload)-1] != 0 {
+			return events, fmt.Errorf("string of part type %#x is not NUL terminated", partType)
+		}
+		*s = string(payload[:len(payload)-1])
+	}
+	return events, nil
+}
+
+func (l *CollectdListener) valuesToEvents(payload []byte, host, plugin, pluginInstance, typ, typeInstance string) (event.Events, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("truncated values part")
+	}
+	count := int(binary.BigEndian.Uint16(payload))
+	if len(payload) != 2+9*count {
+		return nil, fmt.Errorf("values part of %d bytes cannot hold %d values", len(payload), count)
+	}
+	types, values := payload[2:2+count], payload[2+count:]
+	dsNames := l.TypesDB[typ]
+
+	events := make(event.Events, 0, count)
+	for i := 0; i < count; i++ {
+		dsName := "value"
+		if len(dsNames) == count {
+			dsName = dsNames[i]
+		} else if count > 1 {
+			dsName = strconv.Itoa(i)
+		}
+		components := []string{"collectd", plugin}
+		if typ != plugin {
+			components = append(components, typ)
+		}
+		if dsName != "value" {
+			components = append(components, dsName)
+		}
+		name := strings.Join(components, ".")
+
+		labels := map[string]string{}
+		for label, value := range map[string]string{"host": host, "plugin_instance": pluginInstance, "type_instance": typeInstance} {
+			if value != "" {
+				labels[label] = value
+			}
+		}
+
+		raw := values[8*i : 8*i+8]
+		switch types[i] {
+		case collectdGauge:
+			// Unlike all other numbers, gauges are little endian.
+			value := math.Float64frombits(binary.LittleEndian.Uint64(raw))
+			events = append(events, event.NewGaugeEvent(name, value, false, labels))
+		case collectdAbsolute:
+			events = append(events, event.NewCounterEvent(name, float64(binary.BigEndian.Uint64(raw)), labels))
+		case collectdCounter:
+			value := float64(binary.BigEndian.Uint64(raw))
+			events = append(events, event.NewCounterEvent(name, l.counters.increment(name, labels, value), labels))
+		case collectdDerive:
+			value := float64(int64(binary.BigEndian.Uint64(raw)))
+			events = append(events, event.NewCounterEvent(name, l.counters.increment(name, labels, value), labels))
+		default:
+			return events, fmt.Errorf("unknown data source type %d", types[i])
+		}
+	}
+	return events, nil
+}
+
+// ParseCollectdTypesDB reads the names of the data sources of every type from
+// a collectd types.db file.
+func ParseCollectdTypesDB(r io.Reader) (map[string][]string, error) {
+	types := map[string][]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("type %q without data sources", fields[0])
+		}
+		var dsNames []string
+		for _, ds := range strings.Split(strings.Join(fields[1:], ""), ",") {
+			if ds == "" {
+				continue
+			}
+			spec := strings.Split(ds, ":")
+			if len(spec) != 4 {
+				return nil, fmt.Errorf("bad data source %q of type %q", ds, fields[0])
+			}
+			dsNames = append(dsNames, spec[0])
+		}
+		types[fields[0]] = dsNames
+	}
+	return types, scanner.Err()
+}
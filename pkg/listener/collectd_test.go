@@ -0,0 +1,125 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func collectdString(partType uint16, s string) []byte {
+	b := make([]byte, 4, 4+len(s)+1)
+	binary.BigEndian.PutUint16(b, partType)
+	binary.BigEndian.PutUint16(b[2:], uint16(4+len(s)+1))
+	b = append(b, s...)
+	return append(b, 0)
+}
+
+func collectdValuesPart(types []byte, values []uint64) []byte {
+	b := make([]byte, 6, 6+9*len(types))
+	binary.BigEndian.PutUint16(b, collectdValues)
+	binary.BigEndian.PutUint16(b[2:], uint16(6+9*len(types)))
+	binary.BigEndian.PutUint16(b[4:], uint16(len(types)))
+	b = append(b, types...)
+	for i, v := range values {
+		raw := make([]byte, 8)
+		if types[i] == collectdGauge {
+			binary.LittleEndian.PutUint64(raw, v)
+		} else {
+			binary.BigEndian.PutUint64(raw, v)
+		}
+		b = append(b, raw...)
+	}
+	return b
+}
+
+func TestCollectdListener(t *testing.T) {
+	typesDB, err := ParseCollectdTypesDB(strings.NewReader(`
+# comment
+load      shortterm:GAUGE:0:5000, midterm:GAUGE:0:5000, longterm:GAUGE:0:5000
+if_octets rx:DERIVE:0:U, tx:DERIVE:0:U
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &CollectdListener{TypesDB: typesDB, ListenerLabel: "collectd"}
+
+	var packet []byte
+	for _, part := range [][]byte{
+		collectdString(collectdHost, "web1"),
+		collectdString(collectdPlugin, "load"),
+		collectdString(collectdType, "load"),
+		collectdValuesPart([]byte{collectdGauge, collectdGauge, collectdGauge}, []uint64{math.Float64bits(0.5), math.Float64bits(1), math.Float64bits(1.5)}),
+		collectdString(collectdPlugin, "interface"),
+		collectdString(collectdPluginInstance, "eth0"),
+		collectdString(collectdType, "if_octets"),
+		collectdValuesPart([]byte{collectdDerive, collectdDerive}, []uint64{100, 200}),
+		collectdString(collectdPlugin, "memory"),
+		collectdString(collectdPluginInstance, ""),
+		collectdString(collectdType, "memory"),
+		collectdString(collectdTypeInstance, "free"),
+		collectdValuesPart([]byte{collectdGauge}, []uint64{math.Float64bits(42)}),
+	} {
+		packet = append(packet, part...)
+	}
+
+	events := make(chan event.Events, 2)
+	l.HandlePacket(packet, events)
+	// Derives grow by 50 and 20.
+	l.HandlePacket(append(append(append(append(collectdString(collectdHost, "web1"),
+		collectdString(collectdPlugin, "interface")...),
+		collectdString(collectdPluginInstance, "eth0")...),
+		collectdString(collectdType, "if_octets")...),
+		collectdValuesPart([]byte{collectdDerive, collectdDerive}, []uint64{150, 220})...), events)
+	close(events)
+
+	eth0 := map[string]string{"host": "web1", "plugin_instance": "eth0", ListenerLabelName: "collectd"}
+	want := event.Events{
+		event.NewGaugeEvent("collectd.load.shortterm", 0.5, false, map[string]string{"host": "web1", ListenerLabelName: "collectd"}),
+		event.NewGaugeEvent("collectd.load.midterm", 1, false, map[string]string{"host": "web1", ListenerLabelName: "collectd"}),
+		event.NewGaugeEvent("collectd.load.longterm", 1.5, false, map[string]string{"host": "web1", ListenerLabelName: "collectd"}),
+		event.NewCounterEvent("collectd.interface.if_octets.rx", 100, eth0),
+		event.NewCounterEvent("collectd.interface.if_octets.tx", 200, eth0),
+		event.NewGaugeEvent("collectd.memory", 42, false, map[string]string{"host": "web1", "type_instance": "free", ListenerLabelName: "collectd"}),
+		event.NewCounterEvent("collectd.interface.if_octets.rx", 50, eth0),
+		event.NewCounterEvent("collectd.interface.if_octets.tx", 20, eth0),
+	}
+	got := event.Events{}
+	for batch := range events {
+		got = append(got, batch...)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+}
+
+func TestCollectdListenerBadPacket(t *testing.T) {
+	l := &CollectdListener{}
+	for name, packet := range map[string][]byte{
+		"truncated header": {0, 2},
+		"bad length":       {0, 2, 0, 200, 'x', 0},
+		"unterminated":     {0, 2, 0, 5, 'x'},
+		"encrypted":        {0x02, 0x10, 0, 4},
+		"bad values":       {0, 6, 0, 7, 0, 1, 1},
+	} {
+		if _, err := l.packetToEvents(packet); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
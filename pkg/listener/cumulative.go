@@ -0,0 +1,50 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"sync"
+
+	"github.com/prometheus/common/model"
+)
+
+// cumulativeCounters turns the values of cumulative counters, which only
+// grow until they are reset, into increments.
+type cumulativeCounters struct {
+	mtx  sync.Mutex
+	last map[uint64]float64
+}
+
+// increment returns the growth of the series since its previous value, or
+// value if it is the first one. A value lower than the previous one counts as
+// a reset.
+func (c *cumulativeCounters) increment(name string, labels map[string]string, value float64) float64 {
+	series := map[string]string{model.MetricNameLabel: name}
+	for k, v := range labels {
+		series[k] = v
+	}
+	hash := model.LabelsToSignature(series)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.last == nil {
+		c.last = map[uint64]float64{}
+	}
+	last, ok := c.last[hash]
+	c.last[hash] = value
+	if ok && value >= last {
+		return value - last
+	}
+	return value
+}
@@ -0,0 +1,239 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package listener receives StatsD lines over the network and passes the
+// parsed events on.
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+// ListenerLabelName is the label that identifies the receiving listener.
+const ListenerLabelName = "listener"
+
+// SourceLabeler adds labels to events based on the address they were
+// received from.
+type SourceLabeler interface {
+	LabelEvents(events event.Events, src net.IP) event.Events
+}
+
+// AddListenerLabel sets the listener label on all given events, overriding
+// any tag of the same name sent by the client.
+func AddListenerLabel(events event.Events, listener string) event.Events {
+	if listener == "" {
+		return events
+	}
+	for _, e := range events {
+		e.Labels()[ListenerLabelName] = listener
+	}
+	return events
+}
+
+// labelSource applies labeler to events if it is set.
+func labelSource(labeler SourceLabeler, events event.Events, src net.IP) event.Events {
+	if labeler == nil {
+		return events
+	}
+	return labeler.LabelEvents(events, src)
+}
+
+// parserOrDefault returns p, or the StatsD parser if p is nil.
+func parserOrDefault(p line.Parser) line.Parser {
+	if p == nil {
+		return line.ParserFunc(line.LineToEvents)
+	}
+	return p
+}
+
+// parsePacket parses every line of a packet or message received by the given
+// listener with parser. Lines may end in "\r\n".
+func parsePacket(listener string, parser line.Parser, packet []byte) event.Events {
+	events := event.Events{}
+	for _, rawLine := range strings.Split(string(packet), "\n") {
+		countLine(listener)
+		events = append(events, parser.LineToEvents(strings.TrimSuffix(rawLine, "\r"))...)
+	}
+	return events
+}
+
+type StatsDUDPListener struct {
+	Conn *net.UDPConn
+	// ReaderThreads is the number of goroutines reading from Conn
+	// concurrently. Values below 1 mean a single reader.
+	ReaderThreads int
+	// Parser turns received lines into events. Defaults to the StatsD
+	// format.
+	Parser line.Parser
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+	// SourceLabeler, if set, adds labels describing the sender of an
+	// event.
+	SourceLabeler SourceLabeler
+	// MaxLineLength limits the length of lines in bytes. Longer lines are
+	// dropped, or truncated to the limit if TruncateLongLines is set. 0
+	// disables the limit.
+	MaxLineLength     int
+	TruncateLongLines bool
+}
+
+// Listen reads packets from the connection with ReaderThreads goroutines.
+// It never returns.
+func (l *StatsDUDPListener) Listen(e chan<- event.Events) {
+	threads := l.ReaderThreads
+	if threads < 1 {
+		threads = 1
+	}
+	udpReaders.Add(float64(threads))
+	for i := 1; i < threads; i++ {
+		go l.read(e)
+	}
+	l.read(e)
+}
+
+func (l *StatsDUDPListener) read(e chan<- event.Events) {
+	defer udpReaders.Dec()
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := l.Conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		l.HandlePacket(buf[0:n], addr.IP, e)
+	}
+}
+
+// HandlePacket parses all lines in packet and sends the resulting events to
+// e.
+func (l *StatsDUDPListener) HandlePacket(packet []byte, src net.IP, e chan<- event.Events) {
+	udpPackets.Inc()
+	countPacket("udp", packet)
+	packet = limitLineLength(packet, l.MaxLineLength, l.TruncateLongLines)
+	events := parsePacket("udp", parserOrDefault(l.Parser), packet)
+	events = labelSource(l.SourceLabeler, events, src)
+	e <- AddListenerLabel(events, l.ListenerLabel)
+}
+
+// limitLineLength drops the lines of packet longer than max bytes, or
+// truncates them to max bytes if truncate is set.
+func limitLineLength(packet []byte, max int, truncate bool) []byte {
+	if max <= 0 || len(packet) <= max {
+		return packet
+	}
+	lines := bytes.Split(packet, []byte("\n"))
+	kept := lines[:0]
+	for _, l := range lines {
+		if len(l) > max {
+			if !truncate {
+				udpLineTooLong.WithLabelValues("dropped").Inc()
+				continue
+			}
+			udpLineTooLong.WithLabelValues("truncated").Inc()
+			l = l[:max]
+		}
+		kept = append(kept, l)
+	}
+	return bytes.Join(kept, []byte("\n"))
+}
+
+type StatsDTCPListener struct {
+	Conn *net.TCPListener
+	// Delimiter separates the records sent over a connection. 0 means
+	// '\n'. A carriage return preceding the delimiter is dropped.
+	Delimiter byte
+	// Parser turns received lines into events. Defaults to the StatsD
+	// format.
+	Parser line.Parser
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+	// SourceLabeler, if set, adds labels describing the sender of an
+	// event.
+	SourceLabeler SourceLabeler
+}
+
+func (l *StatsDTCPListener) Listen(e chan<- event.Events) {
+	for {
+		c, err := l.Conn.AcceptTCP()
+		if err != nil {
+			log.Fatalf("AcceptTCP failed: %v", err)
+		}
+		go l.HandleConn(c, e)
+	}
+}
+
+// HandleConn reads lines from c until it is closed and sends the resulting
+// events to e.
+func (l *StatsDTCPListener) HandleConn(c *net.TCPConn, e chan<- event.Events) {
+	defer c.Close()
+
+	tcpConnections.Inc()
+	listenerConnections.WithLabelValues("tcp").Inc()
+
+	src := c.RemoteAddr().(*net.TCPAddr).IP
+	parser := parserOrDefault(l.Parser)
+	delimiter := l.Delimiter
+	if delimiter == 0 {
+		delimiter = '\n'
+	}
+	r := bufio.NewReader(c)
+	for {
+		rawLine, isPrefix, err := readRecord(r, delimiter)
+		if err != nil {
+			if err != io.EOF {
+				tcpErrors.Inc()
+				log.Debugf("Read %s failed: %v", c.RemoteAddr(), err)
+			}
+			break
+		}
+		if isPrefix {
+			tcpLineTooLong.Inc()
+			log.Debugf("Read %s failed: line too long", c.RemoteAddr())
+			break
+		}
+		listenerBytes.WithLabelValues("tcp").Add(float64(len(rawLine) + 1))
+		countLine("tcp")
+		events := labelSource(l.SourceLabeler, parser.LineToEvents(string(rawLine)), src)
+		e <- AddListenerLabel(events, l.ListenerLabel)
+	}
+}
+
+// readRecord returns the next record from r without the delimiter and a
+// carriage return preceding it. Like bufio.Reader.ReadLine, it reports
+// records exceeding the buffer of r as prefix, and returns a last record
+// lacking the delimiter without error.
+func readRecord(r *bufio.Reader, delimiter byte) ([]byte, bool, error) {
+	record, err := r.ReadSlice(delimiter)
+	switch {
+	case err == bufio.ErrBufferFull:
+		return record, true, nil
+	case err == io.EOF && len(record) > 0:
+		// The last record lacks the delimiter.
+	case err != nil:
+		return nil, false, err
+	default:
+		record = record[:len(record)-1]
+	}
+	return bytes.TrimSuffix(record, []byte{'\r'}), false, nil
+}
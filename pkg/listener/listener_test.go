@@ -0,0 +1,135 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func counterValue(t *testing.T, vec *prometheus.CounterVec, listener string) float64 {
+	var m dto.Metric
+	if err := vec.WithLabelValues(listener).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestListenerThroughput(t *testing.T) {
+	udpBytes := counterValue(t, listenerBytes, "udp")
+	udpPackets := counterValue(t, listenerPackets, "udp")
+	udpLines := counterValue(t, listenerLines, "udp")
+	stdinBytes := counterValue(t, listenerBytes, "stdin")
+	stdinLines := counterValue(t, listenerLines, "stdin")
+
+	events := make(chan event.Events, 10)
+	ul := &StatsDUDPListener{}
+	ul.HandlePacket([]byte("foo:1|c\nbar:2|g"), net.IPv4(127, 0, 0, 1), events)
+	rl := &ReaderListener{Reader: strings.NewReader("foo:1|c\nbar:2|g\n")}
+	if err := rl.Listen(events); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		vec      *prometheus.CounterVec
+		listener string
+		before   float64
+		want     float64
+	}{
+		{vec: listenerBytes, listener: "udp", before: udpBytes, want: 15},
+		{vec: listenerPackets, listener: "udp", before: udpPackets, want: 1},
+		{vec: listenerLines, listener: "udp", before: udpLines, want: 2},
+		{vec: listenerBytes, listener: "stdin", before: stdinBytes, want: 16},
+		{vec: listenerLines, listener: "stdin", before: stdinLines, want: 2},
+	}
+	for i, s := range scenarios {
+		if got := counterValue(t, s.vec, s.listener) - s.before; got != s.want {
+			t.Errorf("%d. Expected an increase by %v for listener %s, got %v", i, s.want, s.listener, got)
+		}
+	}
+}
+
+func TestCRLFAndDelimiters(t *testing.T) {
+	events := make(chan event.Events, 10)
+	ul := &StatsDUDPListener{}
+	ul.HandlePacket([]byte("foo:1|c\r\nbar:2|g\r\n"), net.IPv4(127, 0, 0, 1), events)
+	if got := <-events; len(got) != 2 || got[0].MetricName() != "foo" || got[1].MetricName() != "bar" {
+		t.Errorf("Expected the CRLF terminated lines to be parsed, got %v", got)
+	}
+
+	for _, delimiter := range []byte{0, ';'} {
+		l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := "foo:1|c\r\nbar:2|g"
+		if delimiter != 0 {
+			payload = "foo:1|c;bar:2|g\r;"
+		}
+		go func() {
+			c, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c.Write([]byte(payload))
+			c.Close()
+		}()
+		c, err := l.AcceptTCP()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tl := &StatsDTCPListener{Delimiter: delimiter}
+		tl.HandleConn(c, events)
+		l.Close()
+
+		for _, want := range []string{"foo", "bar"} {
+			if got := <-events; len(got) != 1 || got[0].MetricName() != want {
+				t.Errorf("Expected event %s with delimiter %q, got %v", want, delimiter, got)
+			}
+		}
+	}
+}
+
+func TestUDPMaxLineLength(t *testing.T) {
+	dropped := counterValue(t, udpLineTooLong, "dropped")
+	truncated := counterValue(t, udpLineTooLong, "truncated")
+
+	events := make(chan event.Events, 10)
+	packet := []byte("foo:1|c\nlong_metric_name:2|c|#tag:value\nbar:3|c")
+	ul := &StatsDUDPListener{MaxLineLength: 10}
+	ul.HandlePacket(packet, net.IPv4(127, 0, 0, 1), events)
+	if got := <-events; len(got) != 2 || got[0].MetricName() != "foo" || got[1].MetricName() != "bar" {
+		t.Errorf("Expected the long line to be dropped, got %v", got)
+	}
+
+	ul = &StatsDUDPListener{MaxLineLength: 20, TruncateLongLines: true}
+	ul.HandlePacket(packet, net.IPv4(127, 0, 0, 1), events)
+	if got := <-events; len(got) != 3 || got[1].MetricName() != "long_metric_name" {
+		t.Errorf("Expected the long line to be truncated, got %v", got)
+	}
+
+	if got := counterValue(t, udpLineTooLong, "dropped") - dropped; got != 1 {
+		t.Errorf("Expected 1 dropped line, got %v", got)
+	}
+	if got := counterValue(t, udpLineTooLong, "truncated") - truncated; got != 1 {
+		t.Errorf("Expected 1 truncated line, got %v", got)
+	}
+}
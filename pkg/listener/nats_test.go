@@ -0,0 +1,91 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestNATSListener(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		fmt.Fprint(c, "INFO {\"server_id\":\"test\"}\r\n")
+		r := bufio.NewReader(c)
+		var ops []string
+		for len(ops) < 3 {
+			op, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			ops = append(ops, strings.TrimSpace(op))
+		}
+		received <- strings.Join(ops, "\n")
+		payload := "foo:1|c\nbar:2|g"
+		fmt.Fprintf(c, "PONG\r\nPING\r\nMSG statsd 1 %d\r\n%s\r\n", len(payload), payload)
+		// Wait for the PONG before closing.
+		r.ReadString('\n')
+	}()
+
+	events := make(chan event.Events, 1)
+	l := &NATSListener{
+		URL:           "nats://secret@" + ln.Addr().String(),
+		Subject:       "statsd",
+		QueueGroup:    "exporters",
+		ListenerLabel: "nats",
+	}
+	go l.Listen(events)
+
+	select {
+	case ops := <-received:
+		want := "CONNECT {\"auth_token\":\"secret\",\"name\":\"statsd_exporter\",\"pedantic\":false,\"verbose\":false}\nSUB statsd exporters 1\nPING"
+		if ops != want {
+			t.Errorf("expected client to send\n%s\ngot\n%s", want, ops)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for subscription")
+	}
+
+	select {
+	case actual := <-events:
+		if len(actual) != 2 {
+			t.Fatalf("expected 2 events, got %d", len(actual))
+		}
+		if actual[0].MetricName() != "foo" || actual[1].MetricName() != "bar" {
+			t.Errorf("unexpected events %v", actual)
+		}
+		if got := actual[0].Labels()[ListenerLabelName]; got != "nats" {
+			t.Errorf("expected listener label nats, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for events")
+	}
+}
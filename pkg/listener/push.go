@@ -0,0 +1,103 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// pushMaxBytes limits the size of a pushed payload.
+const pushMaxBytes = 16 << 20
+
+// PushHandler accepts metrics in the Prometheus text format, POSTed by
+// short-lived jobs, and passes them on as events. The exporter maps and
+// expires them like StatsD events, so their series disappear after the TTL
+// of their mapping.
+//
+// Gauges and untyped metrics set gauges. Counters are cumulative: they
+// increment counters by their growth since the previous push of the series,
+// a lower value counting as a reset. Summaries and histograms are skipped.
+type PushHandler struct {
+	// Events receives the events of every push.
+	Events chan<- event.Events
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+
+	counters cumulativeCounters
+}
+
+func (h *PushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "Only POST and PUT are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, pushMaxBytes+1))
+	if err != nil {
+		pushErrors.Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > pushMaxBytes {
+		pushErrors.Inc()
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	countPacket("push", body)
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	if err != nil {
+		pushErrors.Inc()
+		log.Debugf("Bad push payload: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.Events <- AddListenerLabel(h.familiesToEvents(families), h.ListenerLabel)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *PushHandler) familiesToEvents(families map[string]*dto.MetricFamily) event.Events {
+	events := event.Events{}
+	for name, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				events = append(events, event.NewGaugeEvent(name, m.GetGauge().GetValue(), false, labels))
+			case dto.MetricType_UNTYPED:
+				events = append(events, event.NewGaugeEvent(name, m.GetUntyped().GetValue(), false, labels))
+			case dto.MetricType_COUNTER:
+				increment := h.counters.increment(name, labels, m.GetCounter().GetValue())
+				events = append(events, event.NewCounterEvent(name, increment, labels))
+			default:
+				pushSkipped.Inc()
+			}
+		}
+	}
+	return events
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestPushHandler(t *testing.T) {
+	events := make(chan event.Events, 10)
+	h := &PushHandler{Events: events, ListenerLabel: "push"}
+
+	push := func(body string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/push", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	payload := `# TYPE job_last_success_seconds gauge
+job_last_success_seconds{job="backup"} 1.5e9
+# TYPE job_records_total counter
+job_records_total{job="backup"} 10
+# TYPE job_duration_seconds summary
+job_duration_seconds_sum{job="backup"} 3
+job_duration_seconds_count{job="backup"} 1
+untyped_metric 3
+`
+	if code := push(payload); code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, code)
+	}
+	// The counter grows by 5, then is reset.
+	push("# TYPE job_records_total counter\njob_records_total{job=\"backup\"} 15\n")
+	push("# TYPE job_records_total counter\njob_records_total{job=\"backup\"} 2\n")
+	if code := push("not a metric {"); code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a bad payload, got %d", http.StatusBadRequest, code)
+	}
+	close(events)
+
+	got := map[string][]float64{}
+	for batch := range events {
+		for _, e := range batch {
+			got[e.MetricName()] = append(got[e.MetricName()], e.Value())
+			if l := e.Labels()[ListenerLabelName]; l != "push" {
+				t.Errorf("expected listener label push, got %q", l)
+			}
+		}
+	}
+	want := map[string][]float64{
+		"job_last_success_seconds": {1.5e9},
+		"job_records_total":        {10, 5, 2},
+		"untyped_metric":           {3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events %v, got %v", want, got)
+	}
+}
+
+func TestPushHandlerMethod(t *testing.T) {
+	h := &PushHandler{Events: make(chan event.Events, 1)}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/push", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
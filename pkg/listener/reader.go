@@ -0,0 +1,50 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+// maxReaderLineLength bounds the length of lines read from a ReaderListener.
+const maxReaderLineLength = 1024 * 1024
+
+// ReaderListener reads lines from an io.Reader, e.g. standard input.
+type ReaderListener struct {
+	Reader io.Reader
+	// Parser turns received lines into events. Defaults to the StatsD
+	// format.
+	Parser line.Parser
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+}
+
+// Listen reads lines until the end of the reader. It returns nil at the end
+// of the input, and the error otherwise.
+func (l *ReaderListener) Listen(e chan<- event.Events) error {
+	parser := parserOrDefault(l.Parser)
+	scanner := bufio.NewScanner(l.Reader)
+	scanner.Buffer(make([]byte, 64*1024), maxReaderLineLength)
+	for scanner.Scan() {
+		listenerBytes.WithLabelValues("stdin").Add(float64(len(scanner.Bytes()) + 1))
+		countLine("stdin")
+		e <- AddListenerLabel(parser.LineToEvents(scanner.Text()), l.ListenerLabel)
+	}
+	return scanner.Err()
+}
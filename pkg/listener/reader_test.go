@@ -0,0 +1,46 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestReaderListener(t *testing.T) {
+	events := make(chan event.Events, 10)
+	l := &ReaderListener{
+		Reader:        strings.NewReader("foo:1|c\r\n\nbar:2|g\nbaz:3|ms"),
+		ListenerLabel: "stdin",
+	}
+	if err := l.Listen(events); err != nil {
+		t.Fatal(err)
+	}
+	close(events)
+
+	var names []string
+	for batch := range events {
+		for _, e := range batch {
+			names = append(names, e.MetricName())
+			if got := e.Labels()[ListenerLabelName]; got != "stdin" {
+				t.Errorf("expected listener label stdin, got %q", got)
+			}
+		}
+	}
+	if got, want := strings.Join(names, ","), "foo,bar,baz"; got != want {
+		t.Errorf("expected events %s, got %s", want, got)
+	}
+}
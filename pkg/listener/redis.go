@@ -0,0 +1,279 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+const (
+	redisDefaultPort = "6379"
+	// redisBlockMillis is how long a single XREAD blocks for new entries.
+	redisBlockMillis = 5000
+	redisBatchSize   = 100
+)
+
+// RedisListener receives lines from a Redis pub/sub channel or a Redis
+// stream. It speaks the Redis protocol directly.
+type RedisListener struct {
+	// URL of the Redis server, e.g. "redis://:password@host:6379/0".
+	URL string
+	// Channel to subscribe to. Every message is a batch of lines.
+	Channel string
+	// Stream to read new entries from, if Channel is empty. The value of
+	// StreamField of every entry is a batch of lines.
+	Stream      string
+	StreamField string
+	// Parser turns received lines into events. Defaults to the StatsD
+	// format.
+	Parser line.Parser
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+	// ReconnectWait is the time to wait before reconnecting after an
+	// error. Defaults to one second.
+	ReconnectWait time.Duration
+
+	// lastID is the ID of the last stream entry read, so that reading
+	// continues where it left off after reconnecting.
+	lastID string
+}
+
+// Listen consumes messages, reconnecting on errors. It never returns.
+func (l *RedisListener) Listen(e chan<- event.Events) {
+	wait := l.ReconnectWait
+	if wait == 0 {
+		wait = time.Second
+	}
+	for {
+		err := l.consume(e)
+		redisErrors.Inc()
+		log.Errorf("Reading from Redis failed, reconnecting: %v", err)
+		time.Sleep(wait)
+	}
+}
+
+func (l *RedisListener) consume(e chan<- event.Events) error {
+	conn, r, err := l.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if l.Channel != "" {
+		return l.subscribe(conn, r, e)
+	}
+	return l.readStream(conn, r, e)
+}
+
+// dial connects and authenticates to the server and selects the database
+// given in the URL.
+func (l *RedisListener) dial() (net.Conn, *bufio.Reader, error) {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), redisDefaultPort)
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+
+	var commands [][]string
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			if u.User.Username() != "" {
+				commands = append(commands, []string{"AUTH", u.User.Username(), password})
+			} else {
+				commands = append(commands, []string{"AUTH", password})
+			}
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		commands = append(commands, []string{"SELECT", db})
+	}
+	for _, command := range commands {
+		if _, err := redisCommand(conn, r, command...); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("%s failed: %v", command[0], err)
+		}
+	}
+	return conn, r, nil
+}
+
+func (l *RedisListener) subscribe(conn net.Conn, r *bufio.Reader, e chan<- event.Events) error {
+	if err := writeRedisCommand(conn, "SUBSCRIBE", l.Channel); err != nil {
+		return err
+	}
+	parser := parserOrDefault(l.Parser)
+	for {
+		reply, err := readRedisReply(r)
+		if err != nil {
+			return err
+		}
+		// Messages are ["message", channel, payload].
+		msg, ok := reply.([]interface{})
+		if !ok || len(msg) != 3 {
+			return fmt.Errorf("unexpected reply %v", reply)
+		}
+		if kind, _ := msg[0].([]byte); string(kind) != "message" {
+			continue
+		}
+		payload, _ := msg[2].([]byte)
+		redisMessages.Inc()
+		countPacket("redis", payload)
+		e <- AddListenerLabel(parsePacket("redis", parser, payload), l.ListenerLabel)
+	}
+}
+
+func (l *RedisListener) readStream(conn net.Conn, r *bufio.Reader, e chan<- event.Events) error {
+	if l.lastID == "" {
+		// Only read entries added from now on.
+		l.lastID = "$"
+	}
+	parser := parserOrDefault(l.Parser)
+	for {
+		reply, err := redisCommand(conn, r, "XREAD", "COUNT", strconv.Itoa(redisBatchSize),
+			"BLOCK", strconv.Itoa(redisBlockMillis), "STREAMS", l.Stream, l.lastID)
+		if err != nil {
+			return err
+		}
+		if reply == nil {
+			// Timed out without new entries.
+			continue
+		}
+		// Replies are [[stream, [[id, [field, value, ...]], ...]]].
+		streams, ok := reply.([]interface{})
+		if !ok || len(streams) != 1 {
+			return fmt.Errorf("unexpected reply %v", reply)
+		}
+		stream, ok := streams[0].([]interface{})
+		if !ok || len(stream) != 2 {
+			return fmt.Errorf("unexpected reply %v", reply)
+		}
+		entries, _ := stream[1].([]interface{})
+		for _, entry := range entries {
+			fields, ok := entry.([]interface{})
+			if !ok || len(fields) != 2 {
+				return fmt.Errorf("unexpected stream entry %v", entry)
+			}
+			id, _ := fields[0].([]byte)
+			l.lastID = string(id)
+			values, _ := fields[1].([]interface{})
+			for i := 0; i+1 < len(values); i += 2 {
+				if field, _ := values[i].([]byte); string(field) == l.StreamField {
+					payload, _ := values[i+1].([]byte)
+					redisMessages.Inc()
+					countPacket("redis", payload)
+					e <- AddListenerLabel(parsePacket("redis", parser, payload), l.ListenerLabel)
+				}
+			}
+		}
+	}
+}
+
+// redisCommand sends a command and returns its reply. Error replies are
+// returned as error.
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) (interface{}, error) {
+	if err := writeRedisCommand(w, args...); err != nil {
+		return nil, err
+	}
+	reply, err := readRedisReply(r)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(error); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+func writeRedisCommand(w io.Writer, args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// readRedisReply reads a single reply. Simple strings are returned as
+// string, errors as error, integers as int64, bulk strings as []byte, and
+// arrays as []interface{}. Null bulk strings and arrays are nil.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	header = strings.TrimRight(header, "\r\n")
+	if len(header) == 0 {
+		return nil, errors.New("empty reply")
+	}
+	switch header[0] {
+	case '+':
+		return header[1:], nil
+	case '-':
+		return errors.New(header[1:]), nil
+	case ':':
+		return strconv.ParseInt(header[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(header[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	case '*':
+		size, err := strconv.Atoi(header[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		elements := make([]interface{}, size)
+		for i := range elements {
+			if elements[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return elements, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", header)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// fakeRedis accepts a single connection and answers every command with the
+// next of the given replies, reporting the received commands.
+func fakeRedis(t *testing.T, replies ...string) (string, <-chan []string) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := make(chan []string, len(replies))
+	go func() {
+		defer ln.Close()
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for _, reply := range replies {
+			command, err := readRedisReply(r)
+			if err != nil {
+				return
+			}
+			var args []string
+			for _, arg := range command.([]interface{}) {
+				args = append(args, string(arg.([]byte)))
+			}
+			commands <- args
+			io.WriteString(c, reply)
+		}
+		// Keep the connection open until the test is done.
+		r.ReadByte()
+	}()
+	return ln.Addr().String(), commands
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func TestRedisListenerChannel(t *testing.T) {
+	payload := "foo:1|c\nbar:2|g"
+	addr, commands := fakeRedis(t,
+		"+OK\r\n",
+		"*3\r\n"+bulk("subscribe")+bulk("statsd")+":1\r\n"+
+			"*3\r\n"+bulk("message")+bulk("statsd")+bulk(payload),
+	)
+
+	events := make(chan event.Events, 1)
+	l := &RedisListener{URL: "redis://:secret@" + addr, Channel: "statsd", ListenerLabel: "redis"}
+	go l.Listen(events)
+
+	for _, want := range [][]string{{"AUTH", "secret"}, {"SUBSCRIBE", "statsd"}} {
+		if got := <-commands; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected command %v, got %v", want, got)
+		}
+	}
+	select {
+	case actual := <-events:
+		if len(actual) != 2 || actual[0].MetricName() != "foo" || actual[1].MetricName() != "bar" {
+			t.Fatalf("unexpected events %v", actual)
+		}
+		if got := actual[0].Labels()[ListenerLabelName]; got != "redis" {
+			t.Errorf("expected listener label redis, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for events")
+	}
+}
+
+func TestRedisListenerStream(t *testing.T) {
+	entries := "*1\r\n*2\r\n" + bulk("metrics") + "*2\r\n" +
+		"*2\r\n" + bulk("1-0") + "*2\r\n" + bulk("data") + bulk("foo:1|c") +
+		"*2\r\n" + bulk("2-0") + "*4\r\n" + bulk("other") + bulk("ignored") + bulk("data") + bulk("bar:2|c")
+	addr, commands := fakeRedis(t,
+		"+OK\r\n",
+		"*-1\r\n",
+		entries,
+		"*-1\r\n",
+	)
+
+	events := make(chan event.Events, 2)
+	l := &RedisListener{URL: "redis://" + addr + "/2", Stream: "metrics", StreamField: "data"}
+	go l.Listen(events)
+
+	var names []string
+	for len(names) < 2 {
+		select {
+		case actual := <-events:
+			for _, e := range actual {
+				names = append(names, e.MetricName())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for events")
+		}
+	}
+	if want := []string{"foo", "bar"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected events %v, got %v", want, names)
+	}
+
+	wantCommands := []string{
+		"SELECT 2",
+		"XREAD COUNT 100 BLOCK 5000 STREAMS metrics $",
+		"XREAD COUNT 100 BLOCK 5000 STREAMS metrics $",
+		"XREAD COUNT 100 BLOCK 5000 STREAMS metrics 2-0",
+	}
+	for _, want := range wantCommands {
+		if got := strings.Join(<-commands, " "); got != want {
+			t.Errorf("expected command %q, got %q", want, got)
+		}
+	}
+}
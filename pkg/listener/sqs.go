@@ -0,0 +1,267 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+const (
+	sqsAPIVersion = "2012-11-05"
+	// sqsWaitSeconds is the long polling duration, the maximum SQS allows.
+	sqsWaitSeconds  = 20
+	sqsMaxMessages  = 10
+	amzDateFormat   = "20060102T150405Z"
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sqsServiceName  = "sqs"
+	sqsHTTPTimeout  = (sqsWaitSeconds + 10) * time.Second
+	sqsDefaultDelay = time.Second
+)
+
+// AWSCredentials are used to sign requests to AWS.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AWSCredentialsFromEnv reads credentials from the standard AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func AWSCredentialsFromEnv() (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return creds, nil
+}
+
+// SQSListener long-polls an SQS queue and treats the body of every message
+// as a batch of lines. Messages are deleted once they have been parsed.
+type SQSListener struct {
+	QueueURL    string
+	Region      string
+	Credentials AWSCredentials
+	// Client is used for all requests. Defaults to a client with a timeout
+	// suitable for long polling.
+	Client *http.Client
+	// Parser turns received lines into events. Defaults to the StatsD
+	// format.
+	Parser line.Parser
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+	// RetryWait is the time to wait after a failed request. Defaults to
+	// one second.
+	RetryWait time.Duration
+}
+
+type sqsMessage struct {
+	MessageID     string `xml:"MessageId"`
+	ReceiptHandle string `xml:"ReceiptHandle"`
+	Body          string `xml:"Body"`
+}
+
+type sqsReceiveMessageResponse struct {
+	Messages []sqsMessage `xml:"ReceiveMessageResult>Message"`
+}
+
+type sqsErrorResponse struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+// Listen polls the queue until the process exits. It never returns.
+func (l *SQSListener) Listen(e chan<- event.Events) {
+	wait := l.RetryWait
+	if wait == 0 {
+		wait = sqsDefaultDelay
+	}
+	for {
+		if err := l.poll(e); err != nil {
+			sqsErrors.Inc()
+			log.Errorf("Polling SQS queue %s failed: %v", l.QueueURL, err)
+			time.Sleep(wait)
+		}
+	}
+}
+
+// poll receives and processes a single batch of messages.
+func (l *SQSListener) poll(e chan<- event.Events) error {
+	var resp sqsReceiveMessageResponse
+	err := l.call(url.Values{
+		"Action":              {"ReceiveMessage"},
+		"MaxNumberOfMessages": {strconv.Itoa(sqsMaxMessages)},
+		"WaitTimeSeconds":     {strconv.Itoa(sqsWaitSeconds)},
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if len(resp.Messages) == 0 {
+		return nil
+	}
+
+	parser := parserOrDefault(l.Parser)
+	deleteParams := url.Values{"Action": {"DeleteMessageBatch"}}
+	for i, msg := range resp.Messages {
+		sqsMessages.Inc()
+		countPacket("sqs", []byte(msg.Body))
+		e <- AddListenerLabel(parsePacket("sqs", parser, []byte(msg.Body)), l.ListenerLabel)
+
+		prefix := fmt.Sprintf("DeleteMessageBatchRequestEntry.%d.", i+1)
+		deleteParams.Set(prefix+"Id", strconv.Itoa(i))
+		deleteParams.Set(prefix+"ReceiptHandle", msg.ReceiptHandle)
+	}
+	// Messages that cannot be deleted become visible again and are
+	// processed twice.
+	return l.call(deleteParams, nil)
+}
+
+// call sends a signed request to the queue API and decodes the XML response
+// into out, if it is not nil.
+func (l *SQSListener) call(params url.Values, out interface{}) error {
+	params.Set("Version", sqsAPIVersion)
+	body := []byte(params.Encode())
+	req, err := http.NewRequest("POST", l.QueueURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, body, l.Credentials, l.Region, sqsServiceName, time.Now())
+
+	client := l.Client
+	if client == nil {
+		client = &http.Client{Timeout: sqsHTTPTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResp sqsErrorResponse
+		if xml.Unmarshal(respBody, &errResp) == nil && errResp.Code != "" {
+			return fmt.Errorf("%s: %s: %s", params.Get("Action"), errResp.Code, errResp.Message)
+		}
+		return fmt.Errorf("%s: unexpected status %s", params.Get("Action"), resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(respBody, out)
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to req. The
+// Host header, X-Amz-Date, and, if set, Content-Type and the session token
+// are signed.
+func signV4(req *http.Request, body []byte, creds AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host":       req.URL.Host,
+		"x-amz-date": amzDate,
+	}
+	for _, name := range []string{"Content-Type", "X-Amz-Security-Token"} {
+		if v := req.Header.Get(name); v != "" {
+			headers[strings.ToLower(name)] = v
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// RegionFromSQSURL extracts the region from a queue URL of the form
+// https://sqs.<region>.amazonaws.com/<account>/<queue>.
+func RegionFromSQSURL(queueURL string) (string, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(u.Hostname(), ".")
+	if len(parts) < 4 || parts[0] != "sqs" {
+		return "", fmt.Errorf("cannot determine region from queue URL %q", queueURL)
+	}
+	return parts[1], nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// TestSignV4 uses the get-vanilla case of the AWS Signature Version 4 test
+// suite.
+func TestSignV4(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("expected Authorization header\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestSQSListener(t *testing.T) {
+	deleted := make(chan []string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		if got := r.Header.Get("X-Amz-Security-Token"); got != "token" {
+			t.Errorf("expected session token, got %q", got)
+		}
+		r.ParseForm()
+		switch r.PostForm.Get("Action") {
+		case "ReceiveMessage":
+			w.Write([]byte(`<ReceiveMessageResponse><ReceiveMessageResult>
+<Message><MessageId>a</MessageId><ReceiptHandle>handle-a</ReceiptHandle><Body>foo:1|c
+bar:2|g</Body></Message>
+<Message><MessageId>b</MessageId><ReceiptHandle>handle-b</ReceiptHandle><Body>baz:3|ms</Body></Message>
+</ReceiveMessageResult></ReceiveMessageResponse>`))
+		case "DeleteMessageBatch":
+			deleted <- []string{
+				r.PostForm.Get("DeleteMessageBatchRequestEntry.1.ReceiptHandle"),
+				r.PostForm.Get("DeleteMessageBatchRequestEntry.2.ReceiptHandle"),
+			}
+			w.Write([]byte(`<DeleteMessageBatchResponse></DeleteMessageBatchResponse>`))
+		default:
+			t.Errorf("unexpected action %q", r.PostForm.Get("Action"))
+		}
+	}))
+	defer server.Close()
+
+	events := make(chan event.Events, 2)
+	l := &SQSListener{
+		QueueURL:      server.URL + "/123456789012/statsd",
+		Region:        "eu-west-1",
+		Credentials:   AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"},
+		ListenerLabel: "sqs",
+	}
+	if err := l.poll(events); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for len(events) > 0 {
+		for _, e := range <-events {
+			names = append(names, e.MetricName())
+			if got := e.Labels()[ListenerLabelName]; got != "sqs" {
+				t.Errorf("expected listener label sqs, got %q", got)
+			}
+		}
+	}
+	if got, want := strings.Join(names, ","), "foo,bar,baz"; got != want {
+		t.Errorf("expected events %s, got %s", want, got)
+	}
+	if got := <-deleted; got[0] != "handle-a" || got[1] != "handle-b" {
+		t.Errorf("expected both messages to be deleted, got %v", got)
+	}
+}
+
+func TestRegionFromSQSURL(t *testing.T) {
+	region, err := RegionFromSQSURL("https://sqs.eu-west-1.amazonaws.com/123456789012/statsd")
+	if err != nil || region != "eu-west-1" {
+		t.Errorf("expected region eu-west-1, got %q (%v)", region, err)
+	}
+	if _, err := RegionFromSQSURL("http://localhost:9324/queue/statsd"); err == nil {
+		t.Error("expected error for queue URL without region")
+	}
+}
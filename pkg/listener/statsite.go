@@ -0,0 +1,87 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bufio"
+	"io"
+	"net"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+// StatsiteListener accepts TCP connections carrying the binary stream
+// statsite writes to its sinks with binary_stream enabled, e.g. from a
+// stream_cmd of "nc exporter 9127".
+type StatsiteListener struct {
+	Conn *net.TCPListener
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+}
+
+func (l *StatsiteListener) Listen(e chan<- event.Events) {
+	for {
+		c, err := l.Conn.AcceptTCP()
+		if err != nil {
+			log.Fatalf("AcceptTCP failed: %v", err)
+		}
+		go l.HandleConn(c, e)
+	}
+}
+
+// HandleConn reads records from c until it is closed and sends the resulting
+// events to e. Events are batched while more records are buffered.
+func (l *StatsiteListener) HandleConn(c io.ReadCloser, e chan<- event.Events) {
+	defer c.Close()
+
+	listenerConnections.WithLabelValues("statsite").Inc()
+
+	r := bufio.NewReader(&countingReader{r: c, listener: "statsite"})
+	events := event.Events{}
+	for {
+		record, err := line.ReadStatsiteRecord(r)
+		if err != nil {
+			if err != io.EOF {
+				statsiteErrors.Inc()
+				log.Debugf("Reading statsite records failed: %v", err)
+			}
+			break
+		}
+		listenerPackets.WithLabelValues("statsite").Inc()
+		events = append(events, record...)
+		if r.Buffered() == 0 && len(events) > 0 {
+			e <- AddListenerLabel(events, l.ListenerLabel)
+			events = event.Events{}
+		}
+	}
+	if len(events) > 0 {
+		e <- AddListenerLabel(events, l.ListenerLabel)
+	}
+}
+
+// countingReader counts the bytes read from r as received by listener.
+type countingReader struct {
+	r        io.Reader
+	listener string
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	listenerBytes.WithLabelValues(c.listener).Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+// FileTailListener follows a file that lines are appended to, like tail -F.
+// When the file is rotated, i.e. replaced by a new file of the same name, the
+// remainder of the old file is read before switching to the new one. When it
+// is truncated, reading starts again at its beginning.
+type FileTailListener struct {
+	Path string
+	// FromStart reads the lines already in the file when the listener
+	// starts. By default, only lines appended later are read.
+	FromStart bool
+	// Parser turns received lines into events. Defaults to the StatsD
+	// format.
+	Parser line.Parser
+	// ListenerLabel is attached as the listener label to all events
+	// received by this listener. Empty disables the label.
+	ListenerLabel string
+	// PollInterval is how often the file is checked for new lines.
+	// Defaults to one second.
+	PollInterval time.Duration
+
+	file    *os.File
+	offset  int64
+	partial []byte
+	discard bool
+	started bool
+}
+
+// Listen follows the file until the process exits. It never returns.
+func (l *FileTailListener) Listen(e chan<- event.Events) {
+	interval := l.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	for {
+		if err := l.poll(e); err != nil {
+			fileErrors.Inc()
+			log.Errorf("Error tailing %s: %v", l.Path, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// poll reads the lines appended since the last poll, and handles rotation
+// and truncation of the file.
+func (l *FileTailListener) poll(e chan<- event.Events) error {
+	if l.file == nil {
+		f, err := os.Open(l.Path)
+		if os.IsNotExist(err) {
+			// The file has not been created yet, or is being rotated.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		l.offset = 0
+		if !l.started && !l.FromStart {
+			if l.offset, err = f.Seek(0, io.SeekEnd); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		l.file = f
+		l.started = true
+	}
+
+	if err := l.read(e); err != nil {
+		return err
+	}
+
+	current, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	latest, err := os.Stat(l.Path)
+	if os.IsNotExist(err) {
+		// Rotated, but the new file does not exist yet. Keep reading the
+		// old one in case it is still written to.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(current, latest) {
+		fileRotations.Inc()
+		// Pick up lines written between the last read and the rotation.
+		err := l.read(e)
+		l.flushPartial(e)
+		l.discard = false
+		l.file.Close()
+		l.file = nil
+		if err != nil {
+			return err
+		}
+		return l.poll(e)
+	}
+	if current.Size() < l.offset {
+		fileRotations.Inc()
+		l.partial = nil
+		l.discard = false
+		if l.offset, err = l.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return l.read(e)
+	}
+	return nil
+}
+
+// read processes all complete lines up to the end of the file. An
+// incomplete last line is kept until the rest of it is written.
+func (l *FileTailListener) read(e chan<- event.Events) error {
+	parser := parserOrDefault(l.Parser)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := l.file.Read(buf)
+		l.offset += int64(n)
+		listenerBytes.WithLabelValues("file").Add(float64(n))
+		data := append(l.partial, buf[:n]...)
+		if l.discard {
+			// Skip the rest of a line that was too long.
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				data = nil
+			} else {
+				data = data[i+1:]
+				l.discard = false
+			}
+		}
+		if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+			e <- AddListenerLabel(parsePacket("file", parser, data[:i]), l.ListenerLabel)
+			data = data[i+1:]
+		}
+		if len(data) > maxReaderLineLength {
+			fileLineTooLong.Inc()
+			data = nil
+			l.discard = true
+		}
+		l.partial = append([]byte(nil), data...)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// flushPartial processes an incomplete last line of a file that will not be
+// written to anymore.
+func (l *FileTailListener) flushPartial(e chan<- event.Events) {
+	if len(l.partial) > 0 {
+		e <- AddListenerLabel(parsePacket("file", parserOrDefault(l.Parser), l.partial), l.ListenerLabel)
+		l.partial = nil
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestFileTailListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "statsd.log")
+
+	appendTo := func(s string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := make(chan event.Events, 100)
+	l := &FileTailListener{Path: path}
+	poll := func() []string {
+		if err := l.poll(events); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for {
+			select {
+			case batch := <-events:
+				for _, e := range batch {
+					names = append(names, e.MetricName())
+				}
+			default:
+				return names
+			}
+		}
+	}
+
+	scenarios := []struct {
+		name   string
+		action func()
+		want   string
+	}{
+		{
+			name:   "missing file",
+			action: func() {},
+		},
+		{
+			name:   "existing content is skipped",
+			action: func() { appendTo("old:1|c\n") },
+		},
+		{
+			name:   "appended lines",
+			action: func() { appendTo("a:1|c\nb:1|c\nc:1") },
+			want:   "a,b",
+		},
+		{
+			name:   "completed line",
+			action: func() { appendTo("|c\n") },
+			want:   "c",
+		},
+		{
+			name: "rotation",
+			action: func() {
+				appendTo("d:1|c\ne:1|c")
+				if err := os.Rename(path, path+".1"); err != nil {
+					t.Fatal(err)
+				}
+				appendTo("f:1|c\nf:2|c\n")
+			},
+			want: "d,e,f,f",
+		},
+		{
+			name: "truncation",
+			action: func() {
+				if err := ioutil.WriteFile(path, []byte("g:1|c\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "g",
+		},
+	}
+
+	for _, s := range scenarios {
+		s.action()
+		if got := strings.Join(poll(), ","); got != s.want {
+			t.Errorf("%s: expected events %q, got %q", s.name, s.want, got)
+		}
+	}
+}
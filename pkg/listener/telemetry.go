@@ -0,0 +1,209 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listener
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	udpPackets = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_udp_packets_total",
+			Help: "The total number of StatsD packets received over UDP.",
+		},
+	)
+	udpReaders = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_udp_reader_goroutines",
+			Help: "The number of goroutines reading from the UDP socket.",
+		},
+	)
+	tcpConnections = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tcp_connections_total",
+			Help: "The total number of TCP connections handled.",
+		},
+	)
+	tcpErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tcp_connection_errors_total",
+			Help: "The number of errors encountered reading from TCP.",
+		},
+	)
+	tcpLineTooLong = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tcp_too_long_lines_total",
+			Help: "The number of lines discarded due to being too long.",
+		},
+	)
+	udpLineTooLong = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_udp_too_long_lines_total",
+			Help: "The number of lines received over UDP exceeding the maximum line length, by whether they were dropped or truncated.",
+		},
+		[]string{"action"},
+	)
+	natsMessages = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_nats_messages_total",
+			Help: "The total number of messages received from NATS.",
+		},
+	)
+	natsErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_nats_connection_errors_total",
+			Help: "The number of failed or lost NATS connections.",
+		},
+	)
+	redisMessages = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_redis_messages_total",
+			Help: "The total number of messages and stream entries received from Redis.",
+		},
+	)
+	redisErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_redis_connection_errors_total",
+			Help: "The number of failed or lost Redis connections.",
+		},
+	)
+	sqsMessages = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_sqs_messages_total",
+			Help: "The total number of messages received from SQS.",
+		},
+	)
+	sqsErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_sqs_request_errors_total",
+			Help: "The number of failed SQS requests.",
+		},
+	)
+	fileRotations = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_file_rotations_total",
+			Help: "The number of rotations and truncations of tailed files.",
+		},
+	)
+	fileErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_file_errors_total",
+			Help: "The number of errors encountered tailing files.",
+		},
+	)
+	fileLineTooLong = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_file_too_long_lines_total",
+			Help: "The number of lines in tailed files discarded due to being too long.",
+		},
+	)
+	statsiteErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_statsite_connection_errors_total",
+			Help: "The number of statsite connections closed because of a malformed or truncated record.",
+		},
+	)
+	collectdErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_collectd_packet_errors_total",
+			Help: "The number of malformed or unsupported collectd packets.",
+		},
+	)
+	pushErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_push_errors_total",
+			Help: "The number of pushed payloads rejected because they could not be read or parsed.",
+		},
+	)
+	pushSkipped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_push_skipped_metrics_total",
+			Help: "The number of pushed metrics skipped because their type is not supported.",
+		},
+	)
+	linesReceived = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_lines_total",
+			Help: "The total number of StatsD lines received.",
+		},
+	)
+	listenerBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_listener_received_bytes_total",
+			Help: "The total number of bytes received, by listener.",
+		},
+		[]string{"listener"},
+	)
+	listenerPackets = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_listener_packets_total",
+			Help: "The total number of packets or messages received, by listener.",
+		},
+		[]string{"listener"},
+	)
+	listenerConnections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_listener_connections_total",
+			Help: "The total number of connections accepted, by listener.",
+		},
+		[]string{"listener"},
+	)
+	listenerLines = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_listener_lines_total",
+			Help: "The total number of lines received, by listener.",
+		},
+		[]string{"listener"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(udpPackets)
+	prometheus.MustRegister(udpReaders)
+	prometheus.MustRegister(tcpConnections)
+	prometheus.MustRegister(tcpErrors)
+	prometheus.MustRegister(tcpLineTooLong)
+	prometheus.MustRegister(udpLineTooLong)
+	prometheus.MustRegister(natsMessages)
+	prometheus.MustRegister(natsErrors)
+	prometheus.MustRegister(redisMessages)
+	prometheus.MustRegister(redisErrors)
+	prometheus.MustRegister(sqsMessages)
+	prometheus.MustRegister(sqsErrors)
+	prometheus.MustRegister(fileRotations)
+	prometheus.MustRegister(fileErrors)
+	prometheus.MustRegister(fileLineTooLong)
+	prometheus.MustRegister(statsiteErrors)
+	prometheus.MustRegister(collectdErrors)
+	prometheus.MustRegister(pushErrors)
+	prometheus.MustRegister(pushSkipped)
+	prometheus.MustRegister(linesReceived)
+	prometheus.MustRegister(listenerBytes)
+	prometheus.MustRegister(listenerPackets)
+	prometheus.MustRegister(listenerConnections)
+	prometheus.MustRegister(listenerLines)
+}
+
+// countPacket counts a packet or message received by the given listener.
+func countPacket(listener string, packet []byte) {
+	listenerPackets.WithLabelValues(listener).Inc()
+	listenerBytes.WithLabelValues(listener).Add(float64(len(packet)))
+}
+
+// countLine counts a line received by the given listener.
+func countLine(listener string) {
+	linesReceived.Inc()
+	listenerLines.WithLabelValues(listener).Inc()
+}
@@ -20,6 +20,7 @@ type ActionType string
 const (
 	ActionTypeMap     ActionType = "map"
 	ActionTypeDrop    ActionType = "drop"
+	ActionTypeInfo    ActionType = "info"
 	ActionTypeDefault ActionType = ""
 )
 
@@ -33,6 +34,8 @@ func (t *ActionType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	switch ActionType(v) {
 	case ActionTypeDrop:
 		*t = ActionTypeDrop
+	case ActionTypeInfo:
+		*t = ActionTypeInfo
 	case ActionTypeMap, ActionTypeDefault:
 		*t = ActionTypeMap
 	default:
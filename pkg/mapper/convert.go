@@ -0,0 +1,189 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// regexCaptureRE matches the capture groups of regex matches that
+	// correspond to a glob wildcard.
+	regexCaptureRE = regexp.MustCompile(`^\(\[\^\\?\.\][*+]\)$`)
+	// captureRefRE matches the capture references of names and labels.
+	captureRefRE = regexp.MustCompile(`\$\{?(\d+)\}?`)
+)
+
+// ConvertMatchTypes rewrites the matches of the mappings in config to the
+// match type to, and returns the resulting config. All other settings are
+// kept. Mappings that cannot be converted are left unchanged, with the
+// reasons returned in skipped.
+//
+// Globs become anchored regular expressions capturing every wildcard
+// component. Only regular expressions made of literal components and
+// ([^.]*) or ([^.]+) captures of whole components can become globs.
+func ConvertMatchTypes(config string, to MatchType) (out []byte, skipped []string, err error) {
+	if to != MatchTypeGlob && to != MatchTypeRegex {
+		return nil, nil, fmt.Errorf("invalid match type %q", to)
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(config), &doc); err != nil {
+		return nil, nil, err
+	}
+
+	defaultType := MatchTypeGlob
+	if defaults, ok := mapSliceValue(doc, "defaults").(yaml.MapSlice); ok {
+		if t, ok := mapSliceValue(defaults, "match_type").(string); ok && t != "" {
+			defaultType = MatchType(t)
+		}
+	}
+	mappings, _ := mapSliceValue(doc, "mappings").([]interface{})
+	for i, item := range mappings {
+		mapping, ok := item.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		match, _ := mapSliceValue(mapping, "match").(string)
+		from := defaultType
+		if t, ok := mapSliceValue(mapping, "match_type").(string); ok && t != "" {
+			from = MatchType(t)
+		}
+		if from == to {
+			continue
+		}
+
+		var converted string
+		if to == MatchTypeRegex {
+			converted = globToRegex(match)
+		} else if converted, err = regexToGlob(match); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", match, err))
+			continue
+		}
+		mapping = setMapSliceValue(mapping, "match", converted)
+		mapping = setMapSliceValue(mapping, "match_type", string(to))
+		if to == MatchTypeRegex {
+			// In regular expressions, $1_total refers to the group
+			// named 1_total.
+			mapping = bracketCaptureRefs(mapping)
+		}
+		mappings[i] = mapping
+	}
+	out, err = yaml.Marshal(doc)
+	return out, skipped, err
+}
+
+// CompareMappings maps every name with a and b, as every metric type, and
+// describes the differences of the results.
+func CompareMappings(a, b *MetricMapper, names []string) []string {
+	var diffs []string
+	for _, name := range names {
+		for _, t := range []MetricType{MetricTypeCounter, MetricTypeGauge, MetricTypeTimer, MetricTypeSet} {
+			if diff := compareMapping(a, b, name, t); diff != "" {
+				diffs = append(diffs, fmt.Sprintf("%s (%s): %s", name, t, diff))
+			}
+		}
+	}
+	return diffs
+}
+
+func compareMapping(a, b *MetricMapper, name string, t MetricType) string {
+	describe := func(m *MetricMapper) string {
+		mapping, labels, present := m.GetMapping(name, t)
+		if !present {
+			return "no mapping"
+		}
+		return fmt.Sprintf("%s %s%v", mapping.Action, mapping.Name, labels)
+	}
+	if resultA, resultB := describe(a), describe(b); resultA != resultB {
+		return fmt.Sprintf("%s before, %s after", resultA, resultB)
+	}
+	return ""
+}
+
+// globToRegex converts a glob match into an anchored regular expression.
+func globToRegex(glob string) string {
+	components := strings.Split(glob, ".")
+	for i, c := range components {
+		if c == "*" {
+			components[i] = `([^.]*)`
+		} else {
+			components[i] = regexp.QuoteMeta(c)
+		}
+	}
+	return "^" + strings.Join(components, `\.`) + "$"
+}
+
+// regexToGlob converts an anchored regular expression of literal components
+// and whole-component captures into a glob match.
+func regexToGlob(regex string) (string, error) {
+	if !strings.HasPrefix(regex, "^") || !strings.HasSuffix(regex, "$") {
+		return "", fmt.Errorf("not anchored at both ends")
+	}
+	components := strings.Split(regex[1:len(regex)-1], `\.`)
+	for i, c := range components {
+		if regexCaptureRE.MatchString(c) {
+			components[i] = "*"
+			continue
+		}
+		literal := strings.Replace(c, `\-`, "-", -1)
+		if !segmentRE.MatchString(literal) {
+			return "", fmt.Errorf("component %q is neither a glob literal nor a capture of a whole component", c)
+		}
+		components[i] = literal
+	}
+	if len(components) < 2 {
+		return "", fmt.Errorf("globs need at least two components")
+	}
+	return strings.Join(components, "."), nil
+}
+
+// bracketCaptureRefs rewrites the capture references in the name and labels
+// of mapping as ${n}.
+func bracketCaptureRefs(mapping yaml.MapSlice) yaml.MapSlice {
+	if name, ok := mapSliceValue(mapping, "name").(string); ok {
+		mapping = setMapSliceValue(mapping, "name", captureRefRE.ReplaceAllString(name, "$${$1}"))
+	}
+	if labels, ok := mapSliceValue(mapping, "labels").(yaml.MapSlice); ok {
+		for i, l := range labels {
+			if v, ok := l.Value.(string); ok {
+				labels[i].Value = captureRefRE.ReplaceAllString(v, "$${$1}")
+			}
+		}
+	}
+	return mapping
+}
+
+func mapSliceValue(s yaml.MapSlice, key string) interface{} {
+	for _, item := range s {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// setMapSliceValue sets key to value, appending it if it is not set yet.
+func setMapSliceValue(s yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range s {
+		if item.Key == key {
+			s[i].Value = value
+			return s
+		}
+	}
+	return append(s, yaml.MapItem{Key: key, Value: value})
+}
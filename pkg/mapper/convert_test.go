@@ -0,0 +1,99 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertMatchTypes(t *testing.T) {
+	config := `
+defaults:
+  ttl: 1m
+mappings:
+- match: api.*.requests
+  name: api_requests_$1
+  help: Requests per API host.
+  labels:
+    host: $1
+    job: api
+- match: jobs.*.*
+  name: jobs_${2}
+  labels:
+    job: ${1}
+- match: ^db\.([^.]+)\.query-time$
+  match_type: regex
+  name: db_query_time
+  labels:
+    db: $1
+- match: ^cache\.(.*)$
+  match_type: regex
+  name: cache
+  labels:
+    key: $1
+`
+	names := []string{
+		"api.web01.requests",
+		"jobs.backup.duration",
+		"db.users.query-time",
+		"cache.a.b",
+		"other.metric",
+	}
+	original := &MetricMapper{}
+	if err := original.InitFromYAMLString(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, to := range []MatchType{MatchTypeRegex, MatchTypeGlob} {
+		out, skipped, err := ConvertMatchTypes(config, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		converted := &MetricMapper{}
+		if err := converted.InitFromYAMLString(string(out)); err != nil {
+			t.Fatalf("Config converted to %s is invalid: %v\n%s", to, err, out)
+		}
+		if diffs := CompareMappings(original, converted, names); len(diffs) > 0 {
+			t.Errorf("Config converted to %s maps differently:\n%s\n%s", to, strings.Join(diffs, "\n"), out)
+		}
+		for _, mapping := range converted.Mappings {
+			if mapping.Match == `^cache\.(.*)$` {
+				continue
+			}
+			if mapping.MatchType != to {
+				t.Errorf("Mapping %s was not converted to %s", mapping.Match, to)
+			}
+		}
+		if converted.Mappings[0].HelpText != "Requests per API host." || converted.Defaults.Ttl != original.Defaults.Ttl {
+			t.Errorf("Settings were not kept in the config converted to %s:\n%s", to, out)
+		}
+		if to == MatchTypeGlob && len(skipped) != 1 {
+			t.Errorf("Expected the cache mapping to be skipped, got %v", skipped)
+		}
+	}
+}
+
+func TestCompareMappings(t *testing.T) {
+	a, b := &MetricMapper{}, &MetricMapper{}
+	if err := a.InitFromYAMLString("mappings:\n- match: aa.*\n  name: a\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.InitFromYAMLString("mappings:\n- match: aa.*\n  name: b\n"); err != nil {
+		t.Fatal(err)
+	}
+	if diffs := CompareMappings(a, b, []string{"aa.x", "cc.x"}); len(diffs) != 4 {
+		t.Errorf("Expected a difference for every metric type of aa.x, got %v", diffs)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2013 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	illegalCharsRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// EscapeMetricName turns a StatsD metric or tag name into a valid Prometheus
+// metric or label name.
+func EscapeMetricName(metricName string) string {
+	// If a metric starts with a digit, prepend an underscore.
+	if metricName[0] >= '0' && metricName[0] <= '9' {
+		metricName = "_" + metricName
+	}
+
+	// Replace all illegal metric chars with underscores.
+	metricName = illegalCharsRE.ReplaceAllString(metricName, "_")
+	return metricName
+}
+
+// EscapeMetricNameWithSeparator is like EscapeMetricName, but replaces the
+// dots separating the components of the name with separator.
+func EscapeMetricNameWithSeparator(metricName, separator string) string {
+	components := strings.Split(metricName, ".")
+	for i, c := range components {
+		components[i] = illegalCharsRE.ReplaceAllString(c, "_")
+	}
+	metricName = strings.Join(components, separator)
+
+	if metricName[0] >= '0' && metricName[0] <= '9' {
+		metricName = "_" + metricName
+	}
+	return metricName
+}
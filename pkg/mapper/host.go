@@ -0,0 +1,53 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import "fmt"
+
+// HostTag is the name of the tag DogStatsD clients report their host in.
+const HostTag = "host"
+
+// HostTagAction is what happens to the host tag of incoming events.
+type HostTagAction string
+
+const (
+	// HostTagKeep exports the host tag as host label.
+	HostTagKeep HostTagAction = "keep"
+	// HostTagExportedInstance exports the host tag as exported_instance
+	// label, which does not collide with the conventions of Prometheus
+	// relabeling.
+	HostTagExportedInstance HostTagAction = "exported_instance"
+	// HostTagDrop drops the host tag.
+	HostTagDrop    HostTagAction = "drop"
+	HostTagDefault HostTagAction = ""
+)
+
+func (a *HostTagAction) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch HostTagAction(v) {
+	case HostTagExportedInstance:
+		*a = HostTagExportedInstance
+	case HostTagDrop:
+		*a = HostTagDrop
+	case HostTagKeep, HostTagDefault:
+		*a = HostTagKeep
+	default:
+		return fmt.Errorf("invalid host tag action '%s'", v)
+	}
+	return nil
+}
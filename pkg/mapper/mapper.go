@@ -14,9 +14,13 @@
 package mapper
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -32,30 +36,55 @@ var (
 	metricLineRE = regexp.MustCompile(`^(\*\.|` + statsdMetricRE + `\.)+(\*|` + statsdMetricRE + `)$`)
 	metricNameRE = regexp.MustCompile(`^([a-zA-Z_]|` + templateReplaceRE + `)([a-zA-Z0-9_]|` + templateReplaceRE + `)*$`)
 	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]+$`)
+	namespaceRE  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
 )
 
 type mapperConfigDefaults struct {
 	TimerType           TimerType         `yaml:"timer_type"`
 	Buckets             []float64         `yaml:"buckets"`
-	Quantiles           []metricObjective `yaml:"quantiles"`
+	Quantiles           []MetricObjective `yaml:"quantiles"`
+	QuantileAlgorithm   QuantileAlgorithm `yaml:"quantile_algorithm"`
 	MatchType           MatchType         `yaml:"match_type"`
 	GlobDisableOrdering bool              `yaml:"glob_disable_ordering"`
 	Ttl                 time.Duration     `yaml:"ttl"`
+	TtlType             TtlType           `yaml:"ttl_type"`
+	ExpiryAction        ExpiryAction      `yaml:"expiry_action"`
+	ExpiryGrace         time.Duration     `yaml:"expiry_grace"`
+	ScrapeAction        ScrapeAction      `yaml:"scrape_action"`
+	Lowercase           bool              `yaml:"lowercase"`
+	Namespace           string            `yaml:"namespace"`
+	HostTag             HostTagAction     `yaml:"host_tag"`
+	SetWindow           time.Duration     `yaml:"set_window"`
+	SetMaxElements      int               `yaml:"set_max_elements"`
 }
 
 type MetricMapper struct {
 	Defaults mapperConfigDefaults `yaml:"defaults"`
 	Mappings []MetricMapping      `yaml:"mappings"`
-	FSM      *fsm.FSM
-	doFSM    bool
-	doRegex  bool
-	mutex    sync.Mutex
+	// RelabelConfigs are applied to the name and labels of metrics after
+	// mapping.
+	RelabelConfigs []RelabelConfig `yaml:"relabel_configs,omitempty"`
+	// ScopedDefaults override the defaults for some of the glob mappings.
+	ScopedDefaults []ScopedDefaults `yaml:"scoped_defaults,omitempty"`
+	FSM            *fsm.FSM
+	doFSM          bool
+	doRegex        bool
+	mutex          sync.Mutex
 
 	MappingsCount prometheus.Gauge
+
+	// DefaultQuantiles are used for timers if the mapping config does not
+	// set any default quantiles.
+	DefaultQuantiles []MetricObjective
 }
 
 type MetricMapping struct {
-	Match           string `yaml:"match"`
+	Match string `yaml:"match"`
+	// NotMatch excludes the metrics matching any of these globs or
+	// regular expressions, depending on the match type, from the mapping.
+	NotMatch        []string `yaml:"not_match,omitempty"`
+	notMatch        []*regexp.Regexp
+	globRegex       *regexp.Regexp
 	Name            string `yaml:"name"`
 	nameFormatter   *fsm.TemplateFormatter
 	regex           *regexp.Regexp
@@ -64,25 +93,97 @@ type MetricMapping struct {
 	labelFormatters []*fsm.TemplateFormatter
 	TimerType       TimerType         `yaml:"timer_type"`
 	Buckets         []float64         `yaml:"buckets"`
-	Quantiles       []metricObjective `yaml:"quantiles"`
+	Quantiles       []MetricObjective `yaml:"quantiles"`
 	MatchType       MatchType         `yaml:"match_type"`
 	HelpText        string            `yaml:"help"`
 	Action          ActionType        `yaml:"action"`
-	MatchMetricType MetricType        `yaml:"match_metric_type"`
+	MatchMetricType MetricType        `yaml:"match_metric_type,omitempty"`
 	Ttl             time.Duration     `yaml:"ttl"`
+	TtlType         TtlType           `yaml:"ttl_type"`
+	ExpiryAction    ExpiryAction      `yaml:"expiry_action"`
+	ExpiryGrace     time.Duration     `yaml:"expiry_grace"`
+	// ScrapeAction, if delete or zero, removes or resets the series after
+	// every successful scrape.
+	ScrapeAction ScrapeAction `yaml:"scrape_action,omitempty"`
+	// ValueLabel, if set, turns events into counter increments of one,
+	// with the event value formatted by ValueLabelFormat as this label.
+	ValueLabel       string `yaml:"value_label,omitempty"`
+	ValueLabelFormat string `yaml:"value_label_format,omitempty"`
+	// Thresholds, in seconds, make timers also count the observations
+	// exceeding each of them.
+	Thresholds []float64 `yaml:"thresholds,omitempty"`
+	// TimerAggregates additionally exports the classic StatsD timer
+	// aggregates of every aggregation window as gauges.
+	TimerAggregates bool `yaml:"timer_aggregates,omitempty"`
+	// QuantileAlgorithm selects how summary timers estimate quantiles.
+	QuantileAlgorithm QuantileAlgorithm `yaml:"quantile_algorithm"`
+	// Lowercase lowercases the exported name and label names.
+	Lowercase bool `yaml:"lowercase,omitempty"`
+	// Namespace and Subsystem are joined with the name by underscores,
+	// like in the options of Prometheus client metrics.
+	Namespace string `yaml:"namespace,omitempty"`
+	Subsystem string `yaml:"subsystem,omitempty"`
+	// HostTag is what happens to the host tag of matched events.
+	HostTag HostTagAction `yaml:"host_tag,omitempty"`
+	// SetWindow is the sliding window over which the distinct elements
+	// of sets are counted, and SetMaxElements limits the number of
+	// elements counted per series.
+	SetWindow      time.Duration `yaml:"set_window,omitempty"`
+	SetMaxElements int           `yaml:"set_max_elements,omitempty"`
+	// SampleRate, if set, keeps only this fraction of the matched events,
+	// chosen at random. Counter increments are scaled up accordingly.
+	SampleRate float64 `yaml:"sample_rate,omitempty"`
+	// MinValue and MaxValue bound counter increments, gauge values and
+	// timer observations, as received. Values out of range are clamped,
+	// or dropped if OutOfRange is drop.
+	MinValue   *float64         `yaml:"min_value,omitempty"`
+	MaxValue   *float64         `yaml:"max_value,omitempty"`
+	OutOfRange OutOfRangeAction `yaml:"out_of_range,omitempty"`
+	// RoundTo, if set, rounds values to the nearest multiple of it after
+	// applying the value range.
+	RoundTo float64 `yaml:"round_to,omitempty"`
+	// Outputs are additional metrics emitted for every matched event.
+	Outputs []MetricOutput `yaml:"outputs,omitempty"`
 }
 
-type metricObjective struct {
+type MetricObjective struct {
 	Quantile float64 `yaml:"quantile"`
 	Error    float64 `yaml:"error"`
 }
 
-var defaultQuantiles = []metricObjective{
+const (
+	defaultSetWindow      = time.Minute
+	defaultSetMaxElements = 1000
+)
+
+var defaultQuantiles = []MetricObjective{
 	{Quantile: 0.5, Error: 0.05},
 	{Quantile: 0.9, Error: 0.01},
 	{Quantile: 0.99, Error: 0.001},
 }
 
+// ParseQuantiles parses a comma separated list of quantile:error pairs, e.g.
+// "0.5:0.05,0.99:0.001".
+func ParseQuantiles(s string) ([]MetricObjective, error) {
+	var objectives []MetricObjective
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid quantile %q, expected quantile:error", pair)
+		}
+		quantile, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil || quantile < 0 || quantile > 1 {
+			return nil, fmt.Errorf("invalid quantile %q, must be between 0 and 1", parts[0])
+		}
+		objectiveErr, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || objectiveErr < 0 || objectiveErr > 1 {
+			return nil, fmt.Errorf("invalid quantile error %q, must be between 0 and 1", parts[1])
+		}
+		objectives = append(objectives, MetricObjective{Quantile: quantile, Error: objectiveErr})
+	}
+	return objectives, nil
+}
+
 func (m *MetricMapper) InitFromYAMLString(fileContents string) error {
 	var n MetricMapper
 
@@ -96,15 +197,36 @@ func (m *MetricMapper) InitFromYAMLString(fileContents string) error {
 
 	if n.Defaults.Quantiles == nil || len(n.Defaults.Quantiles) == 0 {
 		n.Defaults.Quantiles = defaultQuantiles
+		if len(m.DefaultQuantiles) > 0 {
+			n.Defaults.Quantiles = m.DefaultQuantiles
+		}
 	}
 
 	if n.Defaults.MatchType == MatchTypeDefault {
 		n.Defaults.MatchType = MatchTypeGlob
 	}
 
+	if n.Defaults.SetWindow <= 0 {
+		n.Defaults.SetWindow = defaultSetWindow
+	}
+
+	if n.Defaults.SetMaxElements <= 0 {
+		n.Defaults.SetMaxElements = defaultSetMaxElements
+	}
+
+	if n.Defaults.Namespace != "" && !namespaceRE.MatchString(n.Defaults.Namespace) {
+		return fmt.Errorf("invalid namespace: %s", n.Defaults.Namespace)
+	}
+
+	for i := range n.ScopedDefaults {
+		if err := n.ScopedDefaults[i].validate(); err != nil {
+			return err
+		}
+	}
+
 	remainingMappingsCount := len(n.Mappings)
 
-	n.FSM = fsm.NewFSM([]string{string(MetricTypeCounter), string(MetricTypeGauge), string(MetricTypeTimer)},
+	n.FSM = fsm.NewFSM([]string{string(MetricTypeCounter), string(MetricTypeGauge), string(MetricTypeTimer), string(MetricTypeSet)},
 		remainingMappingsCount, n.Defaults.GlobDisableOrdering)
 
 	for i := range n.Mappings {
@@ -112,19 +234,12 @@ func (m *MetricMapper) InitFromYAMLString(fileContents string) error {
 
 		currentMapping := &n.Mappings[i]
 
-		// check that label is correct
-		for k := range currentMapping.Labels {
-			if !labelNameRE.MatchString(k) {
-				return fmt.Errorf("invalid label key: %s", k)
-			}
-		}
-
 		if currentMapping.Name == "" {
 			return fmt.Errorf("line %d: metric mapping didn't set a metric name", i)
 		}
 
-		if !metricNameRE.MatchString(currentMapping.Name) {
-			return fmt.Errorf("metric name '%s' doesn't match regex '%s'", currentMapping.Name, metricNameRE)
+		if err := currentMapping.validate(); err != nil {
+			return err
 		}
 
 		if currentMapping.MatchType == "" {
@@ -135,13 +250,14 @@ func (m *MetricMapper) InitFromYAMLString(fileContents string) error {
 			currentMapping.Action = ActionTypeMap
 		}
 
+		captureCount := 0
 		if currentMapping.MatchType == MatchTypeGlob {
 			n.doFSM = true
 			if !metricLineRE.MatchString(currentMapping.Match) {
 				return fmt.Errorf("invalid match: %s", currentMapping.Match)
 			}
 
-			captureCount := n.FSM.AddState(currentMapping.Match, string(currentMapping.MatchMetricType),
+			captureCount = n.FSM.AddState(currentMapping.Match, string(currentMapping.MatchMetricType),
 				remainingMappingsCount, currentMapping)
 
 			currentMapping.nameFormatter = fsm.NewTemplateFormatter(currentMapping.Name, captureCount)
@@ -156,6 +272,7 @@ func (m *MetricMapper) InitFromYAMLString(fileContents string) error {
 			}
 			currentMapping.labelFormatters = labelFormatters
 			currentMapping.labelKeys = labelKeys
+			currentMapping.globRegex = globRegexp(currentMapping.Match)
 
 		} else {
 			if regex, err := regexp.Compile(currentMapping.Match); err != nil {
@@ -166,22 +283,71 @@ func (m *MetricMapper) InitFromYAMLString(fileContents string) error {
 			n.doRegex = true
 		}
 
+		if err := currentMapping.initNotMatch(); err != nil {
+			return err
+		}
+
+		defaults := n.defaultsFor(currentMapping)
+
 		if currentMapping.TimerType == "" {
-			currentMapping.TimerType = n.Defaults.TimerType
+			currentMapping.TimerType = defaults.TimerType
 		}
 
 		if currentMapping.Buckets == nil || len(currentMapping.Buckets) == 0 {
-			currentMapping.Buckets = n.Defaults.Buckets
+			currentMapping.Buckets = defaults.Buckets
 		}
 
 		if currentMapping.Quantiles == nil || len(currentMapping.Quantiles) == 0 {
-			currentMapping.Quantiles = n.Defaults.Quantiles
+			currentMapping.Quantiles = defaults.Quantiles
+		}
+
+		if currentMapping.QuantileAlgorithm == QuantileAlgorithmDefault {
+			currentMapping.QuantileAlgorithm = defaults.QuantileAlgorithm
+		}
+
+		if currentMapping.Ttl == 0 && defaults.Ttl > 0 {
+			currentMapping.Ttl = defaults.Ttl
+		}
+
+		if currentMapping.TtlType == TtlTypeDefault {
+			currentMapping.TtlType = defaults.TtlType
+		}
+
+		if currentMapping.SetWindow <= 0 {
+			currentMapping.SetWindow = defaults.SetWindow
 		}
 
-		if currentMapping.Ttl == 0 && n.Defaults.Ttl > 0 {
-			currentMapping.Ttl = n.Defaults.Ttl
+		if currentMapping.SetMaxElements <= 0 {
+			currentMapping.SetMaxElements = defaults.SetMaxElements
 		}
 
+		if currentMapping.HostTag == HostTagDefault {
+			currentMapping.HostTag = defaults.HostTag
+		}
+
+		if currentMapping.ExpiryAction == ExpiryActionDefault {
+			currentMapping.ExpiryAction = defaults.ExpiryAction
+		}
+
+		if currentMapping.ExpiryGrace == 0 {
+			currentMapping.ExpiryGrace = defaults.ExpiryGrace
+		}
+
+		if currentMapping.ScrapeAction == ScrapeActionDefault {
+			currentMapping.ScrapeAction = defaults.ScrapeAction
+		}
+
+		for j := range currentMapping.Outputs {
+			if err := currentMapping.Outputs[j].init(currentMapping, captureCount); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range n.RelabelConfigs {
+		if err := n.RelabelConfigs[i].init(); err != nil {
+			return err
+		}
 	}
 
 	m.mutex.Lock()
@@ -189,6 +355,8 @@ func (m *MetricMapper) InitFromYAMLString(fileContents string) error {
 
 	m.Defaults = n.Defaults
 	m.Mappings = n.Mappings
+	m.RelabelConfigs = n.RelabelConfigs
+	m.ScopedDefaults = n.ScopedDefaults
 	if n.doFSM {
 		var mappings []string
 		for _, mapping := range n.Mappings {
@@ -210,6 +378,82 @@ func (m *MetricMapper) InitFromYAMLString(fileContents string) error {
 	return nil
 }
 
+// Config is the resolved content of a mapping configuration.
+type Config struct {
+	Defaults       mapperConfigDefaults `yaml:"defaults"`
+	Mappings       []MetricMapping      `yaml:"mappings"`
+	RelabelConfigs []RelabelConfig      `yaml:"relabel_configs,omitempty"`
+	ScopedDefaults []ScopedDefaults     `yaml:"scoped_defaults,omitempty"`
+}
+
+// Config returns the currently loaded configuration, with all defaults
+// applied.
+func (m *MetricMapper) Config() Config {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return Config{Defaults: m.Defaults, Mappings: m.Mappings, RelabelConfigs: m.RelabelConfigs, ScopedDefaults: m.ScopedDefaults}
+}
+
+// DumpFSM writes the FSM of the currently loaded glob mappings to w as a Dot
+// graph.
+func (m *MetricMapper) DumpFSM(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.doFSM {
+		return errors.New("no glob mappings are loaded")
+	}
+	m.FSM.DumpFSM(w)
+	return nil
+}
+
+// validate checks the settings of a mapping besides its match, and applies
+// the defaults of its value label.
+func (m *MetricMapping) validate() error {
+	// check that label is correct
+	for k := range m.Labels {
+		if !labelNameRE.MatchString(k) {
+			return fmt.Errorf("invalid label key: %s", k)
+		}
+	}
+
+	if !metricNameRE.MatchString(m.Name) {
+		return fmt.Errorf("metric name '%s' doesn't match regex '%s'", m.Name, metricNameRE)
+	}
+
+	for _, part := range []string{m.Namespace, m.Subsystem} {
+		if part != "" && !namespaceRE.MatchString(part) {
+			return fmt.Errorf("invalid namespace or subsystem %q in mapping for %s", part, m.Match)
+		}
+	}
+
+	if m.ValueLabel != "" {
+		if !labelNameRE.MatchString(m.ValueLabel) {
+			return fmt.Errorf("invalid value label: %s", m.ValueLabel)
+		}
+		if m.ValueLabelFormat == "" {
+			m.ValueLabelFormat = "%g"
+		}
+		if strings.Contains(fmt.Sprintf(m.ValueLabelFormat, 1.0), "%!") {
+			return fmt.Errorf("invalid value label format %q: must format a single float", m.ValueLabelFormat)
+		}
+	} else if m.ValueLabelFormat != "" {
+		return fmt.Errorf("value_label_format set without value_label in mapping for %s", m.Match)
+	}
+
+	if m.SampleRate < 0 || m.SampleRate > 1 {
+		return fmt.Errorf("invalid sample rate %g in mapping for %s: must be between 0 and 1", m.SampleRate, m.Match)
+	}
+
+	if m.RoundTo < 0 {
+		return fmt.Errorf("invalid round_to %g in mapping for %s: must not be negative", m.RoundTo, m.Match)
+	}
+
+	if m.MinValue != nil && m.MaxValue != nil && *m.MinValue > *m.MaxValue {
+		return fmt.Errorf("min_value %g is greater than max_value %g in mapping for %s", *m.MinValue, *m.MaxValue, m.Match)
+	}
+	return nil
+}
+
 func (m *MetricMapper) InitFromFile(fileName string) error {
 	mappingStr, err := ioutil.ReadFile(fileName)
 	if err != nil {
@@ -219,35 +463,57 @@ func (m *MetricMapper) InitFromFile(fileName string) error {
 }
 
 func (m *MetricMapper) GetMapping(statsdMetric string, statsdMetricType MetricType) (*MetricMapping, prometheus.Labels, bool) {
+	mapping, labels, _, present := m.GetMappingOutputs(statsdMetric, statsdMetricType)
+	return mapping, labels, present
+}
+
+// GetMappingOutputs is like GetMapping, but also returns the outputs of the
+// mapping, with their names and labels expanded like those of the mapping.
+func (m *MetricMapper) GetMappingOutputs(statsdMetric string, statsdMetricType MetricType) (*MetricMapping, prometheus.Labels, []Output, bool) {
 	// glob matching
 	if m.doFSM {
 		finalState, captures := m.FSM.GetMapping(statsdMetric, string(statsdMetricType))
 		if finalState != nil && finalState.Result != nil {
 			result := finalState.Result.(*MetricMapping)
+			if result.excludes(statsdMetric) {
+				m.mutex.Lock()
+				defer m.mutex.Unlock()
+				if mapping, labels, outputs, ok := m.getGlobMapping(statsdMetric, statsdMetricType); ok {
+					return mapping, labels, outputs, true
+				}
+				return m.getRegexMapping(statsdMetric, statsdMetricType)
+			}
 			result.Name = result.nameFormatter.Format(captures)
 
 			labels := prometheus.Labels{}
 			for index, formatter := range result.labelFormatters {
 				labels[result.labelKeys[index]] = formatter.Format(captures)
 			}
-			return result, labels, true
+			var outputs []Output
+			for i := range result.Outputs {
+				outputs = append(outputs, result.Outputs[i].format(captures))
+			}
+			return result, labels, outputs, true
 		} else if !m.doRegex {
 			// if there's no regex match type, return immediately
-			return nil, nil, false
+			return nil, nil, nil, false
 		}
 	}
 
 	// regex matching
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	return m.getRegexMapping(statsdMetric, statsdMetricType)
+}
 
+func (m *MetricMapper) getRegexMapping(statsdMetric string, statsdMetricType MetricType) (*MetricMapping, prometheus.Labels, []Output, bool) {
 	for _, mapping := range m.Mappings {
 		// if a rule don't have regex matching type, the regex field is unset
 		if mapping.regex == nil {
 			continue
 		}
 		matches := mapping.regex.FindStringSubmatchIndex(statsdMetric)
-		if len(matches) == 0 {
+		if len(matches) == 0 || mapping.excludes(statsdMetric) {
 			continue
 		}
 
@@ -268,8 +534,12 @@ func (m *MetricMapper) GetMapping(statsdMetric string, statsdMetricType MetricTy
 			labels[label] = string(value)
 		}
 
-		return &mapping, labels, true
+		var outputs []Output
+		for i := range mapping.Outputs {
+			outputs = append(outputs, mapping.Outputs[i].expand(mapping.regex, statsdMetric, matches))
+		}
+		return &mapping, labels, outputs, true
 	}
 
-	return nil, nil, false
+	return nil, nil, nil, false
 }
@@ -14,14 +14,20 @@
 package mapper
 
 import (
+	"bytes"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	yaml "gopkg.in/yaml.v2"
 )
 
 type mappings map[string]struct {
 	name       string
 	labels     map[string]string
-	quantiles  []metricObjective
+	quantiles  []MetricObjective
 	notPresent bool
 	ttl        time.Duration
 }
@@ -432,7 +438,7 @@ mappings:
 				"test.*.*": {
 					name:   "foo",
 					labels: map[string]string{},
-					quantiles: []metricObjective{
+					quantiles: []MetricObjective{
 						{Quantile: 0.42, Error: 0.04},
 						{Quantile: 0.7, Error: 0.002},
 					},
@@ -451,7 +457,7 @@ mappings:
 				"test1.*.*": {
 					name:   "foo",
 					labels: map[string]string{},
-					quantiles: []metricObjective{
+					quantiles: []MetricObjective{
 						{Quantile: 0.5, Error: 0.05},
 						{Quantile: 0.9, Error: 0.01},
 						{Quantile: 0.99, Error: 0.001},
@@ -665,6 +671,153 @@ mappings:
 				},
 			},
 		},
+		// Config with an unknown expiry action.
+		{
+			config: `mappings:
+- match: web.*
+  name: "web"
+  ttl: 5s
+  expiry_action: forget`,
+			configBad: true,
+		},
+		// Config with an unknown scrape action.
+		{
+			config: `mappings:
+- match: web.*
+  name: "web"
+  scrape_action: forget`,
+			configBad: true,
+		},
+		// Config with an empty value range.
+		{
+			config: `mappings:
+- match: web.*
+  name: "web"
+  min_value: 10
+  max_value: 1`,
+			configBad: true,
+		},
+		// Config with a negative rounding step.
+		{
+			config: `mappings:
+- match: web.*
+  name: "web"
+  round_to: -1`,
+			configBad: true,
+		},
+		// Config with an unknown out of range action.
+		{
+			config: `mappings:
+- match: web.*
+  name: "web"
+  max_value: 1
+  out_of_range: ignore`,
+			configBad: true,
+		},
+		// Config with an unknown host tag action.
+		{
+			config: `mappings:
+- match: web.*
+  name: "web"
+  host_tag: rename`,
+			configBad: true,
+		},
+		// Config with negative match patterns.
+		{
+			config: `mappings:
+- match: api.*.latency
+  not_match:
+  - api.healthcheck.latency
+  - api.*.latency.*
+  name: "api_latency"
+  labels:
+    endpoint: "$1"
+- match: api.*.*
+  name: "api_other"
+  labels:
+    endpoint: "$1"
+    kind: "$2"
+- match: db\.(\w+)\.latency
+  match_type: regex
+  not_match:
+  - ^db\.tmp_
+  name: "db_latency"
+  labels:
+    table: "$1"
+`,
+			mappings: mappings{
+				"api.users.latency": {
+					name: "api_latency",
+					labels: map[string]string{
+						"endpoint": "users",
+					},
+				},
+				"api.healthcheck.latency": {
+					name: "api_other",
+					labels: map[string]string{
+						"endpoint": "healthcheck",
+						"kind":     "latency",
+					},
+				},
+				"db.users.latency": {
+					name: "db_latency",
+					labels: map[string]string{
+						"table": "users",
+					},
+				},
+				"db.tmp_users.latency": {
+					notPresent: true,
+				},
+			},
+		},
+		// Config with negative match patterns falling through to a regex.
+		{
+			config: `defaults:
+  glob_disable_ordering: true
+mappings:
+- match: api.*.latency
+  not_match: [api.healthcheck.latency]
+  name: "api_latency"
+- match: api\.(\w+)\.latency
+  match_type: regex
+  not_match: [users]
+  name: "${1}_latency"
+`,
+			mappings: mappings{
+				"api.users.latency": {
+					name: "api_latency",
+				},
+				"api.healthcheck.latency": {
+					name: "healthcheck_latency",
+				},
+			},
+		},
+		// Config with an invalid negative glob.
+		{
+			config: `mappings:
+- match: api.*.latency
+  not_match: [api.**.latency]
+  name: "api_latency"`,
+			configBad: true,
+		},
+		// Config with an invalid negative regex.
+		{
+			config: `mappings:
+- match: api\.(\w+)\.latency
+  match_type: regex
+  not_match: ["api.(health"]
+  name: "api_latency"`,
+			configBad: true,
+		},
+		// Config with an invalid subsystem.
+		{
+			config: `mappings:
+- match: web.*
+  name: "web"
+  namespace: myorg
+  subsystem: front-end`,
+			configBad: true,
+		},
 	}
 
 	mapper := MetricMapper{}
@@ -754,6 +907,17 @@ mappings:
 			configBad:      false,
 			expectedAction: ActionTypeDrop,
 		},
+		{
+			// info action set
+			config: `---
+mappings:
+- match: test.*.*
+  name: "foo"
+  action: info
+`,
+			configBad:      false,
+			expectedAction: ActionTypeInfo,
+		},
 		{
 			// invalid action set
 			config: `---
@@ -785,3 +949,470 @@ mappings:
 		}
 	}
 }
+
+func TestValueLabel(t *testing.T) {
+	scenarios := []struct {
+		config     string
+		configBad  bool
+		wantFormat string
+	}{
+		{
+			config: `---
+mappings:
+- match: http.*.status
+  name: "http_responses"
+  value_label: code
+`,
+			wantFormat: "%g",
+		},
+		{
+			config: `---
+mappings:
+- match: http.*.status
+  name: "http_responses"
+  value_label: code
+  value_label_format: "%.0fxx"
+`,
+			wantFormat: "%.0fxx",
+		},
+		{
+			config: `---
+mappings:
+- match: http.*.status
+  name: "http_responses"
+  value_label: code
+  value_label_format: "%s %s"
+`,
+			configBad: true,
+		},
+		{
+			config: `---
+mappings:
+- match: http.*.status
+  name: "http_responses"
+  value_label: "a-b"
+`,
+			configBad: true,
+		},
+		{
+			config: `---
+mappings:
+- match: http.*.status
+  name: "http_responses"
+  value_label_format: "%g"
+`,
+			configBad: true,
+		},
+	}
+
+	for i, scenario := range scenarios {
+		mapper := MetricMapper{}
+		err := mapper.InitFromYAMLString(scenario.config)
+		if err != nil && !scenario.configBad {
+			t.Fatalf("%d. Config load error: %s %s", i, scenario.config, err)
+		}
+		if err == nil && scenario.configBad {
+			t.Fatalf("%d. Expected bad config, but loaded ok: %s", i, scenario.config)
+		}
+		if !scenario.configBad && mapper.Mappings[0].ValueLabelFormat != scenario.wantFormat {
+			t.Errorf("%d. Expected format %q, got %q", i, scenario.wantFormat, mapper.Mappings[0].ValueLabelFormat)
+		}
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	for rate, bad := range map[string]bool{"0.5": false, "1": false, "-0.1": true, "1.5": true} {
+		mapper := MetricMapper{}
+		err := mapper.InitFromYAMLString(`---
+mappings:
+- match: hot.*
+  name: "hot"
+  sample_rate: ` + rate + `
+`)
+		if err != nil && !bad {
+			t.Errorf("Sample rate %s should be valid, got %s", rate, err)
+		}
+		if err == nil && bad {
+			t.Errorf("Sample rate %s should be invalid", rate)
+		}
+	}
+}
+
+func TestParseQuantiles(t *testing.T) {
+	scenarios := []struct {
+		in   string
+		bad  bool
+		want []MetricObjective
+	}{
+		{
+			in:   "0.5:0.05,0.99:0.001",
+			want: []MetricObjective{{Quantile: 0.5, Error: 0.05}, {Quantile: 0.99, Error: 0.001}},
+		}, {
+			in:   " 0.9:0.01 ",
+			want: []MetricObjective{{Quantile: 0.9, Error: 0.01}},
+		},
+		{in: "0.5", bad: true},
+		{in: "1.5:0.01", bad: true},
+		{in: "0.5:x", bad: true},
+		{in: "0.5:0.05,", bad: true},
+	}
+
+	for i, scenario := range scenarios {
+		got, err := ParseQuantiles(scenario.in)
+		if scenario.bad {
+			if err == nil {
+				t.Fatalf("%d. Expected error parsing %q", i, scenario.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d. Unexpected error parsing %q: %s", i, scenario.in, err)
+		}
+		if !reflect.DeepEqual(got, scenario.want) {
+			t.Fatalf("%d. Expected %v, got %v", i, scenario.want, got)
+		}
+	}
+}
+
+func TestDefaultQuantiles(t *testing.T) {
+	quantiles := []MetricObjective{{Quantile: 0.75, Error: 0.02}}
+	mapper := MetricMapper{DefaultQuantiles: quantiles}
+
+	err := mapper.InitFromYAMLString(`---
+mappings:
+- match: test.*
+  name: "foo"
+`)
+	if err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	if !reflect.DeepEqual(mapper.Defaults.Quantiles, quantiles) {
+		t.Fatalf("Expected default quantiles %v, got %v", quantiles, mapper.Defaults.Quantiles)
+	}
+	if !reflect.DeepEqual(mapper.Mappings[0].Quantiles, quantiles) {
+		t.Fatalf("Expected mapping quantiles %v, got %v", quantiles, mapper.Mappings[0].Quantiles)
+	}
+
+	err = mapper.InitFromYAMLString(`---
+defaults:
+  quantiles:
+    - quantile: 0.5
+      error: 0.05
+`)
+	if err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	if len(mapper.Defaults.Quantiles) != 1 || mapper.Defaults.Quantiles[0].Quantile != 0.5 {
+		t.Fatalf("Expected quantiles from the config to take precedence, got %v", mapper.Defaults.Quantiles)
+	}
+}
+
+func TestDumpFSM(t *testing.T) {
+	mapper := MetricMapper{}
+	err := mapper.InitFromYAMLString(`---
+mappings:
+- match: test.*
+  name: "foo"
+`)
+	if err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := mapper.DumpFSM(&buf); err != nil {
+		t.Fatalf("Unexpected error dumping FSM: %s", err)
+	}
+	if !strings.Contains(buf.String(), `[label = "test"]`) {
+		t.Fatalf("Expected FSM to contain a transition for test, got %s", buf.String())
+	}
+
+	err = mapper.InitFromYAMLString(`---
+mappings:
+- match: other.*
+  name: "bar"
+`)
+	if err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	buf.Reset()
+	if err := mapper.DumpFSM(&buf); err != nil {
+		t.Fatalf("Unexpected error dumping FSM: %s", err)
+	}
+	if strings.Contains(buf.String(), `[label = "test"]`) || !strings.Contains(buf.String(), `[label = "other"]`) {
+		t.Fatalf("Expected FSM of the reloaded config, got %s", buf.String())
+	}
+
+	err = mapper.InitFromYAMLString(`---
+mappings:
+- match: other\.(.*)
+  match_type: regex
+  name: "bar"
+`)
+	if err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+	if err := mapper.DumpFSM(&buf); err == nil {
+		t.Fatalf("Expected an error without glob mappings")
+	}
+}
+
+func TestEscapeMetricName(t *testing.T) {
+	scenarios := map[string]string{
+		"clean":                   "clean",
+		"0starts_with_digit":      "_0starts_with_digit",
+		"with_underscore":         "with_underscore",
+		"with.dot":                "with_dot",
+		"with😱emoji":              "with_emoji",
+		"with.*.multiple":         "with___multiple",
+		"test.web-server.foo.bar": "test_web_server_foo_bar",
+	}
+
+	for in, want := range scenarios {
+		if got := EscapeMetricName(in); want != got {
+			t.Errorf("expected `%s` to be escaped to `%s`, got `%s`", in, want, got)
+		}
+	}
+}
+
+func TestEscapeMetricNameWithSeparator(t *testing.T) {
+	scenarios := map[string]string{
+		"clean":                   "clean",
+		"0starts.with_digit":      "_0starts:with_digit",
+		"with.dot":                "with:dot",
+		"with.*.multiple":         "with:_:multiple",
+		"test.web-server.foo.bar": "test:web_server:foo:bar",
+	}
+
+	for in, want := range scenarios {
+		if got := EscapeMetricNameWithSeparator(in, ":"); want != got {
+			t.Errorf("expected `%s` to be escaped to `%s`, got `%s`", in, want, got)
+		}
+	}
+	if got, want := EscapeMetricNameWithSeparator("with.dot", "_"), EscapeMetricName("with.dot"); got != want {
+		t.Errorf("expected `_` as separator to escape like EscapeMetricName, got `%s`", got)
+	}
+}
+
+func TestMappingOutputs(t *testing.T) {
+	config := `
+defaults:
+  ttl: 1m
+mappings:
+- match: api.*.duration
+  name: api_duration_seconds
+  timer_type: histogram
+  labels:
+    endpoint: $1
+  outputs:
+  - name: api_requests_total
+    count: true
+  - name: api_${1}_duration_seconds
+    timer_type: summary
+    ttl: 5m
+    labels: {}
+- match: db\.(\w+)\.duration
+  match_type: regex
+  name: db_duration_seconds
+  labels:
+    table: $1
+  outputs:
+  - name: db_queries_total
+    count: true
+    labels:
+      query_table: $1
+`
+	mapper := MetricMapper{}
+	if err := mapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+
+	_, _, outputs, present := mapper.GetMappingOutputs("api.users.duration", MetricTypeTimer)
+	if !present || len(outputs) != 2 {
+		t.Fatalf("Expected a mapping with 2 outputs, got %d", len(outputs))
+	}
+	count, summary := outputs[0], outputs[1]
+	if count.Mapping.Name != "api_requests_total" || !count.Count || count.Labels["endpoint"] != "users" {
+		t.Errorf("Unexpected counting output %s%v, count %v", count.Mapping.Name, count.Labels, count.Count)
+	}
+	if count.Mapping.TimerType != TimerTypeHistogram || count.Mapping.Ttl != time.Minute {
+		t.Errorf("Expected the counting output to inherit the settings of its mapping, got timer type %q and ttl %s", count.Mapping.TimerType, count.Mapping.Ttl)
+	}
+	if summary.Mapping.Name != "api_users_duration_seconds" || len(summary.Labels) != 0 {
+		t.Errorf("Unexpected summary output %s%v", summary.Mapping.Name, summary.Labels)
+	}
+	if summary.Mapping.TimerType != TimerTypeSummary || summary.Mapping.Ttl != 5*time.Minute {
+		t.Errorf("Expected the summary output to override the settings of its mapping, got timer type %q and ttl %s", summary.Mapping.TimerType, summary.Mapping.Ttl)
+	}
+
+	_, labels, outputs, present := mapper.GetMappingOutputs("db.users.duration", MetricTypeTimer)
+	if !present || len(outputs) != 1 || labels["table"] != "users" {
+		t.Fatalf("Expected a regex mapping with 1 output, got %d", len(outputs))
+	}
+	if outputs[0].Mapping.Name != "db_queries_total" || outputs[0].Labels["query_table"] != "users" || len(outputs[0].Labels) != 1 {
+		t.Errorf("Unexpected regex output %s%v", outputs[0].Mapping.Name, outputs[0].Labels)
+	}
+
+	out, err := yaml.Marshal(mapper.Config())
+	if err != nil {
+		t.Fatalf("Marshaling the config failed: %v", err)
+	}
+	if !strings.Contains(string(out), "count: true") {
+		t.Errorf("Expected the config to contain the counting output, got:\n%s", out)
+	}
+
+	for _, bad := range []string{
+		"mappings:\n- match: a.*\n  name: a\n  outputs:\n  - labels: {x: $1}\n",
+		"mappings:\n- match: a.*\n  name: a\n  outputs:\n  - name: b\n    match: b.*\n",
+		"mappings:\n- match: a.*\n  name: a\n  outputs:\n  - name: b-c\n",
+	} {
+		if err := (&MetricMapper{}).InitFromYAMLString(bad); err == nil {
+			t.Errorf("Expected an error for config %q", bad)
+		}
+	}
+}
+
+func TestScopedDefaults(t *testing.T) {
+	config := `
+defaults:
+  timer_type: histogram
+  ttl: 1m
+scoped_defaults:
+- match: db
+  buckets: [0.001, 0.01, 0.1]
+- match: http.*
+  buckets: [0.1, 1, 10]
+  ttl: 5m
+- match: http.admin
+  timer_type: summary
+mappings:
+- match: db.*.query
+  name: db_query_seconds
+- match: http.admin.request
+  name: http_admin_request_seconds
+- match: http.*.request
+  name: http_request_seconds
+- match: http.*.response
+  name: http_response_seconds
+  buckets: [1]
+- match: http\.(.*)
+  match_type: regex
+  name: http_regex_seconds
+- match: cache.*
+  name: cache_seconds
+`
+	mapper := MetricMapper{}
+	if err := mapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+
+	scenarios := []struct {
+		metric    string
+		timerType TimerType
+		buckets   []float64
+		ttl       time.Duration
+	}{
+		{"db.users.query", TimerTypeHistogram, []float64{0.001, 0.01, 0.1}, time.Minute},
+		{"http.users.request", TimerTypeHistogram, []float64{0.1, 1, 10}, 5 * time.Minute},
+		{"http.admin.request", TimerTypeSummary, []float64{0.1, 1, 10}, 5 * time.Minute},
+		{"http.users.response", TimerTypeHistogram, []float64{1}, 5 * time.Minute},
+		{"http.other.path.request", TimerTypeHistogram, prometheus.DefBuckets, time.Minute},
+		{"cache.hits", TimerTypeHistogram, prometheus.DefBuckets, time.Minute},
+	}
+	for _, scenario := range scenarios {
+		m, _, present := mapper.GetMapping(scenario.metric, MetricTypeTimer)
+		if !present {
+			t.Fatalf("%s: Expected a mapping", scenario.metric)
+		}
+		if m.TimerType != scenario.timerType || !reflect.DeepEqual(m.Buckets, scenario.buckets) || m.Ttl != scenario.ttl {
+			t.Errorf("%s: Expected timer type %q, buckets %v and ttl %s, got %q, %v and %s", scenario.metric, scenario.timerType, scenario.buckets, scenario.ttl, m.TimerType, m.Buckets, m.Ttl)
+		}
+	}
+
+	if err := mapper.InitFromYAMLString("scoped_defaults:\n- match: db..query\n"); err == nil {
+		t.Errorf("Expected an invalid scoped defaults match to fail")
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	config := `
+mappings:
+- match: api.*.*
+  name: api_requests_total
+  labels:
+    endpoint: $1
+    code: $2
+relabel_configs:
+- source_labels: [endpoint]
+  regex: healthcheck
+  action: drop
+- source_labels: [code]
+  regex: (\d)\d\d
+  target_label: code_class
+  replacement: ${1}xx
+- source_labels: [__name__, code_class]
+  regex: api_requests_total;5xx
+  target_label: __name__
+  replacement: api_errors_total
+- regex: tag_(.+)
+  replacement: $1
+  action: labelmap
+- source_labels: [code]
+  target_label: code
+  replacement: ""
+`
+	mapper := MetricMapper{}
+	if err := mapper.InitFromYAMLString(config); err != nil {
+		t.Fatalf("Config load error: %s", err)
+	}
+
+	scenarios := []struct {
+		name       string
+		labels     prometheus.Labels
+		dropped    bool
+		metricName string
+		expected   prometheus.Labels
+	}{
+		{
+			name:    "api_requests_total",
+			labels:  prometheus.Labels{"endpoint": "healthcheck", "code": "200"},
+			dropped: true,
+		},
+		{
+			name:       "api_requests_total",
+			labels:     prometheus.Labels{"endpoint": "users", "code": "200", "tag_team": "web"},
+			metricName: "api_requests_total",
+			expected:   prometheus.Labels{"endpoint": "users", "code_class": "2xx", "team": "web", "tag_team": "web"},
+		},
+		{
+			name:       "api_requests_total",
+			labels:     prometheus.Labels{"endpoint": "users", "code": "503"},
+			metricName: "api_errors_total",
+			expected:   prometheus.Labels{"endpoint": "users", "code_class": "5xx"},
+		},
+	}
+	for i, scenario := range scenarios {
+		name, labels, ok := mapper.Relabel(scenario.name, scenario.labels)
+		if ok == scenario.dropped {
+			t.Fatalf("%d. Expected dropped to be %v", i, scenario.dropped)
+		}
+		if scenario.dropped {
+			continue
+		}
+		if name != scenario.metricName {
+			t.Errorf("%d. Expected name %s, got %s", i, scenario.metricName, name)
+		}
+		if !reflect.DeepEqual(labels, scenario.expected) {
+			t.Errorf("%d. Expected labels %v, got %v", i, scenario.expected, labels)
+		}
+	}
+
+	for _, config := range []string{
+		"relabel_configs:\n- regex: (\n  target_label: a",
+		"relabel_configs:\n- source_labels: [a]\n  action: replace",
+		"relabel_configs:\n- action: keep",
+		"relabel_configs:\n- source_labels: [a]\n  action: hashmod",
+	} {
+		if err := mapper.InitFromYAMLString(config); err == nil {
+			t.Errorf("Expected bad relabel config, but loaded ok: %s", config)
+		}
+	}
+}
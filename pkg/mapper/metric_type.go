@@ -21,6 +21,7 @@ const (
 	MetricTypeCounter MetricType = "counter"
 	MetricTypeGauge   MetricType = "gauge"
 	MetricTypeTimer   MetricType = "timer"
+	MetricTypeSet     MetricType = "set"
 )
 
 func (m *MetricType) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -36,6 +37,8 @@ func (m *MetricType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		*m = MetricTypeGauge
 	case MetricTypeTimer:
 		*m = MetricTypeTimer
+	case MetricTypeSet:
+		*m = MetricTypeSet
 	default:
 		return fmt.Errorf("invalid metric type '%s'", v)
 	}
@@ -0,0 +1,101 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// globRegexp returns a regular expression matching the same metric names as
+// the glob, with a capture for every `*`.
+func globRegexp(glob string) *regexp.Regexp {
+	components := strings.Split(glob, ".")
+	for i, component := range components {
+		if component == "*" {
+			components[i] = `([^.]*)`
+		} else {
+			components[i] = regexp.QuoteMeta(component)
+		}
+	}
+	return regexp.MustCompile("^" + strings.Join(components, `\.`) + "$")
+}
+
+// initNotMatch compiles the not_match patterns of the mapping, which are
+// globs or regular expressions like its match.
+func (m *MetricMapping) initNotMatch() error {
+	m.notMatch = nil
+	for _, pattern := range m.NotMatch {
+		if m.MatchType == MatchTypeGlob {
+			if !metricLineRE.MatchString(pattern) {
+				return fmt.Errorf("invalid not_match: %s", pattern)
+			}
+			m.notMatch = append(m.notMatch, globRegexp(pattern))
+			continue
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid not_match regex %s in mapping: %v", pattern, err)
+		}
+		m.notMatch = append(m.notMatch, regex)
+	}
+	return nil
+}
+
+// excludes reports whether a not_match pattern of the mapping matches the
+// metric name.
+func (m *MetricMapping) excludes(statsdMetric string) bool {
+	for _, regex := range m.notMatch {
+		if regex.MatchString(statsdMetric) {
+			return true
+		}
+	}
+	return false
+}
+
+// getGlobMapping looks for the first glob mapping, in the order of the
+// config, matching the metric. The FSM only returns the best match, so when
+// that is excluded by not_match, the glob mappings are tried one by one.
+func (m *MetricMapper) getGlobMapping(statsdMetric string, statsdMetricType MetricType) (*MetricMapping, prometheus.Labels, []Output, bool) {
+	for i := range m.Mappings {
+		mapping := &m.Mappings[i]
+		if mapping.globRegex == nil {
+			continue
+		}
+		if mt := mapping.MatchMetricType; mt != "" && mt != statsdMetricType {
+			continue
+		}
+		matches := mapping.globRegex.FindStringSubmatch(statsdMetric)
+		if len(matches) == 0 || mapping.excludes(statsdMetric) {
+			continue
+		}
+		captures := matches[1:]
+
+		result := *mapping
+		result.Name = mapping.nameFormatter.Format(captures)
+		labels := prometheus.Labels{}
+		for index, formatter := range mapping.labelFormatters {
+			labels[mapping.labelKeys[index]] = formatter.Format(captures)
+		}
+		var outputs []Output
+		for i := range mapping.Outputs {
+			outputs = append(outputs, mapping.Outputs[i].format(captures))
+		}
+		return &result, labels, outputs, true
+	}
+	return nil, nil, nil, false
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper/fsm"
+)
+
+// MetricOutput is a metric a mapping emits for every event it matches, in
+// addition to its own. It takes the settings of the mapping, including its
+// labels, and overrides those it sets itself. Its name and labels can refer
+// to the captures of the match of the mapping.
+type MetricOutput struct {
+	// Count turns the events into counter increments of one, to count
+	// them instead of recording their values.
+	Count bool
+
+	raw     yaml.MapSlice
+	mapping MetricMapping
+}
+
+// Output is a metric to emit for an event, as returned by
+// GetMappingOutputs.
+type Output struct {
+	Mapping *MetricMapping
+	Labels  prometheus.Labels
+	Count   bool
+}
+
+func (o *MetricOutput) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw yaml.MapSlice
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	o.raw = raw[:0:0]
+	for _, item := range raw {
+		switch item.Key {
+		case "count":
+			count, ok := item.Value.(bool)
+			if !ok {
+				return fmt.Errorf("invalid count %v in output: must be a boolean", item.Value)
+			}
+			o.Count = count
+		case "match", "not_match", "match_type", "match_metric_type", "action", "outputs":
+			return fmt.Errorf("outputs cannot set %s", item.Key)
+		default:
+			o.raw = append(o.raw, item)
+		}
+	}
+	return nil
+}
+
+func (o MetricOutput) MarshalYAML() (interface{}, error) {
+	return struct {
+		MetricMapping `yaml:",inline"`
+		Count         bool `yaml:"count,omitempty"`
+	}{o.mapping, o.Count}, nil
+}
+
+// init resolves the settings of the output from those of its mapping.
+func (o *MetricOutput) init(parent *MetricMapping, captureCount int) error {
+	o.mapping = *parent
+	o.mapping.Name = ""
+	o.mapping.Outputs = nil
+	for _, item := range o.raw {
+		if item.Key == "labels" {
+			o.mapping.Labels = nil
+		}
+	}
+	out, err := yaml.Marshal(o.raw)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(out, &o.mapping); err != nil {
+		return fmt.Errorf("invalid output in mapping for %s: %v", parent.Match, err)
+	}
+	if o.mapping.Name == "" {
+		return fmt.Errorf("output in mapping for %s didn't set a metric name", parent.Match)
+	}
+	if err := o.mapping.validate(); err != nil {
+		return err
+	}
+
+	if parent.MatchType == MatchTypeGlob {
+		o.mapping.nameFormatter = fsm.NewTemplateFormatter(o.mapping.Name, captureCount)
+		o.mapping.labelKeys = make([]string, 0, len(o.mapping.Labels))
+		o.mapping.labelFormatters = make([]*fsm.TemplateFormatter, 0, len(o.mapping.Labels))
+		for label, valueExpr := range o.mapping.Labels {
+			o.mapping.labelKeys = append(o.mapping.labelKeys, label)
+			o.mapping.labelFormatters = append(o.mapping.labelFormatters, fsm.NewTemplateFormatter(valueExpr, captureCount))
+		}
+	}
+	return nil
+}
+
+// format returns the output for the captures of a glob match.
+func (o *MetricOutput) format(captures []string) Output {
+	mapping := o.mapping
+	mapping.Name = o.mapping.nameFormatter.Format(captures)
+	labels := prometheus.Labels{}
+	for i, formatter := range o.mapping.labelFormatters {
+		labels[o.mapping.labelKeys[i]] = formatter.Format(captures)
+	}
+	return Output{Mapping: &mapping, Labels: labels, Count: o.Count}
+}
+
+// expand returns the output for the matches of a regex match.
+func (o *MetricOutput) expand(regex *regexp.Regexp, statsdMetric string, matches []int) Output {
+	mapping := o.mapping
+	mapping.Name = string(regex.ExpandString([]byte{}, o.mapping.Name, statsdMetric, matches))
+	labels := prometheus.Labels{}
+	for label, valueExpr := range o.mapping.Labels {
+		labels[label] = string(regex.ExpandString([]byte{}, valueExpr, statsdMetric, matches))
+	}
+	return Output{Mapping: &mapping, Labels: labels, Count: o.Count}
+}
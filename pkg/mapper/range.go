@@ -0,0 +1,45 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import "fmt"
+
+// OutOfRangeAction is what happens to values outside of the range of a
+// mapping.
+type OutOfRangeAction string
+
+const (
+	// OutOfRangeClamp replaces the value by the nearest bound.
+	OutOfRangeClamp OutOfRangeAction = "clamp"
+	// OutOfRangeDrop drops the event.
+	OutOfRangeDrop    OutOfRangeAction = "drop"
+	OutOfRangeDefault OutOfRangeAction = ""
+)
+
+func (a *OutOfRangeAction) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch OutOfRangeAction(v) {
+	case OutOfRangeDrop:
+		*a = OutOfRangeDrop
+	case OutOfRangeClamp, OutOfRangeDefault:
+		*a = OutOfRangeClamp
+	default:
+		return fmt.Errorf("invalid out of range action %q", v)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RelabelAction is what a relabel config does with the metrics it matches.
+type RelabelAction string
+
+const (
+	// RelabelReplace sets the target label to the replacement, expanded
+	// with the captures of the regex.
+	RelabelReplace RelabelAction = "replace"
+	// RelabelKeep drops the metrics whose source labels don't match.
+	RelabelKeep RelabelAction = "keep"
+	// RelabelDrop drops the metrics whose source labels match.
+	RelabelDrop RelabelAction = "drop"
+	// RelabelLabelMap copies the labels whose names match to the names
+	// given by the replacement.
+	RelabelLabelMap RelabelAction = "labelmap"
+)
+
+// MetricNameLabel is the label holding the metric name while relabeling.
+const MetricNameLabel = "__name__"
+
+// RelabelConfig is a step of the relabeling of mapped metrics, like the
+// relabel configs of Prometheus.
+type RelabelConfig struct {
+	SourceLabels []string      `yaml:"source_labels,flow,omitempty"`
+	Separator    string        `yaml:"separator"`
+	Regex        string        `yaml:"regex"`
+	TargetLabel  string        `yaml:"target_label,omitempty"`
+	Replacement  string        `yaml:"replacement"`
+	Action       RelabelAction `yaml:"action"`
+
+	regex *regexp.Regexp
+}
+
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain RelabelConfig
+	config := plain{
+		Separator:   ";",
+		Regex:       "(.*)",
+		Replacement: "$1",
+		Action:      RelabelReplace,
+	}
+	if err := unmarshal(&config); err != nil {
+		return err
+	}
+	*c = RelabelConfig(config)
+	return nil
+}
+
+func (c *RelabelConfig) init() error {
+	regex, err := regexp.Compile("^(?:" + c.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid relabel regex %s: %v", c.Regex, err)
+	}
+	c.regex = regex
+
+	switch c.Action {
+	case RelabelReplace:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %s requires a target label", c.Action)
+		}
+	case RelabelKeep, RelabelDrop:
+		if len(c.SourceLabels) == 0 {
+			return fmt.Errorf("relabel action %s requires source labels", c.Action)
+		}
+	case RelabelLabelMap:
+	default:
+		return fmt.Errorf("invalid relabel action %q", c.Action)
+	}
+	return nil
+}
+
+// Relabel applies the relabel configs of the mapping config to the name and
+// labels of a metric, and reports whether the metric is kept. Labels whose
+// name starts with two underscores are removed afterwards.
+func (m *MetricMapper) Relabel(metricName string, labels prometheus.Labels) (string, prometheus.Labels, bool) {
+	m.mutex.Lock()
+	configs := m.RelabelConfigs
+	m.mutex.Unlock()
+	if len(configs) == 0 {
+		return metricName, labels, true
+	}
+
+	relabeled := make(prometheus.Labels, len(labels)+1)
+	for label, value := range labels {
+		relabeled[label] = value
+	}
+	relabeled[MetricNameLabel] = metricName
+
+	for i := range configs {
+		if !configs[i].apply(relabeled) {
+			return "", nil, false
+		}
+	}
+
+	metricName = relabeled[MetricNameLabel]
+	if metricName == "" {
+		return "", nil, false
+	}
+	for label := range relabeled {
+		if strings.HasPrefix(label, "__") {
+			delete(relabeled, label)
+		}
+	}
+	return EscapeMetricName(metricName), relabeled, true
+}
+
+func (c *RelabelConfig) apply(labels prometheus.Labels) bool {
+	values := make([]string, 0, len(c.SourceLabels))
+	for _, label := range c.SourceLabels {
+		values = append(values, labels[label])
+	}
+	value := strings.Join(values, c.Separator)
+
+	switch c.Action {
+	case RelabelKeep:
+		return c.regex.MatchString(value)
+	case RelabelDrop:
+		return !c.regex.MatchString(value)
+	case RelabelReplace:
+		matches := c.regex.FindStringSubmatchIndex(value)
+		if matches == nil {
+			return true
+		}
+		target := string(c.regex.ExpandString(nil, c.TargetLabel, value, matches))
+		if target != MetricNameLabel && !labelNameRE.MatchString(target) {
+			return true
+		}
+		replacement := string(c.regex.ExpandString(nil, c.Replacement, value, matches))
+		if replacement == "" {
+			delete(labels, target)
+		} else {
+			labels[target] = replacement
+		}
+	case RelabelLabelMap:
+		mapped := prometheus.Labels{}
+		for label, value := range labels {
+			if c.regex.MatchString(label) {
+				mapped[c.regex.ReplaceAllString(label, c.Replacement)] = value
+			}
+		}
+		for label, value := range mapped {
+			labels[label] = value
+		}
+	}
+	return true
+}
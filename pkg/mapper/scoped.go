@@ -0,0 +1,121 @@
+// Copyright 2018 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var scopeRE = regexp.MustCompile(`^(\*|` + statsdMetricRE + `)(\.(\*|` + statsdMetricRE + `))*$`)
+
+// ScopedDefaults are defaults of the glob mappings whose match starts with
+// the components of Match, e.g. `db` or `http.*`. The settings they set
+// override the global defaults.
+type ScopedDefaults struct {
+	Match             string            `yaml:"match"`
+	TimerType         TimerType         `yaml:"timer_type,omitempty"`
+	Buckets           []float64         `yaml:"buckets,omitempty"`
+	Quantiles         []MetricObjective `yaml:"quantiles,omitempty"`
+	QuantileAlgorithm QuantileAlgorithm `yaml:"quantile_algorithm,omitempty"`
+	Ttl               time.Duration     `yaml:"ttl,omitempty"`
+	TtlType           TtlType           `yaml:"ttl_type,omitempty"`
+	ExpiryAction      ExpiryAction      `yaml:"expiry_action,omitempty"`
+	ExpiryGrace       time.Duration     `yaml:"expiry_grace,omitempty"`
+	ScrapeAction      ScrapeAction      `yaml:"scrape_action,omitempty"`
+	HostTag           HostTagAction     `yaml:"host_tag,omitempty"`
+	SetWindow         time.Duration     `yaml:"set_window,omitempty"`
+	SetMaxElements    int               `yaml:"set_max_elements,omitempty"`
+}
+
+func (s *ScopedDefaults) validate() error {
+	if !scopeRE.MatchString(s.Match) {
+		return fmt.Errorf("invalid scoped defaults match: %s", s.Match)
+	}
+	return nil
+}
+
+// covers reports whether the components of a glob match start with those of
+// the scope. A `*` of the scope covers any component.
+func (s *ScopedDefaults) covers(match string) bool {
+	scope := strings.Split(s.Match, ".")
+	components := strings.Split(match, ".")
+	if len(components) < len(scope) {
+		return false
+	}
+	for i, component := range scope {
+		if component != "*" && component != components[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// scoped returns the defaults overridden by the settings of the scope.
+func (d mapperConfigDefaults) scoped(s *ScopedDefaults) mapperConfigDefaults {
+	if s.TimerType != TimerTypeDefault {
+		d.TimerType = s.TimerType
+	}
+	if len(s.Buckets) > 0 {
+		d.Buckets = s.Buckets
+	}
+	if len(s.Quantiles) > 0 {
+		d.Quantiles = s.Quantiles
+	}
+	if s.QuantileAlgorithm != QuantileAlgorithmDefault {
+		d.QuantileAlgorithm = s.QuantileAlgorithm
+	}
+	if s.Ttl > 0 {
+		d.Ttl = s.Ttl
+	}
+	if s.TtlType != TtlTypeDefault {
+		d.TtlType = s.TtlType
+	}
+	if s.ExpiryAction != ExpiryActionDefault {
+		d.ExpiryAction = s.ExpiryAction
+	}
+	if s.ExpiryGrace > 0 {
+		d.ExpiryGrace = s.ExpiryGrace
+	}
+	if s.ScrapeAction != ScrapeActionDefault {
+		d.ScrapeAction = s.ScrapeAction
+	}
+	if s.HostTag != HostTagDefault {
+		d.HostTag = s.HostTag
+	}
+	if s.SetWindow > 0 {
+		d.SetWindow = s.SetWindow
+	}
+	if s.SetMaxElements > 0 {
+		d.SetMaxElements = s.SetMaxElements
+	}
+	return d
+}
+
+// defaultsFor returns the defaults of a mapping, applying the scoped
+// defaults covering it in order.
+func (m *MetricMapper) defaultsFor(mapping *MetricMapping) mapperConfigDefaults {
+	defaults := m.Defaults
+	if mapping.MatchType != MatchTypeGlob {
+		return defaults
+	}
+	for i := range m.ScopedDefaults {
+		if m.ScopedDefaults[i].covers(mapping.Match) {
+			defaults = defaults.scoped(&m.ScopedDefaults[i])
+		}
+	}
+	return defaults
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// defaultSuggesterMaxNames bounds the memory used by a Suggester.
+	defaultSuggesterMaxNames = 10000
+	// defaultSuggesterMinVariants is the number of different values a
+	// segment needs to have among otherwise equal names to be considered
+	// variable.
+	defaultSuggesterMinVariants = 3
+)
+
+var (
+	segmentRE = regexp.MustCompile(`^` + statsdMetricRE + `$`)
+	// idRE matches segments that look like hexadecimal IDs or UUIDs.
+	idRE = regexp.MustCompile(`^[0-9a-fA-F-]{8,}$`)
+)
+
+// Suggester records metric names and suggests glob mappings for them, turning
+// the segments that vary between otherwise equal names into labels.
+type Suggester struct {
+	// MaxNames is the maximum number of distinct names recorded. Defaults
+	// to 10000.
+	MaxNames int
+	// MinVariants is the number of different values a segment needs to
+	// have among otherwise equal names to become a label. Defaults to 3.
+	MinVariants int
+
+	mtx   sync.Mutex
+	names map[string]struct{}
+}
+
+// SuggestedMapping is a mapping suggested by a Suggester.
+type SuggestedMapping struct {
+	Match  string            `yaml:"match"`
+	Name   string            `yaml:"name"`
+	Labels prometheus.Labels `yaml:"labels"`
+}
+
+// RecordUnmapped records the name of a metric without mapping.
+func (s *Suggester) RecordUnmapped(metricName string) {
+	max := s.MaxNames
+	if max == 0 {
+		max = defaultSuggesterMaxNames
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.names == nil {
+		s.names = map[string]struct{}{}
+	}
+	if len(s.names) < max {
+		s.names[metricName] = struct{}{}
+	}
+}
+
+// Suggest returns mappings for the recorded names that have variable
+// segments, sorted by their match.
+func (s *Suggester) Suggest() []SuggestedMapping {
+	minVariants := s.MinVariants
+	if minVariants == 0 {
+		minVariants = defaultSuggesterMinVariants
+	}
+
+	// Patterns are grouped by their number of segments, as only patterns
+	// of equal length can be generalized into each other.
+	patterns := map[int][][]string{}
+	s.mtx.Lock()
+	for name := range s.names {
+		segments := strings.Split(name, ".")
+		if len(segments) < 2 {
+			continue
+		}
+		for i, segment := range segments {
+			if !segmentRE.MatchString(segment) || (idRE.MatchString(segment) && strings.ContainsAny(segment, "0123456789")) {
+				segments[i] = "*"
+			}
+		}
+		patterns[len(segments)] = append(patterns[len(segments)], segments)
+	}
+	s.mtx.Unlock()
+
+	var mappings []SuggestedMapping
+	for length, group := range patterns {
+		for generalize(group, length, minVariants) {
+		}
+		seen := map[string]bool{}
+		for _, segments := range group {
+			match := strings.Join(segments, ".")
+			if seen[match] || !strings.Contains(match, "*") {
+				continue
+			}
+			seen[match] = true
+			if m, ok := suggestMapping(segments); ok {
+				mappings = append(mappings, m)
+			}
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].Match < mappings[j].Match })
+	return mappings
+}
+
+// SuggestYAML returns the suggested mappings as mapping config.
+func (s *Suggester) SuggestYAML() ([]byte, error) {
+	return yaml.Marshal(struct {
+		Mappings []SuggestedMapping `yaml:"mappings"`
+	}{s.Suggest()})
+}
+
+// generalize replaces a segment with a wildcard in all patterns that are
+// equal except for that segment, if it has at least minVariants values among
+// them. It reports whether any pattern was changed.
+func generalize(patterns [][]string, length, minVariants int) bool {
+	changed := false
+	for i := 0; i < length; i++ {
+		variants := map[string]map[string]bool{}
+		for _, segments := range patterns {
+			key := strings.Join(segments[:i], ".") + "\xff" + strings.Join(segments[i+1:], ".")
+			if variants[key] == nil {
+				variants[key] = map[string]bool{}
+			}
+			variants[key][segments[i]] = true
+		}
+		for _, segments := range patterns {
+			if segments[i] == "*" {
+				continue
+			}
+			key := strings.Join(segments[:i], ".") + "\xff" + strings.Join(segments[i+1:], ".")
+			if len(variants[key]) >= minVariants && hasLiteral(segments, i) {
+				segments[i] = "*"
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// hasLiteral reports whether segments has a literal segment other than the
+// one at skip, so that the pattern is not generalized to match everything.
+func hasLiteral(segments []string, skip int) bool {
+	for i, segment := range segments {
+		if i != skip && segment != "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestMapping builds the mapping for a pattern. The metric name consists of
+// the literal segments, and every wildcard becomes a label named after the
+// preceding literal segment.
+func suggestMapping(segments []string) (SuggestedMapping, bool) {
+	var nameParts []string
+	labels := prometheus.Labels{}
+	wildcard := 0
+	for i, segment := range segments {
+		if segment != "*" {
+			nameParts = append(nameParts, segment)
+			continue
+		}
+		wildcard++
+		label := fmt.Sprintf("label%d", wildcard)
+		if i > 0 && segments[i-1] != "*" {
+			if l := EscapeMetricName(segments[i-1]); labels[l] == "" {
+				label = l
+			}
+		}
+		labels[label] = fmt.Sprintf("$%d", wildcard)
+	}
+	if len(nameParts) == 0 {
+		return SuggestedMapping{}, false
+	}
+	return SuggestedMapping{
+		Match:  strings.Join(segments, "."),
+		Name:   EscapeMetricName(strings.Join(nameParts, "_")),
+		Labels: labels,
+	}, true
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSuggester(t *testing.T) {
+	s := &Suggester{}
+	for _, name := range []string{
+		"api.web01.requests",
+		"api.web02.requests",
+		"api.web03.requests",
+		"api.web01.errors",
+		"jobs.1234.duration",
+		"jobs.5678.duration",
+		"cache.3f2a9c1e7b.hits",
+		"cache.3f2a9c1e7b.misses",
+		"db.queries",
+		"uptime",
+	} {
+		s.RecordUnmapped(name)
+	}
+
+	want := []SuggestedMapping{
+		{Match: "api.*.requests", Name: "api_requests", Labels: prometheus.Labels{"api": "$1"}},
+		{Match: "cache.*.hits", Name: "cache_hits", Labels: prometheus.Labels{"cache": "$1"}},
+		{Match: "cache.*.misses", Name: "cache_misses", Labels: prometheus.Labels{"cache": "$1"}},
+		{Match: "jobs.*.duration", Name: "jobs_duration", Labels: prometheus.Labels{"jobs": "$1"}},
+	}
+	if got := s.Suggest(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected suggestions %v, got %v", want, got)
+	}
+
+	config, err := s.SuggestYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &MetricMapper{}
+	if err := m.InitFromYAMLString(string(config)); err != nil {
+		t.Fatalf("Suggested config is invalid: %v\n%s", err, config)
+	}
+	mapping, labels, present := m.GetMapping("api.web04.requests", MetricTypeCounter)
+	if !present || mapping.Name != "api_requests" || labels["api"] != "web04" {
+		t.Errorf("Suggested config does not map api.web04.requests: %v %v", mapping, labels)
+	}
+}
+
+func TestSuggesterMaxNames(t *testing.T) {
+	s := &Suggester{MaxNames: 2, MinVariants: 2}
+	for _, name := range []string{"aa.x1.bb", "aa.x2.bb", "aa.x3.cc", "aa.x4.cc"} {
+		s.RecordUnmapped(name)
+	}
+	if got := s.Suggest(); len(got) != 1 || got[0].Match != "aa.*.bb" {
+		t.Errorf("Expected only aa.*.bb to be suggested, got %v", got)
+	}
+}
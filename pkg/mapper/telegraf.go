@@ -0,0 +1,205 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TelegrafMapping is a mapping converted from a template of Telegraf's statsd
+// input.
+type TelegrafMapping struct {
+	Match     string            `yaml:"match"`
+	MatchType MatchType         `yaml:"match_type,omitempty"`
+	Name      string            `yaml:"name"`
+	Labels    prometheus.Labels `yaml:"labels,omitempty"`
+
+	// literals is the number of literal filter components, more specific
+	// mappings are tried first.
+	literals int
+}
+
+// ConvertTelegrafTemplates converts templates of Telegraf's statsd input,
+// e.g. "cpu.* measurement.measurement.region env=prod", into mappings. Like
+// Telegraf's Prometheus output, the measurement and field are joined into the
+// metric name, leaving out the field if there is none. Mappings with more
+// literal filter components come first, as Telegraf prefers the most specific
+// filter.
+//
+// Names must have as many components as the template, or the filter if it is
+// longer, unless the last template part is greedy (measurement* or field*);
+// such templates become regular expression mappings. Filters can only use
+// wildcards for whole components.
+func ConvertTelegrafTemplates(templates []string) ([]TelegrafMapping, error) {
+	var mappings []TelegrafMapping
+	for _, t := range templates {
+		m, err := convertTelegrafTemplate(t)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %v", t, err)
+		}
+		mappings = append(mappings, m)
+	}
+	sort.SliceStable(mappings, func(i, j int) bool { return mappings[i].literals > mappings[j].literals })
+	return mappings, nil
+}
+
+// ConvertTelegrafTemplatesYAML reads templates, one per line, and returns the
+// converted mappings as mapping config. Blank lines and comments are skipped,
+// so are the quotes, commas and brackets of the templates setting copied from
+// a Telegraf config.
+func ConvertTelegrafTemplatesYAML(r io.Reader) ([]byte, error) {
+	var templates []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		t := strings.Trim(strings.TrimSpace(scanner.Text()), `",`)
+		if t == "" || strings.HasPrefix(t, "#") || t == "]" || strings.HasPrefix(t, "templates") && strings.HasSuffix(t, "[") {
+			continue
+		}
+		templates = append(templates, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	mappings, err := ConvertTelegrafTemplates(templates)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(struct {
+		Mappings []TelegrafMapping `yaml:"mappings"`
+	}{mappings})
+}
+
+func convertTelegrafTemplate(t string) (TelegrafMapping, error) {
+	var filter, template, tags string
+	fields := strings.Fields(t)
+	switch {
+	case len(fields) == 1:
+		template = fields[0]
+	case len(fields) == 2 && strings.Contains(fields[1], "="):
+		template, tags = fields[0], fields[1]
+	case len(fields) == 2:
+		filter, template = fields[0], fields[1]
+	case len(fields) == 3:
+		filter, template, tags = fields[0], fields[1], fields[2]
+	default:
+		return TelegrafMapping{}, fmt.Errorf("expected [filter] template [tags]")
+	}
+
+	parts := strings.Split(template, ".")
+	var filterParts []string
+	if filter != "" {
+		filterParts = strings.Split(filter, ".")
+	}
+	greedy := strings.HasSuffix(parts[len(parts)-1], "*")
+	length := len(parts)
+	if len(filterParts) > length && !greedy {
+		length = len(filterParts)
+	}
+
+	m := TelegrafMapping{Labels: prometheus.Labels{}}
+	var match []string
+	var measurement, field []string
+	tagValues := map[string][]string{}
+	var tagOrder []string
+	captures := 0
+	for i := 0; i < length; i++ {
+		part := ""
+		if i < len(parts) {
+			part = parts[i]
+		}
+		if strings.HasSuffix(part, "*") && i != len(parts)-1 {
+			return TelegrafMapping{}, fmt.Errorf("only the last part can be greedy")
+		}
+
+		// The value of the part is either a literal filter component, or a
+		// capture of the match.
+		var value string
+		literal := i < len(filterParts) && filterParts[i] != "*"
+		switch {
+		case literal && strings.ContainsAny(filterParts[i], "*?[]"):
+			return TelegrafMapping{}, fmt.Errorf("filter component %q is not a literal or *", filterParts[i])
+		case literal && greedy:
+			match = append(match, regexp.QuoteMeta(filterParts[i]))
+			value = filterParts[i]
+			m.literals++
+		case literal:
+			match = append(match, filterParts[i])
+			value = filterParts[i]
+			m.literals++
+		case greedy && strings.HasSuffix(part, "*"):
+			captures++
+			match = append(match, "(.+)")
+			value = fmt.Sprintf("${%d}", captures)
+		case greedy:
+			captures++
+			match = append(match, `([^.]+)`)
+			value = fmt.Sprintf("${%d}", captures)
+		default:
+			captures++
+			match = append(match, "*")
+			value = fmt.Sprintf("${%d}", captures)
+		}
+
+		switch strings.TrimSuffix(part, "*") {
+		case "":
+		case "measurement":
+			measurement = append(measurement, value)
+		case "field":
+			field = append(field, value)
+		default:
+			if strings.HasSuffix(part, "*") {
+				return TelegrafMapping{}, fmt.Errorf("tag %q cannot be greedy", part)
+			}
+			if _, ok := tagValues[part]; !ok {
+				tagOrder = append(tagOrder, part)
+			}
+			tagValues[part] = append(tagValues[part], value)
+		}
+	}
+	if len(measurement) == 0 {
+		return TelegrafMapping{}, fmt.Errorf("template without measurement")
+	}
+
+	m.Name = strings.Join(measurement, "_")
+	if len(field) > 0 {
+		m.Name += "_" + strings.Join(field, "_")
+	}
+	if greedy {
+		m.Match = "^" + strings.Join(match, `\.`) + "$"
+		m.MatchType = MatchTypeRegex
+	} else {
+		m.Match = strings.Join(match, ".")
+	}
+	for _, tag := range tagOrder {
+		m.Labels[EscapeMetricName(tag)] = strings.Join(tagValues[tag], "_")
+	}
+	if tags != "" {
+		for _, kv := range strings.Split(tags, ",") {
+			pair := strings.SplitN(kv, "=", 2)
+			if len(pair) != 2 || pair[0] == "" {
+				return TelegrafMapping{}, fmt.Errorf("bad tag %q", kv)
+			}
+			m.Labels[EscapeMetricName(pair[0])] = pair[1]
+		}
+	}
+	return m, nil
+}
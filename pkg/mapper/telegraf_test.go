@@ -0,0 +1,82 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestConvertTelegrafTemplates(t *testing.T) {
+	config, err := ConvertTelegrafTemplatesYAML(strings.NewReader(`
+# Copied from telegraf.conf
+templates = [
+  "measurement.measurement.region",
+  "cpu.* measurement.host.field env=prod",
+  "mem.* measurement.field*",
+]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &MetricMapper{}
+	if err := m.InitFromYAMLString(string(config)); err != nil {
+		t.Fatalf("Converted config is invalid: %v\n%s", err, config)
+	}
+
+	scenarios := []struct {
+		name   string
+		want   string
+		labels prometheus.Labels
+	}{
+		{"api.requests.eu", "api_requests", prometheus.Labels{"region": "eu"}},
+		{"cpu.web1.idle", "cpu_idle", prometheus.Labels{"host": "web1", "env": "prod"}},
+		{"mem.heap.used.bytes", "mem_heap.used.bytes", prometheus.Labels{}},
+	}
+	for _, s := range scenarios {
+		mapping, labels, present := m.GetMapping(s.name, MetricTypeGauge)
+		if !present {
+			t.Errorf("%s: no mapping in\n%s", s.name, config)
+			continue
+		}
+		if mapping.Name != s.want {
+			t.Errorf("%s: expected name %q, got %q", s.name, s.want, mapping.Name)
+		}
+		if len(labels) != len(s.labels) {
+			t.Errorf("%s: expected labels %v, got %v", s.name, s.labels, labels)
+		}
+		for k, v := range s.labels {
+			if labels[k] != v {
+				t.Errorf("%s: expected labels %v, got %v", s.name, s.labels, labels)
+			}
+		}
+	}
+}
+
+func TestConvertTelegrafTemplatesErrors(t *testing.T) {
+	for _, template := range []string{
+		"host.field",
+		"measurement*.field",
+		"measurement.host*",
+		"cp?.* measurement.field",
+		"measurement.field env",
+		"a b c d",
+	} {
+		if _, err := ConvertTelegrafTemplates([]string{template}); err == nil {
+			t.Errorf("Expected an error converting %q", template)
+		}
+	}
+}
@@ -20,6 +20,7 @@ type TimerType string
 const (
 	TimerTypeHistogram TimerType = "histogram"
 	TimerTypeSummary   TimerType = "summary"
+	TimerTypeSketch    TimerType = "sketch"
 	TimerTypeDefault   TimerType = ""
 )
 
@@ -32,6 +33,8 @@ func (t *TimerType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	switch TimerType(v) {
 	case TimerTypeHistogram:
 		*t = TimerTypeHistogram
+	case TimerTypeSketch:
+		*t = TimerTypeSketch
 	case TimerTypeSummary, TimerTypeDefault:
 		*t = TimerTypeSummary
 	default:
@@ -39,3 +42,34 @@ func (t *TimerType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 	return nil
 }
+
+// QuantileAlgorithm selects how summary timers estimate their quantiles.
+type QuantileAlgorithm string
+
+const (
+	// QuantileAlgorithmTargeted maintains the configured quantiles with
+	// their absolute errors, like client_golang summaries.
+	QuantileAlgorithmTargeted QuantileAlgorithm = "targeted"
+	// QuantileAlgorithmBiased maintains all quantiles with an error
+	// relative to their distance from the maximum, which is cheaper for
+	// high-throughput timers.
+	QuantileAlgorithmBiased  QuantileAlgorithm = "biased"
+	QuantileAlgorithmDefault QuantileAlgorithm = ""
+)
+
+func (a *QuantileAlgorithm) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch QuantileAlgorithm(v) {
+	case QuantileAlgorithmBiased:
+		*a = QuantileAlgorithmBiased
+	case QuantileAlgorithmTargeted, QuantileAlgorithmDefault:
+		*a = QuantileAlgorithmTargeted
+	default:
+		return fmt.Errorf("invalid quantile algorithm '%s'", v)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapper
+
+import "fmt"
+
+type TtlType string
+
+const (
+	// TtlTypeSliding expires a series ttl after its last update.
+	TtlTypeSliding TtlType = "sliding"
+	// TtlTypeFixed expires a series ttl after it was first seen,
+	// regardless of updates.
+	TtlTypeFixed   TtlType = "fixed"
+	TtlTypeDefault TtlType = ""
+)
+
+func (t *TtlType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch TtlType(v) {
+	case TtlTypeFixed:
+		*t = TtlTypeFixed
+	case TtlTypeSliding, TtlTypeDefault:
+		*t = TtlTypeSliding
+	default:
+		return fmt.Errorf("invalid ttl type '%s'", v)
+	}
+	return nil
+}
+
+// ExpiryAction is what happens to a series once its ttl has passed.
+type ExpiryAction string
+
+const (
+	// ExpiryActionDelete removes the series.
+	ExpiryActionDelete ExpiryAction = "delete"
+	// ExpiryActionZero resets the series to zero, and only removes it once
+	// the expiry grace period has passed as well.
+	ExpiryActionZero    ExpiryAction = "zero"
+	ExpiryActionDefault ExpiryAction = ""
+)
+
+func (a *ExpiryAction) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch ExpiryAction(v) {
+	case ExpiryActionZero:
+		*a = ExpiryActionZero
+	case ExpiryActionDelete, ExpiryActionDefault:
+		*a = ExpiryActionDelete
+	default:
+		return fmt.Errorf("invalid expiry action '%s'", v)
+	}
+	return nil
+}
+
+// ScrapeAction is what happens to a series after every successful scrape,
+// like the deleteCounters and deleteGauges settings of StatsD.
+type ScrapeAction string
+
+const (
+	// ScrapeActionNone keeps the series.
+	ScrapeActionNone ScrapeAction = "none"
+	// ScrapeActionDelete removes the series until its next event.
+	ScrapeActionDelete ScrapeAction = "delete"
+	// ScrapeActionZero resets the series to zero.
+	ScrapeActionZero    ScrapeAction = "zero"
+	ScrapeActionDefault ScrapeAction = ""
+)
+
+func (a *ScrapeAction) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch ScrapeAction(v) {
+	case ScrapeActionDelete:
+		*a = ScrapeActionDelete
+	case ScrapeActionZero:
+		*a = ScrapeActionZero
+	case ScrapeActionNone, ScrapeActionDefault:
+		*a = ScrapeActionNone
+	default:
+		return fmt.Errorf("invalid scrape action '%s'", v)
+	}
+	return nil
+}
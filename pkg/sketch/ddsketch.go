@@ -0,0 +1,175 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sketch implements DDSketch, a mergeable quantile sketch with
+// relative-error guarantees, see https://arxiv.org/abs/1908.10693.
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DDSketch summarizes a stream of values in logarithmically sized buckets.
+// Every quantile it returns is within the configured relative accuracy of
+// the true value, as long as the number of buckets stays below the limit.
+// Once the limit is reached, the lowest buckets are collapsed, so that
+// accuracy is only lost for the lowest quantiles.
+//
+// DDSketch is not safe for concurrent use.
+type DDSketch struct {
+	gamma      float64
+	logGamma   float64
+	maxBuckets int
+
+	positive map[int]uint64
+	negative map[int]uint64
+	zero     uint64
+	count    uint64
+	sum      float64
+}
+
+// NewDDSketch returns an empty DDSketch with the given relative accuracy
+// (e.g. 0.01 for 1%) and maximum number of buckets per sign.
+func NewDDSketch(relativeAccuracy float64, maxBuckets int) (*DDSketch, error) {
+	if relativeAccuracy <= 0 || relativeAccuracy >= 1 {
+		return nil, fmt.Errorf("relative accuracy must be between 0 and 1, got %v", relativeAccuracy)
+	}
+	if maxBuckets < 1 {
+		return nil, fmt.Errorf("max buckets must be positive, got %d", maxBuckets)
+	}
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &DDSketch{
+		gamma:      gamma,
+		logGamma:   math.Log(gamma),
+		maxBuckets: maxBuckets,
+		positive:   map[int]uint64{},
+		negative:   map[int]uint64{},
+	}, nil
+}
+
+// minIndexableValue is the smallest magnitude that gets its own bucket,
+// smaller values are counted as zero.
+const minIndexableValue = 1e-9
+
+func (s *DDSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+func (s *DDSketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (1 + s.gamma)
+}
+
+// Add records a single value.
+func (s *DDSketch) Add(v float64) {
+	switch {
+	case v > minIndexableValue:
+		s.addToStore(s.positive, s.index(v))
+	case v < -minIndexableValue:
+		s.addToStore(s.negative, s.index(-v))
+	default:
+		s.zero++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (s *DDSketch) addToStore(store map[int]uint64, index int) {
+	store[index]++
+	if len(store) > s.maxBuckets {
+		collapseLowest(store, s.maxBuckets)
+	}
+}
+
+// collapseLowest merges the lowest buckets of store into one until at most
+// maxBuckets remain.
+func collapseLowest(store map[int]uint64, maxBuckets int) {
+	indexes := sortedIndexes(store)
+	excess := len(indexes) - maxBuckets
+	target := indexes[excess]
+	for _, index := range indexes[:excess] {
+		store[target] += store[index]
+		delete(store, index)
+	}
+}
+
+func sortedIndexes(store map[int]uint64) []int {
+	indexes := make([]int, 0, len(store))
+	for index := range store {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// Merge adds all values recorded in other to s. Both sketches must have been
+// created with the same relative accuracy.
+func (s *DDSketch) Merge(other *DDSketch) error {
+	if s.gamma != other.gamma {
+		return fmt.Errorf("cannot merge sketches with different relative accuracy")
+	}
+	for index, count := range other.positive {
+		s.positive[index] += count
+	}
+	for index, count := range other.negative {
+		s.negative[index] += count
+	}
+	if len(s.positive) > s.maxBuckets {
+		collapseLowest(s.positive, s.maxBuckets)
+	}
+	if len(s.negative) > s.maxBuckets {
+		collapseLowest(s.negative, s.maxBuckets)
+	}
+	s.zero += other.zero
+	s.count += other.count
+	s.sum += other.sum
+	return nil
+}
+
+// Count returns the number of recorded values.
+func (s *DDSketch) Count() uint64 { return s.count }
+
+// Sum returns the sum of all recorded values.
+func (s *DDSketch) Sum() float64 { return s.sum }
+
+// Quantile returns an estimate of the q-quantile (0 <= q <= 1) of the
+// recorded values, or NaN if the sketch is empty.
+func (s *DDSketch) Quantile(q float64) float64 {
+	if s.count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := uint64(q * float64(s.count-1))
+
+	// Negative values are ordered from the largest magnitude down.
+	var seen uint64
+	negIndexes := sortedIndexes(s.negative)
+	for i := len(negIndexes) - 1; i >= 0; i-- {
+		seen += s.negative[negIndexes[i]]
+		if seen > rank {
+			return -s.value(negIndexes[i])
+		}
+	}
+	seen += s.zero
+	if seen > rank {
+		return 0
+	}
+	posIndexes := sortedIndexes(s.positive)
+	for _, index := range posIndexes {
+		seen += s.positive[index]
+		if seen > rank {
+			return s.value(index)
+		}
+	}
+	return s.value(posIndexes[len(posIndexes)-1])
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sketch
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestDDSketchAccuracy(t *testing.T) {
+	const accuracy = 0.01
+
+	scenarios := map[string]func(r *rand.Rand) float64{
+		"uniform":     func(r *rand.Rand) float64 { return r.Float64() * 1000 },
+		"exponential": func(r *rand.Rand) float64 { return r.ExpFloat64() * 50 },
+		"mixed sign":  func(r *rand.Rand) float64 { return r.NormFloat64() * 100 },
+	}
+
+	for name, gen := range scenarios {
+		s, err := NewDDSketch(accuracy, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := rand.New(rand.NewSource(42))
+		values := make([]float64, 10000)
+		sum := 0.0
+		for i := range values {
+			values[i] = gen(r)
+			sum += values[i]
+			s.Add(values[i])
+		}
+		sort.Float64s(values)
+
+		if s.Count() != uint64(len(values)) {
+			t.Errorf("%s: expected count %d, got %d", name, len(values), s.Count())
+		}
+		if math.Abs(s.Sum()-sum) > 1e-6*math.Abs(sum) {
+			t.Errorf("%s: expected sum %f, got %f", name, sum, s.Sum())
+		}
+		for _, q := range []float64{0, 0.5, 0.9, 0.99, 0.999, 1} {
+			want := values[int(q*float64(len(values)-1))]
+			got := s.Quantile(q)
+			if math.Abs(got-want) > accuracy*math.Abs(want)+1e-9 {
+				t.Errorf("%s: quantile %v: expected %f within %v, got %f", name, q, want, accuracy, got)
+			}
+		}
+	}
+}
+
+func TestDDSketchMerge(t *testing.T) {
+	a, _ := NewDDSketch(0.01, 2048)
+	b, _ := NewDDSketch(0.01, 2048)
+	all, _ := NewDDSketch(0.01, 2048)
+	for i := 1; i <= 1000; i++ {
+		if i%2 == 0 {
+			a.Add(float64(i))
+		} else {
+			b.Add(float64(i))
+		}
+		all.Add(float64(i))
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []float64{0.1, 0.5, 0.99} {
+		if a.Quantile(q) != all.Quantile(q) {
+			t.Errorf("quantile %v: merged sketch returned %f, expected %f", q, a.Quantile(q), all.Quantile(q))
+		}
+	}
+
+	c, _ := NewDDSketch(0.05, 2048)
+	if err := a.Merge(c); err == nil {
+		t.Error("merging sketches with different accuracy should fail")
+	}
+}
+
+func TestDDSketchBoundedBuckets(t *testing.T) {
+	s, _ := NewDDSketch(0.01, 64)
+	for i := 0; i < 100000; i++ {
+		s.Add(math.Pow(1.001, float64(i)))
+	}
+	if len(s.positive) > 64 {
+		t.Fatalf("expected at most 64 buckets, got %d", len(s.positive))
+	}
+	// High quantiles stay accurate after collapsing the lowest buckets.
+	want := math.Pow(1.001, math.Floor(0.99*99999))
+	if got := s.Quantile(0.99); math.Abs(got-want) > 0.01*want {
+		t.Errorf("expected p99 %f, got %f", want, got)
+	}
+}
+
+func TestDDSketchEmpty(t *testing.T) {
+	s, _ := NewDDSketch(0.01, 2048)
+	if !math.IsNaN(s.Quantile(0.5)) {
+		t.Errorf("expected NaN for empty sketch, got %f", s.Quantile(0.5))
+	}
+	if _, err := NewDDSketch(0, 2048); err == nil {
+		t.Error("expected error for invalid accuracy")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spill buffers events on disk while the exporter cannot keep up
+// with them.
+package spill
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+)
+
+// maxReadSize bounds the size of the batches read back from disk.
+const maxReadSize = 64 * 1024
+
+// Queue passes on events, spilling them to a file while the receiver is
+// busy. Spilled events are stored as DogStatsD lines and passed on in order
+// once the receiver catches up.
+type Queue struct {
+	file     *os.File
+	maxBytes int64
+
+	readOff  int64
+	writeOff int64
+	// next is the batch read from disk to be passed on next.
+	next    event.Events
+	nextLen int64
+}
+
+// NewQueue returns a queue spilling to the file at path, which is truncated.
+// The file grows to at most maxBytes; events beyond that are dropped.
+func NewQueue(path string, maxBytes int64) (*Queue, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Queue{file: f, maxBytes: maxBytes}, nil
+}
+
+// Run passes on the events read from in to out. When out is full, events are
+// spilled to disk. It returns when in is closed, after passing on all
+// spilled events.
+func (q *Queue) Run(in <-chan event.Events, out chan<- event.Events) {
+	defer q.file.Close()
+	for {
+		if q.readOff == q.writeOff {
+			events, ok := <-in
+			if !ok {
+				return
+			}
+			select {
+			case out <- events:
+			default:
+				q.spill(events)
+			}
+			continue
+		}
+
+		if q.next == nil {
+			if err := q.read(); err != nil {
+				log.Errorf("Error reading spilled events, discarding them: %v", err)
+				spillErrors.Inc()
+				q.reset()
+				continue
+			}
+		}
+		// Keep spilling until the file is drained, so that events are
+		// passed on in order.
+		select {
+		case events, ok := <-in:
+			if !ok {
+				for q.readOff < q.writeOff {
+					if q.next == nil && q.read() != nil {
+						break
+					}
+					out <- q.next
+					q.advance()
+				}
+				return
+			}
+			q.spill(events)
+		case out <- q.next:
+			q.advance()
+		}
+	}
+}
+
+// spill appends events to the file.
+func (q *Queue) spill(events event.Events) {
+	var b strings.Builder
+	for _, e := range events {
+		lines, err := line.EventToLines(e)
+		if err != nil {
+			continue
+		}
+		for _, l := range lines {
+			b.WriteString(l)
+			b.WriteByte('\n')
+		}
+	}
+	if q.writeOff+int64(b.Len()) > q.maxBytes {
+		eventsDropped.Add(float64(len(events)))
+		return
+	}
+	n, err := q.file.WriteAt([]byte(b.String()), q.writeOff)
+	q.writeOff += int64(n)
+	if err != nil {
+		log.Errorf("Error spilling events: %v", err)
+		spillErrors.Inc()
+		eventsDropped.Add(float64(len(events)))
+		return
+	}
+	eventsSpilled.Add(float64(len(events)))
+	spillBytes.Add(float64(n))
+}
+
+// read reads the next batch of spilled events.
+func (q *Queue) read() error {
+	size := q.writeOff - q.readOff
+	if size > maxReadSize {
+		size = maxReadSize
+	}
+	buf := make([]byte, size)
+	if _, err := q.file.ReadAt(buf, q.readOff); err != nil && err != io.EOF {
+		return err
+	}
+	end := bytes.LastIndexByte(buf, '\n')
+	if end < 0 {
+		// Lines are written completely, so this is a line longer than
+		// maxReadSize. Skip it.
+		q.next = event.Events{}
+		q.nextLen = size
+		return nil
+	}
+	q.next = event.Events{}
+	for _, l := range strings.Split(string(buf[:end]), "\n") {
+		q.next = append(q.next, line.LineToEvents(l)...)
+	}
+	q.nextLen = int64(end + 1)
+	return nil
+}
+
+// advance marks the current batch as passed on, and truncates the file once
+// it is drained.
+func (q *Queue) advance() {
+	q.readOff += q.nextLen
+	spillBytes.Sub(float64(q.nextLen))
+	q.next = nil
+	q.nextLen = 0
+	if q.readOff >= q.writeOff {
+		q.reset()
+	}
+}
+
+func (q *Queue) reset() {
+	spillBytes.Sub(float64(q.writeOff - q.readOff))
+	q.readOff, q.writeOff = 0, 0
+	q.next = nil
+	q.nextLen = 0
+	if err := q.file.Truncate(0); err != nil {
+		log.Errorf("Error truncating spill file: %v", err)
+		spillErrors.Inc()
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spill
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewQueue(filepath.Join(dir, "spill"), 1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan event.Events)
+	// The receiver is not reading, so that all but the first batch are
+	// spilled.
+	out := make(chan event.Events, 1)
+	done := make(chan struct{})
+	go func() {
+		q.Run(in, out)
+		close(out)
+		close(done)
+	}()
+
+	for i := 0; i < 100; i++ {
+		in <- event.Events{event.NewCounterEvent(fmt.Sprintf("metric_%d", i), 1, map[string]string{"tag": "value"})}
+	}
+	close(in)
+
+	i := 0
+	for events := range out {
+		for _, e := range events {
+			if want := fmt.Sprintf("metric_%d", i); e.MetricName() != want || e.Labels()["tag"] != "value" {
+				t.Fatalf("Expected event %s with tag, got %s %v", want, e.MetricName(), e.Labels())
+			}
+			i++
+		}
+	}
+	<-done
+	if i != 100 {
+		t.Errorf("Expected 100 events, got %d", i)
+	}
+}
+
+func TestQueueLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Room for two lines of 12 bytes.
+	q, err := NewQueue(filepath.Join(dir, "spill"), 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		q.spill(event.Events{event.NewCounterEvent(fmt.Sprintf("metric%d", i), 1, nil)})
+	}
+	if q.writeOff != 24 {
+		t.Errorf("Expected 24 bytes to be spilled, got %d", q.writeOff)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spill
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	eventsSpilled = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_spill_events_total",
+			Help: "The total number of events spilled to disk because the event queue was full.",
+		},
+	)
+	eventsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_spill_events_dropped_total",
+			Help: "The number of events dropped because the spill file was full.",
+		},
+	)
+	spillErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_spill_errors_total",
+			Help: "The number of errors reading or writing spill files.",
+		},
+	)
+	spillBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_spill_bytes",
+			Help: "The size of the spilled events not yet processed.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(eventsSpilled)
+	prometheus.MustRegister(eventsDropped)
+	prometheus.MustRegister(spillErrors)
+	prometheus.MustRegister(spillBytes)
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tenant routes events to per-tenant destinations by a tag.
+package tenant
+
+import (
+	"regexp"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+// tenantRE matches the tenant names accepted by the Router. They are used in
+// URL paths, so they are restricted to a safe set of characters.
+var tenantRE = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Router distributes events among tenants, identified by the value of a tag.
+type Router struct {
+	// Tag is the label carrying the tenant. It is removed from the events,
+	// so that destinations can enforce their own tenant label.
+	Tag string
+	// MaxTenants limits the number of tenants. Events of further tenants
+	// are dropped. 0 disables the limit.
+	MaxTenants int
+	// NewTenant is called once for every tenant, and returns the channel
+	// the events of the tenant are sent to.
+	NewTenant func(tenant string) chan<- event.Events
+
+	tenants map[string]chan<- event.Events
+}
+
+// Route sends the events read from in to the channel of their tenant, and
+// events without the tag to out. It returns when in is closed.
+func (r *Router) Route(in <-chan event.Events, out chan<- event.Events) {
+	if r.tenants == nil {
+		r.tenants = make(map[string]chan<- event.Events)
+	}
+	for events := range in {
+		var (
+			untagged event.Events
+			// Tenants are created in the order of their first event.
+			order    []string
+			byTenant = map[string]event.Events{}
+		)
+		for _, e := range events {
+			labels := e.Labels()
+			tenant, ok := labels[r.Tag]
+			if !ok {
+				untagged = append(untagged, e)
+				continue
+			}
+			delete(labels, r.Tag)
+			if _, ok := byTenant[tenant]; !ok {
+				order = append(order, tenant)
+			}
+			byTenant[tenant] = append(byTenant[tenant], e)
+		}
+		for _, tenant := range order {
+			if c := r.tenant(tenant); c != nil {
+				c <- byTenant[tenant]
+			} else {
+				eventsDropped.Add(float64(len(byTenant[tenant])))
+			}
+		}
+		if len(untagged) > 0 {
+			out <- untagged
+		}
+	}
+}
+
+// tenant returns the channel of the given tenant, creating it if necessary.
+// It returns nil for invalid tenants and while the tenant limit is reached.
+func (r *Router) tenant(tenant string) chan<- event.Events {
+	if c, ok := r.tenants[tenant]; ok {
+		return c
+	}
+	if !tenantRE.MatchString(tenant) {
+		log.Debugf("Dropping events of invalid tenant %q", tenant)
+		return nil
+	}
+	if r.MaxTenants > 0 && len(r.tenants) >= r.MaxTenants {
+		log.Debugf("Dropping events of tenant %q, the limit of %d tenants is reached", tenant, r.MaxTenants)
+		return nil
+	}
+	c := r.NewTenant(tenant)
+	r.tenants[tenant] = c
+	tenantsCount.Set(float64(len(r.tenants)))
+	return c
+}
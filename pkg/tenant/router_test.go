@@ -0,0 +1,65 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+)
+
+func TestRouter(t *testing.T) {
+	tenants := map[string]chan event.Events{}
+	r := &Router{
+		Tag:        "tenant",
+		MaxTenants: 2,
+		NewTenant: func(tenant string) chan<- event.Events {
+			c := make(chan event.Events, 10)
+			tenants[tenant] = c
+			return c
+		},
+	}
+
+	in := make(chan event.Events, 1)
+	out := make(chan event.Events, 10)
+	in <- event.Events{
+		event.NewCounterEvent("a", 1, map[string]string{"tenant": "team-a", "code": "200"}),
+		event.NewCounterEvent("b", 1, map[string]string{"tenant": "team-b"}),
+		event.NewCounterEvent("c", 1, map[string]string{"tenant": "team-c"}),
+		event.NewCounterEvent("d", 1, map[string]string{"tenant": "../etc"}),
+		event.NewCounterEvent("e", 1, map[string]string{"code": "200"}),
+	}
+	close(in)
+	r.Route(in, out)
+
+	if len(tenants) != 2 {
+		t.Fatalf("Expected 2 tenants, got %v", tenants)
+	}
+	got := <-tenants["team-a"]
+	if len(got) != 1 || got[0].MetricName() != "a" {
+		t.Fatalf("Expected event a for team-a, got %v", got)
+	}
+	if _, ok := got[0].Labels()["tenant"]; ok || got[0].Labels()["code"] != "200" {
+		t.Errorf("Expected only the tenant tag to be removed, got %v", got[0].Labels())
+	}
+	if got := <-tenants["team-b"]; len(got) != 1 || got[0].MetricName() != "b" {
+		t.Errorf("Expected event b for team-b, got %v", got)
+	}
+	if got := <-out; len(got) != 1 || got[0].MetricName() != "e" {
+		t.Errorf("Expected untagged event e, got %v", got)
+	}
+	if len(out) != 0 {
+		t.Errorf("Expected no further events, got %v", <-out)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tenantsCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_tenants",
+			Help: "The number of tenants events were routed to.",
+		},
+	)
+	eventsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "statsd_exporter_tenant_events_dropped_total",
+			Help: "The total number of events dropped for an invalid tenant or exceeding the tenant limit.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(tenantsCount)
+	prometheus.MustRegister(eventsDropped)
+}
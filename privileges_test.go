@@ -0,0 +1,62 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"testing"
+)
+
+func TestLookupIDs(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip("current user unknown:", err)
+	}
+
+	for _, name := range []string{u.Username, u.Uid} {
+		uid, gid, groups, err := lookupIDs(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uid != os.Getuid() {
+			t.Errorf("%s: expected uid %d, got %d", name, os.Getuid(), uid)
+		}
+		if strconv.Itoa(gid) != u.Gid {
+			t.Errorf("%s: expected gid %s, got %d", name, u.Gid, gid)
+		}
+		if len(groups) == 0 {
+			t.Errorf("%s: expected supplementary groups", name)
+		}
+	}
+
+	uid, gid, groups, err := lookupIDs("", u.Gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != -1 || strconv.Itoa(gid) != u.Gid || len(groups) != 1 || groups[0] != gid {
+		t.Errorf("expected only gid %s, got uid %d, gid %d, groups %v", u.Gid, uid, gid, groups)
+	}
+
+	if _, _, _, err := lookupIDs("no-such-user-statsd-exporter", ""); err == nil {
+		t.Error("expected error for unknown user")
+	}
+	if _, _, _, err := lookupIDs("", "no-such-group-statsd-exporter"); err == nil {
+		t.Error("expected error for unknown group")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupIDs resolves the user and group to run as, given by name or numeric
+// ID, to the uid, gid and supplementary groups to switch to. Without a group,
+// the user's primary and supplementary groups are used. IDs that are not to
+// be changed are -1.
+func lookupIDs(userName, groupName string) (uid, gid int, groups []int, err error) {
+	uid, gid = -1, -1
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if _, ok := err.(user.UnknownUserError); ok {
+			u, err = user.LookupId(userName)
+		}
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("error looking up user %q: %v", userName, err)
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, nil, fmt.Errorf("user %q has non-numeric uid %q", userName, u.Uid)
+		}
+		if gid, err = strconv.Atoi(u.Gid); err != nil {
+			return 0, 0, nil, fmt.Errorf("user %q has non-numeric gid %q", userName, u.Gid)
+		}
+		if groupName == "" {
+			ids, err := u.GroupIds()
+			if err != nil {
+				return 0, 0, nil, fmt.Errorf("error looking up groups of user %q: %v", userName, err)
+			}
+			for _, id := range ids {
+				g, err := strconv.Atoi(id)
+				if err != nil {
+					return 0, 0, nil, fmt.Errorf("user %q has non-numeric group %q", userName, id)
+				}
+				groups = append(groups, g)
+			}
+		}
+	}
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if _, ok := err.(user.UnknownGroupError); ok {
+			g, err = user.LookupGroupId(groupName)
+		}
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("error looking up group %q: %v", groupName, err)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, nil, fmt.Errorf("group %q has non-numeric gid %q", groupName, g.Gid)
+		}
+		groups = []int{gid}
+	}
+	return uid, gid, groups, nil
+}
+
+// dropPrivileges switches the process to the given user and group, so that
+// it can bind privileged ports as root and then run unprivileged. The groups
+// are switched first, as that is no longer permitted once the user is not
+// root.
+func dropPrivileges(userName, groupName string) error {
+	if userName == "" && groupName == "" {
+		return nil
+	}
+	uid, gid, groups, err := lookupIDs(userName, groupName)
+	if err != nil {
+		return err
+	}
+	// A process the sockets were handed over to already runs as the user.
+	if (uid < 0 || uid == syscall.Getuid()) && (gid < 0 || gid == syscall.Getgid()) && syscall.Getuid() != 0 {
+		return nil
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("error setting supplementary groups: %v", err)
+	}
+	if gid >= 0 {
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("error setting gid %d: %v", gid, err)
+		}
+	}
+	if uid >= 0 {
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("error setting uid %d: %v", uid, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// profileHz is the rate at which the stacks of goroutines are sampled.
+	profileHz = 99
+	// profileMaxSeconds limits the duration of a single profile.
+	profileMaxSeconds = 300
+)
+
+// sampleGoroutines adds the stacks of all goroutines, running or waiting, to
+// stacks, as semicolon separated functions from the root of each stack.
+// The stack of the sampling goroutine is left out.
+func sampleGoroutines(stacks map[string]int) {
+	records := make([]runtime.StackRecord, runtime.NumGoroutine()+10)
+	n, ok := runtime.GoroutineProfile(records)
+	for !ok {
+		records = make([]runtime.StackRecord, n+10)
+		n, ok = runtime.GoroutineProfile(records)
+	}
+
+	var funcs []string
+	for _, record := range records[:n] {
+		funcs = funcs[:0]
+		frames := runtime.CallersFrames(record.Stack())
+		for {
+			frame, more := frames.Next()
+			funcs = append(funcs, frame.Function)
+			if !more {
+				break
+			}
+		}
+		stack := strings.Join(reverse(funcs), ";")
+		if stack == "" || strings.Contains(stack, "runtime.GoroutineProfile") {
+			continue
+		}
+		stacks[stack]++
+	}
+}
+
+// reverse reverses the order of funcs in place.
+func reverse(funcs []string) []string {
+	for i, j := 0, len(funcs)-1; i < j; i, j = i+1, j-1 {
+		funcs[i], funcs[j] = funcs[j], funcs[i]
+	}
+	return funcs
+}
+
+// serveWallClockProfile samples the stacks of all goroutines for the number
+// of seconds given by the seconds parameter, 30 by default, and writes how
+// often each stack was seen in the folded format of flame graph tools.
+// Unlike the CPU profile, waiting goroutines are included, so that time
+// spent in syscalls and on locks shows as well as time spent parsing.
+func serveWallClockProfile(w http.ResponseWriter, r *http.Request) {
+	seconds := 30
+	if s := r.FormValue("seconds"); s != "" {
+		var err error
+		seconds, err = strconv.Atoi(s)
+		if err != nil || seconds <= 0 || seconds > profileMaxSeconds {
+			http.Error(w, fmt.Sprintf("seconds must be between 1 and %d", profileMaxSeconds), http.StatusBadRequest)
+			return
+		}
+	}
+
+	stacks := map[string]int{}
+	ticker := time.NewTicker(time.Second / profileHz)
+	defer ticker.Stop()
+	deadline := time.After(time.Duration(seconds) * time.Second)
+sampling:
+	for {
+		select {
+		case <-ticker.C:
+			sampleGoroutines(stacks)
+		case <-deadline:
+			break sampling
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	folded := make([]string, 0, len(stacks))
+	for stack := range stacks {
+		folded = append(folded, stack)
+	}
+	sort.Strings(folded)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, stack := range folded {
+		fmt.Fprintf(w, "%s %d\n", stack, stacks[stack])
+	}
+}
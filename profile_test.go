@@ -0,0 +1,45 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func blockForProfile(done <-chan struct{}) {
+	<-done
+}
+
+func TestSampleGoroutines(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	go blockForProfile(done)
+
+	for i := 0; i < 100; i++ {
+		stacks := map[string]int{}
+		sampleGoroutines(stacks)
+		for stack := range stacks {
+			if strings.Contains(stack, "runtime.GoroutineProfile") {
+				t.Fatalf("The sampling goroutine should be left out, got %q", stack)
+			}
+			if strings.Contains(stack, ".blockForProfile;") {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("Expected the waiting goroutine to be sampled")
+}
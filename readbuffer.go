@@ -0,0 +1,70 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/log"
+)
+
+// rmemMaxPath holds the largest read buffer the kernel grants to sockets.
+const rmemMaxPath = "/proc/sys/net/core/rmem_max"
+
+// readRmemMax returns the value of net.core.rmem_max, or 0 where it cannot
+// be read.
+func readRmemMax(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// tuneReadBuffer sets the read buffer of a UDP connection to the requested
+// size, or without one to the largest size net.core.rmem_max allows. The
+// size in effect is exported, and a warning logged if the kernel granted
+// less than requested.
+func tuneReadBuffer(conn *net.UDPConn, requested int) error {
+	rmemMax := readRmemMax(rmemMaxPath)
+	size := requested
+	if size == 0 {
+		size = rmemMax
+	}
+	if size > 0 {
+		if err := conn.SetReadBuffer(size); err != nil {
+			return err
+		}
+	}
+
+	effective, err := readBufferSize(conn)
+	if err != nil {
+		log.Debugf("Cannot read the effective UDP read buffer size: %v", err)
+		return nil
+	}
+	udpReadBuffer.Set(float64(effective))
+	// Linux reports twice the granted size, so that clamping shows in
+	// rmem_max rather than in the effective size.
+	if requested > 0 && (effective < requested || rmemMax > 0 && requested > rmemMax) {
+		log.Warnf("The UDP read buffer is %d bytes instead of the requested %d, raise net.core.rmem_max (%d) to allow it", effective, requested, rmemMax)
+	}
+	return nil
+}
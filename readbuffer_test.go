@@ -0,0 +1,68 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestReadRmemMax(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsd_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "rmem_max")
+	if err := ioutil.WriteFile(path, []byte("212992\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRmemMax(path); got != 212992 {
+		t.Errorf("Expected 212992, got %d", got)
+	}
+	if got := readRmemMax(filepath.Join(dir, "missing")); got != 0 {
+		t.Errorf("Expected 0 for a missing file, got %d", got)
+	}
+}
+
+func TestTuneReadBuffer(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := tuneReadBuffer(conn, 4096); err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range metrics {
+		if family.GetName() == "statsd_exporter_udp_read_buffer_bytes" {
+			if value := family.GetMetric()[0].GetGauge().GetValue(); value < 4096 {
+				t.Errorf("Expected a read buffer of at least 4096 bytes, got %f", value)
+			}
+			return
+		}
+	}
+	t.Error("The read buffer size is not exported")
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// listenerNames are the listeners that can be given their own exposition
+// path.
+var listenerNames = []string{"udp", "tcp", "nats", "redis", "sqs", "stdin", "file"}
+
+// parseListenerPaths parses listener=path pairs into a map from listener
+// name to path.
+func parseListenerPaths(specs []string, metricsEndpoint string) (map[string]string, error) {
+	paths := make(map[string]string, len(specs))
+	seen := map[string]bool{metricsEndpoint: true}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid listener path %q, expected listener=path", spec)
+		}
+		name, path := parts[0], parts[1]
+		known := false
+		for _, n := range listenerNames {
+			known = known || n == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown listener %q, expected one of %s", name, strings.Join(listenerNames, ", "))
+		}
+		if _, ok := paths[name]; ok {
+			return nil, fmt.Errorf("listener %q given more than one path", name)
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("path %q of listener %q must start with /", path, name)
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("path %q of listener %q is already used", path, name)
+		}
+		seen[path] = true
+		paths[name] = path
+	}
+	return paths, nil
+}
+
+// gathererHandler exposes the metrics gathered from g.
+func gathererHandler(g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := g.Gather()
+		if err != nil {
+			http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		enc := expfmt.NewEncoder(w, format)
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				http.Error(w, "An error has occurred while encoding metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseListenerPaths(t *testing.T) {
+	paths, err := parseListenerPaths([]string{"udp=/metrics/udp", "tcp=/metrics/tcp"}, "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths["udp"] != "/metrics/udp" || paths["tcp"] != "/metrics/tcp" || len(paths) != 2 {
+		t.Errorf("Unexpected paths %v", paths)
+	}
+
+	for _, specs := range [][]string{
+		{"udp"},
+		{"carrier-pigeon=/metrics/pigeon"},
+		{"udp=metrics"},
+		{"udp=/metrics"},
+		{"udp=/a", "tcp=/a"},
+		{"udp=/a", "udp=/b"},
+	} {
+		if _, err := parseListenerPaths(specs, "/metrics"); err == nil {
+			t.Errorf("Expected an error for %v", specs)
+		}
+	}
+}
+
+func TestGathererHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "isolated_total", Help: "Isolated."})
+	reg.MustRegister(c)
+	c.Inc()
+
+	rec := httptest.NewRecorder()
+	gathererHandler(reg).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/isolated", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	if !strings.Contains(string(body), "isolated_total 1") {
+		t.Errorf("Expected the registry's metrics, got %q", body)
+	}
+	if strings.Contains(string(body), "go_goroutines") {
+		t.Errorf("Expected no metrics of the default registry, got %q", body)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// configRouter hands out the queue of the Exporter for each mapping config.
+// Listeners with their own mapping config feed a dedicated Exporter, so that
+// conflicting naming conventions cannot interfere with each other, and all
+// other listeners feed the Exporter of --statsd.mapping-config.
+type configRouter struct {
+	// load loads a mapping config on its first use.
+	load func(fileName string) *mapper.MetricMapper
+	// start starts an Exporter mapping with m and returns its queue.
+	start func(m *mapper.MetricMapper) chan<- event.Events
+
+	mainConfig string
+	mappers    map[string]*mapper.MetricMapper
+	queues     map[string]chan<- event.Events
+}
+
+func newConfigRouter(mainConfig string, m *mapper.MetricMapper, events chan<- event.Events) *configRouter {
+	return &configRouter{
+		mainConfig: mainConfig,
+		mappers:    map[string]*mapper.MetricMapper{mainConfig: m},
+		queues:     map[string]chan<- event.Events{mainConfig: events},
+	}
+}
+
+// mapper returns the mapper of a mapping config, "" being the main one.
+func (r *configRouter) mapper(fileName string) *mapper.MetricMapper {
+	if fileName == "" {
+		fileName = r.mainConfig
+	}
+	if m, ok := r.mappers[fileName]; ok {
+		return m
+	}
+	m := r.load(fileName)
+	r.mappers[fileName] = m
+	return m
+}
+
+// queue returns the queue of the Exporter of a mapping config, "" being the
+// main one.
+func (r *configRouter) queue(fileName string) chan<- event.Events {
+	if fileName == "" {
+		fileName = r.mainConfig
+	}
+	if e, ok := r.queues[fileName]; ok {
+		return e
+	}
+	e := r.start(r.mapper(fileName))
+	r.queues[fileName] = e
+	return e
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+func TestConfigRouter(t *testing.T) {
+	newMapper := func(prefix string) *mapper.MetricMapper {
+		m := &mapper.MetricMapper{}
+		err := m.InitFromYAMLString(fmt.Sprintf(`
+mappings:
+- match: api.*
+  name: %s_${1}
+`, prefix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	type queue struct {
+		events chan event.Events
+		done   chan struct{}
+		reg    *prometheus.Registry
+	}
+	var queues []queue
+	start := func(m *mapper.MetricMapper) chan<- event.Events {
+		q := queue{make(chan event.Events), make(chan struct{}), prometheus.NewRegistry()}
+		queues = append(queues, q)
+		ex := exporter.NewExporter(m, exporter.WithRegisterer(q.reg))
+		go func() {
+			ex.Listen(q.events)
+			close(q.done)
+		}()
+		return q.events
+	}
+
+	mainMapper := newMapper("main")
+	router := newConfigRouter("main.yml", mainMapper, start(mainMapper))
+	loads := 0
+	router.load = func(fileName string) *mapper.MetricMapper {
+		loads++
+		return newMapper(fileName[:1])
+	}
+	router.start = start
+
+	// Two listeners with mapping configs of their own, and listeners using
+	// the main one, implicitly or explicitly.
+	for _, fileName := range []string{"a.yml", "b.yml", "", "main.yml", "a.yml"} {
+		router.queue(fileName) <- event.Events{event.NewCounterEvent("api.requests", 1, nil)}
+	}
+	if loads != 2 {
+		t.Errorf("Expected each mapping config to be loaded once, got %d loads", loads)
+	}
+	if len(queues) != 3 {
+		t.Fatalf("Expected an Exporter per mapping config, got %d", len(queues))
+	}
+
+	// The same line is mapped differently by each mapping config.
+	for i, want := range []struct {
+		name  string
+		value float64
+	}{{"main_requests", 2}, {"a_requests", 2}, {"b_requests", 1}} {
+		close(queues[i].events)
+		<-queues[i].done
+		metrics, err := queues[i].reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		value := getFloat64(metrics, want.name, prometheus.Labels{})
+		if len(metrics) != 1 || value == nil || *value != want.value {
+			t.Errorf("Expected only %s at %f in Exporter %d, got %v", want.name, want.value, i, metrics)
+		}
+	}
+	if router.mapper("") != mainMapper {
+		t.Error("Expected listeners without mapping config to use the main one")
+	}
+}
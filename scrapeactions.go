@@ -0,0 +1,69 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+)
+
+// scrapeActions applies the scrape actions of the series of the exporters
+// whose metrics a handler exposes.
+type scrapeActions struct {
+	mtx       sync.Mutex
+	exporters []*exporter.Exporter
+}
+
+func (s *scrapeActions) add(ex *exporter.Exporter) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.exporters = append(s.exporters, ex)
+}
+
+// handler returns a handler serving scrapes with h, and applying the scrape
+// actions once a scrape succeeded.
+func (s *scrapeActions) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mtx.Lock()
+		exporters := s.exporters
+		s.mtx.Unlock()
+
+		ends := make([]func(bool), 0, len(exporters))
+		for _, ex := range exporters {
+			ends = append(ends, ex.BeginScrape())
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		for _, end := range ends {
+			end(sw.status == http.StatusOK)
+		}
+	})
+}
+
+// statusWriter records the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/prometheus/statsd_exporter/pkg/clock"
+)
+
+// cachedResponse is a response of the metrics handler kept for reuse.
+type cachedResponse struct {
+	renderedAt time.Time
+	status     int
+	header     http.Header
+	body       []byte
+}
+
+// responseRecorder captures a response to cache it.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// cacheResponses serves the responses of h for up to maxAge after they were
+// rendered, so that frequent scrapes don't gather the registry every time.
+// Responses are cached per requested format and encoding. Scrapes arriving
+// while a response is rendered wait for it.
+func cacheResponses(h http.Handler, maxAge time.Duration) http.Handler {
+	var (
+		mtx   sync.Mutex
+		cache = map[string]*cachedResponse{}
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := string(expfmt.Negotiate(r.Header))
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			key += ";gzip"
+		}
+
+		mtx.Lock()
+		resp, ok := cache[key]
+		if ok && clock.Now().Sub(resp.renderedAt) < maxAge {
+			scrapeCacheRequests.WithLabelValues("hit").Inc()
+		} else {
+			scrapeCacheRequests.WithLabelValues("miss").Inc()
+			rec := &responseRecorder{header: http.Header{}}
+			h.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			resp = &cachedResponse{renderedAt: clock.Now(), status: rec.status, header: rec.header, body: rec.body.Bytes()}
+			if resp.status == http.StatusOK {
+				cache[key] = resp
+			} else {
+				delete(cache, key)
+			}
+		}
+		mtx.Unlock()
+
+		for name, values := range resp.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.status)
+		w.Write(resp.body)
+	})
+}
+
+// maybeCacheResponses caches the responses of h if maxAge is positive.
+func maybeCacheResponses(h http.Handler, maxAge time.Duration) http.Handler {
+	if maxAge <= 0 {
+		return h
+	}
+	return cacheResponses(h, maxAge)
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/statsd_exporter/pkg/clock"
+)
+
+func TestCacheResponses(t *testing.T) {
+	clock.ClockInstance = &clock.Clock{Instant: time.Unix(0, 0)}
+	defer func() { clock.ClockInstance = nil }()
+
+	renders := 0
+	h := cacheResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renders++
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "render %d", renders)
+	}), 5*time.Second)
+
+	scrape := func(accept string) string {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/plain" {
+			t.Fatalf("Unexpected response %d with content type %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		return rec.Body.String()
+	}
+
+	if got := scrape(""); got != "render 1" {
+		t.Fatalf("Expected the first scrape to render, got %q", got)
+	}
+	clock.ClockInstance.Instant = time.Unix(4, 0)
+	if got := scrape(""); got != "render 1" {
+		t.Fatalf("Expected a scrape within the max age to be served from the cache, got %q", got)
+	}
+	if got := scrape("application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited"); got != "render 2" {
+		t.Fatalf("Expected a scrape for another format to render, got %q", got)
+	}
+	clock.ClockInstance.Instant = time.Unix(5, 0)
+	if got := scrape(""); got != "render 3" {
+		t.Fatalf("Expected a scrape after the max age to render, got %q", got)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/prometheus/common/log"
+	"golang.org/x/sys/windows"
+)
+
+// serviceName is the name the exporter logs to the event log under when
+// running as a service. The service manager does not pass the name services
+// running in their own process are installed as.
+const serviceName = "statsd_exporter"
+
+// errFailedServiceControllerConnect is returned by
+// StartServiceCtrlDispatcher when the process was not started as a service.
+const errFailedServiceControllerConnect = syscall.Errno(1063)
+
+var (
+	procRegisterServiceCtrlHandlerExW = windows.NewLazySystemDLL("advapi32.dll").NewProc("RegisterServiceCtrlHandlerExW")
+
+	serviceMainCallback    = syscall.NewCallback(serviceMain)
+	serviceHandlerCallback = syscall.NewCallback(serviceHandler)
+
+	service        windowsService
+	serviceStarted = make(chan error, 1)
+)
+
+// windowsService reports the state of the exporter to the service manager.
+type windowsService struct {
+	mtx    sync.Mutex
+	handle windows.Handle
+	status windows.SERVICE_STATUS
+}
+
+func (s *windowsService) setState(state uint32) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.status.ServiceType = windows.SERVICE_WIN32_OWN_PROCESS
+	s.status.CurrentState = state
+	s.status.ControlsAccepted = 0
+	if state == windows.SERVICE_RUNNING {
+		s.status.ControlsAccepted = windows.SERVICE_ACCEPT_STOP | windows.SERVICE_ACCEPT_SHUTDOWN
+	}
+	s.report()
+}
+
+// reportState reports the current state again.
+func (s *windowsService) reportState() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.report()
+}
+
+// report reports the status to the service manager. s.mtx must be held.
+func (s *windowsService) report() {
+	if err := windows.SetServiceStatus(s.handle, &s.status); err != nil {
+		log.Errorln("Error reporting service status:", err)
+	}
+}
+
+// serviceMain is called by the service manager on the dispatcher thread
+// once the service starts.
+func serviceMain(argc uint32, argv **uint16) uintptr {
+	name, _ := windows.UTF16PtrFromString(serviceName)
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(name)), serviceHandlerCallback, 0)
+	if h == 0 {
+		serviceStarted <- err
+		return 0
+	}
+	service.handle = windows.Handle(h)
+	service.setState(windows.SERVICE_RUNNING)
+	serviceStarted <- nil
+	return 0
+}
+
+// serviceHandler is called by the service manager with control requests.
+func serviceHandler(ctl, eventType uint32, eventData, context uintptr) uintptr {
+	switch ctl {
+	case windows.SERVICE_CONTROL_STOP, windows.SERVICE_CONTROL_SHUTDOWN:
+		service.setState(windows.SERVICE_STOP_PENDING)
+		go shutdown("Received service stop request")
+	case windows.SERVICE_CONTROL_INTERROGATE:
+		service.reportState()
+	}
+	return windows.NO_ERROR
+}
+
+// runAsService connects the exporter to the service manager if it was
+// started as a Windows service, and logs to the event log from then on.
+// Stopping the service shuts the exporter down like SIGTERM does.
+func runAsService() error {
+	name, err := windows.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return err
+	}
+	table := []windows.SERVICE_TABLE_ENTRY{
+		{ServiceName: name, ServiceProc: serviceMainCallback},
+		{},
+	}
+	dispatched := make(chan error, 1)
+	go func() {
+		// The dispatcher thread runs the callbacks until the service stops.
+		runtime.LockOSThread()
+		dispatched <- windows.StartServiceCtrlDispatcher(&table[0])
+	}()
+
+	select {
+	case err := <-dispatched:
+		if err == errFailedServiceControllerConnect {
+			return nil
+		}
+		return err
+	case err := <-serviceStarted:
+		if err != nil {
+			return err
+		}
+	}
+
+	onShutdown(func() { service.setState(windows.SERVICE_STOPPED) })
+	if err := log.Base().SetFormat("logger:eventlog?name=" + serviceName); err != nil {
+		return err
+	}
+	log.Infoln("Running as Windows service", serviceName)
+	return nil
+}
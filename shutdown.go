@@ -0,0 +1,55 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/common/log"
+)
+
+var (
+	shutdownMtx   sync.Mutex
+	shutdownHooks []func()
+)
+
+// onShutdown registers f to be run when the exporter shuts down. Hooks run
+// in the reverse order of their registration.
+func onShutdown(f func()) {
+	shutdownMtx.Lock()
+	defer shutdownMtx.Unlock()
+	shutdownHooks = append(shutdownHooks, f)
+}
+
+// shutdown runs the shutdown hooks and exits. It never returns, and hooks
+// run only once if it is called concurrently.
+func shutdown(reason string) {
+	shutdownMtx.Lock()
+	log.Infof("%s, exiting", reason)
+	for i := len(shutdownHooks) - 1; i >= 0; i-- {
+		shutdownHooks[i]()
+	}
+	os.Exit(0)
+}
+
+// shutdownOnSignal shuts down on SIGINT or SIGTERM.
+func shutdownOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	shutdown("Received " + sig.String())
+}
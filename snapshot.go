@@ -0,0 +1,78 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+)
+
+// restoreGauges restores the gauges of ex from the snapshot at path, if it
+// exists.
+func restoreGauges(ex *exporter.Exporter, path string) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Errorf("Error opening gauge snapshot %s: %v", path, err)
+		return
+	}
+	defer f.Close()
+	if err := ex.RestoreGauges(f); err != nil {
+		log.Errorf("Error restoring gauges from %s: %v", path, err)
+		return
+	}
+	log.Infoln("Restored gauges from", path)
+}
+
+// snapshotGauges saves the gauges of ex to path every interval, and when the
+// exporter shuts down. Before the sockets are handed over to a new process,
+// the gauges are saved for it to restore them, and this process stops saving
+// them. It never returns.
+func snapshotGauges(ex *exporter.Exporter, path string, interval time.Duration) {
+	var (
+		mtx        sync.Mutex
+		handedOver bool
+	)
+	save := func() {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if handedOver {
+			return
+		}
+		if err := writeFileAtomically(path, ex.SaveGauges); err != nil {
+			log.Errorf("Error saving gauges to %s: %v", path, err)
+		}
+	}
+	onShutdown(save)
+	onHandOver(func() {
+		save()
+		mtx.Lock()
+		handedOver = true
+		mtx.Unlock()
+	}, func() {
+		mtx.Lock()
+		handedOver = false
+		mtx.Unlock()
+	})
+	for range time.Tick(interval) {
+		save()
+	}
+}
@@ -18,105 +18,99 @@ import (
 )
 
 var (
-	eventStats = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "statsd_exporter_events_total",
-			Help: "The total number of StatsD events seen.",
-		},
-		[]string{"type"},
-	)
-	eventsUnmapped = prometheus.NewCounter(prometheus.CounterOpts{
-		Name: "statsd_exporter_events_unmapped_total",
-		Help: "The total number of StatsD events no mapping was found for.",
-	})
-	udpPackets = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: "statsd_exporter_udp_packets_total",
-			Help: "The total number of StatsD packets received over UDP.",
-		},
-	)
-	tcpConnections = prometheus.NewCounter(
+	configLoads = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "statsd_exporter_tcp_connections_total",
-			Help: "The total number of TCP connections handled.",
+			Name: "statsd_exporter_config_reloads_total",
+			Help: "The number of configuration reloads.",
 		},
+		[]string{"outcome"},
 	)
-	tcpErrors = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: "statsd_exporter_tcp_connection_errors_total",
-			Help: "The number of errors encountered reading from TCP.",
+	configLastReloadSuccessful = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_config_last_reload_successful",
+			Help: "Whether the last load of the mapping config was successful.",
 		},
+		[]string{"file"},
 	)
-	tcpLineTooLong = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: "statsd_exporter_tcp_too_long_lines_total",
-			Help: "The number of lines discarded due to being too long.",
+	configLastReloadSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful load of the mapping config.",
 		},
+		[]string{"file"},
 	)
-	linesReceived = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: "statsd_exporter_lines_total",
-			Help: "The total number of StatsD lines received.",
+	configGeneration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_config_generation",
+			Help: "The number of successful loads of the mapping config since the start, increasing with every reload.",
 		},
+		[]string{"file"},
 	)
-	samplesReceived = prometheus.NewCounter(
+	mappingsCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "statsd_exporter_loaded_mappings",
+		Help: "The current number of configured metric mappings.",
+	})
+	kubernetesRefreshes = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "statsd_exporter_samples_total",
-			Help: "The total number of StatsD samples received.",
+			Name: "statsd_exporter_kubernetes_pod_refreshes_total",
+			Help: "The number of refreshes of the Kubernetes pod list.",
 		},
+		[]string{"outcome"},
 	)
-	sampleErrors = prometheus.NewCounterVec(
+	udpReadBuffer = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "statsd_exporter_udp_read_buffer_bytes",
+		Help: "The size of the UDP read buffer as reported by the kernel.",
+	})
+	otlpPushes = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "statsd_exporter_sample_errors_total",
-			Help: "The total number of errors parsing StatsD samples.",
+			Name: "statsd_exporter_otlp_pushes_total",
+			Help: "The number of pushes of the metrics to the OTLP endpoint.",
 		},
-		[]string{"reason"},
+		[]string{"outcome"},
 	)
-	tagsReceived = prometheus.NewCounter(
+	scrapeCacheRequests = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "statsd_exporter_tags_total",
-			Help: "The total number of DogStatsD tags processed.",
+			Name: "statsd_exporter_scrape_cache_requests_total",
+			Help: "The number of scrapes served from the scrape cache, or rendered for it.",
 		},
+		[]string{"result"},
 	)
-	tagErrors = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: "statsd_exporter_tag_errors_total",
-			Help: "The number of errors parsign DogStatsD tags.",
+	httpRequestsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "statsd_exporter_http_requests_in_flight",
+			Help: "The number of requests of the metrics endpoints being served.",
 		},
+		[]string{"handler"},
 	)
-	configLoads = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "statsd_exporter_config_reloads_total",
-			Help: "The number of configuration reloads.",
+	httpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "statsd_exporter_http_request_duration_seconds",
+			Help:    "The time it took to serve requests of the metrics endpoints.",
+			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"outcome"},
+		[]string{"handler", "code"},
 	)
-	mappingsCount = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "statsd_exporter_loaded_mappings",
-		Help: "The current number of configured metric mappings.",
-	})
-	conflictingEventStats = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "statsd_exporter_events_conflict_total",
-			Help: "The total number of StatsD events with conflicting names.",
+	httpResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "statsd_exporter_http_response_size_bytes",
+			Help:    "The size of the responses of the metrics endpoints.",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 8),
 		},
-		[]string{"type"},
+		[]string{"handler"},
 	)
 )
 
 func init() {
-	prometheus.MustRegister(eventStats)
-	prometheus.MustRegister(eventsUnmapped)
-	prometheus.MustRegister(udpPackets)
-	prometheus.MustRegister(tcpConnections)
-	prometheus.MustRegister(tcpErrors)
-	prometheus.MustRegister(tcpLineTooLong)
-	prometheus.MustRegister(linesReceived)
-	prometheus.MustRegister(samplesReceived)
-	prometheus.MustRegister(sampleErrors)
-	prometheus.MustRegister(tagsReceived)
-	prometheus.MustRegister(tagErrors)
 	prometheus.MustRegister(configLoads)
+	prometheus.MustRegister(configLastReloadSuccessful)
+	prometheus.MustRegister(configLastReloadSuccess)
+	prometheus.MustRegister(configGeneration)
 	prometheus.MustRegister(mappingsCount)
-	prometheus.MustRegister(conflictingEventStats)
+	prometheus.MustRegister(kubernetesRefreshes)
+	prometheus.MustRegister(udpReadBuffer)
+	prometheus.MustRegister(otlpPushes)
+	prometheus.MustRegister(scrapeCacheRequests)
+	prometheus.MustRegister(httpRequestsInFlight)
+	prometheus.MustRegister(httpRequestDuration)
+	prometheus.MustRegister(httpResponseSize)
 }
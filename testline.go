@@ -0,0 +1,210 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/line"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+// maxTestLineBytes limits the size of the body of a test line request.
+const maxTestLineBytes = 1 << 20
+
+type testedLine struct {
+	Line   string        `json:"line"`
+	Error  string        `json:"error,omitempty"`
+	Events []testedEvent `json:"events"`
+}
+
+type testedEvent struct {
+	Name    string            `json:"name"`
+	Type    mapper.MetricType `json:"type"`
+	Value   float64           `json:"value"`
+	Labels  map[string]string `json:"labels"`
+	Mapping *testedMapping    `json:"mapping"`
+}
+
+type testedMapping struct {
+	Match     string            `json:"match"`
+	MatchType mapper.MatchType  `json:"match_type"`
+	Action    mapper.ActionType `json:"action"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+	Outputs   []string          `json:"outputs,omitempty"`
+}
+
+type testLineResult struct {
+	Lines  []testedLine   `json:"lines"`
+	Series []testedSeries `json:"series"`
+}
+
+type testedSeries struct {
+	Series string `json:"series"`
+	Value  string `json:"value"`
+}
+
+// testLineHandler parses the lines POSTed to it like a listener would, and
+// describes as JSON the events they yield, the mapping of the live mapper
+// each event matches, and the series they would be exported as. The lines are
+// handled by an exporter of their own, so they don't affect the exported
+// metrics.
+type testLineHandler struct {
+	mapper    *mapper.MetricMapper
+	options   line.Options
+	configure func(*exporter.Exporter)
+}
+
+// testLineRecorder keeps the reason a line could not be parsed.
+type testLineRecorder struct {
+	reason string
+}
+
+func (r *testLineRecorder) RecordBadLine(listener, line, reason string) {
+	r.reason = reason
+}
+
+func (h *testLineHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests are accepted.", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = line.DefaultFormat
+	}
+	p, err := line.Lookup(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p = line.WithOptions(p, h.options)
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxTestLineBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reg := prometheus.NewRegistry()
+	ex := exporter.NewExporter(h.mapper, exporter.WithRegisterer(reg))
+	if h.configure != nil {
+		h.configure(ex)
+	}
+
+	lines := []testedLine{}
+	var events event.Events
+	for _, l := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+		l = strings.TrimSuffix(l, "\r")
+		if l == "" {
+			continue
+		}
+		recorder := &testLineRecorder{}
+		parsed := line.RecordBadLines(p, "test-line", recorder).LineToEvents(l)
+		tested := testedLine{Line: l, Error: recorder.reason, Events: []testedEvent{}}
+		for _, e := range parsed {
+			tested.Events = append(tested.Events, h.testEvent(e, ex.StripPrefixes))
+		}
+		lines = append(lines, tested)
+		events = append(events, parsed...)
+	}
+
+	// Handling events modifies their labels, so they are described first.
+	ex.HandleEvents(events)
+	series, err := gatherSeries(reg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(struct {
+		Status string         `json:"status"`
+		Data   testLineResult `json:"data"`
+	}{"success", testLineResult{lines, series}})
+	if err != nil {
+		log.Errorln("Error writing test line result:", err)
+	}
+}
+
+// testEvent describes an event and the mapping it matches, looked up like
+// the exporter does.
+func (h *testLineHandler) testEvent(e event.Event, stripPrefixes []string) testedEvent {
+	labels := map[string]string{}
+	for label, value := range e.Labels() {
+		labels[label] = value
+	}
+	tested := testedEvent{
+		Name:   e.MetricName(),
+		Type:   e.MetricType(),
+		Value:  e.Value(),
+		Labels: labels,
+	}
+
+	name := e.MetricName()
+	for _, prefix := range stripPrefixes {
+		if len(name) > len(prefix) && strings.HasPrefix(name, prefix) {
+			name = name[len(prefix):]
+			break
+		}
+	}
+	if h.mapper.Defaults.Lowercase {
+		name = strings.ToLower(name)
+	}
+	mapping, mappingLabels, outputs, present := h.mapper.GetMappingOutputs(name, e.MetricType())
+	if !present {
+		return tested
+	}
+	tested.Mapping = &testedMapping{
+		Match:     mapping.Match,
+		MatchType: mapping.MatchType,
+		Action:    mapping.Action,
+		Name:      mapping.Name,
+		Labels:    mappingLabels,
+	}
+	for _, output := range outputs {
+		tested.Mapping.Outputs = append(tested.Mapping.Outputs, output.Mapping.Name)
+	}
+	return tested
+}
+
+// gatherSeries returns the series of the registry, sorted, with their type
+// and value.
+func gatherSeries(g prometheus.Gatherer) ([]testedSeries, error) {
+	mfs, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+	series := []testedSeries{}
+	for _, mf := range mfs {
+		for _, metric := range mf.GetMetric() {
+			series = append(series, testedSeries{
+				Series: seriesName(mf.GetName(), metric),
+				Value:  seriesValue(mf.GetType(), metric),
+			})
+		}
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Series < series[j].Series })
+	return series, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+func TestTestLineHandler(t *testing.T) {
+	m := &mapper.MetricMapper{}
+	config := `
+mappings:
+- match: api.*.latency
+  name: api_latency_seconds
+  labels:
+    endpoint: $1
+`
+	if err := m.InitFromYAMLString(config); err != nil {
+		t.Fatal(err)
+	}
+	h := &testLineHandler{
+		mapper: m,
+		configure: func(ex *exporter.Exporter) {
+			ex.StripPrefixes = []string{"prod."}
+		},
+	}
+
+	body := "prod.api.users.latency:100|ms|#region:eu\nother.counter:2|c\nbroken\n"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/test-line", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var result struct {
+		Data testLineResult `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := result.Data.Lines
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+	timer := lines[0].Events[0]
+	if timer.Name != "prod.api.users.latency" || timer.Type != mapper.MetricTypeTimer || timer.Value != 100 || timer.Labels["region"] != "eu" {
+		t.Errorf("Unexpected timer event %+v", timer)
+	}
+	if timer.Mapping == nil || timer.Mapping.Match != "api.*.latency" || timer.Mapping.Name != "api_latency_seconds" || timer.Mapping.Labels["endpoint"] != "users" {
+		t.Errorf("Unexpected mapping of the timer event %+v", timer.Mapping)
+	}
+	if lines[1].Events[0].Mapping != nil {
+		t.Errorf("Expected the counter to be unmapped, got %+v", lines[1].Events[0].Mapping)
+	}
+	if lines[2].Error == "" || len(lines[2].Events) != 0 {
+		t.Errorf("Expected the broken line to fail to parse, got %+v", lines[2])
+	}
+
+	expected := []testedSeries{
+		{`api_latency_seconds{endpoint="users",region="eu"}`, "summary count 1 sum 100"},
+		{`other_counter{}`, "counter 2"},
+	}
+	if !reflect.DeepEqual(result.Data.Series, expected) {
+		t.Errorf("Expected series %v, got %v", expected, result.Data.Series)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/test-line", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rejected, got status %d", rec.Code)
+	}
+}
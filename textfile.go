@@ -0,0 +1,63 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+// textfileSkipPrefixes are the metrics node_exporter exports itself. Writing
+// them to a textfile would make its scrapes fail.
+var textfileSkipPrefixes = []string{"go_", "process_", "promhttp_"}
+
+// writeTextfile writes the metrics gathered from g to path in the Prometheus
+// text format. The file is replaced atomically, so that node_exporter's
+// textfile collector never reads a partially written file.
+func writeTextfile(g prometheus.Gatherer, path string) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, func(w io.Writer) error {
+		enc := expfmt.NewEncoder(w, expfmt.FmtText)
+	families:
+		for _, mf := range mfs {
+			for _, prefix := range textfileSkipPrefixes {
+				if strings.HasPrefix(mf.GetName(), prefix) {
+					continue families
+				}
+			}
+			if err := enc.Encode(mf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeTextfiles periodically writes the metrics gathered from g to path. It
+// never returns.
+func writeTextfiles(g prometheus.Gatherer, path string, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := writeTextfile(g, path); err != nil {
+			log.Errorf("Error writing metrics to %s: %v", path, err)
+		}
+	}
+}
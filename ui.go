@@ -0,0 +1,225 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	// uiPath is the path the UI is served at.
+	uiPath = "/ui/"
+	// maxUIUnmappedNames limits the unmapped names shown by the UI.
+	maxUIUnmappedNames = 100
+)
+
+// mappingHits counts the events every mapping matched, by its match.
+type mappingHits struct {
+	mtx    sync.Mutex
+	counts map[string]uint64
+}
+
+func (h *mappingHits) RecordMapped(match string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.counts == nil {
+		h.counts = map[string]uint64{}
+	}
+	h.counts[match]++
+}
+
+type uiCount struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// top returns the counts of all mappings, most frequent first.
+func (h *mappingHits) top() []uiCount {
+	h.mtx.Lock()
+	counts := make([]uiCount, 0, len(h.counts))
+	for match, count := range h.counts {
+		counts = append(counts, uiCount{Name: match, Count: count})
+	}
+	h.mtx.Unlock()
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+type uiStats struct {
+	Unmapped    []uiCount          `json:"unmapped"`
+	Mappings    []uiCount          `json:"mappings"`
+	ScrapeCache map[string]float64 `json:"scrape_cache"`
+}
+
+// uiHandler serves a page showing the most frequent unmapped names, the
+// events every mapping matched, the scrape cache statistics, and a form to
+// test lines, at uiPath, and the data it shows as JSON at api/stats below
+// it.
+type uiHandler struct {
+	unmapped *unmappedTracker
+	hits     *mappingHits
+	gatherer prometheus.Gatherer
+}
+
+func (h *uiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case uiPath:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(uiPage))
+	case uiPath + "api/stats":
+		h.serveStats(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *uiHandler) serveStats(w http.ResponseWriter) {
+	stats := uiStats{
+		Unmapped:    []uiCount{},
+		Mappings:    h.hits.top(),
+		ScrapeCache: map[string]float64{},
+	}
+	if h.unmapped != nil {
+		for _, n := range h.unmapped.top() {
+			if len(stats.Unmapped) == maxUIUnmappedNames {
+				break
+			}
+			stats.Unmapped = append(stats.Unmapped, uiCount{Name: n.name, Count: n.count})
+		}
+	}
+	mfs, err := h.gatherer.Gather()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "statsd_exporter_scrape_cache_requests_total" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == "result" {
+					stats.ScrapeCache[pair.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Errorln("Error writing UI stats:", err)
+	}
+}
+
+// uiPage polls api/stats relative to its own location, and shows the rate
+// of every count between polls.
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>StatsD Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+td.num { text-align: right; }
+textarea { width: 40em; height: 6em; }
+pre { background: #f4f4f4; padding: 1em; }
+</style>
+</head>
+<body>
+<h1>StatsD Exporter</h1>
+
+<h2>Test lines</h2>
+<form id="test">
+<textarea id="lines" placeholder="api.users.latency:100|ms|#region:eu"></textarea><br>
+<button type="submit">Test</button>
+</form>
+<pre id="result"></pre>
+
+<h2>Mappings</h2>
+<table id="mappings"><tr><th>Match</th><th>Events</th><th>Events/s</th></tr></table>
+
+<h2>Unmapped names</h2>
+<table id="unmapped"><tr><th>Name</th><th>Events</th><th>Events/s</th></tr></table>
+
+<h2>Scrape cache</h2>
+<table id="cache"><tr><th>Result</th><th>Scrapes</th></tr></table>
+
+<script>
+var previous = {mappings: {}, unmapped: {}}, previousTime = 0;
+
+function cell(row, text, numeric) {
+  var td = row.insertCell();
+  td.textContent = text;
+  if (numeric) td.className = "num";
+}
+
+function fill(id, counts, seconds) {
+  var table = document.getElementById(id);
+  while (table.rows.length > 1) table.deleteRow(1);
+  var current = {};
+  counts.forEach(function(c) {
+    var row = table.insertRow();
+    cell(row, c.name);
+    cell(row, c.count, true);
+    var before = previous[id][c.name];
+    cell(row, seconds > 0 && before !== undefined ? ((c.count - before) / seconds).toFixed(2) : "", true);
+    current[c.name] = c.count;
+  });
+  previous[id] = current;
+}
+
+function refresh() {
+  fetch("api/stats").then(function(r) { return r.json(); }).then(function(stats) {
+    var now = Date.now(), seconds = previousTime ? (now - previousTime) / 1000 : 0;
+    previousTime = now;
+    fill("mappings", stats.mappings, seconds);
+    fill("unmapped", stats.unmapped, seconds);
+    var table = document.getElementById("cache");
+    while (table.rows.length > 1) table.deleteRow(1);
+    Object.keys(stats.scrape_cache).sort().forEach(function(result) {
+      var row = table.insertRow();
+      cell(row, result);
+      cell(row, stats.scrape_cache[result], true);
+    });
+  });
+}
+
+document.getElementById("test").addEventListener("submit", function(e) {
+  e.preventDefault();
+  fetch("/debug/test-line", {method: "POST", body: document.getElementById("lines").value})
+    .then(function(r) { return r.text(); })
+    .then(function(text) {
+      try { text = JSON.stringify(JSON.parse(text), null, 2); } catch (err) {}
+      document.getElementById("result").textContent = text;
+    });
+});
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
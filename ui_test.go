@@ -0,0 +1,73 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/prometheus/statsd_exporter/pkg/event"
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+)
+
+func TestUIStats(t *testing.T) {
+	m := &mapper.MetricMapper{}
+	if err := m.InitFromYAMLString("mappings:\n- match: ui.*.requests\n  name: ui_requests\n"); err != nil {
+		t.Fatal(err)
+	}
+	tracker := newUnmappedTracker(10)
+	hits := &mappingHits{}
+	ex := exporter.NewExporter(m, exporter.WithRegisterer(prometheus.NewRegistry()))
+	ex.UnmappedRecorder = tracker
+	ex.MappingRecorder = hits
+	ex.HandleEvents(event.Events{
+		event.NewCounterEvent("ui.users.requests", 1, nil),
+		event.NewCounterEvent("ui.orders.requests", 1, nil),
+		event.NewCounterEvent("ui.unknown", 1, nil),
+	})
+
+	reg := prometheus.NewRegistry()
+	cache := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "statsd_exporter_scrape_cache_requests_total", Help: "test"}, []string{"result"})
+	reg.MustRegister(cache)
+	cache.WithLabelValues("hit").Add(3)
+
+	h := &uiHandler{unmapped: tracker, hits: hits, gatherer: reg}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/api/stats", nil))
+	var stats uiStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := uiStats{
+		Unmapped:    []uiCount{{"ui.unknown", 1}},
+		Mappings:    []uiCount{{"ui.*.requests", 2}},
+		ScrapeCache: map[string]float64{"hit": 3},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected stats %+v, got %+v", expected, stats)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	if !strings.Contains(rec.Body.String(), "api/stats") {
+		t.Errorf("Expected the UI page, got %q", rec.Body)
+	}
+}
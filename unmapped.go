@@ -0,0 +1,94 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/statsd_exporter/pkg/exporter"
+)
+
+// unmappedRecorders passes unmapped metric names to several recorders.
+type unmappedRecorders []exporter.UnmappedRecorder
+
+func (r unmappedRecorders) RecordUnmapped(metricName string) {
+	for _, recorder := range r {
+		recorder.RecordUnmapped(metricName)
+	}
+}
+
+// unmappedTracker counts the events of the most frequent unmapped metric
+// names. Once it tracks max names, a new name replaces the least frequent
+// one and inherits its count, so that frequent names are kept while counts
+// of rare names may be overestimated.
+type unmappedTracker struct {
+	max int
+
+	mtx    sync.Mutex
+	counts map[string]uint64
+}
+
+func newUnmappedTracker(max int) *unmappedTracker {
+	return &unmappedTracker{max: max, counts: map[string]uint64{}}
+}
+
+func (t *unmappedTracker) RecordUnmapped(metricName string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if _, ok := t.counts[metricName]; !ok && len(t.counts) >= t.max {
+		var minName string
+		var minCount uint64
+		for name, count := range t.counts {
+			if minName == "" || count < minCount {
+				minName, minCount = name, count
+			}
+		}
+		delete(t.counts, minName)
+		t.counts[metricName] = minCount
+	}
+	t.counts[metricName]++
+}
+
+type unmappedName struct {
+	name  string
+	count uint64
+}
+
+// top returns the tracked names, most frequent first.
+func (t *unmappedTracker) top() []unmappedName {
+	t.mtx.Lock()
+	names := make([]unmappedName, 0, len(t.counts))
+	for name, count := range t.counts {
+		names = append(names, unmappedName{name: name, count: count})
+	}
+	t.mtx.Unlock()
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].count != names[j].count {
+			return names[i].count > names[j].count
+		}
+		return names[i].name < names[j].name
+	})
+	return names
+}
+
+// ServeHTTP lists the tracked names with their event counts, one per line.
+func (t *unmappedTracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, n := range t.top() {
+		fmt.Fprintf(w, "%d %s\n", n.count, n.name)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnmappedTracker(t *testing.T) {
+	tracker := newUnmappedTracker(2)
+	for _, name := range []string{"foo", "bar", "foo", "foo", "bar", "baz"} {
+		tracker.RecordUnmapped(name)
+	}
+
+	w := httptest.NewRecorder()
+	tracker.ServeHTTP(w, httptest.NewRequest("GET", "/debug/unmapped", nil))
+
+	// baz replaces bar, the least frequent name, and inherits its count.
+	want := "3 baz\n3 foo\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+}